@@ -0,0 +1,267 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+//attentionLayer is a multi-head attention layer over sequences, with one colomn per position. Queries are computed from the first input, keys and values from the second input if any (cross attention), else from the first one (self attention).
+//
+//q=wq*x, k=wk*src, v=wv*src are split in Heads blocks of rows, each head computes attention(q,k,v), heads are concatenated and out=wo*heads+bo
+type attentionLayer struct {
+	size   int
+	heads  int
+	causal bool
+	params []*Param
+	rec    recording
+}
+
+//newAttentionLayer returns an attention layer for inputs of shapes in
+func newAttentionLayer(cfg *LayerConfig, in []Shape) (*attentionLayer, Shape, error) {
+	if len(in) < 1 || len(in) > 2 {
+		return nil, Shape{}, fmt.Errorf("%s layer expects 1 or 2 inputs received %d", cfg.Type, len(in))
+	}
+	for i, s := range in {
+		if s.Height != 1 {
+			return nil, Shape{}, fmt.Errorf("inputs[%d]: attention layer expects a sequence of height 1, received %d", i, s.Height)
+		}
+	}
+	l := &attentionLayer{size: cfg.Size, heads: cfg.Heads, causal: cfg.Causal}
+	if l.heads == 0 {
+		l.heads = 1
+	}
+	if l.heads < 0 || l.size%l.heads != 0 {
+		return nil, Shape{}, fmt.Errorf("size %d is not divisible by %d heads", l.size, l.heads)
+	}
+	src := in[len(in)-1].Rows
+	l.params = attentionParams("", l.size, in[0].Rows, src)
+	return l, Shape{Rows: l.size, Height: 1, Width: in[0].Width}, nil
+}
+
+//attentionParams returns the params wq, wk, wv, wo, bo of an attention of the given size, for queries of inSize rows and keys of srcSize rows
+func attentionParams(prefix string, size, inSize, srcSize int) []*Param {
+	return []*Param{
+		{Name: prefix + "wq", Value: mat.NewM64(size, inSize, nil)},
+		{Name: prefix + "wk", Value: mat.NewM64(size, srcSize, nil)},
+		{Name: prefix + "wv", Value: mat.NewM64(size, srcSize, nil)},
+		{Name: prefix + "wo", Value: mat.NewM64(size, size, nil)},
+		{Name: prefix + "bo", Value: mat.NewM64(size, 1, nil), bias: true},
+	}
+}
+
+//attend records the multi-head attention of queries from x over src, params being wq, wk, wv, wo, bo
+func attend(t *autodiff.Tape, x, src *autodiff.Var, params []*autodiff.Var, heads int, causal bool) (*autodiff.Var, error) {
+	proj := make([]*autodiff.Var, 3)
+	for i, in := range []*autodiff.Var{x, src, src} {
+		var err error
+		if proj[i], err = t.MatMul(params[i], in); err != nil {
+			return nil, fmt.Errorf("%s projection failed: %s", []string{"query", "key", "value"}[i], err.Error())
+		}
+	}
+	size, _ := params[3].Value.Dims()
+	d := size / heads
+	outs := make([]*autodiff.Var, heads)
+	for h := range outs {
+		qkv := make([]*autodiff.Var, 3)
+		for i, p := range proj {
+			_, c := p.Value.Dims()
+			var err error
+			if qkv[i], err = t.Slice(p, h*d, (h+1)*d, 0, c); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if outs[h], err = t.Attention(qkv[0], qkv[1], qkv[2], causal); err != nil {
+			return nil, fmt.Errorf("head %d: %s", h, err.Error())
+		}
+	}
+	out, err := t.Concat(autodiff.Rows, outs...)
+	if err != nil {
+		return nil, err
+	}
+	if out, err = t.MatMul(params[3], out); err != nil {
+		return nil, err
+	}
+	return t.Add(out, params[4])
+}
+
+func (l *attentionLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) < 1 || len(inputs) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 inputs received %d", len(inputs))
+	}
+	return attend(t, inputs[0], inputs[len(inputs)-1], params, l.heads, l.causal)
+}
+
+//Forward to implement Layer
+func (l *attentionLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, l.params)
+}
+
+//Backward to implement Layer
+func (l *attentionLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *attentionLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *attentionLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypeAttention, Size: l.size, Heads: l.heads, Causal: l.causal}
+}
+
+//positionalLayer adds sinusoidal positional encodings to a sequence: for position p, row 2i gets sin(p/10000^(2i/d)) and row 2i+1 gets cos(p/10000^(2i/d)), d being the number of rows
+type positionalLayer struct {
+	size int
+	rec  recording
+}
+
+//encoding returns the positional encodings of c positions
+func (l *positionalLayer) encoding(c int) *mat.M64 {
+	res := mat.NewM64(l.size, c, nil)
+	for i := 0; i < l.size; i++ {
+		freq := math.Pow(10000, -float64(i-i%2)/float64(l.size))
+		for p := 0; p < c; p++ {
+			if i%2 == 0 {
+				res.Set(i, p, math.Sin(float64(p)*freq))
+			} else {
+				res.Set(i, p, math.Cos(float64(p)*freq))
+			}
+		}
+	}
+	return res
+}
+
+func (l *positionalLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	_, c := inputs[0].Value.Dims()
+	return t.Add(inputs[0], t.Const(l.encoding(c)))
+}
+
+//Forward to implement Layer
+func (l *positionalLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, nil)
+}
+
+//Backward to implement Layer
+func (l *positionalLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, nil)
+}
+
+//Params to implement Layer
+func (l *positionalLayer) Params() []*Param {
+	return nil
+}
+
+//Config to implement Layer
+func (l *positionalLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypePositional}
+}
+
+//transformerLayer is a transformer encoder block over sequences of d rows:
+//
+//h=layernorm(x+attention(x)), out=layernorm(h+w2*relu(w1*h+b1)+b2), w1 having Size rows
+type transformerLayer struct {
+	size   int
+	heads  int
+	causal bool
+	norms  [2]*normLayer
+	params []*Param
+	rec    recording
+}
+
+//newTransformerLayer returns a transformer encoder block for sequences of shape in
+func newTransformerLayer(cfg *LayerConfig, in Shape) (*transformerLayer, Shape, error) {
+	if in.Height != 1 {
+		return nil, Shape{}, fmt.Errorf("transformer layer expects a sequence of height 1, received %d", in.Height)
+	}
+	l := &transformerLayer{size: cfg.Size, heads: cfg.Heads, causal: cfg.Causal}
+	if l.heads == 0 {
+		l.heads = 1
+	}
+	if l.heads < 0 || in.Rows%l.heads != 0 {
+		return nil, Shape{}, fmt.Errorf("size %d is not divisible by %d heads", in.Rows, l.heads)
+	}
+	d := in.Rows
+	l.params = attentionParams("", d, d, d)
+	for i := range l.norms {
+		n, _, err := newNormLayer(&LayerConfig{Type: LayerTypeLayerNorm, Epsilon: cfg.Epsilon}, in)
+		if err != nil {
+			return nil, Shape{}, err
+		}
+		l.norms[i] = n
+	}
+	l.params = append(l.params,
+		&Param{Name: "norm1_gamma", Value: l.norms[0].gamma, bias: true}, &Param{Name: "norm1_beta", Value: l.norms[0].beta, bias: true},
+		&Param{Name: "w1", Value: mat.NewM64(l.size, d, nil)}, &Param{Name: "b1", Value: mat.NewM64(l.size, 1, nil), bias: true},
+		&Param{Name: "w2", Value: mat.NewM64(d, l.size, nil)}, &Param{Name: "b2", Value: mat.NewM64(d, 1, nil), bias: true},
+		&Param{Name: "norm2_gamma", Value: l.norms[1].gamma, bias: true}, &Param{Name: "norm2_beta", Value: l.norms[1].beta, bias: true},
+	)
+	return l, in, nil
+}
+
+func (l *transformerLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	a, err := attend(t, x, x, params[:5], l.heads, l.causal)
+	if err != nil {
+		return nil, fmt.Errorf("attention: %s", err.Error())
+	}
+	if a, err = t.Add(x, a); err != nil {
+		return nil, err
+	}
+	h, err := l.norms[0].record(t, []*autodiff.Var{a}, params[5:7])
+	if err != nil {
+		return nil, err
+	}
+	f, err := t.MatMul(params[7], h)
+	if err != nil {
+		return nil, fmt.Errorf("feed forward: %s", err.Error())
+	}
+	if f, err = t.Add(f, params[8]); err != nil {
+		return nil, err
+	}
+	if f, err = t.Map(f, activation.Relu()); err != nil {
+		return nil, err
+	}
+	if f, err = t.MatMul(params[9], f); err != nil {
+		return nil, fmt.Errorf("feed forward: %s", err.Error())
+	}
+	if f, err = t.Add(f, params[10]); err != nil {
+		return nil, err
+	}
+	if f, err = t.Add(h, f); err != nil {
+		return nil, err
+	}
+	return l.norms[1].record(t, []*autodiff.Var{f}, params[11:13])
+}
+
+//Forward to implement Layer
+func (l *transformerLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, l.params)
+}
+
+//Backward to implement Layer
+func (l *transformerLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *transformerLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *transformerLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypeTransformer, Size: l.size, Heads: l.heads, Causal: l.causal, Epsilon: l.norms[0].eps}
+}
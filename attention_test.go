@@ -0,0 +1,236 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//attentionModels returns models over sequences of 2 features
+func attentionModels() ([]*Model, error) {
+	seq := Shape{Rows: 2, Height: 1}
+	specs := [][]struct {
+		name   string
+		cfg    *LayerConfig
+		inputs []string
+	}{
+		{
+			{"pos", &LayerConfig{Type: LayerTypePositional}, []string{Input}},
+			{"att", &LayerConfig{Type: LayerTypeAttention, Size: 4, Heads: 2, Causal: true}, []string{"pos"}},
+			{"out", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{"att"}},
+		},
+		{
+			{"enc", &LayerConfig{Size: 3, FuncType: activation.FuncTypeTanh}, []string{Input}},
+			{"cross", &LayerConfig{Type: LayerTypeAttention, Size: 2}, []string{Input, "enc"}},
+		},
+		{
+			{"up", &LayerConfig{Size: 4, FuncType: activation.FuncTypeIden}, []string{Input}},
+			{"block", &LayerConfig{Type: LayerTypeTransformer, Size: 6, Heads: 2}, []string{"up"}},
+			{"out", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{"block"}},
+		},
+	}
+	models := make([]*Model, len(specs))
+	for i, spec := range specs {
+		m, err := NewModelWithShape(seq)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range spec {
+			if err = m.AddConfig(s.name, s.cfg, s.inputs...); err != nil {
+				return nil, fmt.Errorf("model %d: %s", i, err.Error())
+			}
+		}
+		models[i] = m
+	}
+	return models, nil
+}
+
+func TestAttentionGradients(t *testing.T) {
+	models, err := attentionModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for ind, m := range models {
+		randomizeParams(int64(ind), m.Params())
+		x := randM64(r, 2, 4)
+		if err = checkModelGradients(m, x, randM64(r, 2, 4), activation.Power(0.5, 2)); err != nil {
+			t.Errorf("test %d: %s", ind, err.Error())
+		}
+	}
+}
+
+func TestAttentionConfig(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		cfg    *LayerConfig
+		in     Shape
+		inputs []string
+		shape  Shape
+		err    error
+	}{
+		{&LayerConfig{Type: LayerTypeAttention}, Shape{4, 1, 0}, []string{Input}, Shape{}, fmt.Errorf("size must be >0")},
+		{&LayerConfig{Type: LayerTypeAttention, Size: 6, Heads: 4}, Shape{4, 1, 0}, []string{Input}, Shape{}, fmt.Errorf("size 6 is not divisible by 4 heads")},
+		{&LayerConfig{Type: LayerTypeAttention, Size: 6}, Shape{4, 2, 2}, []string{Input}, Shape{}, fmt.Errorf("inputs[0]: attention layer expects a sequence of height 1, received 2")},
+		{&LayerConfig{Type: LayerTypeAttention, Size: 6}, Shape{4, 1, 0}, []string{Input, Input, Input}, Shape{}, fmt.Errorf("attention layer expects 1 or 2 inputs received 3")},
+		{&LayerConfig{Type: LayerTypeTransformer, Size: 8, Heads: 3}, Shape{4, 1, 0}, []string{Input}, Shape{}, fmt.Errorf("size 4 is not divisible by 3 heads")},
+		{&LayerConfig{Type: LayerTypeAttention, Size: 6, Heads: 3}, Shape{4, 1, 5}, []string{Input}, Shape{6, 1, 5}, nil},
+		{&LayerConfig{Type: LayerTypeTransformer, Size: 8, Heads: 2}, Shape{4, 1, 0}, []string{Input}, Shape{4, 1, 0}, nil},
+		{&LayerConfig{Type: LayerTypePositional}, Shape{4, 1, 0}, []string{Input}, Shape{4, 1, 0}, nil},
+	}
+	for ind, test := range tests {
+		m, err := NewModelWithShape(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.AddConfig("att", test.cfg, test.inputs...)
+		if err != nil {
+			err = fmt.Errorf("%s", err.Error()[len("layer 'att': "):])
+		}
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "shape", test.shape, m.OutShape())
+		}
+	}
+}
+
+func TestPositionalEncoding(t *testing.T) {
+	m, err := NewModelWithShape(Shape{Rows: 4, Height: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.AddConfig("pos", &LayerConfig{Type: LayerTypePositional}, Input); err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.FeedForward(mat.NewM64(4, 3, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := 0; p < 3; p++ {
+		exp := []float64{math.Sin(float64(p)), math.Cos(float64(p)), math.Sin(float64(p) / 100), math.Cos(float64(p) / 100)}
+		for i, v := range exp {
+			if math.Abs(res.At(i, p)-v) > 1e-12 {
+				t.Errorf("position %d row %d: expected %f received %f", p, i, v, res.At(i, p))
+			}
+		}
+	}
+}
+
+func TestCausalAttention(t *testing.T) {
+	te := tester.NewT(t)
+	models, err := attentionModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := models[0]
+	randomizeParams(3, m.Params())
+	r := rand.New(rand.NewSource(2))
+	x := randM64(r, 2, 5)
+	exp, err := m.FeedForward(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = sliceCols(exp, 0, 3)
+	//changing the last positions does not change the outputs of the first ones
+	x.Set(0, 3, 10)
+	x.Set(1, 4, -10)
+	res, err := m.FeedForward(x)
+	te.CheckError(0, nil, err)
+	for i, v := range sliceCols(res, 0, 3).GetData() {
+		if math.Abs(v-exp.GetData()[i]) > 1e-12 {
+			t.Errorf("output %d: expected %f received %f", i, exp.GetData()[i], v)
+		}
+	}
+}
+
+func TestEncodeTransformer(t *testing.T) {
+	te := tester.NewT(t)
+	models, err := attentionModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(3))
+	x := randM64(r, 2, 4)
+	for ind, m := range models {
+		randomizeParams(int64(ind), m.Params())
+		exp, err := m.FeedForward(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		te.CheckError(ind, nil, m.Encode(buf))
+		d, err := DecodeModel(buf)
+		te.CheckError(ind, nil, err)
+		if err != nil {
+			continue
+		}
+		res, err := d.FeedForward(x)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "output", exp, res)
+	}
+}
+
+func TestTrainTransformer(t *testing.T) {
+	m, err := NewModelWithShape(Shape{Rows: 1, Height: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := []struct {
+		name   string
+		cfg    *LayerConfig
+		inputs []string
+	}{
+		{"up", &LayerConfig{Size: 4, FuncType: activation.FuncTypeIden}, []string{Input}},
+		{"pos", &LayerConfig{Type: LayerTypePositional}, []string{"up"}},
+		{"block", &LayerConfig{Type: LayerTypeTransformer, Size: 8, Heads: 2, Causal: true}, []string{"pos"}},
+		{"out", &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden}, []string{"block"}},
+	}
+	for _, l := range layers {
+		if err = m.AddConfig(l.name, l.cfg, l.inputs...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	randomizeParams(1, m.Params())
+	//running mean of the sequence
+	r := rand.New(rand.NewSource(4))
+	inputs := make([][][]float64, 120)
+	expected := make([][][]float64, len(inputs))
+	for i := range inputs {
+		n := 2 + r.Intn(5)
+		inputs[i], expected[i] = make([][]float64, n), make([][]float64, n)
+		sum := 0.0
+		for s := 0; s < n; s++ {
+			v := 2*r.Float64() - 1
+			sum += v
+			inputs[i][s] = []float64{v}
+			expected[i][s] = []float64{sum / float64(s+1)}
+		}
+	}
+	training, err := NewSequenceDataset(inputs[:100], expected[:100])
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := NewSequenceDataset(inputs[100:], expected[100:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.02), 10, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := tr.testWith(test)
+	if err = tr.Train(rand.NewSource(42), 0, 0.5, 4, training, nil, test); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := tr.testWith(test)
+	if after >= before {
+		t.Errorf("expected cost to decrease: before %f after %f", before, after)
+	}
+}
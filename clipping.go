@@ -0,0 +1,161 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//layerState is the last output, the params and the statistics of a layer, checked by the trainer for NaN and Inf values
+type layerState struct {
+	name    string
+	out     *mat.M64
+	params  []*Param
+	buffers []*Param
+}
+
+//all returns the params and the statistics of the layer
+func (s layerState) all() []*Param {
+	return append(append([]*Param{}, s.params...), s.buffers...)
+}
+
+//inspectable is implemented by networks whose layers can be checked for NaN and Inf values
+type inspectable interface {
+	layerStates() []layerState
+}
+
+//nonFiniteError reports a NaN or Inf value found while training
+type nonFiniteError struct {
+	msg string
+}
+
+func (e *nonFiniteError) Error() string {
+	return e.msg
+}
+
+//findNonFinite returns the position and the value of the first NaN or Inf value of m
+func findNonFinite(m *mat.M64) (int, int, float64, bool) {
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	_, c := m.Dims()
+	for i, v := range m.GetData() {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return i / c, i % c, v, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+//checkActivations returns an error for the first layer whose output has a NaN or Inf value
+func checkActivations(states []layerState) error {
+	for _, s := range states {
+		if i, j, v, ok := findNonFinite(s.out); ok {
+			return &nonFiniteError{fmt.Sprintf("layer '%s': output (%d,%d) is %v", s.name, i, j, v)}
+		}
+	}
+	return nil
+}
+
+//checkGradients returns an error for the first param whose accumulated gradient has a NaN or Inf value
+func checkGradients(states []layerState) error {
+	for _, s := range states {
+		for _, p := range s.params {
+			if i, j, v, ok := findNonFinite(p.Grad); ok {
+				return &nonFiniteError{fmt.Sprintf("layer '%s': gradient of '%s' (%d,%d) is %v", s.name, p.Name, i, j, v)}
+			}
+		}
+	}
+	return nil
+}
+
+//checkParams returns an error for the first param or statistic with a NaN or Inf value
+func checkParams(states []layerState) error {
+	for _, s := range states {
+		for _, p := range s.all() {
+			if i, j, v, ok := findNonFinite(p.Value); ok {
+				return &nonFiniteError{fmt.Sprintf("layer '%s': '%s' (%d,%d) is %v after the update", s.name, p.Name, i, j, v)}
+			}
+		}
+	}
+	return nil
+}
+
+//clipGradients clips each value of the gradients of params to [-value;value] if value>0, then rescales them so that their global norm is at most norm if norm>0
+func clipGradients(params []*Param, value, norm float64) {
+	if value > 0 {
+		for _, p := range params {
+			if p.Grad == nil {
+				continue
+			}
+			data := p.Grad.GetData()
+			for i, v := range data {
+				data[i] = math.Max(-value, math.Min(value, v))
+			}
+			p.Grad.SetData(data)
+		}
+	}
+	if norm <= 0 {
+		return
+	}
+	sum := gradNorm(params)
+	if sum <= norm {
+		return
+	}
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		data := p.Grad.GetData()
+		for i := range data {
+			data[i] *= norm / sum
+		}
+		p.Grad.SetData(data)
+	}
+}
+
+//gradNorm returns the global norm of the gradients of params
+func gradNorm(params []*Param) float64 {
+	sum := 0.0
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		for _, v := range p.Grad.GetData() {
+			sum += v * v
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+//snapshot copies the params and statistics of the layers
+func snapshot(states []layerState) [][]float64 {
+	var saved [][]float64
+	for _, s := range states {
+		for _, p := range s.all() {
+			saved = append(saved, p.Value.GetData())
+		}
+	}
+	return saved
+}
+
+//restore sets back the params and statistics of the layers saved by snapshot
+func restore(states []layerState, saved [][]float64) {
+	k := 0
+	for _, s := range states {
+		for _, p := range s.all() {
+			p.Value.SetData(saved[k])
+			k++
+		}
+	}
+}
+
+//statesParams returns the params of the layers
+func statesParams(states []layerState) []*Param {
+	var params []*Param
+	for _, s := range states {
+		params = append(params, s.params...)
+	}
+	return params
+}
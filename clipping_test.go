@@ -0,0 +1,161 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestClipGradients(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		value float64
+		norm  float64
+		exp   [][]float64
+	}{
+		{0, 0, [][]float64{{3, -4}, {12}}},
+		{5, 0, [][]float64{{3, -4}, {5}}},
+		{0, 26, [][]float64{{3, -4}, {12}}},
+		{0, 6.5, [][]float64{{1.5, -2}, {6}}},
+		{3, math.Sqrt(3), [][]float64{{1, -1}, {1}}},
+	}
+	for ind, test := range tests {
+		params := []*Param{{Name: "w", Grad: mat.NewM64(1, 2, []float64{3, -4})}, {Name: "b", Grad: mat.NewM64(1, 1, []float64{12})}, {Name: "unused"}}
+		clipGradients(params, test.value, test.norm)
+		for i, exp := range test.exp {
+			for j, v := range params[i].Grad.GetData() {
+				te.DeepEqual(ind, fmt.Sprintf("%s[%d]", params[i].Name, j), true, math.Abs(v-exp[j]) < 1e-12)
+			}
+		}
+	}
+	tr := &FCTrainer{}
+	te.CheckError(0, fmt.Errorf("clipping value must be >=0"), tr.SetClipping(-1, 0))
+	te.CheckError(1, fmt.Errorf("clipping norm must be >=0"), tr.SetClipping(0, -1))
+	te.CheckError(2, nil, tr.SetClipping(1, 2))
+	te.DeepEqual(2, "clipping", []float64{1, 2}, []float64{tr.clipValue, tr.clipNorm})
+}
+
+func TestClippedUpdate(t *testing.T) {
+	for ind, newNet := range []func() (Network, error){
+		func() (Network, error) {
+			return mockRandFC(1, 2, []*LayerConfig{{Size: 1, FuncType: activation.FuncTypeIden}})
+		},
+		func() (Network, error) {
+			return NewSequential(2, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+		},
+	} {
+		n, err := newNet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := n.(interface{ Params() []*Param }).Params()
+		if ind == 1 {
+			randomizeParams(1, params)
+		}
+		before := append(params[0].Value.GetData(), params[1].Value.GetData()...)
+		tr, err := NewTrainer(n, log.New(&nopWriter{}, "", 0), NewLr(0.5), 1, 0, activation.Power(0.5, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tr.SetClipping(0, 1); err != nil {
+			t.Fatal(err)
+		}
+		//a large error: the update has a norm of lr*1 at most
+		points := []*Datapoint{{Inp: mat.NewM64(2, 1, []float64{10, -10}), Exp: mat.NewM64(1, 1, []float64{1000})}}
+		if _, err = tr.withBackprop(rand.NewSource(1), &pointsDataset{points: points}, 0, 0.5, 1); err != nil {
+			t.Fatal(err)
+		}
+		after := append(params[0].Value.GetData(), params[1].Value.GetData()...)
+		norm := 0.0
+		for i := range after {
+			norm += (after[i] - before[i]) * (after[i] - before[i])
+		}
+		if math.Abs(math.Sqrt(norm)-0.5) > 1e-9 {
+			t.Errorf("test %d: expected an update of norm 0.5 received %f", ind, math.Sqrt(norm))
+		}
+	}
+}
+
+func TestNonFiniteDetection(t *testing.T) {
+	te := tester.NewT(t)
+	point := func(x0, x1, y float64) *Datapoint {
+		return &Datapoint{Inp: mat.NewM64(2, 1, []float64{x0, x1}), Exp: mat.NewM64(1, 1, []float64{y})}
+	}
+	tests := []struct {
+		points []*Datapoint
+		lr     float64
+		err    error
+	}{
+		{[]*Datapoint{point(1, 0, 1), point(math.NaN(), 0, 1)}, 0.1, fmt.Errorf("iteration 1: training point 1: layer 'hidden': output (0,0) is NaN")},
+		{[]*Datapoint{point(1, 0, 1), point(1, 0, math.Inf(1))}, 0.1, fmt.Errorf("iteration 1: training point 1: cost is +Inf")},
+		{[]*Datapoint{point(1, 0, 1), point(1e300, 0, 1)}, 0.1, fmt.Errorf("iteration 1: training point 1: cost is +Inf")},
+		{[]*Datapoint{point(1, -1, 1), point(1e200, 1e200, 1e150)}, 0.1, fmt.Errorf("iteration 1: training point 1: layer 'hidden': gradient of 'w' (0,0) is -Inf")},
+	}
+	for ind, test := range tests {
+		for _, skip := range []bool{false, true} {
+			m, err := NewModel(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = m.AddConfig("hidden", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, Input); err != nil {
+				t.Fatal(err)
+			}
+			if err = m.AddConfig("out", &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden}, "hidden"); err != nil {
+				t.Fatal(err)
+			}
+			for i, data := range [][]float64{{1, -1, 1, -1}, {0, 0}, {1, 1}, {0}} {
+				m.Params()[i].Value.SetData(data)
+			}
+			buf := &bytes.Buffer{}
+			tr, err := NewTrainer(m, log.New(buf, "", 0), NewLr(test.lr), 1, 0, activation.Power(0.5, 2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.SkipNonFinite(skip)
+			//the first point is trained, the second one fails. In the last case, the hidden weights of each neuron keep opposite values: the outputs are finite but the gradient overflows
+			before := snapshot(m.layerStates())
+			_, err = tr.withBackprop(rand.NewSource(1), &pointsDataset{points: test.points}, 0, 0.5, 1)
+			if !skip {
+				te.CheckError(ind, test.err, err)
+				continue
+			}
+			te.CheckError(ind, nil, err)
+			te.DeepEqual(ind, "logged", true, strings.Contains(buf.String(), test.err.Error()+", batch skipped"))
+			te.DeepEqual(ind, "params are finite", nil, checkParams(m.layerStates()))
+			te.DeepEqual(ind, "params are updated by the first point", false, fmt.Sprint(before) == fmt.Sprint(snapshot(m.layerStates())))
+		}
+	}
+}
+
+func TestNonFiniteWeights(t *testing.T) {
+	te := tester.NewT(t)
+	for _, skip := range []bool{false, true} {
+		m, err := NewSequential(1, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden, L2: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Params()[0].Value.Set(0, 0, 1e308)
+		tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(1), 1, 0, activation.Power(0.5, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.SkipNonFinite(skip)
+		//the gradient of the cost is 0 but the gradient of the penalty 2*w overflows
+		points := []*Datapoint{{Inp: mat.NewM64(1, 1, []float64{0}), Exp: mat.NewM64(1, 1, []float64{0})}}
+		_, err = tr.withBackprop(rand.NewSource(1), &pointsDataset{points: points}, 0, 0.5, 1)
+		if !skip {
+			te.CheckError(0, fmt.Errorf("iteration 1: training point 0: layer 'layer0': 'w' (0,0) is -Inf after the update"), err)
+			continue
+		}
+		te.CheckError(1, fmt.Errorf("iteration 1: every batch was skipped"), err)
+		te.DeepEqual(1, "restored", 1e308, m.Params()[0].Value.At(0, 0))
+	}
+}
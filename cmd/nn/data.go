@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn"
+)
+
+//loadDataset reads a CSV file ("-" for stdin) with inSize inputs per record, an IDX file of inputs, or a pair of IDX files "inputs,labels". classes>0 encodes IDX labels as one-hot vectors
+func loadDataset(path string, inSize, classes int, stdin io.Reader) (*nn.MemoryDataset, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no dataset")
+	}
+	if files := strings.Split(path, ","); len(files) == 2 {
+		inputs, err := os.Open(files[0])
+		if err != nil {
+			return nil, err
+		}
+		defer inputs.Close()
+		labels, err := os.Open(files[1])
+		if err != nil {
+			return nil, err
+		}
+		defer labels.Close()
+		d, err := nn.NewIDXDataset(inputs, labels, classes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+		return d, nil
+	}
+	if path == "-" {
+		return nn.ReadCSV(stdin, inSize)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var d *nn.MemoryDataset
+	switch {
+	case strings.HasSuffix(strings.ToLower(path), ".csv"):
+		d, err = nn.ReadCSV(br, inSize)
+	case isIDX(br):
+		d, err = readIDXInputs(br)
+	default:
+		return nil, fmt.Errorf("%s: unknown dataset format, expected a .csv file or an IDX file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return d, nil
+}
+
+//isIDX reports if r starts with the magic number of an IDX file: 2 zero bytes, a data type and a number of dimensions
+func isIDX(r *bufio.Reader) bool {
+	magic, err := r.Peek(4)
+	if err != nil || magic[0] != 0 || magic[1] != 0 || magic[3] == 0 {
+		return false
+	}
+	switch magic[2] {
+	case 0x08, 0x09, 0x0B, 0x0C, 0x0D, 0x0E:
+		return true
+	}
+	return false
+}
+
+//readIDXInputs reads an IDX file of inputs without labels, to be predicted
+func readIDXInputs(r io.Reader) (*nn.MemoryDataset, error) {
+	dims, values, err := nn.ReadIDX(r)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]*nn.Datapoint, dims[0])
+	if len(points) == 0 {
+		return nn.NewMemoryDataset(points), nil
+	}
+	size := len(values) / len(points)
+	for i := range points {
+		points[i] = &nn.Datapoint{Inp: mat.NewM64(size, 1, values[i*size:(i+1)*size])}
+	}
+	return nn.NewMemoryDataset(points), nil
+}
+
+//split returns a dataset of the first (1-ratio) of the points of d, then a dataset of the rest
+func split(d *nn.MemoryDataset, ratio float64) (*nn.MemoryDataset, *nn.MemoryDataset, error) {
+	if ratio <= 0 || ratio >= 1 {
+		return nil, nil, fmt.Errorf("split must be in range ]0;1[")
+	}
+	points := d.Points()
+	n := int(float64(len(points)) * (1 - ratio))
+	if n == 0 || n == len(points) {
+		return nil, nil, fmt.Errorf("dataset of %d points is too small to be split", len(points))
+	}
+	return nn.NewMemoryDataset(points[:n]), nn.NewMemoryDataset(points[n:]), nil
+}
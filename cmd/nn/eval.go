@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/klahssen/nn"
+)
+
+//loadModel reads a model written by the train command
+func loadModel(path string) (*nn.Model, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing -model")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := nn.DecodeModel(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return m, nil
+}
+
+func runEval(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	model := fs.String("model", "", "model written by train")
+	data := fs.String("data", "", "dataset: CSV file, - for stdin, or IDX files 'inputs,labels'")
+	classes := fs.Int("classes", 0, "number of classes, to encode IDX labels as one-hot vectors")
+	costName := fs.String("cost", "mse", "loss function: mse or mae")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cost, err := nn.LossFunc(*costName)
+	if err != nil {
+		return err
+	}
+	m, err := loadModel(*model)
+	if err != nil {
+		return err
+	}
+	d, err := loadDataset(*data, m.InSize(), *classes, stdin)
+	if err != nil {
+		return err
+	}
+	res, err := nn.Evaluate(m, d, cost)
+	if err != nil {
+		return err
+	}
+	return writeJSON("", stdout, res)
+}
+
+func runPredict(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("predict", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	model := fs.String("model", "", "model written by train")
+	data := fs.String("data", "-", "inputs: CSV file whose extra colomns are ignored, - for stdin, or IDX file")
+	format := fs.String("format", "csv", "output format: csv or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format '%s', expected csv or json", *format)
+	}
+	m, err := loadModel(*model)
+	if err != nil {
+		return err
+	}
+	d, err := loadDataset(*data, m.InSize(), 0, stdin)
+	if err != nil {
+		return err
+	}
+	preds := make([][]float64, 0, d.Size())
+	for i, p := range d.Points() {
+		res, err := m.FeedForward(p.Inp)
+		if err != nil {
+			return fmt.Errorf("datapoint[%d]: %s", i, err.Error())
+		}
+		preds = append(preds, res.GetData())
+	}
+	if *format == "json" {
+		return json.NewEncoder(stdout).Encode(preds)
+	}
+	w := csv.NewWriter(stdout)
+	for _, p := range preds {
+		rec := make([]string, len(p))
+		for i, v := range p {
+			rec[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		if err = w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func runInspect(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	model := fs.String("model", "", "model written by train")
+	asJSON := fs.Bool("json", false, "write the summary as JSON")
+	dot := fs.Bool("dot", false, "write the topology in the Graphviz DOT language")
+	neurons := fs.Bool("neurons", false, "with -dot, draw each neuron and weight of a dense model")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	m, err := loadModel(*model)
+	if err != nil {
+		return err
+	}
+	if *dot {
+		return m.WriteDOT(stdout, nn.DOTOptions{Neurons: *neurons})
+	}
+	s, err := m.Summary()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return s.WriteJSON(stdout)
+	}
+	return s.WriteText(stdout)
+}
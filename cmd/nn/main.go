@@ -0,0 +1,69 @@
+//Command nn trains, evaluates and runs neural networks.
+//
+//Usage:
+//
+//	nn train -spec spec.yaml -data train.csv [-test test.csv] [-validation validation.csv] [-out model.json] [-metrics metrics.json]
+//	nn eval -model model.json -data test.csv
+//	nn predict -model model.json [-data inputs.csv] [-format csv|json]
+//	nn inspect -model model.json [-json | -dot [-neurons]]
+//	nn plot -metrics metrics.json [-out curves.svg|curves.png] [-log]
+//	nn serve -model model.json [-addr :8080] [-watch 10s]
+//
+//Datasets are CSV files whose records hold the inputs followed by the expected outputs ("-" for the standard input), or pairs of IDX files "inputs.idx,labels.idx" like the MNIST database.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+//command is a subcommand of nn
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+var commands = []*command{
+	{"train", "train a network defined by a spec file and save the model", runTrain},
+	{"eval", "measure the performance of a model on a dataset", runEval},
+	{"predict", "write the predictions of a model", runPredict},
+	{"inspect", "print the layers, params and FLOPs of a model", runInspect},
+	{"plot", "draw the training curves of the metrics written by train", runPlot},
+	{"serve", "serve the predictions of a network over HTTP", runServe},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+//run executes the subcommand named by args[0]
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return fmt.Errorf("missing command")
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			if err := c.run(args[1:], stdin, stdout, stderr); err != nil {
+				return fmt.Errorf("%s: %s", c.name, err.Error())
+			}
+			return nil
+		}
+	}
+	usage(stderr)
+	return fmt.Errorf("unknown command '%s'", args[0])
+}
+
+//usage lists the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: nn <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "\nrun 'nn <command> -h' for the flags of a command\n")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klahssen/nn"
+	"github.com/klahssen/tester"
+)
+
+//writeFiles writes a spec and a CSV dataset of y=0.5*x0-x1 in dir
+func writeFiles(t *testing.T, dir string) (string, string) {
+	spec := `input: 2
+layers:
+  - size: 1
+    ftype: iden
+loss: mse
+optimizer:
+  lr: 0.1
+epochs: 30
+batch_size: 4
+seed: 1
+`
+	r := rand.New(rand.NewSource(1))
+	data := &bytes.Buffer{}
+	fmt.Fprintf(data, "x0,x1,y\n")
+	for i := 0; i < 100; i++ {
+		x0, x1 := 2*r.Float64()-1, 2*r.Float64()-1
+		fmt.Fprintf(data, "%f,%f,%f\n", x0, x1, 0.5*x0-x1)
+	}
+	specPath, dataPath := filepath.Join(dir, "spec.yaml"), filepath.Join(dir, "data.csv")
+	if err := ioutil.WriteFile(specPath, []byte(spec), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataPath, data.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return specPath, dataPath
+}
+
+func TestCommands(t *testing.T) {
+	te := tester.NewT(t)
+	dir := t.TempDir()
+	specPath, dataPath := writeFiles(t, dir)
+	model := filepath.Join(dir, "model.json")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := run([]string{"train", "-spec", specPath, "-data", dataPath, "-out", model}, nil, stdout, stderr); err != nil {
+		t.Fatal(err)
+	}
+	metrics := &trainMetrics{}
+	if err := json.Unmarshal(stdout.Bytes(), metrics); err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(0, "epochs", 30, len(metrics.History))
+	te.DeepEqual(0, "report", 30, len(metrics.Report))
+	trained := append([]byte{}, stdout.Bytes()...)
+	te.DeepEqual(0, "training points", 80, metrics.Train.Points)
+	te.DeepEqual(0, "test points", 20, metrics.Test.Points)
+	if metrics.Test.MSE > 1e-3 {
+		t.Errorf("expected a test mse <1e-3 received %f", metrics.Test.MSE)
+	}
+
+	stdout.Reset()
+	te.CheckError(1, nil, run([]string{"eval", "-model", model, "-data", dataPath}, nil, stdout, stderr))
+	res := &nn.Metrics{}
+	te.CheckError(1, nil, json.Unmarshal(stdout.Bytes(), res))
+	te.DeepEqual(1, "points", 100, res.Points)
+
+	stdout.Reset()
+	te.CheckError(2, nil, run([]string{"predict", "-model", model}, strings.NewReader("1,0\n0,1\n"), stdout, stderr))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	te.DeepEqual(2, "predictions", 2, len(lines))
+	preds := make([]float64, len(lines))
+	for i, l := range lines {
+		fmt.Sscanf(l, "%g", &preds[i])
+	}
+	te.DeepEqual(2, "close to y", true, preds[0] > 0.45 && preds[0] < 0.55 && preds[1] > -1.05 && preds[1] < -0.95)
+
+	stdout.Reset()
+	te.CheckError(3, nil, run([]string{"predict", "-model", model, "-format", "json"}, strings.NewReader("1,0\n"), stdout, stderr))
+	var out [][]float64
+	te.CheckError(3, nil, json.Unmarshal(stdout.Bytes(), &out))
+	te.DeepEqual(3, "predictions", 1, len(out))
+
+	stdout.Reset()
+	te.CheckError(4, nil, run([]string{"inspect", "-model", model}, nil, stdout, stderr))
+	te.DeepEqual(4, "topology", true, strings.Contains(stdout.String(), "layer0  dense(iden)  input   1x1x1  2        1       0       6"))
+
+	stdout.Reset()
+	te.CheckError(5, nil, run([]string{"inspect", "-model", model, "-json"}, nil, stdout, stderr))
+	s := &nn.Summary{}
+	te.CheckError(5, nil, json.Unmarshal(stdout.Bytes(), s))
+	te.DeepEqual(5, "params", 3, s.Trainable)
+
+	stdout.Reset()
+	te.CheckError(6, nil, run([]string{"inspect", "-model", model, "-dot", "-neurons"}, nil, stdout, stderr))
+	te.DeepEqual(6, "weights", 2, strings.Count(stdout.String(), "->"))
+
+	//the metrics of train are drawn by plot
+	curves := filepath.Join(dir, "curves.png")
+	te.CheckError(7, nil, run([]string{"plot", "-metrics", "-", "-out", curves}, bytes.NewReader(trained), stdout, stderr))
+	img, err := ioutil.ReadFile(curves)
+	te.CheckError(7, nil, err)
+	te.DeepEqual(7, "png", true, bytes.HasPrefix(img, []byte("\x89PNG")))
+	stdout.Reset()
+	te.CheckError(8, nil, run([]string{"plot", "-metrics", "-", "-out", "-"}, bytes.NewReader(trained), stdout, stderr))
+	te.DeepEqual(8, "svg", true, strings.HasPrefix(stdout.String(), "<svg"))
+}
+
+func TestCommandErrors(t *testing.T) {
+	te := tester.NewT(t)
+	dir := t.TempDir()
+	specPath, dataPath := writeFiles(t, dir)
+	noExt := strings.TrimSuffix(dataPath, ".csv")
+	if err := ioutil.WriteFile(noExt, []byte("1,2,3\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := ioutil.WriteFile(bad, []byte(`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "loss": "hinge"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args  []string
+		stdin string
+		err   error
+	}{
+		{nil, "", fmt.Errorf("missing command")},
+		{[]string{"fit"}, "", fmt.Errorf("unknown command 'fit'")},
+		{[]string{"train", "-data", dataPath}, "", fmt.Errorf("train: missing -spec")},
+		{[]string{"train", "-spec", bad, "-data", dataPath}, "", fmt.Errorf("train: %s: loss: unknown loss 'hinge', expected mse or mae", bad)},
+		{[]string{"train", "-spec", specPath, "-data", "-"}, "1,2,3\n1,x,3\n", fmt.Errorf("train: line 2: colomn 1: invalid value 'x'")},
+		{[]string{"train", "-spec", specPath, "-data", noExt}, "", fmt.Errorf("train: %s: unknown dataset format, expected a .csv file or an IDX file", noExt)},
+		{[]string{"eval", "-data", dataPath}, "", fmt.Errorf("eval: missing -model")},
+		{[]string{"predict", "-model", specPath, "-format", "xml"}, "", fmt.Errorf("predict: unknown format 'xml', expected csv or json")},
+		{[]string{"serve"}, "", fmt.Errorf("serve: missing -model")},
+		{[]string{"serve", "-model", specPath}, "", fmt.Errorf("serve: %s: invalid character 'i' looking for beginning of value", specPath)},
+		{[]string{"plot"}, "", fmt.Errorf("plot: missing -metrics")},
+		{[]string{"plot", "-metrics", "-", "-out", "-"}, `{"history": []}`, fmt.Errorf("plot: report is empty")},
+		{[]string{"plot", "-metrics", "-", "-out", "-", "-width", "10"}, `{"report": [{"epoch": 1}]}`, fmt.Errorf("plot: image is 10x480, minimum is 200x150")},
+	}
+	for ind, test := range tests {
+		err := run(test.args, strings.NewReader(test.stdin), ioutil.Discard, ioutil.Discard)
+		te.CheckError(ind, test.err, err)
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	te := tester.NewT(t)
+	//IDX file of 2 inputs of 2 unsigned bytes, without extension
+	path := filepath.Join(t.TempDir(), "inputs-idx2-ubyte")
+	if err := ioutil.WriteFile(path, []byte{0, 0, 0x08, 2, 0, 0, 0, 2, 0, 0, 0, 2, 1, 2, 3, 4}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	d, err := loadDataset(path, 2, 0, nil)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "inputs", [][]float64{{1, 2}, {3, 4}}, [][]float64{d.Points()[0].Inp.GetData(), d.Points()[1].Inp.GetData()})
+	d, err = loadDataset("-", 2, 0, strings.NewReader("1,2,3\n"))
+	te.CheckError(1, nil, err)
+	te.DeepEqual(1, "points", 1, len(d.Points()))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klahssen/nn/plot"
+)
+
+func runPlot(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("plot", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	metrics := fs.String("metrics", "", "metrics written by train, - for stdin")
+	out := fs.String("out", "curves.svg", "image file, PNG if its extension is .png else SVG, - for SVG on stdout")
+	width := fs.Int("width", plot.DefaultWidth, "width of the image in pixels")
+	height := fs.Int("height", plot.DefaultHeight, "height of the image in pixels")
+	logCost := fs.Bool("log", false, "logarithmic scale for the costs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var r io.Reader
+	switch *metrics {
+	case "":
+		return fmt.Errorf("missing -metrics")
+	case "-":
+		r = stdin
+	default:
+		f, err := os.Open(*metrics)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	res := &trainMetrics{}
+	if err := json.NewDecoder(r).Decode(res); err != nil {
+		return fmt.Errorf("%s: %s", *metrics, err.Error())
+	}
+	opts := plot.Options{Width: *width, Height: *height, LogCost: *logCost}
+	if *out == "-" {
+		return plot.WriteSVG(stdout, res.Report, opts)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(*out), ".png") {
+		err = plot.WritePNG(f, res.Report, opts)
+	} else {
+		err = plot.WriteSVG(f, res.Report, opts)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/klahssen/nn/server"
+)
+
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	model := fs.String("model", "", "network to serve: model or fully connected network written by train, or perceptron")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	maxBody := fs.Int64("max-body", server.DefaultMaxBodyBytes, "maximum size of a request body, in bytes")
+	maxBatch := fs.Int("max-batch", server.DefaultMaxBatch, "maximum number of inputs of a batch")
+	watch := fs.Duration("watch", 0, "reload the network when its file changes, checked at this interval (0 to disable). SIGHUP reloads it too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *model == "" {
+		return fmt.Errorf("missing -model")
+	}
+	logger := log.New(stderr, "", log.LstdFlags)
+	s, err := server.New(*model, server.Options{MaxBodyBytes: *maxBody, MaxBatch: *maxBatch, Logger: logger})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *watch > 0 {
+		go s.Watch(ctx, *watch)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	srv := &http.Server{Addr: *addr, Handler: s}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	logger.Printf("serving %s on %s", *model, *addr)
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := s.Reload(); err != nil {
+					logger.Printf("reload failed: %s", err.Error())
+				}
+				continue
+			}
+			//requests in progress are answered before stopping
+			shutdown, done := context.WithTimeout(context.Background(), 10*time.Second)
+			defer done()
+			return srv.Shutdown(shutdown)
+		}
+	}
+}
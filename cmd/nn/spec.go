@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/klahssen/nn"
+)
+
+//readSpec reads a JSON or YAML spec file, see nn.Spec
+func readSpec(path string) (*nn.Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := nn.ReadSpec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return s, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/klahssen/nn"
+)
+
+//trainMetrics are written by the train command
+type trainMetrics struct {
+	History []float64        `json:"history"` //average cost of each epoch on the training set
+	Report  []nn.EpochReport `json:"report"`  //costs, learning rate and gradient norm of each epoch, drawn by the plot command
+	Train   *nn.Metrics      `json:"train"`
+	Test    *nn.Metrics      `json:"test"`
+}
+
+func runTrain(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	specPath := fs.String("spec", "", "network and training spec, JSON or YAML")
+	data := fs.String("data", "", "training dataset: CSV file, - for stdin, or IDX files 'inputs,labels'")
+	testData := fs.String("test", "", "test dataset, else the last points of the training dataset are used")
+	validData := fs.String("validation", "", "validation dataset monitored by early stopping, else the last points of the training dataset are used. Without early_stopping in the spec, this dataset is trained on: do not pass a held-out dataset")
+	ratio := fs.Float64("split", 0.2, "ratio of the training dataset used as test or validation dataset when there is none")
+	classes := fs.Int("classes", 0, "number of classes, to encode IDX labels as one-hot vectors")
+	out := fs.String("out", "model.json", "file the trained model is written to")
+	metrics := fs.String("metrics", "", "file the metrics are written to, else stdout")
+	verbose := fs.Bool("v", false, "log the progress of the training")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *specPath == "" {
+		return fmt.Errorf("missing -spec")
+	}
+	s, err := readSpec(*specPath)
+	if err != nil {
+		return err
+	}
+	logs := ioutil.Discard
+	if *verbose {
+		logs = stderr
+	}
+	m, t, err := s.BuildModel(log.New(logs, "", log.LstdFlags))
+	if err != nil {
+		return err
+	}
+	training, err := loadDataset(*data, s.Input, *classes, stdin)
+	if err != nil {
+		return err
+	}
+	var test *nn.MemoryDataset
+	if *testData != "" {
+		test, err = loadDataset(*testData, s.Input, *classes, stdin)
+	} else {
+		training, test, err = split(training, *ratio)
+	}
+	if err != nil {
+		return err
+	}
+	var validation nn.Dataset
+	if *validData != "" {
+		validation, err = loadDataset(*validData, s.Input, *classes, stdin)
+	} else if s.EarlyStopping != nil {
+		training, validation, err = split(training, *ratio)
+	}
+	if err != nil {
+		return err
+	}
+	if err = s.Train(t, training, validation, test); err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err = m.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	cost, _ := nn.LossFunc(s.Loss)
+	res := &trainMetrics{History: t.History(), Report: t.Report()}
+	if res.Train, err = nn.Evaluate(m, training, cost); err != nil {
+		return fmt.Errorf("training dataset: %s", err.Error())
+	}
+	if res.Test, err = nn.Evaluate(m, test, cost); err != nil {
+		return fmt.Errorf("test dataset: %s", err.Error())
+	}
+	return writeJSON(*metrics, stdout, res)
+}
+
+//writeJSON writes v as indented JSON to the file at path, or to w if path is empty
+func writeJSON(path string, w io.Writer, v interface{}) error {
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,403 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+//padding modes of convolution and pooling layers
+const (
+	PaddingValid = "valid" //no padding, the kernel stays inside the input
+	PaddingSame  = "same"  //zero padding so that output size=ceil(input size/stride)
+)
+
+var negInf = math.Inf(-1)
+
+//geometry of a kernel sliding over 2D positions. 1D layers have a kernel height of 1
+type geometry struct {
+	kernel   [2]int
+	stride   [2]int
+	dilation [2]int
+	padding  string
+}
+
+//newGeometry reads kernel, stride and dilation of a layer with dims dimensions from its config. Stride defaults to dftStride and dilation to 1
+func newGeometry(cfg *LayerConfig, dims int, dftStride []int) (geometry, error) {
+	g := geometry{kernel: [2]int{1, 1}, stride: [2]int{1, 1}, dilation: [2]int{1, 1}, padding: cfg.Padding}
+	if g.padding == "" {
+		g.padding = PaddingValid
+	}
+	if g.padding != PaddingValid && g.padding != PaddingSame {
+		return g, fmt.Errorf("invalid padding '%s': expected one of [%s, %s]", cfg.Padding, PaddingSame, PaddingValid)
+	}
+	stride := cfg.Stride
+	if len(stride) == 0 {
+		stride = dftStride
+	}
+	dilation := cfg.Dilation
+	if len(dilation) == 0 {
+		dilation = []int{1, 1}[:dims]
+	}
+	fields := []struct {
+		name string
+		vals []int
+		dest *[2]int
+	}{
+		{"kernel", cfg.Kernel, &g.kernel},
+		{"stride", stride, &g.stride},
+		{"dilation", dilation, &g.dilation},
+	}
+	for _, f := range fields {
+		if len(f.vals) != dims {
+			return g, fmt.Errorf("%s must have %d value(s)", f.name, dims)
+		}
+		for _, v := range f.vals {
+			if v <= 0 {
+				return g, fmt.Errorf("%s values must be >0", f.name)
+			}
+		}
+		copy(f.dest[2-dims:], f.vals)
+	}
+	return g, nil
+}
+
+//values returns the kernel, stride and dilation of a layer with dims dimensions
+func (g geometry) values(dims int) ([]int, []int, []int) {
+	return append([]int{}, g.kernel[2-dims:]...), append([]int{}, g.stride[2-dims:]...), append([]int{}, g.dilation[2-dims:]...)
+}
+
+//window returns the number of positions of the kernel along a dimension of size n (0 if variable), and the padding before the first position
+func (g geometry) window(dim, n int) (int, int, error) {
+	if n == 0 {
+		return 0, 0, nil
+	}
+	span := g.dilation[dim]*(g.kernel[dim]-1) + 1
+	stride := g.stride[dim]
+	if g.padding == PaddingSame {
+		out := (n + stride - 1) / stride
+		pad := (out-1)*stride + span - n
+		if pad < 0 {
+			pad = 0
+		}
+		return out, pad / 2, nil
+	}
+	if n < span {
+		return 0, 0, fmt.Errorf("input size %d is smaller than the kernel span %d", n, span)
+	}
+	return (n-span)/stride + 1, 0, nil
+}
+
+//outShape returns the shape of the output positions for an input of h x w positions
+func (g geometry) outShape(h, w int) (int, int, error) {
+	oh, _, err := g.window(0, h)
+	if err != nil {
+		return 0, 0, err
+	}
+	ow, _, err := g.window(1, w)
+	return oh, ow, err
+}
+
+//patches returns the flat indices gathering the input values seen by the kernel at each output position, for an input of channels x (h*w) positions. If channelsInRows, the result has channels*kh*kw rows and outH*outW colomns (for convolutions), otherwise kh*kw rows and channels*outH*outW colomns (for pooling). Positions in the padding have index -1
+func (g geometry) patches(channels, h, w int, channelsInRows bool) (rows, cols, outH, outW int, idx []int, err error) {
+	outH, padH, err := g.window(0, h)
+	if err != nil {
+		return 0, 0, 0, 0, nil, err
+	}
+	outW, padW, err := g.window(1, w)
+	if err != nil {
+		return 0, 0, 0, 0, nil, err
+	}
+	k := g.kernel[0] * g.kernel[1]
+	npos := outH * outW
+	if channelsInRows {
+		rows, cols = channels*k, npos
+	} else {
+		rows, cols = k, channels*npos
+	}
+	idx = make([]int, rows*cols)
+	for c := 0; c < channels; c++ {
+		for ky := 0; ky < g.kernel[0]; ky++ {
+			for kx := 0; kx < g.kernel[1]; kx++ {
+				kk := ky*g.kernel[1] + kx
+				for oy := 0; oy < outH; oy++ {
+					iy := oy*g.stride[0] + ky*g.dilation[0] - padH
+					for ox := 0; ox < outW; ox++ {
+						ix := ox*g.stride[1] + kx*g.dilation[1] - padW
+						ind := -1
+						if iy >= 0 && iy < h && ix >= 0 && ix < w {
+							ind = c*h*w + iy*w + ix
+						}
+						o := oy*outW + ox
+						if channelsInRows {
+							idx[(c*k+kk)*cols+o] = ind
+						} else {
+							idx[kk*cols+c*npos+o] = ind
+						}
+					}
+				}
+			}
+		}
+	}
+	return rows, cols, outH, outW, idx, nil
+}
+
+//spatialDims returns the positions of an input of shape s with c colomns: the height is fixed, the width is deduced from c
+func spatialDims(s Shape, c int) (int, int, error) {
+	if c%s.Height != 0 {
+		return 0, 0, fmt.Errorf("input has %d colomns, expected a multiple of height %d", c, s.Height)
+	}
+	w := c / s.Height
+	if s.Width > 0 && w != s.Width {
+		return 0, 0, fmt.Errorf("input has %d colomns, expected %d", c, s.Cols())
+	}
+	return s.Height, w, nil
+}
+
+//convLayer is a 1D or 2D convolution: out=fn(w*patches(x)+b). The input has one row per channel and one colomn per position (row major for 2D). w has one row per filter
+type convLayer struct {
+	dims    int
+	in      Shape
+	filters int
+	g       geometry
+	ftype   string
+	fparams []float64
+	a       activation.F
+	w       *mat.M64
+	b       *mat.M64
+	params  []*Param
+	rec     recording
+}
+
+//newConvLayer returns a convolution layer for inputs of shape in
+func newConvLayer(cfg *LayerConfig, dims int, in Shape) (*convLayer, Shape, error) {
+	if dims == 1 && in.Height != 1 {
+		return nil, Shape{}, fmt.Errorf("1D layer expects an input of height 1, received %d", in.Height)
+	}
+	g, err := newGeometry(cfg, dims, []int{1, 1}[:dims])
+	if err != nil {
+		return nil, Shape{}, err
+	}
+	oh, ow, err := g.outShape(in.Height, in.Width)
+	if err != nil {
+		return nil, Shape{}, err
+	}
+	k := in.Rows * g.kernel[0] * g.kernel[1]
+	l := &convLayer{dims: dims, in: in, filters: cfg.Size, g: g, ftype: cfg.FuncType, fparams: cfg.FuncParams, a: cfg.F,
+		w: mat.NewM64(cfg.Size, k, nil), b: mat.NewM64(cfg.Size, 1, nil)}
+	l.params = []*Param{{Name: "w", Value: l.w}, {Name: "b", Value: l.b, bias: true}}
+	return l, Shape{Rows: cfg.Size, Height: oh, Width: ow}, nil
+}
+
+func (l *convLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	r, c := x.Value.Dims()
+	if r != l.in.Rows {
+		return nil, fmt.Errorf("input has %d channels, expected %d", r, l.in.Rows)
+	}
+	h, w, err := spatialDims(l.in, c)
+	if err != nil {
+		return nil, err
+	}
+	rows, cols, _, _, idx, err := l.g.patches(r, h, w, true)
+	if err != nil {
+		return nil, err
+	}
+	p, err := t.Gather(x, rows, cols, idx, 0)
+	if err != nil {
+		return nil, err
+	}
+	z, err := t.MatMul(params[0], p)
+	if err != nil {
+		return nil, fmt.Errorf("w*x failed: %s", err.Error())
+	}
+	z, err = t.Add(z, params[1])
+	if err != nil {
+		return nil, fmt.Errorf("w*x +b failed: %s", err.Error())
+	}
+	return t.Map(z, l.a)
+}
+
+//Forward to implement Layer
+func (l *convLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, l.params)
+}
+
+//Backward to implement Layer
+func (l *convLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *convLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *convLayer) Config() *LayerConfig {
+	kernel, stride, dilation := l.g.values(l.dims)
+	typ := LayerTypeConv1D
+	if l.dims == 2 {
+		typ = LayerTypeConv2D
+	}
+	return &LayerConfig{Type: typ, Size: l.filters, FuncType: l.ftype, FuncParams: l.fparams, Kernel: kernel, Stride: stride, Dilation: dilation, Padding: l.g.padding}
+}
+
+//poolLayer takes the maximum or the average of each channel over a sliding window (over all positions if global)
+type poolLayer struct {
+	typ    string
+	dims   int
+	global bool
+	max    bool
+	in     Shape
+	g      geometry
+	rec    recording
+}
+
+//newPoolLayer returns a pooling layer for inputs of shape in
+func newPoolLayer(cfg *LayerConfig, in Shape) (*poolLayer, Shape, error) {
+	l := &poolLayer{typ: cfg.Type, in: in}
+	switch cfg.Type {
+	case LayerTypeMaxPool1D, LayerTypeAvgPool1D:
+		l.dims = 1
+	case LayerTypeMaxPool2D, LayerTypeAvgPool2D:
+		l.dims = 2
+	default:
+		l.global = true
+	}
+	l.max = cfg.Type == LayerTypeMaxPool1D || cfg.Type == LayerTypeMaxPool2D || cfg.Type == LayerTypeGlobalMaxPool
+	if l.global {
+		return l, Shape{Rows: in.Rows, Height: 1, Width: 1}, nil
+	}
+	if l.dims == 1 && in.Height != 1 {
+		return nil, Shape{}, fmt.Errorf("1D layer expects an input of height 1, received %d", in.Height)
+	}
+	var err error
+	if l.g, err = newGeometry(cfg, l.dims, cfg.Kernel); err != nil {
+		return nil, Shape{}, err
+	}
+	oh, ow, err := l.g.outShape(in.Height, in.Width)
+	if err != nil {
+		return nil, Shape{}, err
+	}
+	return l, Shape{Rows: in.Rows, Height: oh, Width: ow}, nil
+}
+
+func (l *poolLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	r, c := x.Value.Dims()
+	if l.global {
+		if l.max {
+			xt, err := t.Transpose(x)
+			if err != nil {
+				return nil, err
+			}
+			m, err := t.Max(xt)
+			if err != nil {
+				return nil, err
+			}
+			return t.Transpose(m)
+		}
+		return t.MatMul(x, t.Const(filled(c, 1, 1/float64(c))))
+	}
+	h, w, err := spatialDims(l.in, c)
+	if err != nil {
+		return nil, err
+	}
+	rows, cols, oh, ow, idx, err := l.g.patches(r, h, w, false)
+	if err != nil {
+		return nil, err
+	}
+	var p *autodiff.Var
+	if l.max {
+		if p, err = t.Gather(x, rows, cols, idx, negInf); err != nil {
+			return nil, err
+		}
+		p, err = t.Max(p)
+	} else {
+		if p, err = t.Gather(x, rows, cols, idx, 0); err != nil {
+			return nil, err
+		}
+		p, err = t.MatMul(t.Const(filled(1, rows, 1/float64(rows))), p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.Reshape(p, r, oh*ow)
+}
+
+//Forward to implement Layer
+func (l *poolLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, nil)
+}
+
+//Backward to implement Layer
+func (l *poolLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, nil)
+}
+
+//Params to implement Layer
+func (l *poolLayer) Params() []*Param {
+	return nil
+}
+
+//Config to implement Layer
+func (l *poolLayer) Config() *LayerConfig {
+	cfg := &LayerConfig{Type: l.typ, Size: l.in.Rows}
+	if !l.global {
+		cfg.Kernel, cfg.Stride, cfg.Dilation = l.g.values(l.dims)
+		cfg.Padding = l.g.padding
+	}
+	return cfg
+}
+
+//flattenLayer reshapes its input into a column vector, row after row
+type flattenLayer struct {
+	size int
+	rec  recording
+}
+
+func (l *flattenLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	return t.Reshape(inputs[0], l.size, 1)
+}
+
+//Forward to implement Layer
+func (l *flattenLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, nil)
+}
+
+//Backward to implement Layer
+func (l *flattenLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, nil)
+}
+
+//Params to implement Layer
+func (l *flattenLayer) Params() []*Param {
+	return nil
+}
+
+//Config to implement Layer
+func (l *flattenLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypeFlatten, Size: l.size}
+}
+
+//filled returns a rxc matrix filled with val
+func filled(r, c int, val float64) *mat.M64 {
+	data := make([]float64, r*c)
+	for i := range data {
+		data[i] = val
+	}
+	return mat.NewM64(r, c, data)
+}
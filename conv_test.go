@@ -0,0 +1,298 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//pointsDataset serves a fixed list of datapoints
+type pointsDataset struct {
+	points []*Datapoint
+	ind    int
+}
+
+func (d *pointsDataset) Next() *Datapoint {
+	if d.ind >= len(d.points) {
+		return nil
+	}
+	d.ind++
+	return d.points[d.ind-1]
+}
+func (d *pointsDataset) Size() int { return len(d.points) }
+func (d *pointsDataset) Left() int { return len(d.points) - d.ind }
+func (d *pointsDataset) Reset()    { d.ind = 0 }
+
+//ones returns a rxc matrix of ones
+func ones(r, c int) []float64 {
+	return filled(r, c, 1).GetData()
+}
+
+func TestConvForward(t *testing.T) {
+	te := tester.NewT(t)
+	seq := mat.NewM64(1, 4, []float64{1, 2, 3, 4})
+	img := mat.NewM64(1, 9, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	iden := activation.FuncTypeIden
+	tests := []struct {
+		in    Shape
+		cfg   *LayerConfig
+		w     []float64
+		x     *mat.M64
+		shape Shape
+		res   *mat.M64
+		err   error
+	}{
+		{
+			in:    Shape{Rows: 1, Height: 1, Width: 4},
+			cfg:   &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{2}},
+			w:     ones(1, 2),
+			x:     seq,
+			shape: Shape{Rows: 1, Height: 1, Width: 3},
+			res:   mat.NewM64(1, 3, []float64{3, 5, 7}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 1, Width: 4},
+			cfg:   &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{2}, Stride: []int{2}},
+			w:     ones(1, 2),
+			x:     seq,
+			shape: Shape{Rows: 1, Height: 1, Width: 2},
+			res:   mat.NewM64(1, 2, []float64{3, 7}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 1, Width: 4},
+			cfg:   &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{2}, Dilation: []int{2}},
+			w:     ones(1, 2),
+			x:     seq,
+			shape: Shape{Rows: 1, Height: 1, Width: 2},
+			res:   mat.NewM64(1, 2, []float64{4, 6}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 1, Width: 4},
+			cfg:   &LayerConfig{Type: LayerTypeConv1D, Size: 2, FuncType: iden, Kernel: []int{3}, Padding: PaddingSame},
+			w:     []float64{1, 1, 1, 0, 1, 0},
+			x:     seq,
+			shape: Shape{Rows: 2, Height: 1, Width: 4},
+			res:   mat.NewM64(2, 4, []float64{3, 6, 9, 7, 1, 2, 3, 4}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 3, Width: 3},
+			cfg:   &LayerConfig{Type: LayerTypeConv2D, Size: 1, FuncType: iden, Kernel: []int{2, 2}},
+			w:     ones(1, 4),
+			x:     img,
+			shape: Shape{Rows: 1, Height: 2, Width: 2},
+			res:   mat.NewM64(1, 4, []float64{12, 16, 24, 28}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 3, Width: 3},
+			cfg:   &LayerConfig{Type: LayerTypeConv2D, Size: 1, FuncType: iden, Kernel: []int{3, 3}, Stride: []int{2, 2}, Padding: PaddingSame},
+			w:     ones(1, 9),
+			x:     img,
+			shape: Shape{Rows: 1, Height: 2, Width: 2},
+			res:   mat.NewM64(1, 4, []float64{12, 16, 24, 28}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 3, Width: 3},
+			cfg:   &LayerConfig{Type: LayerTypeMaxPool2D, Kernel: []int{2, 2}, Stride: []int{1, 1}},
+			x:     img,
+			shape: Shape{Rows: 1, Height: 2, Width: 2},
+			res:   mat.NewM64(1, 4, []float64{5, 6, 8, 9}),
+		},
+		{
+			in:    Shape{Rows: 1, Height: 1, Width: 4},
+			cfg:   &LayerConfig{Type: LayerTypeAvgPool1D, Kernel: []int{2}},
+			x:     seq,
+			shape: Shape{Rows: 1, Height: 1, Width: 2},
+			res:   mat.NewM64(1, 2, []float64{1.5, 3.5}),
+		},
+		{
+			in:    Shape{Rows: 2, Height: 1, Width: 2},
+			cfg:   &LayerConfig{Type: LayerTypeGlobalMaxPool},
+			x:     mat.NewM64(2, 2, []float64{1, -2, -3, -4}),
+			shape: Shape{Rows: 2, Height: 1, Width: 1},
+			res:   mat.NewM64(2, 1, []float64{1, -3}),
+		},
+		{
+			in:    Shape{Rows: 2, Height: 1, Width: 0},
+			cfg:   &LayerConfig{Type: LayerTypeGlobalAvgPool},
+			x:     mat.NewM64(2, 2, []float64{1, -2, -3, -4}),
+			shape: Shape{Rows: 2, Height: 1, Width: 1},
+			res:   mat.NewM64(2, 1, []float64{-0.5, -3.5}),
+		},
+		{
+			in:    Shape{Rows: 2, Height: 1, Width: 2},
+			cfg:   &LayerConfig{Type: LayerTypeFlatten},
+			x:     mat.NewM64(2, 2, []float64{1, 2, 3, 4}),
+			shape: Shape{Rows: 4, Height: 1, Width: 1},
+			res:   mat.NewM64(4, 1, []float64{1, 2, 3, 4}),
+		},
+		{
+			in:  Shape{Rows: 1, Height: 1, Width: 4},
+			cfg: &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{5}},
+			err: fmt.Errorf("input size 4 is smaller than the kernel span 5"),
+		},
+		{
+			in:  Shape{Rows: 1, Height: 1, Width: 4},
+			cfg: &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{2, 2}},
+			err: fmt.Errorf("kernel must have 1 value(s)"),
+		},
+		{
+			in:  Shape{Rows: 1, Height: 3, Width: 3},
+			cfg: &LayerConfig{Type: LayerTypeConv1D, Size: 1, FuncType: iden, Kernel: []int{2}},
+			err: fmt.Errorf("1D layer expects an input of height 1, received 3"),
+		},
+		{
+			in:  Shape{Rows: 1, Height: 1, Width: 4},
+			cfg: &LayerConfig{Type: LayerTypeMaxPool1D, Kernel: []int{2}, Padding: "full"},
+			err: fmt.Errorf("invalid padding 'full': expected one of [same, valid]"),
+		},
+		{
+			in:  Shape{Rows: 1, Height: 1, Width: 0},
+			cfg: &LayerConfig{Type: LayerTypeFlatten},
+			err: fmt.Errorf("can not flatten an input with a variable number of colomns"),
+		},
+	}
+	for ind, test := range tests {
+		l, shape, err := buildLayer(test.cfg, []Shape{test.in})
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "shape", test.shape, shape)
+		if test.w != nil {
+			l.Params()[0].Value.SetData(test.w)
+		}
+		res, err := l.Forward(test.x)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "res", test.res, res)
+	}
+}
+
+//convModels returns models using every convolution and pooling layer
+func convModels() ([]*Model, error) {
+	relu := activation.FuncTypeRelu
+	tanh := activation.FuncTypeTanh
+	defs := []struct {
+		in     Shape
+		layers []*LayerConfig
+	}{
+		{
+			in: Shape{Rows: 2, Height: 1, Width: 8},
+			layers: []*LayerConfig{
+				{Type: LayerTypeConv1D, Size: 3, FuncType: tanh, Kernel: []int{3}, Dilation: []int{2}},
+				{Type: LayerTypeMaxPool1D, Kernel: []int{2}},
+				{Type: LayerTypeFlatten},
+				{Size: 2, FuncType: activation.FuncTypeIden},
+			},
+		},
+		{
+			in: Shape{Rows: 1, Height: 5, Width: 4},
+			layers: []*LayerConfig{
+				{Type: LayerTypeConv2D, Size: 2, FuncType: relu, Kernel: []int{3, 2}, Stride: []int{2, 1}, Padding: PaddingSame},
+				{Type: LayerTypeAvgPool2D, Kernel: []int{2, 2}, Stride: []int{1, 1}, Padding: PaddingSame},
+				{Type: LayerTypeGlobalMaxPool},
+				{Size: 2, FuncType: activation.FuncTypeSigmoid},
+			},
+		},
+		{
+			in: Shape{Rows: 2, Height: 1, Width: 0},
+			layers: []*LayerConfig{
+				{Type: LayerTypeConv1D, Size: 3, FuncType: tanh, Kernel: []int{2}, Padding: PaddingSame},
+				{Type: LayerTypeAvgPool1D, Kernel: []int{2}, Stride: []int{1}},
+				{Type: LayerTypeGlobalAvgPool},
+				{Size: 2, FuncType: activation.FuncTypeIden},
+			},
+		},
+	}
+	models := make([]*Model, len(defs))
+	for i, d := range defs {
+		m, err := NewModelWithShape(d.in)
+		if err != nil {
+			return nil, err
+		}
+		prev := Input
+		for j, cfg := range d.layers {
+			name := fmt.Sprintf("l%d", j)
+			if err = m.AddConfig(name, cfg, prev); err != nil {
+				return nil, fmt.Errorf("model %d: %s", i, err.Error())
+			}
+			prev = name
+		}
+		models[i] = m
+	}
+	return models, nil
+}
+
+func TestConvGradients(t *testing.T) {
+	models, err := convModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(3))
+	for ind, m := range models {
+		randomizeParams(int64(ind), m.Params())
+		in := m.InShape()
+		cols := in.Cols()
+		if cols == 0 {
+			cols = 5
+		}
+		x := randM64(r, in.Rows, cols)
+		exp := mat.NewM64(m.OutSize(), 1, nil)
+		if err = checkModelGradients(m, x, exp, activation.Power(0.5, 2)); err != nil {
+			t.Errorf("test %d: %s", ind, err.Error())
+		}
+	}
+}
+
+//randM64 returns a rxc matrix of values in [-1;1[
+func randM64(r *rand.Rand, rows, cols int) *mat.M64 {
+	data := make([]float64, rows*cols)
+	for i := range data {
+		data[i] = 2*r.Float64() - 1
+	}
+	return mat.NewM64(rows, cols, data)
+}
+
+func TestTrainConvModel(t *testing.T) {
+	models, err := convModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := models[0]
+	randomizeParams(5, m.Params())
+	//detect where the largest value of channel 0 is
+	r := rand.New(rand.NewSource(4))
+	points := make([]*Datapoint, 100)
+	for i := range points {
+		x := randM64(r, 2, 8)
+		exp := mat.NewM64(2, 1, []float64{1, 0})
+		max := 0
+		for j := 1; j < 8; j++ {
+			if x.At(0, j) > x.At(0, max) {
+				max = j
+			}
+		}
+		if max >= 4 {
+			exp.SetData([]float64{0, 1})
+		}
+		points[i] = &Datapoint{Inp: x, Exp: exp}
+	}
+	training := &pointsDataset{points: points[:80]}
+	test := &pointsDataset{points: points[80:]}
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.05), 10, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := tr.testWith(test)
+	if err = tr.Train(rand.NewSource(42), 0, 0.5, 1, training, nil, test); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := tr.testWith(test)
+	if after >= before {
+		t.Errorf("expected cost to decrease: before %f after %f", before, after)
+	}
+}
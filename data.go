@@ -1,6 +1,7 @@
 package nn
 
 import (
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
@@ -53,7 +54,8 @@ func (s *RandomDataset) Next() *Datapoint {
 		arr[i] = float64(s.r.Int63n(2*s.max)-s.max) / float64(s.max)
 	}
 	s.ind++
-	return &Datapoint{Inp: mat.NewM64(s.inSize, 1, arr), Exp: mat.NewM64(1, 1, s.fn(arr))}
+	exp := s.fn(arr)
+	return &Datapoint{Inp: mat.NewM64(s.inSize, 1, arr), Exp: mat.NewM64(len(exp), 1, exp)}
 }
 
 //Size to implement Dataset interface
@@ -75,6 +77,132 @@ func (s *RandomDataset) Reset() {
 	s.ind = 0
 }
 
+//SequenceDataset serves sequences of variable length: the input of a datapoint has one colomn per timestep
+type SequenceDataset struct {
+	points []*Datapoint
+	ind    int
+}
+
+//NewSequenceDataset returns a dataset of sequences. inputs[i][t] holds the features of sequence i at timestep t. expected[i] holds the expected outputs of sequence i: a single step for many-to-one models, or one step per timestep when the sequence of hidden states is returned
+func NewSequenceDataset(inputs, expected [][][]float64) (*SequenceDataset, error) {
+	if len(inputs) != len(expected) {
+		return nil, fmt.Errorf("received %d input sequences and %d expected sequences", len(inputs), len(expected))
+	}
+	s := &SequenceDataset{points: make([]*Datapoint, len(inputs))}
+	inSize, outSize := -1, -1
+	var err error
+	for i := range inputs {
+		p := &Datapoint{}
+		if p.Inp, err = sequence(inputs[i], &inSize); err != nil {
+			return nil, fmt.Errorf("inputs[%d]: %s", i, err.Error())
+		}
+		if p.Exp, err = sequence(expected[i], &outSize); err != nil {
+			return nil, fmt.Errorf("expected[%d]: %s", i, err.Error())
+		}
+		s.points[i] = p
+	}
+	return s, nil
+}
+
+//sequence returns a matrix with one colomn per step. size is the number of features expected at each step, set from the first step if <0
+func sequence(steps [][]float64, size *int) (*mat.M64, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("sequence is empty")
+	}
+	if *size < 0 {
+		*size = len(steps[0])
+	}
+	if *size == 0 {
+		return nil, fmt.Errorf("steps have no features")
+	}
+	data := make([]float64, *size*len(steps))
+	for t, step := range steps {
+		if len(step) != *size {
+			return nil, fmt.Errorf("step %d has %d features, expected %d", t, len(step), *size)
+		}
+		for f, v := range step {
+			data[f*len(steps)+t] = v
+		}
+	}
+	return mat.NewM64(*size, len(steps), data), nil
+}
+
+//Next to implement Dataset interface
+func (s *SequenceDataset) Next() *Datapoint {
+	if s == nil {
+		panic("Dataset is nil")
+	}
+	if s.ind >= len(s.points) {
+		return nil
+	}
+	s.ind++
+	return s.points[s.ind-1]
+}
+
+//Size to implement Dataset interface
+func (s *SequenceDataset) Size() int {
+	if s == nil {
+		panic("Dataset is nil")
+	}
+	return len(s.points)
+}
+
+//Left to implement Dataset interface
+func (s *SequenceDataset) Left() int {
+	return len(s.points) - s.ind
+}
+
+//Reset to implement Dataset interface
+func (s *SequenceDataset) Reset() {
+	s.ind = 0
+}
+
+//MemoryDataset serves datapoints held in memory
+type MemoryDataset struct {
+	points []*Datapoint
+	ind    int
+}
+
+//NewMemoryDataset returns a dataset serving points in order
+func NewMemoryDataset(points []*Datapoint) *MemoryDataset {
+	return &MemoryDataset{points: points}
+}
+
+//Next to implement Dataset interface
+func (s *MemoryDataset) Next() *Datapoint {
+	if s == nil {
+		panic("Dataset is nil")
+	}
+	if s.ind >= len(s.points) {
+		return nil
+	}
+	s.ind++
+	return s.points[s.ind-1]
+}
+
+//Size to implement Dataset interface
+func (s *MemoryDataset) Size() int {
+	if s == nil {
+		panic("Dataset is nil")
+	}
+	return len(s.points)
+}
+
+//Left to implement Dataset interface
+func (s *MemoryDataset) Left() int {
+	return len(s.points) - s.ind
+}
+
+//Reset to implement Dataset interface
+func (s *MemoryDataset) Reset() {
+	s.ind = 0
+}
+
+//Points returns the datapoints of the dataset
+func (s *MemoryDataset) Points() []*Datapoint {
+	return s.points
+}
+
 func sum(x []float64) []float64 {
 	res := 0.0
 	for i := range x {
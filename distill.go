@@ -0,0 +1,118 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//Distillation trains the network, the student, to reproduce the predictions of a teacher, usually a larger network trained on the same data. The cost of each point is Weight*soft+(1-Weight)*hard, hard being the cost of the outputs against the expected outputs.
+//
+//With a temperature of 0, soft is the cost of the outputs against the outputs of the teacher, for regressions. Else the outputs of both networks are taken as the logits of classifiers: soft is T²*cross-entropy(softmax(teacher/T), softmax(student/T)), a higher temperature T smoothing the probabilities of the teacher. The test and validation costs are measured against the expected outputs only
+type Distillation struct {
+	Teacher     Predictor
+	Temperature float64 //0 for regressions, >0 for classifiers, usually between 1 and 20
+	Weight      float64 //weight of the cost against the teacher in [0;1], 1 to ignore the expected outputs
+}
+
+//validate checks the distillation settings
+func (d *Distillation) validate() error {
+	if d.Teacher == nil {
+		return fmt.Errorf("teacher is nil")
+	}
+	if d.Temperature < 0 {
+		return fmt.Errorf("temperature must be >=0")
+	}
+	if d.Weight < 0 || d.Weight > 1 {
+		return fmt.Errorf("weight must be in [0;1]")
+	}
+	return nil
+}
+
+//SetDistillation trains the network against the predictions of a teacher, see Distillation. nil disables distillation (default)
+func (t *FCTrainer) SetDistillation(d *Distillation) error {
+	if t == nil {
+		return fmt.Errorf("trainer is nil")
+	}
+	if d != nil {
+		if err := d.validate(); err != nil {
+			return err
+		}
+	}
+	t.distill = d
+	return nil
+}
+
+//distillCost blends the cost c and gradient gradCost of the predictions pred for p with the cost against the teacher, gradients being divided by n
+func (t *FCTrainer) distillCost(p *Datapoint, pred *mat.M64, c float64, gradCost *mat.M64, n float64) (float64, *mat.M64, error) {
+	target, err := t.distill.Teacher.FeedForward(p.Inp)
+	if err != nil {
+		return 0, nil, fmt.Errorf("teacher: %s", err.Error())
+	}
+	var soft float64
+	var gradSoft *mat.M64
+	if t.distill.Temperature == 0 {
+		soft, gradSoft, err = t.deviationCost(pred, target, n)
+	} else {
+		soft, gradSoft, err = softCost(pred, target, t.distill.Temperature, n)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if math.IsNaN(soft) || math.IsInf(soft, 0) {
+		return 0, nil, &nonFiniteError{fmt.Sprintf("distillation cost is %v", soft)}
+	}
+	w := t.distill.Weight
+	grad := gradSoft.GetData()
+	for i, v := range gradCost.GetData() {
+		grad[i] = w*grad[i] + (1-w)*v
+	}
+	gradSoft.SetData(grad)
+	return w*soft + (1-w)*c, gradSoft, nil
+}
+
+//softCost returns the average over the colomns of T²*cross-entropy(softmax(target/T), softmax(pred/T)) and its gradient wrt pred divided by n: T*(softmax(pred/T)-softmax(target/T))/n
+func softCost(pred, target *mat.M64, temperature, n float64) (float64, *mat.M64, error) {
+	r, c := pred.Dims()
+	if tr, tc := target.Dims(); tr != r || tc != c {
+		return 0, nil, fmt.Errorf("teacher output is %dx%d, expected %dx%d", tr, tc, r, c)
+	}
+	grad := mat.NewM64(r, c, nil)
+	cost := 0.0
+	ps, qs := make([]float64, r), make([]float64, r)
+	for j := 0; j < c; j++ {
+		for i := 0; i < r; i++ {
+			ps[i], qs[i] = pred.At(i, j)/temperature, target.At(i, j)/temperature
+		}
+		logP, q := logSoftmax(ps), softmax(qs)
+		for i := 0; i < r; i++ {
+			cost -= q[i] * logP[i]
+			grad.Set(i, j, temperature*(math.Exp(logP[i])-q[i])/n)
+		}
+	}
+	return temperature * temperature * cost / float64(c), grad, nil
+}
+
+//softmax returns exp(x_i)/sum_k(exp(x_k))
+func softmax(x []float64) []float64 {
+	res := logSoftmax(x)
+	for i, v := range res {
+		res[i] = math.Exp(v)
+	}
+	return res
+}
+
+//logSoftmax returns the logarithm of the softmax of x, shifted by its maximum to avoid overflows
+func logSoftmax(x []float64) []float64 {
+	max := x[argmax(x)]
+	s := 0.0
+	for _, v := range x {
+		s += math.Exp(v - max)
+	}
+	res := make([]float64, len(x))
+	for i, v := range x {
+		res[i] = v - max - math.Log(s)
+	}
+	return res
+}
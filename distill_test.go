@@ -0,0 +1,174 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestSoftCost(t *testing.T) {
+	te := tester.NewT(t)
+	r := rand.New(rand.NewSource(1))
+	pred, target := randM64(r, 3, 2), randM64(r, 3, 2)
+	temperature, eps := 2.0, 1e-6
+	c, grad, err := softCost(pred, target, temperature, 2)
+	te.CheckError(0, nil, err)
+	//gradient of the cost summed over the colomns, divided by n=2
+	for i := range pred.GetData() {
+		data := pred.GetData()
+		data[i] += eps
+		plus, _, _ := softCost(mat.NewM64(3, 2, data), target, temperature, 2)
+		data[i] -= 2 * eps
+		minus, _, _ := softCost(mat.NewM64(3, 2, data), target, temperature, 2)
+		if num := (plus - minus) / (2 * eps); math.Abs(num-grad.GetData()[i]) > 1e-6 {
+			t.Errorf("value %d: expected a gradient of %f received %f", i, num, grad.GetData()[i])
+		}
+	}
+	//matching logits: the cost is T² times the entropy of the teacher
+	c, _, err = softCost(target, target, temperature, 1)
+	te.CheckError(1, nil, err)
+	entropy := 0.0
+	for j := 0; j < 2; j++ {
+		for _, q := range softmax([]float64{target.At(0, j) / 2, target.At(1, j) / 2, target.At(2, j) / 2}) {
+			entropy -= q * math.Log(q)
+		}
+	}
+	if math.Abs(c-4*entropy/2) > 1e-12 {
+		t.Errorf("expected a cost of %f received %f", 4*entropy/2, c)
+	}
+	_, _, err = softCost(pred, mat.NewM64(2, 2, nil), temperature, 1)
+	te.CheckError(2, fmt.Errorf("teacher output is 2x2, expected 3x2"), err)
+}
+
+//distillFC trains a network 1->1 on y=0 with a teacher y=2x and returns its weight
+func distillFC(weight float64) (float64, error) {
+	teacher, _ := NewFC(1)
+	teacher.SetLayers(&LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	teacher.SetLayerData(0, []float64{2, 0})
+	student, _ := NewFC(1)
+	student.SetLayers(&LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	student.SetLayerData(0, []float64{0, 0})
+	points := make([]*Datapoint, 20)
+	for i := range points {
+		points[i] = &Datapoint{Inp: mat.NewM64(1, 1, []float64{float64(i)/10 - 1}), Exp: mat.NewM64(1, 1, []float64{0})}
+	}
+	tr, err := NewFCTrainer(student, log.New(&nopWriter{}, "", 0), NewLr(0.1), 200, 0, activation.Power(0.5, 2))
+	if err != nil {
+		return 0, err
+	}
+	if err = tr.SetDistillation(&Distillation{Teacher: teacher, Weight: weight}); err != nil {
+		return 0, err
+	}
+	data := &pointsDataset{points: points}
+	if err = tr.Train(rand.NewSource(1), 0, 0.5, 4, data, nil, data); err != nil {
+		return 0, err
+	}
+	return student.layers[0].w.At(0, 0), nil
+}
+
+func TestDistillationRegression(t *testing.T) {
+	//the squared error is minimized by the weighted average of the targets 2x and 0
+	for _, weight := range []float64{0, 0.5, 1} {
+		w, err := distillFC(weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(w-2*weight) > 1e-3 {
+			t.Errorf("weight %.1f: expected w=%f received %f", weight, 2*weight, w)
+		}
+	}
+}
+
+//agreement returns the ratio of points for which both networks have the same largest output
+func agreement(a, b Predictor, data Dataset) (float64, error) {
+	n, same := 0, 0
+	data.Reset()
+	for p := data.Next(); p != nil; p = data.Next() {
+		x, err := a.FeedForward(p.Inp)
+		if err != nil {
+			return 0, err
+		}
+		y, err := b.FeedForward(p.Inp)
+		if err != nil {
+			return 0, err
+		}
+		if argmax(x.GetData()) == argmax(y.GetData()) {
+			same++
+		}
+		n++
+	}
+	return float64(same) / float64(n), nil
+}
+
+func TestDistillationClassifier(t *testing.T) {
+	te := tester.NewT(t)
+	teacher, err := mockRandFC(1, 2, []*LayerConfig{{Size: 16, FuncType: activation.FuncTypeTanh}, {Size: 3, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	student, err := mockRandFC(2, 2, []*LayerConfig{{Size: 3, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//points labelled by the teacher, whose logits are learnt without the labels
+	r := rand.New(rand.NewSource(3))
+	points := make([]*Datapoint, 100)
+	for i := range points {
+		in := randM64(r, 2, 1)
+		out, err := teacher.FeedForward(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		label := mat.NewM64(3, 1, nil)
+		label.Set(argmax(out.GetData()), 0, 1)
+		points[i] = &Datapoint{Inp: in, Exp: label}
+	}
+	data := &pointsDataset{points: points}
+	before, err := agreement(teacher, student, data)
+	te.CheckError(0, nil, err)
+	tr, err := NewFCTrainer(student, log.New(&nopWriter{}, "", 0), NewLr(0.1), 50, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, nil, tr.SetDistillation(&Distillation{Teacher: teacher, Temperature: 2, Weight: 1}))
+	te.CheckError(0, nil, tr.Train(rand.NewSource(1), 0, 0.5, 10, data, nil, data))
+	after, err := agreement(teacher, student, data)
+	te.CheckError(1, nil, err)
+	t.Logf("agreement with the teacher: %.2f before, %.2f after", before, after)
+	if after < 0.9 || after <= before {
+		t.Errorf("expected an agreement >=0.9 and >%.2f received %.2f", before, after)
+	}
+}
+
+func TestSetDistillation(t *testing.T) {
+	te := tester.NewT(t)
+	teacher, _ := mockRandFC(1, 1, []*LayerConfig{{Size: 1, FuncType: activation.FuncTypeIden}})
+	tests := []struct {
+		d   *Distillation
+		err error
+	}{
+		{&Distillation{Teacher: teacher, Temperature: 2, Weight: 0.5}, nil},
+		{nil, nil},
+		{&Distillation{}, fmt.Errorf("teacher is nil")},
+		{&Distillation{Teacher: teacher, Temperature: -1}, fmt.Errorf("temperature must be >=0")},
+		{&Distillation{Teacher: teacher, Weight: 2}, fmt.Errorf("weight must be in [0;1]")},
+	}
+	tr, err := NewFCTrainer(teacher, log.New(&nopWriter{}, "", 0), NewLr(0.1), 1, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ind, test := range tests {
+		te.CheckError(ind, test.err, tr.SetDistillation(test.d))
+	}
+	//the teacher must have the outputs of the student
+	other, _ := mockRandFC(1, 1, []*LayerConfig{{Size: 2, FuncType: activation.FuncTypeIden}})
+	te.CheckError(5, nil, tr.SetDistillation(&Distillation{Teacher: other}))
+	data := &pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(1, 1, []float64{1}), Exp: mat.NewM64(1, 1, []float64{1})}}}
+	te.CheckError(5, fmt.Errorf("iteration 1: training point 0: failed to compute deviation: m,n rows not equal"), tr.Train(rand.NewSource(1), 0, 0.5, 1, data, nil, data))
+}
@@ -0,0 +1,155 @@
+package nn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//DefaultMaxNeurons is the default limit of neurons drawn by the neuron view of WriteDOT
+const DefaultMaxNeurons = 100
+
+//colors of the edges of the neuron view, by sign of the weight
+const (
+	dotPositive = "#2166ac"
+	dotNegative = "#b2182b"
+)
+
+//DOTOptions configure the Graphviz DOT export of a network
+type DOTOptions struct {
+	//Neurons draws each neuron and weight instead of each layer: edges are thicker for larger weights, blue for positive ones and red for negative ones. Only dense layers can be drawn
+	Neurons bool
+	//MaxNeurons is the maximum number of neurons of the neuron view, including the inputs, DefaultMaxNeurons if 0
+	MaxNeurons int
+}
+
+//neuronLayer is a dense layer drawn by the neuron view
+type neuronLayer struct {
+	name       string
+	activation string
+	input      string //name of the input layer, Input for the network's input
+	w          *mat.M64
+	b          *mat.M64
+}
+
+//WriteDOT writes the topology of the network in the Graphviz DOT language, see DOTOptions
+func (ff *FC) WriteDOT(w io.Writer, opts DOTOptions) error {
+	s, err := ff.Summary()
+	if err != nil {
+		return err
+	}
+	if !opts.Neurons {
+		return writeLayersDOT(w, s)
+	}
+	layers := make([]*neuronLayer, len(ff.layers))
+	for i, l := range ff.layers {
+		layers[i] = &neuronLayer{name: s.Layers[i].Name, activation: l.ftype, input: s.Layers[i].Inputs[0], w: l.w, b: l.b}
+	}
+	return writeNeuronsDOT(w, ff.inSize, layers, opts)
+}
+
+//WriteDOT writes the topology of the model in the Graphviz DOT language, see DOTOptions. The neuron view requires every layer to be dense
+func (m *Model) WriteDOT(w io.Writer, opts DOTOptions) error {
+	s, err := m.Summary()
+	if err != nil {
+		return err
+	}
+	if !opts.Neurons {
+		return writeLayersDOT(w, s)
+	}
+	if m.inShape.Cols() != 1 {
+		return fmt.Errorf("neuron view requires colomn vector inputs, model input is %s", m.inShape)
+	}
+	layers := make([]*neuronLayer, len(m.nodes))
+	for i, n := range m.nodes {
+		l, ok := n.layer.(*layer)
+		if !ok {
+			return fmt.Errorf("neuron view only supports dense layers, layer '%s' is %s", n.name, s.Layers[i].Type)
+		}
+		layers[i] = &neuronLayer{name: n.name, activation: l.ftype, input: s.Layers[i].Inputs[0], w: l.w, b: l.b}
+	}
+	return writeNeuronsDOT(w, m.inShape.Rows, layers, opts)
+}
+
+//dotQuote returns s as a quoted DOT string
+func dotQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+//writeLayersDOT draws a node per layer, labeled with its type, activation, output shape and number of params, and an edge per input
+func writeLayersDOT(w io.Writer, s *Summary) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph network {\n\trankdir=LR;\n\tnode [shape=box, style=rounded];\n")
+	fmt.Fprintf(bw, "\t%s [label=%s, shape=ellipse];\n", dotQuote(Input), dotQuote(fmt.Sprintf("%s\\n%s", Input, s.Input)))
+	for _, l := range s.Layers {
+		typ := l.Type
+		if l.Activation != "" {
+			typ += "(" + l.Activation + ")"
+		}
+		label := fmt.Sprintf("%s\\n%s\\n%s", l.Name, typ, l.Output)
+		if l.Trainable > 0 {
+			label += fmt.Sprintf("\\n%d params", l.Trainable)
+		}
+		fmt.Fprintf(bw, "\t%s [label=%s];\n", dotQuote(l.Name), dotQuote(label))
+		for _, in := range l.Inputs {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", dotQuote(in), dotQuote(l.Name))
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+//writeNeuronsDOT draws a cluster of neurons per layer and an edge per weight, whose width grows with its magnitude and whose color is its sign
+func writeNeuronsDOT(w io.Writer, inSize int, layers []*neuronLayer, opts DOTOptions) error {
+	max := opts.MaxNeurons
+	if max <= 0 {
+		max = DefaultMaxNeurons
+	}
+	neurons, largest := inSize, 0.0
+	for _, l := range layers {
+		r, _ := l.w.Dims()
+		neurons += r
+		for _, v := range l.w.GetData() {
+			largest = math.Max(largest, math.Abs(v))
+		}
+	}
+	if neurons > max {
+		return fmt.Errorf("neuron view is limited to %d neurons, network has %d", max, neurons)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph network {\n\trankdir=LR;\n\tsplines=line;\n\tnode [shape=circle, label=\"\", width=0.3];\n")
+	cluster := func(name, label string, size int, tooltip func(i int) string) {
+		fmt.Fprintf(bw, "\tsubgraph %s {\n\t\tlabel=%s;\n", dotQuote("cluster_"+name), dotQuote(label))
+		for i := 0; i < size; i++ {
+			fmt.Fprintf(bw, "\t\t%s [tooltip=%s];\n", dotQuote(fmt.Sprintf("%s_%d", name, i)), dotQuote(tooltip(i)))
+		}
+		fmt.Fprintf(bw, "\t}\n")
+	}
+	cluster(Input, Input, inSize, func(i int) string { return fmt.Sprintf("%s[%d]", Input, i) })
+	for _, l := range layers {
+		r, c := l.w.Dims()
+		cluster(l.name, fmt.Sprintf("%s (%s)", l.name, l.activation), r, func(i int) string {
+			return fmt.Sprintf("%s[%d] b=%g", l.name, i, l.b.At(i, 0))
+		})
+		for i := 0; i < r; i++ {
+			for j := 0; j < c; j++ {
+				v := l.w.At(i, j)
+				width := 0.5
+				if largest > 0 {
+					width += 4.5 * math.Abs(v) / largest
+				}
+				color := dotPositive
+				if v < 0 {
+					color = dotNegative
+				}
+				fmt.Fprintf(bw, "\t%s -> %s [penwidth=%.2f, color=%s, tooltip=%s];\n", dotQuote(fmt.Sprintf("%s_%d", l.input, j)), dotQuote(fmt.Sprintf("%s_%d", l.name, i)), width, dotQuote(color), dotQuote(fmt.Sprintf("%g", v)))
+			}
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
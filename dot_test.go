@@ -0,0 +1,82 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestFCWriteDOT(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := NewFC(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SetLayers(&LayerConfig{Size: 1, FuncType: activation.FuncTypeTanh}); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SetLayerData(0, []float64{2, -1, 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, f.WriteDOT(buf, DOTOptions{}))
+	exp := `digraph network {
+	rankdir=LR;
+	node [shape=box, style=rounded];
+	"input" [label="input\n2x1x1", shape=ellipse];
+	"layer0" [label="layer0\ndense(tanh)\n1x1x1\n3 params"];
+	"input" -> "layer0";
+}
+`
+	te.DeepEqual(0, "layers", exp, buf.String())
+	buf.Reset()
+	te.CheckError(1, nil, f.WriteDOT(buf, DOTOptions{Neurons: true}))
+	exp = `digraph network {
+	rankdir=LR;
+	splines=line;
+	node [shape=circle, label="", width=0.3];
+	subgraph "cluster_input" {
+		label="input";
+		"input_0" [tooltip="input[0]"];
+		"input_1" [tooltip="input[1]"];
+	}
+	subgraph "cluster_layer0" {
+		label="layer0 (tanh)";
+		"layer0_0" [tooltip="layer0[0] b=0.5"];
+	}
+	"input_0" -> "layer0_0" [penwidth=5.00, color="#2166ac", tooltip="2"];
+	"input_1" -> "layer0_0" [penwidth=2.75, color="#b2182b", tooltip="-1"];
+}
+`
+	te.DeepEqual(1, "neurons", exp, buf.String())
+	te.CheckError(2, fmt.Errorf("neuron view is limited to 2 neurons, network has 3"), f.WriteDOT(buf, DOTOptions{Neurons: true, MaxNeurons: 2}))
+	empty, _ := NewFC(2)
+	te.CheckError(3, fmt.Errorf("network has no layers"), empty.WriteDOT(buf, DOTOptions{}))
+}
+
+func TestModelWriteDOT(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := residualModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, m.WriteDOT(buf, DOTOptions{}))
+	for _, edge := range []string{`"input" -> "h1";`, `"h1" -> "h2";`, `"h2" -> "skip";`, `"input" -> "skip";`, `"skip" -> "out";`} {
+		te.DeepEqual(0, edge, true, strings.Contains(buf.String(), edge))
+	}
+	te.CheckError(1, fmt.Errorf("neuron view only supports dense layers, layer 'skip' is add"), m.WriteDOT(buf, DOTOptions{Neurons: true}))
+	//dense models are drawn like fully connected networks
+	d, err := NewSequential(3, &LayerConfig{Size: 2, FuncType: activation.FuncTypeRelu}, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	te.CheckError(2, nil, d.WriteDOT(buf, DOTOptions{Neurons: true}))
+	te.DeepEqual(2, "edges", 3*2+2*1, strings.Count(buf.String(), "->"))
+	te.DeepEqual(2, "hidden to output", true, strings.Contains(buf.String(), `"layer0_1" -> "layer1_0"`))
+}
@@ -0,0 +1,23 @@
+package nn
+
+import (
+	"math/rand"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//dropper is implemented by networks with dropout: the trainer sets the random source their masks are drawn from
+type dropper interface {
+	setRand(r *rand.Rand)
+}
+
+//dropMask returns a rows x cols mask whose values are 0 with probability p and 1/(1-p) else. Dropout is inverted: outputs keep the same expected value, and are used unchanged in inference mode
+func dropMask(r *rand.Rand, p float64, rows, cols int) *mat.M64 {
+	data := make([]float64, rows*cols)
+	for i := range data {
+		if r.Float64() >= p {
+			data[i] = 1 / (1 - p)
+		}
+	}
+	return mat.NewM64(rows, cols, data)
+}
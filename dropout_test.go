@@ -0,0 +1,98 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestDropMask(t *testing.T) {
+	te := tester.NewT(t)
+	m := dropMask(rand.New(rand.NewSource(1)), 0.25, 100, 100)
+	dropped := 0
+	for _, v := range m.GetData() {
+		if v == 0 {
+			dropped++
+			continue
+		}
+		te.DeepEqual(0, "kept value", 1/0.75, v)
+	}
+	if math.Abs(float64(dropped)/1e4-0.25) > 0.02 {
+		t.Errorf("expected 25%% of dropped values received %d", dropped)
+	}
+}
+
+func TestDropoutFCMatchesModel(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 20, FuncType: activation.FuncTypeTanh, Dropout: 0.5},
+		{Size: 2, FuncType: activation.FuncTypeIden},
+	}
+	f, err := mockRandFC(3, 3, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewSequential(3, configs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range f.Params() {
+		m.Params()[i].Value.SetData(p.Value.GetData())
+	}
+	in := mat.NewM64(3, 1, []float64{0.1, -0.2, 0.3})
+	infer, err := f.FeedForward(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the same masks are drawn from the same source
+	f.SetTraining(true)
+	m.SetTraining(true)
+	f.setRand(rand.New(rand.NewSource(5)))
+	m.setRand(rand.New(rand.NewSource(5)))
+	outF, err := f.FeedForward(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outM, err := m.FeedForward(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(0, "outputs", outF.GetData(), outM.GetData())
+	te.DeepEqual(0, "dropout changes the output", false, fmt.Sprint(infer.GetData()) == fmt.Sprint(outF.GetData()))
+	//gradients use the masks of the forward pass
+	gradCost := mat.NewM64(2, 1, []float64{0.5, -1})
+	f.ZeroGrad()
+	m.ZeroGrad()
+	te.CheckError(0, nil, f.Accumulate(in, gradCost))
+	te.CheckError(0, nil, m.Accumulate(in, gradCost))
+	for i, p := range f.Params() {
+		exp, val := p.Grad.GetData(), m.Params()[i].Grad.GetData()
+		for j := range exp {
+			if math.Abs(exp[j]-val[j]) > 1e-12 {
+				t.Errorf("param '%s' (%d): expected gradient %f received %f", p.Name, j, exp[j], val[j])
+			}
+		}
+	}
+	//inference mode is not affected
+	f.SetTraining(false)
+	m.SetTraining(false)
+	for ind, n := range []Network{f, m} {
+		out, err := n.FeedForward(in)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "inference", infer.GetData(), out.GetData())
+	}
+	//dropout is saved with the model
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, m.Encode(buf))
+	d, err := DecodeModel(buf)
+	te.CheckError(0, nil, err)
+	if err == nil {
+		te.DeepEqual(0, "dropout", 0.5, d.nodes[0].dropout)
+	}
+}
@@ -0,0 +1,208 @@
+package nn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//embeddingLayer maps integer indices to learned vectors: the rows of a Vocab x Size table. Each index of a colomn of the input is replaced by its vector, so a colomn of n indices gives a colomn of n*Size values.
+//
+//Only the rows of the looked up indices receive a gradient and are updated. With MaxNorm>0, the looked up vectors are rescaled to a norm of MaxNorm at most before being used
+type embeddingLayer struct {
+	vocab   int
+	size    int
+	maxNorm float64
+	w       *mat.M64
+	params  []*Param
+	idx     [][]int //indices of the last forward pass, per row and colomn of the input
+}
+
+//newEmbeddingLayer returns an embedding layer for inputs of shape in
+func newEmbeddingLayer(cfg *LayerConfig, in Shape) (*embeddingLayer, Shape, error) {
+	if cfg.Vocab <= 0 {
+		return nil, Shape{}, fmt.Errorf("vocab must be >0")
+	}
+	l := &embeddingLayer{vocab: cfg.Vocab, size: cfg.Size, maxNorm: cfg.MaxNorm, w: mat.NewM64(cfg.Vocab, cfg.Size, nil)}
+	l.params = []*Param{{Name: "w", Value: l.w, Grad: mat.NewM64(cfg.Vocab, cfg.Size, nil), rows: map[int]struct{}{}}}
+	return l, Shape{Rows: in.Rows * cfg.Size, Height: in.Height, Width: in.Width}, nil
+}
+
+//index converts a value of the input to a row of the table
+func (l *embeddingLayer) index(v float64) (int, error) {
+	if v != math.Trunc(v) || v < 0 || v >= float64(l.vocab) {
+		return 0, fmt.Errorf("invalid index %v, expected an integer in range [0;%d[", v, l.vocab)
+	}
+	return int(v), nil
+}
+
+//Forward to implement Layer
+func (l *embeddingLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	if x == nil {
+		return nil, fmt.Errorf("input is nil")
+	}
+	r, c := x.Dims()
+	idx := make([][]int, r)
+	out := mat.NewM64(r*l.size, c, nil)
+	for i := 0; i < r; i++ {
+		idx[i] = make([]int, c)
+		for j := 0; j < c; j++ {
+			k, err := l.index(x.At(i, j))
+			if err != nil {
+				return nil, fmt.Errorf("input (%d,%d): %s", i, j, err.Error())
+			}
+			if l.maxNorm > 0 {
+				renormRow(l.w, k, l.maxNorm)
+			}
+			idx[i][j] = k
+			for d := 0; d < l.size; d++ {
+				out.Set(i*l.size+d, j, l.w.At(k, d))
+			}
+		}
+	}
+	l.idx = idx
+	return out, nil
+}
+
+//Backward to implement Layer. Indices are not differentiable: the gradient wrt the input is 0
+func (l *embeddingLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	if l.idx == nil {
+		return nil, fmt.Errorf("no forward pass to backpropagate")
+	}
+	if gradOut == nil {
+		return nil, fmt.Errorf("output gradient is nil")
+	}
+	r, c := len(l.idx), len(l.idx[0])
+	if gr, gc := gradOut.Dims(); gr != r*l.size || gc != c {
+		return nil, fmt.Errorf("output gradient has shape %dx%d, expected %dx%d", gr, gc, r*l.size, c)
+	}
+	p := l.params[0]
+	row := make([]float64, l.size)
+	for i := range l.idx {
+		for j, k := range l.idx[i] {
+			for d := range row {
+				row[d] = gradOut.At(i*l.size+d, j)
+			}
+			p.accumulateRow(k, row)
+		}
+	}
+	return []*mat.M64{mat.NewM64(r, c, nil)}, nil
+}
+
+//Params to implement Layer
+func (l *embeddingLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *embeddingLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypeEmbedding, Size: l.size, Vocab: l.vocab, MaxNorm: l.maxNorm}
+}
+
+//Vocabulary maps tokens to the indices fed to an embedding layer
+type Vocabulary map[string]int
+
+//ReadVectors reads pre-trained vectors in the text format of GloVe or word2vec: each line holds a token followed by the values of its vector, separated by spaces. The header line "<count> <size>" of word2vec files is skipped. Vectors are returned as the rows of a matrix, in the order of the file
+func ReadVectors(r io.Reader) (Vocabulary, *mat.M64, error) {
+	vocab := Vocabulary{}
+	var data []float64
+	size := 0
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if line == 1 && len(fields) == 2 {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				if _, err = strconv.Atoi(fields[1]); err == nil {
+					continue
+				}
+			}
+		}
+		if size == 0 {
+			size = len(fields) - 1
+			if size == 0 {
+				return nil, nil, fmt.Errorf("line %d: vector is empty", line)
+			}
+		}
+		if len(fields)-1 != size {
+			return nil, nil, fmt.Errorf("line %d: vector has %d values, expected %d", line, len(fields)-1, size)
+		}
+		if _, ok := vocab[fields[0]]; ok {
+			return nil, nil, fmt.Errorf("line %d: duplicate token '%s'", line, fields[0])
+		}
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid value '%s'", line, f)
+			}
+			data = append(data, v)
+		}
+		vocab[fields[0]] = len(vocab)
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(vocab) == 0 {
+		return nil, nil, fmt.Errorf("no vectors")
+	}
+	return vocab, mat.NewM64(len(vocab), size, data), nil
+}
+
+//SetEmbeddings copies pre-trained vectors into the table of the named embedding layer. vocab maps the tokens of the vectors, as returned by ReadVectors, to their rows. indices maps tokens to the indices of the layer: tokens missing from vocab keep their vectors. If indices is nil, the rows of vectors are copied to the same indices
+func (m *Model) SetEmbeddings(name string, vectors *mat.M64, vocab, indices Vocabulary) error {
+	l, err := m.Layer(name)
+	if err != nil {
+		return err
+	}
+	e, ok := l.(*embeddingLayer)
+	if !ok {
+		return fmt.Errorf("layer '%s' is not an embedding layer", name)
+	}
+	if vectors == nil {
+		return fmt.Errorf("vectors are nil")
+	}
+	r, c := vectors.Dims()
+	if c != e.size {
+		return fmt.Errorf("vectors have size %d, expected %d", c, e.size)
+	}
+	copyRow := func(from, to int) {
+		for j := 0; j < c; j++ {
+			e.w.Set(to, j, vectors.At(from, j))
+		}
+	}
+	if indices == nil {
+		if r > e.vocab {
+			return fmt.Errorf("received %d vectors for a vocab of %d", r, e.vocab)
+		}
+		for i := 0; i < r; i++ {
+			copyRow(i, i)
+		}
+		return nil
+	}
+	for token, to := range indices {
+		if to < 0 || to >= e.vocab {
+			return fmt.Errorf("token '%s' has index %d, expected an integer in range [0;%d[", token, to, e.vocab)
+		}
+		if from, ok := vocab[token]; ok && (from < 0 || from >= r) {
+			return fmt.Errorf("token '%s' has vector %d, expected an integer in range [0;%d[", token, from, r)
+		}
+	}
+	for token, to := range indices {
+		if from, ok := vocab[token]; ok {
+			copyRow(from, to)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//embeddingModel returns dense(embedding(x)) for inputs of inSize indices
+func embeddingModel(inSize int, cfg *LayerConfig) (*Model, error) {
+	return NewSequential(inSize, cfg, &LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh})
+}
+
+func TestEmbeddingForward(t *testing.T) {
+	te := tester.NewT(t)
+	table := []float64{0, 1, 2, 3, 4, 5, 6, 7}
+	tests := []struct {
+		cfg *LayerConfig
+		in  *mat.M64
+		exp *mat.M64
+		err error
+	}{
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4}, mat.NewM64(2, 1, []float64{3, 0}), mat.NewM64(4, 1, []float64{6, 7, 0, 1}), nil},
+		//a batch of 2 colomns
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4}, mat.NewM64(2, 2, []float64{1, 2, 2, 2}), mat.NewM64(4, 2, []float64{2, 4, 3, 5, 4, 4, 5, 5}), nil},
+		//vectors of norm 5 rescaled to 1
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4, MaxNorm: 1}, mat.NewM64(2, 1, []float64{0, 1}), mat.NewM64(4, 1, []float64{0, 1, 2 / math.Sqrt(13), 3 / math.Sqrt(13)}), nil},
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4}, mat.NewM64(2, 1, []float64{1.5, 0}), nil, fmt.Errorf("layer 'layer0': input (0,0): invalid index 1.5, expected an integer in range [0;4[")},
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4}, mat.NewM64(2, 1, []float64{0, 4}), nil, fmt.Errorf("layer 'layer0': input (1,0): invalid index 4, expected an integer in range [0;4[")},
+		{&LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 4}, mat.NewM64(2, 1, []float64{-1, 0}), nil, fmt.Errorf("layer 'layer0': input (0,0): invalid index -1, expected an integer in range [0;4[")},
+	}
+	for ind, test := range tests {
+		m, err := NewSequential(2, test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Params()[0].Value.SetData(table)
+		res, err := m.FeedForward(test.in)
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "output", test.exp, res)
+		}
+	}
+	for ind, cfg := range []*LayerConfig{{Type: LayerTypeEmbedding, Vocab: 4}, {Type: LayerTypeEmbedding, Size: 2}, {Type: LayerTypeEmbedding, Size: 2, Vocab: 4, MaxNorm: -1}} {
+		_, err := NewSequential(2, cfg)
+		te.CheckError(ind, []error{fmt.Errorf("configs[0]: layer 'layer0': size must be >0"), fmt.Errorf("configs[0]: layer 'layer0': vocab must be >0"), fmt.Errorf("configs[0]: layer 'layer0': max norm must be >=0")}[ind], err)
+	}
+}
+
+func TestEmbeddingGradients(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := embeddingModel(3, &LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	//index 4 is used twice, 1, 3 and 5 are not used
+	in := mat.NewM64(3, 2, []float64{4, 0, 2, 4, 4, 2})
+	if err = checkModelGradients(m, in, mat.NewM64(2, 2, []float64{0.5, -0.5, 0.1, 0.2}), activation.Power(0.5, 2)); err != nil {
+		t.Fatal(err)
+	}
+	w := m.Params()[0]
+	before := w.Value.GetData()
+	if err = m.step(0.1); err != nil {
+		t.Fatal(err)
+	}
+	after := w.Value.GetData()
+	for i := 0; i < 6; i++ {
+		used := i == 0 || i == 2 || i == 4
+		te.DeepEqual(i, "has gradient", used, w.Grad.At(i, 0) != 0 || w.Grad.At(i, 1) != 0)
+		te.DeepEqual(i, "updated", used, after[2*i] != before[2*i] || after[2*i+1] != before[2*i+1])
+	}
+	m.ZeroGrad()
+	te.DeepEqual(0, "zero gradient", mat.NewM64(6, 2, nil), w.Grad)
+}
+
+func TestReadVectors(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		text    string
+		vocab   Vocabulary
+		vectors *mat.M64
+		err     error
+	}{
+		{"the 0.1 0.2\ncat -1 2e-1\n", Vocabulary{"the": 0, "cat": 1}, mat.NewM64(2, 2, []float64{0.1, 0.2, -1, 0.2}), nil},
+		{"2 3\nthe 1 2 3\n\ncat 4 5 6\n", Vocabulary{"the": 0, "cat": 1}, mat.NewM64(2, 3, []float64{1, 2, 3, 4, 5, 6}), nil},
+		{"", nil, nil, fmt.Errorf("no vectors")},
+		{"the\n", nil, nil, fmt.Errorf("line 1: vector is empty")},
+		{"the 1 2\ncat 1\n", nil, nil, fmt.Errorf("line 2: vector has 1 values, expected 2")},
+		{"the 1 2\nthe 1 2\n", nil, nil, fmt.Errorf("line 2: duplicate token 'the'")},
+		{"the 1 x\n", nil, nil, fmt.Errorf("line 1: invalid value 'x'")},
+	}
+	for ind, test := range tests {
+		vocab, vectors, err := ReadVectors(strings.NewReader(test.text))
+		te.CheckError(ind, test.err, err)
+		te.DeepEqual(ind, "vocab", test.vocab, vocab)
+		te.DeepEqual(ind, "vectors", test.vectors, vectors)
+	}
+}
+
+func TestSetEmbeddings(t *testing.T) {
+	te := tester.NewT(t)
+	vocab, vectors, err := ReadVectors(strings.NewReader("the 1 2\ncat 3 4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		layer   string
+		vectors *mat.M64
+		indices Vocabulary
+		exp     []float64
+		err     error
+	}{
+		{"layer0", vectors, nil, []float64{1, 2, 3, 4, 0, 0}, nil},
+		{"layer0", vectors, Vocabulary{"cat": 0, "dog": 1, "the": 2}, []float64{3, 4, 0, 0, 1, 2}, nil},
+		{"layer0", vectors, Vocabulary{"cat": 3}, nil, fmt.Errorf("token 'cat' has index 3, expected an integer in range [0;3[")},
+		{"layer0", mat.NewM64(4, 2, nil), nil, nil, fmt.Errorf("received 4 vectors for a vocab of 3")},
+		{"layer0", mat.NewM64(2, 3, nil), nil, nil, fmt.Errorf("vectors have size 3, expected 2")},
+		{"layer0", nil, nil, nil, fmt.Errorf("vectors are nil")},
+		{"layer1", vectors, nil, nil, fmt.Errorf("layer 'layer1' is not an embedding layer")},
+	}
+	for ind, test := range tests {
+		m, err := embeddingModel(1, &LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.SetEmbeddings(test.layer, test.vectors, vocab, test.indices)
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "table", test.exp, m.Params()[0].Value.GetData())
+		}
+	}
+}
+
+func TestTrainEmbeddingModel(t *testing.T) {
+	m, err := embeddingModel(2, &LayerConfig{Type: LayerTypeEmbedding, Size: 3, Vocab: 20, MaxNorm: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	//pairs of ids: are they both even, both odd
+	r := rand.New(rand.NewSource(2))
+	points := make([]*Datapoint, 300)
+	for i := range points {
+		a, b := r.Intn(20), r.Intn(20)
+		exp := []float64{-0.5, -0.5}
+		if a%2 == 0 && b%2 == 0 {
+			exp[0] = 0.5
+		}
+		if a%2 == 1 && b%2 == 1 {
+			exp[1] = 0.5
+		}
+		points[i] = &Datapoint{Inp: mat.NewM64(2, 1, []float64{float64(a), float64(b)}), Exp: mat.NewM64(2, 1, exp)}
+	}
+	training := &pointsDataset{points: points[:250]}
+	test := &pointsDataset{points: points[250:]}
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.1), 20, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := tr.testWith(test)
+	if err = tr.Train(rand.NewSource(42), 0, 0.5, 4, training, nil, test); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := tr.testWith(test)
+	if after >= before {
+		t.Errorf("expected cost to decrease: before %f after %f", before, after)
+	}
+}
@@ -0,0 +1,211 @@
+package nn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//modelVersion is the version of the encoding of models
+const modelVersion = 1
+
+//buffered is implemented by layers holding non trainable values saved with the model, like the running statistics of batchnorm
+type buffered interface {
+	Buffers() []*Param
+}
+
+//matrixDef is the encoding of a matrix
+type matrixDef struct {
+	Rows int       `json:"rows"`
+	Cols int       `json:"cols"`
+	Data []float64 `json:"data"`
+}
+
+//layerDef is the encoding of a layer of a model
+type layerDef struct {
+	Name    string                `json:"name"`
+	Config  *LayerConfig          `json:"config"`
+	Inputs  []string              `json:"inputs"`
+	Params  map[string]*matrixDef `json:"params,omitempty"`
+	Buffers map[string]*matrixDef `json:"buffers,omitempty"`
+}
+
+//modelDef is the encoding of a model
+type modelDef struct {
+	Version int         `json:"version"`
+	Input   Shape       `json:"input"`
+	Layers  []*layerDef `json:"layers"`
+}
+
+func exportMatrices(params []*Param) map[string]*matrixDef {
+	if len(params) == 0 {
+		return nil
+	}
+	res := make(map[string]*matrixDef, len(params))
+	for _, p := range params {
+		r, c := p.Value.Dims()
+		res[p.Name] = &matrixDef{Rows: r, Cols: c, Data: p.Value.GetData()}
+	}
+	return res
+}
+
+//injectMatrices sets the values of params from their definitions
+func injectMatrices(params []*Param, defs map[string]*matrixDef) error {
+	if len(defs) != len(params) {
+		return fmt.Errorf("received %d values, expected %d", len(defs), len(params))
+	}
+	for _, p := range params {
+		d, ok := defs[p.Name]
+		if !ok || d == nil {
+			return fmt.Errorf("missing '%s'", p.Name)
+		}
+		r, c := p.Value.Dims()
+		if d.Rows != r || d.Cols != c || len(d.Data) != r*c {
+			return fmt.Errorf("'%s' has shape %dx%d with %d values, expected %dx%d", p.Name, d.Rows, d.Cols, len(d.Data), r, c)
+		}
+		p.Value.SetData(d.Data)
+	}
+	return nil
+}
+
+//Encode writes the definition of the model in JSON: its architecture, params and the statistics of its layers. Only layers built from a LayerConfig can be decoded, layers with custom activation functions can not be encoded
+func (m *Model) Encode(w io.Writer) error {
+	if err := m.isUsable(); err != nil {
+		return err
+	}
+	def := &modelDef{Version: modelVersion, Input: m.inShape, Layers: make([]*layerDef, len(m.nodes))}
+	for i, n := range m.nodes {
+		l := &layerDef{Name: n.name, Config: n.layer.Config(), Inputs: make([]string, len(n.inputs)), Params: exportMatrices(n.layer.Params())}
+		if l.Config.FuncType == activation.FuncTypeCustom {
+			return fmt.Errorf("layer '%s': custom activation functions can not be encoded", n.name)
+		}
+		n.reg.configure(l.Config)
+		l.Config.Dropout, l.Config.Frozen = n.dropout, n.frozen
+		for j, ind := range n.inputs {
+			l.Inputs[j] = Input
+			if ind >= 0 {
+				l.Inputs[j] = m.nodes[ind].name
+			}
+		}
+		if b, ok := n.layer.(buffered); ok {
+			l.Buffers = exportMatrices(b.Buffers())
+		}
+		def.Layers[i] = l
+	}
+	return json.NewEncoder(w).Encode(def)
+}
+
+//DecodeModel reads a model written by Encode
+func DecodeModel(r io.Reader) (*Model, error) {
+	def := &modelDef{}
+	if err := json.NewDecoder(r).Decode(def); err != nil {
+		return nil, err
+	}
+	if def.Version != modelVersion {
+		return nil, fmt.Errorf("unsupported model version %d", def.Version)
+	}
+	m, err := NewModelWithShape(def.Input)
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range def.Layers {
+		if l == nil {
+			return nil, fmt.Errorf("layers[%d] is nil", i)
+		}
+		if err = m.AddConfig(l.Name, l.Config, l.Inputs...); err != nil {
+			return nil, err
+		}
+		layer := m.nodes[len(m.nodes)-1].layer
+		if err = injectMatrices(layer.Params(), l.Params); err != nil {
+			return nil, fmt.Errorf("layer '%s': params: %s", l.Name, err.Error())
+		}
+		var buffers []*Param
+		if b, ok := layer.(buffered); ok {
+			buffers = b.Buffers()
+		}
+		if err = injectMatrices(buffers, l.Buffers); err != nil {
+			return nil, fmt.Errorf("layer '%s': buffers: %s", l.Name, err.Error())
+		}
+	}
+	if len(m.nodes) == 0 {
+		return nil, fmt.Errorf("model has no layers")
+	}
+	return m, nil
+}
+
+//fcVersion is the version of the encoding of fully connected networks
+const fcVersion = 1
+
+//FCType is the type written in the encoding of fully connected networks, to tell them from models
+const FCType = "fc"
+
+//fcDef is the encoding of a fully connected network
+type fcDef struct {
+	Version int           `json:"version"`
+	Type    string        `json:"type"`
+	Input   int           `json:"input"`
+	Layers  []*fcLayerDef `json:"layers"`
+}
+
+//fcLayerDef is the encoding of a layer of a fully connected network
+type fcLayerDef struct {
+	Config *LayerConfig          `json:"config"`
+	Params map[string]*matrixDef `json:"params"`
+}
+
+//Encode writes the definition of the network in JSON: the config of its layers, with their regularization and dropout, and their params. Layers with custom activation functions can not be encoded
+func (ff *FC) Encode(w io.Writer) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	def := &fcDef{Version: fcVersion, Type: FCType, Input: ff.inSize, Layers: make([]*fcLayerDef, len(ff.layers))}
+	for i, l := range ff.layers {
+		if l.ftype == activation.FuncTypeCustom {
+			return fmt.Errorf("layers[%d]: custom activation functions can not be encoded", i)
+		}
+		cfg := l.Config()
+		ff.reg(i).configure(cfg)
+		if i < len(ff.drops) {
+			cfg.Dropout = ff.drops[i]
+		}
+		cfg.Frozen = ff.isFrozen(i)
+		def.Layers[i] = &fcLayerDef{Config: cfg, Params: exportMatrices(l.params)}
+	}
+	return json.NewEncoder(w).Encode(def)
+}
+
+//DecodeFC reads a fully connected network written by Encode
+func DecodeFC(r io.Reader) (*FC, error) {
+	def := &fcDef{}
+	if err := json.NewDecoder(r).Decode(def); err != nil {
+		return nil, err
+	}
+	if def.Type != FCType {
+		return nil, fmt.Errorf("type is '%s', expected '%s'", def.Type, FCType)
+	}
+	if def.Version != fcVersion {
+		return nil, fmt.Errorf("unsupported network version %d", def.Version)
+	}
+	ff, err := NewFC(def.Input)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]*LayerConfig, len(def.Layers))
+	for i, l := range def.Layers {
+		if l == nil {
+			return nil, fmt.Errorf("layers[%d] is nil", i)
+		}
+		configs[i] = l.Config
+	}
+	if err = ff.SetLayers(configs...); err != nil {
+		return nil, err
+	}
+	for i, l := range def.Layers {
+		if err = injectMatrices(ff.layers[i].params, l.Params); err != nil {
+			return nil, fmt.Errorf("layers[%d]: params: %s", i, err.Error())
+		}
+	}
+	return ff, nil
+}
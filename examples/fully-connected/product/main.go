@@ -32,6 +32,12 @@ func main() {
 		fmt.Fprintf(os.Stderr, "failed to construct new trainer: %s\n", err.Error())
 		os.Exit(1)
 	}
+	//large targets produce large gradients with Power costs and Iden activations
+	if err = fct.SetClipping(0, 10); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set gradient clipping: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fct.SkipNonFinite(true)
 	training, validation, test := getDatasets()
 	r, err := fct.TrainWithBackprop(rand.NewSource(42), 10, 0.5, batchSize, training, validation, test)
 	if err != nil {
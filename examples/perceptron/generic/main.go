@@ -73,7 +73,7 @@ func GetRandomDataset(seed int64, inSize int, max int64, nsamples int, fn func(x
 }
 
 //Learn trains a new network that tries to learn target function
-func Learn(inSize int, batchSize int, learningRate float64, costFn activation.F, training, test nn.Dataset) (*nn.Perceptron, error) {
+func Learn(inSize int, batchSize int, learningRate float64, loss string, training, test nn.Dataset) (*nn.Perceptron, error) {
 
 	if inSize < 1 {
 		return nil, fmt.Errorf("input size must be >=1")
@@ -84,16 +84,14 @@ func Learn(inSize int, batchSize int, learningRate float64, costFn activation.F,
 	if test == nil || test.Left() == 0 {
 		return nil, fmt.Errorf("no test data")
 	}
-	if costFn.Func == nil {
-		return nil, fmt.Errorf("cost function is nil")
-	}
-	if costFn.Deriv == nil {
-		return nil, fmt.Errorf("cost derivative is nil")
+	costFn, err := nn.LossFunc(loss)
+	if err != nil {
+		return nil, err
 	}
 	fmt.Printf("create perceptron\n")
 	ftype := "iden"
 	fparams := []float64{}
-	p, err := nn.NewPerceptron(inSize, learningRate, ftype, fparams, activation.Iden(), costFn)
+	p, err := nn.NewPerceptronWithLoss(inSize, learningRate, ftype, fparams, activation.Iden(), loss)
 	if err != nil {
 		return nil, err
 	}
@@ -5,7 +5,6 @@ import (
 	"os"
 
 	"github.com/klahssen/nn/examples/perceptron/generic"
-	"github.com/klahssen/nn/internal/activation"
 )
 
 func target(x []float64) float64 {
@@ -19,12 +18,12 @@ func target(x []float64) float64 {
 }
 
 func main() {
-	costFn := activation.Power(1.0, 2)
+	loss := "mse"
 	inSize := 3
-	learningRate := 0.1
+	learningRate := 0.2
 	training := generic.GetRandomDataset(60, inSize, 1000, 1000, target)
 	test := generic.GetRandomDataset(40, inSize, 1000, 20, target)
-	p, err := generic.Learn(inSize, 2, learningRate, costFn, training, test)
+	p, err := generic.Learn(inSize, 2, learningRate, loss, training, test)
 	if err != nil {
 		fmt.Printf("failed to learn target function: %s\n", err.Error())
 	}
@@ -2,8 +2,12 @@ package nn
 
 import (
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
 
 	"github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/autodiff"
 )
 
 //FC represents a simple fully connected feed forward neural network
@@ -11,6 +15,16 @@ type FC struct {
 	inSize  int
 	outSize int
 	layers  []*layer
+	regs    []*regularizer //penalties and constraints of each layer, nil if none
+	outs    []*mat.M64     //outputs of the layers for the last input
+	drops   []float64      //dropout probability of each layer
+	//training mode, drawing dropout masks from rnd. The masks drawn for the input masked are reused to compute its gradients
+	training bool
+	rnd      *rand.Rand
+	masks    []*mat.M64
+	masked   *mat.M64
+	opt      Optimizer //nil for sgd
+	frozen   []bool    //layers whose params are not trained
 }
 
 //NewFC returns a new instance of Fully Connected FeedForward Neural Network, with no layers
@@ -37,18 +51,37 @@ func (ff *FC) init() {
 
 //SetLayers sets neuron layers connected via w,b,fn. Must have at least 1 layer
 func (ff *FC) SetLayers(configs ...*LayerConfig) error {
-	var err error
-	n := len(configs)
-	if n < 1 {
+	if len(configs) < 1 {
 		return fmt.Errorf("must have at least one layer")
 	}
+	layers, regs, drops, frozen, err := newLayers(ff.inSize, configs)
+	if err != nil {
+		return err
+	}
+	ff.layers = layers
+	ff.outSize = layers[len(layers)-1].outSize
+	ff.regs = regs
+	ff.drops = drops
+	ff.frozen = frozen
+
+	return nil
+}
 
-	prevSize := ff.inSize
+//newLayers builds the layers defined by configs, the first one being fed by inputs of size inSize, with their regularizers, dropout probabilities and frozen flags
+func newLayers(inSize int, configs []*LayerConfig) ([]*layer, []*regularizer, []float64, []bool, error) {
+	n := len(configs)
+	prevSize := inSize
 	layers := make([]*layer, n)
+	regs := make([]*regularizer, n)
+	drops := make([]float64, n)
+	frozen := make([]bool, n)
 
 	for i, l := range configs {
-		if err = l.Validate(); err != nil {
-			return fmt.Errorf("configs[%d]: %s", i, err.Error())
+		if err := l.Validate(); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("configs[%d]: %s", i, err.Error())
+		}
+		if l.Type != "" && l.Type != LayerTypeDense {
+			return nil, nil, nil, nil, fmt.Errorf("configs[%d]: layer type '%s' is not supported in a fully connected network", i, l.Type)
 		}
 		lay := newLayer(prevSize, l.Size, l.FuncType, l.FuncParams, l.F)
 		if l.KeepState {
@@ -56,11 +89,28 @@ func (ff *FC) SetLayers(configs ...*LayerConfig) error {
 			lay.keepState = true
 		}
 		layers[i] = lay
+		regs[i] = newRegularizer(l)
+		drops[i] = l.Dropout
+		frozen[i] = l.Frozen
 		prevSize = l.Size
 	}
-	ff.layers = layers
+	return layers, regs, drops, frozen, nil
+}
 
-	return nil
+//InSize returns the size of the input
+func (ff *FC) InSize() int {
+	if ff == nil {
+		return 0
+	}
+	return ff.inSize
+}
+
+//OutSize returns the size of the output, the size of the last layer
+func (ff *FC) OutSize() int {
+	if ff == nil {
+		return 0
+	}
+	return ff.outSize
 }
 
 //SetLayerData sets W and B matrices in layer at layerInd
@@ -98,92 +148,232 @@ func (ff *FC) validate() error {
 	return nil
 }
 
-//Info prints a summary of the network's definition
+//isUsable checks if the network can be trained
+func (ff *FC) isUsable() error {
+	if ff == nil {
+		return fmt.Errorf("neural network is nil")
+	}
+	for i, lay := range ff.layers {
+		if err := lay.IsUsable(); err != nil {
+			return fmt.Errorf("layer [%d]: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+//Info prints the summary of the network to stdout, see WriteInfo. It panics if the network is not usable
 func (ff *FC) Info() {
-	if err := ff.validate(); err != nil {
+	if err := ff.WriteInfo(os.Stdout); err != nil {
 		panic(err)
 	}
-	neurons := 0
-	fmt.Printf("\n======================= DEFINITION =======================\nInfo about this FeedForward Neural Net:\nlayer(s): %d\n\n", len(ff.layers))
-	//defs := make([]*LayerConfig, len(ff.layers))
-	for i, l := range ff.layers {
-		neurons += l.outSize
-		//defs[i] = l.Config()
-		fmt.Printf("- Layer %d:\nneuron(s): %d\nactivation type: '%s'\nactivation params: %v\n\n", i+1, l.outSize, l.ftype, l.fparams)
-	}
+}
 
-	fmt.Printf("Total: %d neuron(s)\n=========================================================\n\n\n", neurons)
+//WriteInfo writes the summary of the network as a table, see Summary
+func (ff *FC) WriteInfo(w io.Writer) error {
+	s, err := ff.Summary()
+	if err != nil {
+		return err
+	}
+	return s.WriteText(w)
 }
 
 //FeedForward feeds data forward from input, returns output layer's state
 func (ff *FC) FeedForward(input *mat.M64) (*mat.M64, error) {
-	in := input
-	var out *mat.M64
+	if ff == nil {
+		return nil, fmt.Errorf("network is nil")
+	}
+	out, _, _, err := ff.forward(autodiff.NewTape(), input, true)
+	if err != nil {
+		return nil, err
+	}
+	return out.Value, nil
+}
+
+//forward records the computation of every layer on tape t. It returns the output and the weights and bias variables of each layer. In training mode, new dropout masks are drawn if redraw is set or if they were drawn for another input
+func (ff *FC) forward(t *autodiff.Tape, input *mat.M64, redraw bool) (*autodiff.Var, []*autodiff.Var, []*autodiff.Var, error) {
+	if input == nil {
+		return nil, nil, nil, fmt.Errorf("input is nil")
+	}
+	ws := make([]*autodiff.Var, len(ff.layers))
+	bs := make([]*autodiff.Var, len(ff.layers))
+	ff.outs = make([]*mat.M64, len(ff.layers))
+	out := t.Const(input)
+	if redraw || input != ff.masked || len(ff.masks) != len(ff.layers) {
+		ff.masks, ff.masked = make([]*mat.M64, len(ff.layers)), input
+	}
 	var err error
 	for i, l := range ff.layers {
-		out, err = l.FeedForward(in)
+		out, ws[i], bs[i], err = l.forward(t, out)
 		if err != nil {
-			return nil, fmt.Errorf("layer[%d]: %s", i, err.Error())
+			return nil, nil, nil, fmt.Errorf("layer[%d]: %s", i, err.Error())
+		}
+		if ff.training && i < len(ff.drops) && ff.drops[i] > 0 {
+			if ff.masks[i] == nil {
+				if ff.rnd == nil {
+					ff.rnd = rand.New(rand.NewSource(1))
+				}
+				r, c := out.Value.Dims()
+				ff.masks[i] = dropMask(ff.rnd, ff.drops[i], r, c)
+			}
+			if out, err = t.Mul(out, t.Const(ff.masks[i])); err != nil {
+				return nil, nil, nil, fmt.Errorf("layer[%d]: dropout: %s", i, err.Error())
+			}
+		}
+		ff.outs[i] = out.Value
+		if l.keepState {
+			l.state = out.Value
 		}
-		in = out
 	}
-	return out, nil
+	return out, ws, bs, nil
 }
 
-//Backprop the cost gradient
+//Backprop the cost gradient. Gradients of all layers are computed before any weight is updated
 func (ff *FC) Backprop(lr float64, in, gradCost *mat.M64) error {
 	if ff == nil {
 		return fmt.Errorf("network is nil")
 	}
-	if in == nil {
-		return fmt.Errorf("input is nil")
+	if lr <= 0 || lr > 1.0 {
+		return fmt.Errorf("learning rate must be in range ]0;1]")
 	}
-	if gradCost == nil {
-		return fmt.Errorf("cost gradient is nil")
+	ff.ZeroGrad()
+	if err := ff.Accumulate(in, gradCost); err != nil {
+		return err
 	}
-	var err error
-	n := len(ff.layers)
-	ind := 0
-	var next *layer
-	var input *mat.M64
-	for i := range ff.layers {
-		ind = (n - 1) - i
-		if ind == 0 {
-			input = in
-		} else {
-			input = ff.layers[ind-1].state
+	return ff.step(lr)
+}
+
+//Params returns the weights and bias of all layers
+func (ff *FC) Params() []*Param {
+	if ff == nil {
+		return nil
+	}
+	var params []*Param
+	for _, l := range ff.layers {
+		params = append(params, l.params...)
+	}
+	return params
+}
+
+//ZeroGrad clears the gradients of all parameters
+func (ff *FC) ZeroGrad() {
+	for _, p := range ff.Params() {
+		p.ZeroGrad()
+	}
+}
+
+//Accumulate adds the gradients of the cost for input in to the gradients of the parameters, gradCost being the gradient of the cost wrt the output
+func (ff *FC) Accumulate(in, gradCost *mat.M64) error {
+	gradW, gradB, err := ff.gradients(in, gradCost)
+	if err != nil {
+		return err
+	}
+	for i, l := range ff.layers {
+		if ff.isFrozen(i) {
+			continue
 		}
-		/*
-			fmt.Printf("layers[%d]\n", ind)
-			fmt.Printf("	state: %+v\n", ff.layers[ind].state.GetData())
-			fmt.Printf("	b:%+v\n", ff.layers[ind].b.GetData())
-			fmt.Printf("	w:%+v\n", ff.layers[ind].w.GetData())
-			fmt.Printf("	gradSig: %+v\n", ff.layers[ind].gradSig.GetData())
-		*/
-		if i == 0 {
-			//output layer
-			//fmt.Printf("	params: gradCost:%+v gradSig:%+v w:%+v\n", gradCost.GetData(), nil, nil)
-			gradCost, err = ff.layers[ind].Backprop(lr, input, gradCost, nil, nil, true)
-			if err != nil {
-				return fmt.Errorf("layer %d: %s", ind, err.Error())
-			}
-			next = ff.layers[ind]
-			//fmt.Printf("	new b:%+v\n", ff.layers[ind].b.GetData())
-			//fmt.Printf("	new w:%+v\n", ff.layers[ind].w.GetData())
-		} else {
-			//fmt.Printf("params: gradCost:%+v gradSig:%+v w:%+v\n", gradCost.GetData(), next.gradSig.GetData(), next.w.GetData())
-			gradCost, err = ff.layers[ind].Backprop(lr, input, gradCost, next.gradSig, next.w, false)
-			if err != nil {
-				return fmt.Errorf("layer %d: %s", ind, err.Error())
-			}
-			next = ff.layers[ind]
-			//fmt.Printf("	new b:%+v\n", ff.layers[ind].b.GetData())
-			//fmt.Printf("	new w:%+v\n", ff.layers[ind].w.GetData())
+		if err = l.params[0].accumulate(gradW[i]); err != nil {
+			return fmt.Errorf("layer %d: %s", i, err.Error())
+		}
+		if err = l.params[1].accumulate(gradB[i]); err != nil {
+			return fmt.Errorf("layer %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+//step updates the params of the layers which are not frozen with the accumulated gradients and the gradients of the penalties, then applies the max-norm constraints. Pruned weights are kept at 0
+func (ff *FC) step(lr float64) error {
+	for i, l := range ff.layers {
+		if ff.isFrozen(i) {
+			continue
+		}
+		ff.reg(i).addGradients(l.params)
+		l.params[0].mask(true)
+	}
+	update := sgdStep
+	if ff.opt != nil {
+		update = ff.opt.Update
+	}
+	if err := update(lr, ff.TrainableParams()); err != nil {
+		return err
+	}
+	for i, l := range ff.layers {
+		if ff.isFrozen(i) {
+			continue
 		}
+		ff.reg(i).constrain(l.params)
+		l.params[0].mask(false)
 	}
 	return nil
 }
 
+//SetOptimizer sets the optimizer updating the params, nil for the stochastic gradient descent without momentum (default)
+func (ff *FC) SetOptimizer(o Optimizer) {
+	if ff == nil {
+		return
+	}
+	ff.opt = o
+}
+
+//reg returns the regularizer of layer i, nil if none
+func (ff *FC) reg(i int) *regularizer {
+	if i >= len(ff.regs) {
+		return nil
+	}
+	return ff.regs[i]
+}
+
+//layerStates returns the last outputs and the params of the layers
+func (ff *FC) layerStates() []layerState {
+	states := make([]layerState, len(ff.layers))
+	for i, l := range ff.layers {
+		states[i] = layerState{name: fmt.Sprintf("layer%d", i), params: l.params}
+		if i < len(ff.outs) {
+			states[i].out = ff.outs[i]
+		}
+	}
+	return states
+}
+
+//penalty returns the sum of the penalties of the layers, to be added to the cost
+func (ff *FC) penalty() float64 {
+	if ff == nil {
+		return 0
+	}
+	s := 0.0
+	for i, l := range ff.layers {
+		s += ff.reg(i).penalty(l.params)
+	}
+	return s
+}
+
+//gradients computes the gradient of the cost wrt w and b of each layer, gradCost being the gradient of the cost wrt the output for input in
+func (ff *FC) gradients(in, gradCost *mat.M64) ([]*mat.M64, []*mat.M64, error) {
+	if ff == nil {
+		return nil, nil, fmt.Errorf("network is nil")
+	}
+	if in == nil {
+		return nil, nil, fmt.Errorf("input is nil")
+	}
+	if gradCost == nil {
+		return nil, nil, fmt.Errorf("cost gradient is nil")
+	}
+	t := autodiff.NewTape()
+	out, ws, bs, err := ff.forward(t, in, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = t.Backward(out, gradCost); err != nil {
+		return nil, nil, fmt.Errorf("failed to backpropagate: %s", err.Error())
+	}
+	gradW := make([]*mat.M64, len(ff.layers))
+	gradB := make([]*mat.M64, len(ff.layers))
+	for i := range ff.layers {
+		gradW[i], gradB[i] = ws[i].Grad, bs[i].Grad
+	}
+	return gradW, gradB, nil
+}
+
 //GetState returns the output values of a layer if keepStates==true or an error
 func (ff *FC) GetState(layerInd int) (*mat.M64, error) {
 	if ff == nil {
@@ -199,3 +389,21 @@ func (ff *FC) GetState(layerInd int) (*mat.M64, error) {
 	}
 	return s, nil
 }
+
+//SetTraining switches the network to training mode, where the outputs of the layers with dropout are randomly zeroed, or to inference mode (default). The trainer switches it while training
+func (ff *FC) SetTraining(training bool) {
+	if ff == nil {
+		return
+	}
+	ff.training = training
+}
+
+//setRand sets the random source of the dropout masks
+func (ff *FC) setRand(r *rand.Rand) {
+	ff.rnd = r
+}
+
+//stacksBatches reports if the samples of a batch can be stacked as the colomns of a single input: dense layers process colomns independently
+func (ff *FC) stacksBatches() bool {
+	return true
+}
@@ -0,0 +1,113 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//TestFC32Accuracy compares the float32 path to the float64 path on random inputs of a network of 6 layers: the maximum relative error of the outputs is about 2e-7
+func TestFC32Accuracy(t *testing.T) {
+	configs := []*LayerConfig{
+		{Size: 32, FuncType: activation.FuncTypeTanh},
+		{Size: 32, FuncType: activation.FuncTypeRelu},
+		{Size: 32, FuncType: activation.FuncTypeElu, FuncParams: []float64{1}},
+		{Size: 16, FuncType: activation.FuncTypeLeakyRelu, FuncParams: []float64{0.1}},
+		{Size: 8, FuncType: activation.FuncTypeSigmoid},
+		{Size: 4, FuncType: activation.FuncTypeIden},
+	}
+	f, err := mockRandFC(1, 16, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//weights in [-0.5;0.5[ keep the hidden layers out of saturation
+	for _, p := range f.Params() {
+		data := p.Value.GetData()
+		for i := range data {
+			data[i] /= 2
+		}
+		p.Value.SetData(data)
+	}
+	f32, err := f.Float32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(2))
+	maxErr := 0.0
+	for n := 0; n < 200; n++ {
+		//inputs in [-2;2[
+		in := randM64(r, 16, 1)
+		for i := 0; i < 16; i++ {
+			in.Set(i, 0, 2*in.At(i, 0))
+		}
+		exp, err := f.FeedForward(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := f32.FeedForward(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range out.GetData() {
+			//relative to the magnitude of the outputs, close to 0 for some of them
+			maxErr = math.Max(maxErr, math.Abs(v-exp.At(i, 0))/math.Max(1, math.Abs(exp.At(i, 0))))
+		}
+	}
+	t.Logf("maximum relative error: %g", maxErr)
+	if maxErr > 1e-6 {
+		t.Errorf("expected a relative error <1e-6 received %g", maxErr)
+	}
+}
+
+func TestFC32(t *testing.T) {
+	te := tester.NewT(t)
+	double := activation.F{Func: func(x float64) float64 { return 2 * x }, Deriv: func(x float64) float64 { return 2 }}
+	f, err := mockRandFC(3, 3, []*LayerConfig{{Size: 2, FuncType: activation.FuncTypeTanh}, {Size: 2, F: double}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f32, err := f.Float32()
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "sizes", []int{3, 2}, []int{f32.InSize(), f32.OutSize()})
+	//colomns are run as a batch
+	in := mat.NewM64(3, 2, []float64{1, 0.5, -1, 0, 0.25, 2})
+	batch, err := f32.FeedForward(in)
+	te.CheckError(1, nil, err)
+	for j := 0; j < 2; j++ {
+		out, err := f32.Predict([]float32{float32(in.At(0, j)), float32(in.At(1, j)), float32(in.At(2, j))})
+		te.CheckError(1, nil, err)
+		te.DeepEqual(1, fmt.Sprintf("colomn %d", j), []float64{float64(out[0]), float64(out[1])}, []float64{batch.At(0, j), batch.At(1, j)})
+	}
+	//back to float64, the weights are rounded and the activations kept
+	back, err := f32.Float64()
+	te.CheckError(2, nil, err)
+	for i, p := range back.Params() {
+		for j, v := range p.Value.GetData() {
+			te.DeepEqual(2, p.Name, float64(float32(f.Params()[i].Value.GetData()[j])), v)
+		}
+	}
+	te.DeepEqual(2, "activations", []string{activation.FuncTypeTanh, activation.FuncTypeCustom}, []string{back.layers[0].ftype, back.layers[1].ftype})
+	out, err := back.FeedForward(in)
+	te.CheckError(2, nil, err)
+	for i, v := range out.GetData() {
+		if math.Abs(v-batch.GetData()[i]) > 1e-6 {
+			t.Errorf("output %d: expected %f received %f", i, batch.GetData()[i], v)
+		}
+	}
+	//errors
+	_, err = f32.Predict([]float32{1})
+	te.CheckError(3, fmt.Errorf("input has 1 values, expected 3"), err)
+	_, err = f32.FeedForward(mat.NewM64(2, 1, nil))
+	te.CheckError(4, fmt.Errorf("input has 2 rows, expected 3"), err)
+	empty, _ := NewFC(2)
+	_, err = empty.Float32()
+	te.CheckError(5, fmt.Errorf("network has no layers"), err)
+	var nilFC32 *FC32
+	_, err = nilFC32.Predict(nil)
+	te.CheckError(6, fmt.Errorf("network is nil"), err)
+}
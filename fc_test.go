@@ -1,7 +1,9 @@
 package nn
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	mat "github.com/klahssen/go-mat"
@@ -202,8 +204,8 @@ func TestFCBackprop(t *testing.T) {
 			lr:       0.5,
 			in:       mat.NewM64(2, 1, []float64{1, 2}),
 			gradCost: mat.NewM64(1, 1, []float64{1}),
-			newW:     mat.NewM64(2, 2, []float64{1.25, 1.5, 1.25, 1.5}),
-			newB:     mat.NewM64(2, 1, []float64{0.25, 0.25}),
+			newW:     mat.NewM64(2, 2, []float64{0.5, 0, 0.5, 0}),
+			newB:     mat.NewM64(2, 1, []float64{-0.5, -0.5}),
 			err:      nil,
 		},
 	}
@@ -217,3 +219,41 @@ func TestFCBackprop(t *testing.T) {
 
 	}
 }
+
+func TestFCEncode(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 3, FuncType: activation.FuncTypeTanh, L2: 0.1, Dropout: 0.2},
+		{Size: 2, FuncType: activation.FuncTypeSigmoid, MaxNorm: 2},
+	}
+	f, err := mockRandFC(1, 4, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, f.Encode(buf))
+	d, err := DecodeFC(buf)
+	te.CheckError(0, nil, err)
+	if err != nil {
+		return
+	}
+	te.DeepEqual(0, "sizes", []int{4, 2}, []int{d.InSize(), d.OutSize()})
+	te.DeepEqual(0, "regularizers", f.regs, d.regs)
+	te.DeepEqual(0, "dropout", f.drops, d.drops)
+	in := mat.NewM64(4, 1, []float64{0.1, -0.2, 0.3, -0.4})
+	exp, _ := f.FeedForward(in)
+	out, err := d.FeedForward(in)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "output", exp.GetData(), out.GetData())
+	for ind, test := range []struct {
+		data string
+		err  error
+	}{
+		{`{"type": "model", "version": 1}`, fmt.Errorf("type is 'model', expected 'fc'")},
+		{`{"type": "fc", "version": 2}`, fmt.Errorf("unsupported network version 2")},
+		{`{"type": "fc", "version": 1, "input": 2, "layers": [{"config": {"size": 1, "ftype": "iden"}, "params": {"w": {"rows": 1, "cols": 3, "data": [1, 2, 3]}, "b": {"rows": 1, "cols": 1, "data": [0]}}}]}`, fmt.Errorf("layers[0]: params: 'w' has shape 1x3 with 3 values, expected 1x2")},
+	} {
+		_, err := DecodeFC(strings.NewReader(test.data))
+		te.CheckError(ind, test.err, err)
+	}
+}
@@ -14,9 +14,62 @@ const (
 	maxDropOut = 0.9
 )
 
-//FCTrainer trains the inner Fully Connected feed forward neural network with training and validation datasets, and evaluates its performance with test dataset
+//Network is a feed forward neural network trainable by backpropagation, like FC or Model
+type Network interface {
+	FeedForward(input *mat.M64) (*mat.M64, error)
+	Backprop(lr float64, in, gradCost *mat.M64) error
+}
+
+//usable is implemented by networks able to check their definition before training
+type usable interface {
+	isUsable() error
+}
+
+//stateful is implemented by networks keeping a state between inputs, reset at the beginning of each pass over a dataset
+type stateful interface {
+	ResetStates()
+}
+
+//resetStates clears the state of the network, if any
+func (t *FCTrainer) resetStates() {
+	if s, ok := t.n.(stateful); ok {
+		s.ResetStates()
+	}
+}
+
+//setTraining switches the network to training or inference mode, if it has one
+func (t *FCTrainer) setTraining(training bool) {
+	if s, ok := t.n.(interface{ SetTraining(bool) }); ok {
+		s.SetTraining(training)
+	}
+}
+
+//batchable is implemented by networks able to process the samples of a batch stacked as the colomns of a single input
+type batchable interface {
+	stacksBatches() bool
+}
+
+//accumulator is implemented by networks able to sum the gradients of several inputs before updating their params
+type accumulator interface {
+	ZeroGrad()
+	Accumulate(in, gradCost *mat.M64) error
+	step(lr float64) error
+}
+
+//penalized is implemented by networks with regularization penalties added to the cost
+type penalized interface {
+	penalty() float64
+}
+
+//prunable is implemented by networks whose weights can be pruned, see FC.Prune
+type prunable interface {
+	Prune(opts PruneOptions) error
+	Sparsity() float64
+}
+
+//FCTrainer trains the inner Fully Connected feed forward neural network (or any Network) with training and validation datasets, and evaluates its performance with test dataset
 type FCTrainer struct {
-	n  *FC
+	n  Network
 	lr LrSource
 	/*training   Dataset
 	validation Dataset
@@ -26,15 +79,128 @@ type FCTrainer struct {
 	niter   uint
 	maxiter uint
 	tol     float64
+	//gradient clipping, 0 to disable
+	clipValue float64
+	clipNorm  float64
+	skip      bool          //skip the batches producing NaN or Inf values instead of failing
+	costs     []float64     //average cost of each iteration of the last run of backpropagation
+	history   []float64     //average cost of each iteration on the training set
+	epochs    []EpochReport //report of each iteration of the last run of backpropagation
+	report    []EpochReport //report of each iteration on the training set
+	gradNorm  float64       //norm of the gradient of the last batch, before clipping
+	//cost of monitor evaluated after each iteration, and early stopping on it, 0 patience to disable
+	patience uint
+	minDelta float64
+	monitor  Dataset
+	//pruning every prunePeriod iterations for pruneSteps steps, 0 period to disable
+	prune       PruneOptions
+	prunePeriod uint
+	pruneSteps  uint
+	distill     *Distillation //nil without distillation
+}
+
+//EpochReport sums up an iteration over the training set
+type EpochReport struct {
+	Epoch      uint     `json:"epoch"`                //starting at 1
+	Cost       float64  `json:"cost"`                 //average cost on the training set
+	Validation *float64 `json:"validation,omitempty"` //average cost on the validation set after the iteration, nil without validation set
+	Lr         float64  `json:"lr"`                   //learning rate of the iteration
+	GradNorm   float64  `json:"grad_norm"`            //average norm of the gradient of the batches before clipping, 0 for networks which do not accumulate their gradients
+	Sparsity   float64  `json:"sparsity,omitempty"`   //ratio of weights equal to 0 after the iteration, for networks which can be pruned
+}
+
+//earlyStop keeps the best cost on the validation set and the params reaching it
+type earlyStop struct {
+	best  float64
+	wait  uint //number of iterations without improvement
+	saved [][]float64
 }
 
 //NewFCTrainer constructs a new Trainer for a Feed Forward Neural Net. It will stop if it reaches max number of iter or converges to the error tolerance
 func NewFCTrainer(fc *FC, l Logger, lr LrSource, maxIter uint, tolerance float64, cost activation.F) (*FCTrainer, error) {
-	t := &FCTrainer{n: fc, lr: lr, l: l, maxiter: maxIter, cost: cost, tol: math.Abs(tolerance)}
+	if fc == nil {
+		return NewTrainer(nil, l, lr, maxIter, tolerance, cost)
+	}
+	return NewTrainer(fc, l, lr, maxIter, tolerance, cost)
+}
+
+//NewTrainer constructs a new Trainer for any Network, such as a Model. It will stop if it reaches max number of iter or converges to the error tolerance
+func NewTrainer(n Network, l Logger, lr LrSource, maxIter uint, tolerance float64, cost activation.F) (*FCTrainer, error) {
+	t := &FCTrainer{n: n, lr: lr, l: l, maxiter: maxIter, cost: cost, tol: math.Abs(tolerance)}
 	err := t.validate()
 	return t, err
 }
 
+//SetClipping clips the accumulated gradient of the cost before each update: each value to [-value;value] if value>0, then the whole gradient to a global norm of norm if norm>0. Only applies to networks accumulating their gradients, like FC and Model
+func (t *FCTrainer) SetClipping(value, norm float64) error {
+	if t == nil {
+		return fmt.Errorf("trainer is nil")
+	}
+	if value < 0 {
+		return fmt.Errorf("clipping value must be >=0")
+	}
+	if norm < 0 {
+		return fmt.Errorf("clipping norm must be >=0")
+	}
+	t.clipValue, t.clipNorm = value, norm
+	return nil
+}
+
+//SkipNonFinite sets the behaviour of the trainer when a batch produces NaN or Inf values in the cost, the outputs, the gradients or the params of a layer: training fails with an error identifying the layer and the step by default, if skip is true the batch is logged and skipped, the params being restored to their previous values
+func (t *FCTrainer) SkipNonFinite(skip bool) {
+	if t == nil {
+		return
+	}
+	t.skip = skip
+}
+
+//SetEarlyStopping stops the training when the average cost on the validation set has not decreased by more than minDelta for patience iterations, the params of the best iteration being restored. The validation set is then evaluated after each iteration over the training set instead of being trained on. A patience of 0 disables early stopping (default)
+func (t *FCTrainer) SetEarlyStopping(patience uint, minDelta float64) error {
+	if t == nil {
+		return fmt.Errorf("trainer is nil")
+	}
+	if minDelta < 0 {
+		return fmt.Errorf("minimum delta must be >=0")
+	}
+	t.patience, t.minDelta = patience, minDelta
+	return nil
+}
+
+//SetPruning prunes the network every period iterations over the training set, steps times, the weights left being fine-tuned in between. A target sparsity is reached gradually: step k prunes to k/steps of it. With early stopping, only the params of the iterations after the last step can be restored. A period of 0 disables pruning (default)
+func (t *FCTrainer) SetPruning(opts PruneOptions, period, steps uint) error {
+	if t == nil {
+		return fmt.Errorf("trainer is nil")
+	}
+	if _, ok := t.n.(prunable); !ok {
+		return fmt.Errorf("network can not be pruned")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if period > 0 && steps == 0 {
+		return fmt.Errorf("pruning steps must be >0")
+	}
+	t.prune, t.prunePeriod, t.pruneSteps = opts, period, steps
+	return nil
+}
+
+//pruneStep prunes the network after iteration i if it is a pruning step
+func (t *FCTrainer) pruneStep(i uint) (bool, error) {
+	if t.prunePeriod == 0 || i%t.prunePeriod != 0 || i/t.prunePeriod > t.pruneSteps {
+		return false, nil
+	}
+	p, ok := t.n.(prunable)
+	if !ok {
+		return false, nil
+	}
+	opts := t.prune
+	opts.Sparsity *= float64(i/t.prunePeriod) / float64(t.pruneSteps)
+	if err := p.Prune(opts); err != nil {
+		return false, fmt.Errorf("iteration %d: failed to prune: %s", i, err.Error())
+	}
+	return true, nil
+}
+
 //Validate checks if the trainers definition is OK
 func (t *FCTrainer) validate() error {
 	if t == nil {
@@ -47,10 +213,9 @@ func (t *FCTrainer) validate() error {
 		return fmt.Errorf("learning rate source is nil")
 	}
 	//check network def
-	var err error
-	for i, lay := range t.n.layers {
-		if err = lay.IsUsable(); err != nil {
-			return fmt.Errorf("layer [%d]: %s", i, err.Error())
+	if u, ok := t.n.(usable); ok {
+		if err := u.isUsable(); err != nil {
+			return err
 		}
 	}
 	if t.l == nil {
@@ -85,75 +250,275 @@ func (t *FCTrainer) withBackprop(r rand.Source, dataset Dataset, dropOutPeriod u
 	if r == nil {
 		return avg, fmt.Errorf("random source r is nil")
 	}
-	if dropOutRatio <= minDropOut || dropOutRatio > maxDropOut {
+	if dropOutRatio < minDropOut || dropOutRatio > maxDropOut {
 		return avg, fmt.Errorf("dropout must be between %.1f and %.1f", minDropOut, maxDropOut)
 	}
 	if dataset == nil || dataset.Size() == 0 {
 		return avg, fmt.Errorf("dataset is empty")
 	}
+	if batchSize == 0 {
+		batchSize = 1
+	}
 	t.l.Printf("Start training ...")
-	counter := uint(1)
-	c := 0.0 //stores the cost for a point (average of cost of all outputs)
-	var p *Datapoint
-	var pred, dev, cost, gradCost *mat.M64
-	var err error
-	//t.l.Printf("Max iterations: %d\n", t.maxiter)
+	if d, ok := t.n.(dropper); ok {
+		d.setRand(rand.New(r))
+	}
+	t.setTraining(true)
+	defer t.setTraining(false)
+	batch := make([]*Datapoint, 0, batchSize)
+	t.costs, t.epochs = nil, nil
+	es := &earlyStop{best: math.Inf(1)}
 	for i := uint(1); i <= t.maxiter; i++ {
-		//t.l.Printf("iteration: %d counter=%d\n", i, counter)
+		if s, ok := t.lr.(scheduled); ok {
+			s.SetEpoch(i - 1)
+		}
 		dataset.Reset()
-		ip := 0
+		t.resetStates()
+		avg = 0
+		rep := EpochReport{Epoch: i, Lr: t.lr.GetRate()}
+		ip := 0      //index of the first point of the batch
+		trained := 0 //number of points of the batches which were not skipped
 		for {
 			//process each datapoint
-			p = dataset.Next()
+			p := dataset.Next()
+			if p != nil {
+				if batch = append(batch, p); uint(len(batch)) < batchSize {
+					continue
+				}
+			}
+			if len(batch) > 0 {
+				c, err := t.trainBatch(batch)
+				if _, ok := err.(*nonFiniteError); ok && t.skip {
+					t.l.Printf("iteration %d: training point %d: %s, batch skipped", i, ip, err.Error())
+				} else if err != nil {
+					return avg, fmt.Errorf("iteration %d: training point %d: %s", i, ip, err.Error())
+				} else {
+					avg += c
+					trained += len(batch)
+					rep.GradNorm += t.gradNorm * float64(len(batch))
+				}
+				ip += len(batch)
+				batch = batch[:0]
+			}
 			if p == nil {
 				break
 			}
-			//t.l.Printf("point [%d]: %+v\n", ip, p)
-			//compute prediction
-			pred, err = t.n.FeedForward(p.Inp)
-			if err != nil {
-				return avg, fmt.Errorf("iteration %d: training point %d: %s", i, ip, err.Error())
-			}
-			//compute deviation
-			dev, err = mat.Sub(pred, p.Exp)
-			if err != nil {
-				return avg, fmt.Errorf("iteration %d: training point %d: failed to compute deviation: %s", i, ip, err.Error())
+		}
+		if trained == 0 {
+			return avg, fmt.Errorf("iteration %d: every batch was skipped", i)
+		}
+		avg = avg / float64(trained)
+		rep.Cost, rep.GradNorm = avg, rep.GradNorm/float64(trained)
+		pruned, err := t.pruneStep(i)
+		if err != nil {
+			return avg, err
+		}
+		if pruned {
+			//the params saved before pruning are not restored
+			*es = earlyStop{best: math.Inf(1)}
+		}
+		if p, ok := t.n.(prunable); ok {
+			rep.Sparsity = p.Sparsity()
+		}
+		var c float64
+		if t.monitor != nil {
+			var err error
+			if c, err = t.validationCost(i); err != nil {
+				return avg, err
 			}
-			cost, err = mat.MapElem(dev, t.cost.Func)
+			rep.Validation = &c
+		}
+		t.costs, t.epochs = append(t.costs, avg), append(t.epochs, rep)
+		if avg <= t.tol {
+			break
+		}
+		if t.monitor != nil && t.patience > 0 && t.earlyStop(i, c, es) {
+			break
+		}
+	}
+
+	t.l.Printf("Total Average Cost = %f", avg)
+	return avg, nil
+}
+
+//validationCost evaluates the validation set after iteration i
+func (t *FCTrainer) validationCost(i uint) (float64, error) {
+	t.setTraining(false)
+	c, err := t.testWith(t.monitor)
+	t.setTraining(true)
+	if err != nil {
+		return 0, fmt.Errorf("iteration %d: validation set: %s", i, err.Error())
+	}
+	return c, nil
+}
+
+//earlyStop keeps the params if the validation cost c after iteration i is the best so far, and returns true if the training must stop, the best params being restored
+func (t *FCTrainer) earlyStop(i uint, c float64, es *earlyStop) bool {
+	in, inspect := t.n.(inspectable)
+	if c < es.best-t.minDelta {
+		es.best, es.wait = c, 0
+		if inspect {
+			es.saved = snapshot(in.layerStates())
+		}
+		return false
+	}
+	if es.wait++; es.wait < t.patience {
+		return false
+	}
+	t.l.Printf("iteration %d: validation cost did not improve for %d iterations, stopping", i, t.patience)
+	if inspect && es.saved != nil {
+		restore(in.layerStates(), es.saved)
+	}
+	return true
+}
+
+//trainBatch updates the network with the average gradient of the cost over the batch, and returns the sum of the costs of its points, including the regularization penalty before the update. When batches with NaN or Inf values are skipped, the params are restored on such errors
+func (t *FCTrainer) trainBatch(batch []*Datapoint) (float64, error) {
+	in, ok := t.n.(inspectable)
+	if !ok || !t.skip {
+		return t.processBatch(batch)
+	}
+	states := in.layerStates()
+	saved := snapshot(states)
+	c, err := t.processBatch(batch)
+	if _, ok := err.(*nonFiniteError); ok {
+		restore(states, saved)
+	}
+	return c, err
+}
+
+//processBatch updates the network with the batch, see trainBatch
+func (t *FCTrainer) processBatch(batch []*Datapoint) (float64, error) {
+	n := float64(len(batch))
+	lr := t.lr.GetRate()
+	total := 0.0
+	t.gradNorm = 0
+	if p, ok := t.n.(penalized); ok {
+		total = p.penalty() * n
+	}
+	//points are stacked as the colomns of a single input when the network allows it
+	points, weight := batch, 1.0
+	if b, ok := t.n.(batchable); ok && b.stacksBatches() && len(batch) > 1 {
+		p, err := stack(batch)
+		if err != nil {
+			return 0, err
+		}
+		points, weight = []*Datapoint{p}, n
+	}
+	acc, ok := t.n.(accumulator)
+	if !ok {
+		for _, p := range points {
+			c, gradCost, err := t.costGradient(p, n)
 			if err != nil {
-				return avg, fmt.Errorf("iteration %d: training point %d: failed to compute cost vector: %s", i, ip, err.Error())
+				return 0, err
 			}
-			c = 0.0
-			for j := 0; j < cost.Size(); j++ {
-				c += cost.AtInd(j)
+			total += c * weight
+			if err = t.n.Backprop(lr, p.Inp, gradCost); err != nil {
+				return 0, fmt.Errorf("failed to backpropagate: %s", err.Error())
 			}
-			c = c / float64(cost.Size())
-			avg += c
-			if counter == batchSize {
-				//t.l.Printf("counter==batchSize: backprop!\n")
-				gradCost, err = mat.MapElem(dev, t.cost.Deriv)
-				if err != nil {
-					return avg, fmt.Errorf("iteration %d: training point %d: failed to compute cost vector: %s", i, ip, err.Error())
-				}
-				counter = 0
-				//compute mean error
-				avg = avg / float64(batchSize)
-				//backprop
-				err = t.n.Backprop(t.lr.GetRate(), p.Inp, gradCost)
-				if err != nil {
-					return avg, fmt.Errorf("iteration %d: training point %d: failed to backpropagate: %s", i, ip, err.Error())
-				}
-				if avg <= t.tol {
-					break
-				}
-			}
-			counter++
-			ip++
 		}
+		return total, nil
+	}
+	in, inspect := t.n.(inspectable)
+	acc.ZeroGrad()
+	for _, p := range points {
+		c, gradCost, err := t.costGradient(p, n)
+		if err != nil {
+			return 0, err
+		}
+		total += c * weight
+		if err = acc.Accumulate(p.Inp, gradCost); err != nil {
+			return 0, fmt.Errorf("failed to backpropagate: %s", err.Error())
+		}
+	}
+	if !inspect {
+		if err := acc.step(lr); err != nil {
+			return 0, fmt.Errorf("failed to update params: %s", err.Error())
+		}
+		return total, nil
 	}
+	states := in.layerStates()
+	if err := checkGradients(states); err != nil {
+		return 0, err
+	}
+	params := statesParams(states)
+	t.gradNorm = gradNorm(params)
+	clipGradients(params, t.clipValue, t.clipNorm)
+	if err := acc.step(lr); err != nil {
+		return 0, fmt.Errorf("failed to update params: %s", err.Error())
+	}
+	return total, checkParams(states)
+}
 
-	t.l.Printf("Total Average Cost = %f", avg)
-	return avg, nil
+//costGradient runs the network on p and returns the average cost of the outputs and the gradient of the cost wrt the outputs, divided by n. With distillation, the cost against the teacher is blended in
+func (t *FCTrainer) costGradient(p *Datapoint, n float64) (float64, *mat.M64, error) {
+	pred, err := t.n.FeedForward(p.Inp)
+	if err != nil {
+		return 0, nil, err
+	}
+	if in, ok := t.n.(inspectable); ok {
+		if err = checkActivations(in.layerStates()); err != nil {
+			return 0, nil, err
+		}
+	}
+	c, gradCost, err := t.deviationCost(pred, p.Exp, n)
+	if err != nil || t.distill == nil {
+		return c, gradCost, err
+	}
+	return t.distillCost(p, pred, c, gradCost, n)
+}
+
+//deviationCost returns the average cost of the deviation of pred from exp and its gradient wrt pred, divided by n
+func (t *FCTrainer) deviationCost(pred, exp *mat.M64, n float64) (float64, *mat.M64, error) {
+	dev, err := mat.Sub(pred, exp)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to compute deviation: %s", err.Error())
+	}
+	c := 0.0
+	for _, v := range dev.GetData() {
+		c += t.cost.Func(v)
+	}
+	if math.IsNaN(c) || math.IsInf(c, 0) {
+		return 0, nil, &nonFiniteError{fmt.Sprintf("cost is %v", c)}
+	}
+	gradCost, err := mat.MapElem(dev, func(x float64) float64 { return t.cost.Deriv(x) / n })
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to compute cost gradient: %s", err.Error())
+	}
+	return c / float64(dev.Size()), gradCost, nil
+}
+
+//stack returns a datapoint whose colomns are the inputs and expected outputs of the batch
+func stack(batch []*Datapoint) (*Datapoint, error) {
+	ins, exps := make([]*mat.M64, len(batch)), make([]*mat.M64, len(batch))
+	for i, p := range batch {
+		ins[i], exps[i] = p.Inp, p.Exp
+	}
+	in, err := stackCols(ins)
+	if err != nil {
+		return nil, fmt.Errorf("inputs: %s", err.Error())
+	}
+	exp, err := stackCols(exps)
+	if err != nil {
+		return nil, fmt.Errorf("expected outputs: %s", err.Error())
+	}
+	return &Datapoint{Inp: in, Exp: exp}, nil
+}
+
+//stackCols concatenates colomn vectors
+func stackCols(vs []*mat.M64) (*mat.M64, error) {
+	r, _ := vs[0].Dims()
+	data := make([]float64, r*len(vs))
+	for j, v := range vs {
+		vr, vc := v.Dims()
+		if vr != r || vc != 1 {
+			return nil, fmt.Errorf("point %d has shape %dx%d, expected %dx1", j, vr, vc, r)
+		}
+		for i := 0; i < r; i++ {
+			data[i*len(vs)+j] = v.At(i, 0)
+		}
+	}
+	return mat.NewM64(r, len(vs), data), nil
 }
 
 //testWith uses current definition of the Neural Network on a dataset and outputs the performance (average cost)
@@ -166,6 +531,7 @@ func (t *FCTrainer) testWith(data Dataset) (float64, error) {
 	var p *Datapoint
 	iters := 0
 	data.Reset()
+	t.resetStates()
 	t.l.Printf("Start Evaluation ...")
 	for {
 		p = data.Next()
@@ -201,33 +567,63 @@ func (t *FCTrainer) testWith(data Dataset) (float64, error) {
 
 //TrainWithBackprop trains the inner network using back propagation, with an optional dropout (if period>0). updatePeriod sets how often backpropagation is applied and the period on which the cost is averaged. Deactivated neurons are selected randomly using the provided source
 func (t *FCTrainer) TrainWithBackprop(r rand.Source, dropOutPeriod uint, dropOutRatio float64, batchSize uint, training, validation, test Dataset) (*FC, error) {
+	err := t.Train(r, dropOutPeriod, dropOutRatio, batchSize, training, validation, test)
+	fc, _ := t.n.(*FC)
+	return fc, err
+}
+
+//Train trains the inner network like TrainWithBackprop, whatever its type. Dropout is set per layer by LayerConfig.Dropout: dropOutPeriod and dropOutRatio may be 0
+func (t *FCTrainer) Train(r rand.Source, dropOutPeriod uint, dropOutRatio float64, batchSize uint, training, validation, test Dataset) error {
 	if err := t.validate(); err != nil {
-		return t.n, err
+		return err
 	}
-	for i := range t.n.layers {
-		t.n.layers[i].keepState = true
+	if fc, ok := t.n.(*FC); ok {
+		for i := range fc.layers {
+			fc.layers[i].keepState = true
+		}
 	}
 	if training == nil || training.Size() == 0 {
-		return t.n, fmt.Errorf("training set is empty")
+		return fmt.Errorf("training set is empty")
 	}
 	if test == nil || test.Size() == 0 {
-		return t.n, fmt.Errorf("test set is empty")
+		return fmt.Errorf("test set is empty")
+	}
+	early := t.patience > 0
+	if validation != nil && validation.Size() > 0 {
+		t.monitor = validation
+	} else if early {
+		return fmt.Errorf("early stopping requires a validation set")
 	}
 	t.l.Printf("--- Training set ---\n")
-	if _, err := t.withBackprop(r, training, dropOutPeriod, dropOutRatio, batchSize); err != nil {
-		return t.n, err
+	_, err := t.withBackprop(r, training, dropOutPeriod, dropOutRatio, batchSize)
+	t.history, t.report, t.monitor = t.costs, t.epochs, nil
+	if err != nil {
+		return err
 	}
-	//validation set
-	if validation != nil && validation.Size() > 0 {
+	//validation set, trained on unless it is monitored by early stopping
+	if validation != nil && validation.Size() > 0 && !early {
 		t.l.Printf("--- Validation set ---\n")
 		if _, err := t.withBackprop(r, validation, dropOutPeriod, dropOutRatio, 1); err != nil {
-			return t.n, err
+			return err
 		}
 	}
 	t.l.Printf("--- Test set ---\n")
-	_, err := t.testWith(test)
-	if err != nil {
-		return t.n, err
+	_, err = t.testWith(test)
+	return err
+}
+
+//History returns the average cost of each iteration over the training set during the last training
+func (t *FCTrainer) History() []float64 {
+	if t == nil {
+		return nil
+	}
+	return t.history
+}
+
+//Report returns the report of each iteration over the training set during the last training, the validation cost being measured if a validation set was given
+func (t *FCTrainer) Report() []EpochReport {
+	if t == nil {
+		return nil
 	}
-	return t.n, nil
+	return t.report
 }
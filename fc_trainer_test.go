@@ -3,8 +3,11 @@ package nn
 import (
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"testing"
 
+	mat "github.com/klahssen/go-mat"
 	"github.com/klahssen/nn/internal/activation"
 	"github.com/klahssen/tester"
 )
@@ -92,3 +95,75 @@ func TestNewFCT(t *testing.T) {
 		te.CheckError(ind, test.err, err)
 	}
 }
+
+func TestEarlyStopping(t *testing.T) {
+	te := tester.NewT(t)
+	//the validation set expects the opposite of the training set: its cost increases from the first iteration
+	var training, validation []*Datapoint
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		x := 2*r.Float64() - 1
+		training = append(training, &Datapoint{Inp: mat.NewM64(1, 1, []float64{x}), Exp: mat.NewM64(1, 1, []float64{x})})
+		validation = append(validation, &Datapoint{Inp: mat.NewM64(1, 1, []float64{x}), Exp: mat.NewM64(1, 1, []float64{-x})})
+	}
+	m, err := NewSequential(1, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.1), 50, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, fmt.Errorf("minimum delta must be >=0"), tr.SetEarlyStopping(2, -1))
+	te.CheckError(1, nil, tr.SetEarlyStopping(2, 0))
+	te.CheckError(2, fmt.Errorf("early stopping requires a validation set"), tr.Train(rand.NewSource(1), 0, 0.5, 1, &pointsDataset{points: training}, nil, &pointsDataset{points: training}))
+	//the weight after the first iteration is kept
+	tr.maxiter = 1
+	te.CheckError(3, nil, tr.Train(rand.NewSource(1), 0, 0.5, 1, &pointsDataset{points: training}, &pointsDataset{points: validation}, &pointsDataset{points: training}))
+	first := m.Params()[0].Value.At(0, 0)
+	m.Params()[0].Value.Set(0, 0, 0)
+	m.Params()[1].Value.Set(0, 0, 0)
+	tr.maxiter = 50
+	te.CheckError(4, nil, tr.Train(rand.NewSource(1), 0, 0.5, 1, &pointsDataset{points: training}, &pointsDataset{points: validation}, &pointsDataset{points: training}))
+	te.DeepEqual(4, "iterations", 3, len(tr.History()))
+	te.DeepEqual(4, "restored weight", first, m.Params()[0].Value.At(0, 0))
+}
+
+func TestReport(t *testing.T) {
+	te := tester.NewT(t)
+	var points []*Datapoint
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		x := 2*r.Float64() - 1
+		points = append(points, &Datapoint{Inp: mat.NewM64(1, 1, []float64{x}), Exp: mat.NewM64(1, 1, []float64{2 * x})})
+	}
+	m, err := NewSequential(1, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewStepLr(0.1, 0.5, 2), 4, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, nil, tr.Train(rand.NewSource(1), 0, 0.5, 4, &pointsDataset{points: points[:15]}, nil, &pointsDataset{points: points[15:]}))
+	report := tr.Report()
+	te.DeepEqual(0, "epochs", 4, len(report))
+	for i, rep := range report {
+		te.DeepEqual(i, "epoch", uint(i+1), rep.Epoch)
+		te.DeepEqual(i, "cost", tr.History()[i], rep.Cost)
+		te.DeepEqual(i, "lr", 0.1*math.Pow(0.5, float64(i/2)), rep.Lr)
+		te.DeepEqual(i, "no validation", (*float64)(nil), rep.Validation)
+		te.DeepEqual(i, "gradient norm", true, rep.GradNorm > 0)
+	}
+	//the validation set is evaluated after each iteration, before being trained on
+	te.CheckError(1, nil, tr.Train(rand.NewSource(1), 0, 0.5, 4, &pointsDataset{points: points[:10]}, &pointsDataset{points: points[10:15]}, &pointsDataset{points: points[15:]}))
+	report = tr.Report()
+	te.DeepEqual(1, "epochs", 4, len(report))
+	for i, rep := range report {
+		te.DeepEqual(i, "validation", true, rep.Validation != nil && *rep.Validation > 0)
+	}
+	te.DeepEqual(1, "validation decreases", true, *report[3].Validation < *report[0].Validation)
+	//dropout is set per layer, the dropout ratio of the trainer may be 0
+	te.CheckError(2, nil, tr.Train(rand.NewSource(1), 0, 0, 4, &pointsDataset{points: points[:15]}, nil, &pointsDataset{points: points[15:]}))
+	te.CheckError(3, fmt.Errorf("dropout must be between 0.0 and 0.9"), tr.Train(rand.NewSource(1), 0, -0.1, 4, &pointsDataset{points: points[:15]}, nil, &pointsDataset{points: points[15:]}))
+}
@@ -1,6 +1,9 @@
 module github.com/klahssen/nn
 
+go 1.19
+
 require (
 	github.com/klahssen/go-mat v1.2.4
 	github.com/klahssen/tester v1.0.1
+	gopkg.in/yaml.v2 v2.4.0
 )
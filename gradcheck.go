@@ -0,0 +1,129 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//dftGradCheckEps is the default step used to compute central finite differences
+const dftGradCheckEps = 1e-5
+
+//GradCheck holds the largest relative errors between analytic and numerical gradients of a layer
+type GradCheck struct {
+	Layer      int
+	WeightsErr float64
+	BiasErr    float64
+}
+
+//MaxErr returns the largest relative error of the layer
+func (g *GradCheck) MaxErr() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Max(g.WeightsErr, g.BiasErr)
+}
+
+//GradCheck compares the gradients computed by backpropagation against central finite differences (f(x+eps)-f(x-eps))/2eps for every weight and bias, with cost=sum(cost(pred-exp)). eps<=0 uses a default step. The network is left unchanged
+func (ff *FC) GradCheck(in, exp *mat.M64, cost activation.F, eps float64) ([]*GradCheck, error) {
+	if err := ff.validate(); err != nil {
+		return nil, err
+	}
+	if in == nil {
+		return nil, fmt.Errorf("input is nil")
+	}
+	if exp == nil {
+		return nil, fmt.Errorf("expected output is nil")
+	}
+	if cost.Func == nil {
+		return nil, fmt.Errorf("cost function is nil")
+	}
+	if cost.Deriv == nil {
+		return nil, fmt.Errorf("cost derivative is nil")
+	}
+	if eps <= 0 {
+		eps = dftGradCheckEps
+	}
+	pred, err := ff.FeedForward(in)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := mat.Sub(pred, exp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute deviation: %s", err.Error())
+	}
+	gradCost, err := mat.MapElem(dev, cost.Deriv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute cost gradient: %s", err.Error())
+	}
+	gradW, gradB, err := ff.gradients(in, gradCost)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*GradCheck, len(ff.layers))
+	for i, l := range ff.layers {
+		res[i] = &GradCheck{Layer: i}
+		if res[i].WeightsErr, err = ff.checkParam(l.w, gradW[i], in, exp, cost, eps); err != nil {
+			return nil, fmt.Errorf("layer %d: weights: %s", i, err.Error())
+		}
+		if res[i].BiasErr, err = ff.checkParam(l.b, gradB[i], in, exp, cost, eps); err != nil {
+			return nil, fmt.Errorf("layer %d: bias: %s", i, err.Error())
+		}
+	}
+	return res, nil
+}
+
+//checkParam returns the largest relative error between grad and the numerical gradient of each value of param
+func (ff *FC) checkParam(param, grad, in, exp *mat.M64, cost activation.F, eps float64) (float64, error) {
+	maxErr := 0.0
+	r, c := param.Dims()
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			v := param.At(i, j)
+			param.Set(i, j, v+eps)
+			plus, err := ff.cost(in, exp, cost)
+			if err != nil {
+				param.Set(i, j, v)
+				return 0, err
+			}
+			param.Set(i, j, v-eps)
+			minus, err := ff.cost(in, exp, cost)
+			param.Set(i, j, v)
+			if err != nil {
+				return 0, err
+			}
+			if e := relativeErr(grad.At(i, j), (plus-minus)/(2*eps)); e > maxErr {
+				maxErr = e
+			}
+		}
+	}
+	return maxErr, nil
+}
+
+//cost returns the sum of the cost of each output
+func (ff *FC) cost(in, exp *mat.M64, cost activation.F) (float64, error) {
+	pred, err := ff.FeedForward(in)
+	if err != nil {
+		return 0, err
+	}
+	dev, err := mat.Sub(pred, exp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute deviation: %s", err.Error())
+	}
+	c := 0.0
+	for _, v := range dev.GetData() {
+		c += cost.Func(v)
+	}
+	return c, nil
+}
+
+//relativeErr returns |a-b|/max(|a|,|b|), or 0 if both are negligible
+func relativeErr(a, b float64) float64 {
+	d := math.Max(math.Abs(a), math.Abs(b))
+	if d < 1e-10 {
+		return 0
+	}
+	return math.Abs(a-b) / d
+}
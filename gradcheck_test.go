@@ -0,0 +1,101 @@
+package nn
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//mockRandFC returns a network with random weights and bias in [-1;1[
+func mockRandFC(seed int64, inSize int, configs []*LayerConfig) (*FC, error) {
+	f, err := NewFC(inSize)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.SetLayers(configs...); err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(seed))
+	for i, l := range f.layers {
+		data := make([]float64, l.dataSize())
+		for j := range data {
+			data[j] = 2*r.Float64() - 1
+		}
+		if err = f.SetLayerData(i, data); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func TestFCGradCheck(t *testing.T) {
+	activations := []struct {
+		ftype   string
+		fparams []float64
+	}{
+		{activation.FuncTypeIden, nil},
+		{activation.FuncTypeSigmoid, nil},
+		{activation.FuncTypeTanh, nil},
+		{activation.FuncTypeRelu, nil},
+		{activation.FuncTypeLeakyRelu, []float64{0.01}},
+		{activation.FuncTypeElu, []float64{1.0}},
+	}
+	costs := []struct {
+		name string
+		f    activation.F
+	}{
+		{"power(0.5,2)", activation.Power(0.5, 2)},
+		{"power(1,4)", activation.Power(1, 4)},
+		{"abs", activation.Abs()},
+	}
+	in := mat.NewM64(3, 1, []float64{0.3, -0.7, 0.5})
+	exp := mat.NewM64(2, 1, []float64{0.2, -0.4})
+	tol := 1e-4
+	for ia, a := range activations {
+		for ic, c := range costs {
+			name := fmt.Sprintf("%s/%s", a.ftype, c.name)
+			f, err := mockRandFC(int64(10*ia+ic), 3, []*LayerConfig{
+				{Size: 4, FuncType: a.ftype, FuncParams: a.fparams},
+				{Size: 3, FuncType: a.ftype, FuncParams: a.fparams},
+				{Size: 2, FuncType: a.ftype, FuncParams: a.fparams},
+			})
+			if err != nil {
+				t.Fatalf("%s: failed to build network: %s", name, err.Error())
+			}
+			checks, err := f.GradCheck(in, exp, c.f, 0)
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", name, err.Error())
+				continue
+			}
+			if len(checks) != 3 {
+				t.Errorf("%s: expected 3 layer reports received %d", name, len(checks))
+				continue
+			}
+			for _, g := range checks {
+				if g.MaxErr() > tol {
+					t.Errorf("%s: layer %d: relative error w=%g b=%g exceeds %g", name, g.Layer, g.WeightsErr, g.BiasErr, tol)
+				}
+			}
+		}
+	}
+}
+
+func TestRelativeErr(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		res  float64
+	}{
+		{0, 0, 0},
+		{1, 1, 0},
+		{2, 1, 0.5},
+		{-1, 1, 2},
+	}
+	for ind, test := range tests {
+		if res := relativeErr(test.a, test.b); res != test.res {
+			t.Errorf("test %d: expected %g received %g", ind, test.res, res)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+//initializers draw the initial value of a weight, fanIn and fanOut being the number of inputs and outputs of its neuron
+var initializers = map[string]func(r *rand.Rand, fanIn, fanOut int) float64{
+	"zeros": func(r *rand.Rand, fanIn, fanOut int) float64 { return 0 },
+	"ones":  func(r *rand.Rand, fanIn, fanOut int) float64 { return 1 },
+	//small values, usual for embeddings
+	"uniform": func(r *rand.Rand, fanIn, fanOut int) float64 { return 0.1*r.Float64() - 0.05 },
+	"normal":  func(r *rand.Rand, fanIn, fanOut int) float64 { return 0.05 * r.NormFloat64() },
+	//Glorot and Bengio, for tanh and sigmoid
+	"xavier": func(r *rand.Rand, fanIn, fanOut int) float64 {
+		return (2*r.Float64() - 1) * math.Sqrt(6/float64(fanIn+fanOut))
+	},
+	//He et al., for relu
+	"he": func(r *rand.Rand, fanIn, fanOut int) float64 { return r.NormFloat64() * math.Sqrt(2/float64(fanIn)) },
+	//LeCun, for selu
+	"lecun": func(r *rand.Rand, fanIn, fanOut int) float64 { return r.NormFloat64() * math.Sqrt(1/float64(fanIn)) },
+}
+
+//initializerNames returns the names of the initializers, for error messages
+func initializerNames() string {
+	names := make([]string, 0, len(initializers))
+	for name := range initializers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+//InitParams sets the weights of params with the named initializer: zeros, ones, uniform, normal, xavier, he or lecun. The colomns and rows of each weight matrix are the fan-in and fan-out of the initializer. Biases, shifts and scales keep their values
+func InitParams(params []*Param, name string, r rand.Source) error {
+	f, ok := initializers[name]
+	if !ok {
+		return fmt.Errorf("unknown initializer '%s', expected one of %s", name, initializerNames())
+	}
+	if r == nil {
+		return fmt.Errorf("random source r is nil")
+	}
+	rnd := rand.New(r)
+	for _, p := range params {
+		if p.bias || p.Value == nil {
+			continue
+		}
+		rows, c := p.Value.Dims()
+		data := make([]float64, rows*c)
+		for i := range data {
+			data[i] = f(rnd, c, rows)
+		}
+		p.Value.SetData(data)
+	}
+	return nil
+}
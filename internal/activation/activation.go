@@ -104,7 +104,8 @@ func tanh(x float64) float64 {
 
 //DerivTanh is Tanh's derivative
 func derivTanh(x float64) float64 {
-	return 1 - tanh(x)
+	t := tanh(x)
+	return 1 - t*t
 }
 
 //Elu returns an exponential linear unit with its derivative
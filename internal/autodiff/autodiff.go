@@ -0,0 +1,140 @@
+package autodiff
+
+import (
+	"fmt"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//Tape records operations on variables in order of execution, so that gradients can be propagated backward (reverse-mode automatic differentiation)
+type Tape struct {
+	nodes []*Var
+}
+
+//NewTape returns an empty tape
+func NewTape() *Tape {
+	return &Tape{}
+}
+
+//Var is a matrix value recorded on a tape. Grad holds the gradient of the differentiated output wrt Value once Backward has been called
+type Var struct {
+	Value     *mat.M64
+	Grad      *mat.M64
+	needsGrad bool
+	back      func() error //propagates Grad to the inputs of the operation
+}
+
+//NeedsGrad returns true if a gradient is computed for v
+func (v *Var) NeedsGrad() bool {
+	return v != nil && v.needsGrad
+}
+
+//Var records a leaf variable whose gradient will be computed
+func (t *Tape) Var(m *mat.M64) *Var {
+	return t.leaf(m, true)
+}
+
+//Const records a leaf variable whose gradient is not needed
+func (t *Tape) Const(m *mat.M64) *Var {
+	return t.leaf(m, false)
+}
+
+func (t *Tape) leaf(m *mat.M64, needsGrad bool) *Var {
+	v := &Var{Value: m, needsGrad: needsGrad}
+	t.nodes = append(t.nodes, v)
+	return v
+}
+
+//record adds the result of an operation on inputs to the tape. back is only kept if one of the inputs needs a gradient
+func (t *Tape) record(m *mat.M64, back func(v *Var) error, inputs ...*Var) *Var {
+	v := &Var{Value: m}
+	for _, in := range inputs {
+		if in.needsGrad {
+			v.needsGrad = true
+			break
+		}
+	}
+	if v.needsGrad {
+		v.back = func() error { return back(v) }
+	}
+	t.nodes = append(t.nodes, v)
+	return v
+}
+
+//Len returns the number of recorded variables
+func (t *Tape) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.nodes)
+}
+
+//Reset clears the tape
+func (t *Tape) Reset() {
+	t.nodes = nil
+}
+
+//ZeroGrad clears the gradients of all recorded variables
+func (t *Tape) ZeroGrad() {
+	for _, v := range t.nodes {
+		v.Grad = nil
+	}
+}
+
+//Backward propagates seed, the gradient of some cost wrt out, back to every recorded variable. If seed is nil, out must be a 1x1 matrix and the seed is 1. Gradients add up with the ones of previous calls until ZeroGrad is called
+func (t *Tape) Backward(out *Var, seed *mat.M64) error {
+	if t == nil {
+		return fmt.Errorf("tape is nil")
+	}
+	if out == nil {
+		return fmt.Errorf("output variable is nil")
+	}
+	if seed == nil {
+		if out.Value.Size() != 1 {
+			return fmt.Errorf("seed is required for a non scalar output")
+		}
+		seed = mat.NewM64(1, 1, []float64{1})
+	}
+	last := -1
+	for i, v := range t.nodes {
+		if v == out {
+			last = i
+		}
+	}
+	if last < 0 {
+		return fmt.Errorf("output variable is not recorded on this tape")
+	}
+	if !out.needsGrad {
+		return nil
+	}
+	if err := accumulate(out, seed); err != nil {
+		return fmt.Errorf("invalid seed: %s", err.Error())
+	}
+	for i := last; i >= 0; i-- {
+		v := t.nodes[i]
+		if v.back == nil || v.Grad == nil {
+			continue
+		}
+		if err := v.back(); err != nil {
+			return fmt.Errorf("node %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+//accumulate adds g to the gradient of v
+func accumulate(v *Var, g *mat.M64) error {
+	if !v.needsGrad {
+		return nil
+	}
+	r, c := v.Value.Dims()
+	gr, gc := g.Dims()
+	if r != gr || c != gc {
+		return fmt.Errorf("gradient has shape %dx%d, expected %dx%d", gr, gc, r, c)
+	}
+	if v.Grad == nil {
+		v.Grad = mat.NewM64(r, c, g.GetData())
+		return nil
+	}
+	return v.Grad.Add(g)
+}
@@ -0,0 +1,502 @@
+package autodiff
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//Axis along which matrices are concatenated
+type Axis int
+
+//axes
+const (
+	Rows Axis = iota //stack vertically
+	Cols             //stack horizontally
+)
+
+//Add returns a+b. If b is a column vector and a has several colomns, b is added to each colomn of a
+func (t *Tape) Add(a, b *Var) (*Var, error) {
+	ar, ac := a.Value.Dims()
+	br, bc := b.Value.Dims()
+	if bc == 1 && ac > 1 && br == ar {
+		return t.addCol(a, b)
+	}
+	res, err := mat.Add(a.Value, b.Value)
+	if err != nil {
+		return nil, fmt.Errorf("add: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		if err := accumulate(a, v.Grad); err != nil {
+			return err
+		}
+		return accumulate(b, v.Grad)
+	}, a, b), nil
+}
+
+//addCol adds column vector b to each colomn of a
+func (t *Tape) addCol(a, b *Var) (*Var, error) {
+	r, c := a.Value.Dims()
+	res := mat.NewM64(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			res.Set(i, j, a.Value.At(i, j)+b.Value.At(i, 0))
+		}
+	}
+	return t.record(res, func(v *Var) error {
+		if err := accumulate(a, v.Grad); err != nil {
+			return err
+		}
+		return accumulate(b, sumCols(v.Grad))
+	}, a, b), nil
+}
+
+//Sub returns a-b
+func (t *Tape) Sub(a, b *Var) (*Var, error) {
+	res, err := mat.Sub(a.Value, b.Value)
+	if err != nil {
+		return nil, fmt.Errorf("sub: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		if err := accumulate(a, v.Grad); err != nil {
+			return err
+		}
+		return accumulate(b, scale(v.Grad, -1))
+	}, a, b), nil
+}
+
+//Mul returns the element wise product of a and b
+func (t *Tape) Mul(a, b *Var) (*Var, error) {
+	res, err := mat.MulElem(a.Value, b.Value)
+	if err != nil {
+		return nil, fmt.Errorf("mul: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		ga, err := mat.MulElem(v.Grad, b.Value)
+		if err != nil {
+			return err
+		}
+		if err = accumulate(a, ga); err != nil {
+			return err
+		}
+		gb, err := mat.MulElem(v.Grad, a.Value)
+		if err != nil {
+			return err
+		}
+		return accumulate(b, gb)
+	}, a, b), nil
+}
+
+//Scale returns k*a
+func (t *Tape) Scale(a *Var, k float64) (*Var, error) {
+	return t.record(scale(a.Value, k), func(v *Var) error {
+		return accumulate(a, scale(v.Grad, k))
+	}, a), nil
+}
+
+//MatMul returns the matrix product a*b
+func (t *Tape) MatMul(a, b *Var) (*Var, error) {
+	res, err := mat.Mul(a.Value, b.Value)
+	if err != nil {
+		return nil, fmt.Errorf("matmul: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		if a.needsGrad {
+			bt, err := mat.Transpose(b.Value)
+			if err != nil {
+				return err
+			}
+			ga, err := mat.Mul(v.Grad, bt)
+			if err != nil {
+				return err
+			}
+			if err = accumulate(a, ga); err != nil {
+				return err
+			}
+		}
+		if b.needsGrad {
+			at, err := mat.Transpose(a.Value)
+			if err != nil {
+				return err
+			}
+			gb, err := mat.Mul(at, v.Grad)
+			if err != nil {
+				return err
+			}
+			return accumulate(b, gb)
+		}
+		return nil
+	}, a, b), nil
+}
+
+//Transpose returns the transpose of a
+func (t *Tape) Transpose(a *Var) (*Var, error) {
+	res, err := mat.Transpose(a.Value)
+	if err != nil {
+		return nil, fmt.Errorf("transpose: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		g, err := mat.Transpose(v.Grad)
+		if err != nil {
+			return err
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//Map applies f.Func to each element of a, f.Deriv being used for backpropagation
+func (t *Tape) Map(a *Var, f activation.F) (*Var, error) {
+	if f.Func == nil || f.Deriv == nil {
+		return nil, fmt.Errorf("map: function or derivative is nil")
+	}
+	res, err := mat.MapElem(a.Value, f.Func)
+	if err != nil {
+		return nil, fmt.Errorf("map: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		d, err := mat.MapElem(a.Value, f.Deriv)
+		if err != nil {
+			return err
+		}
+		if err = d.MulElem(v.Grad); err != nil {
+			return err
+		}
+		return accumulate(a, d)
+	}, a), nil
+}
+
+//Exp returns e^a element wise
+func (t *Tape) Exp(a *Var) (*Var, error) {
+	res, err := mat.MapElem(a.Value, math.Exp)
+	if err != nil {
+		return nil, fmt.Errorf("exp: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		g, err := mat.MulElem(v.Grad, v.Value)
+		if err != nil {
+			return err
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//Log returns the natural logarithm of a element wise
+func (t *Tape) Log(a *Var) (*Var, error) {
+	res, err := mat.MapElem(a.Value, math.Log)
+	if err != nil {
+		return nil, fmt.Errorf("log: %s", err.Error())
+	}
+	return t.record(res, func(v *Var) error {
+		r, c := a.Value.Dims()
+		g := mat.NewM64(r, c, nil)
+		for i := 0; i < r; i++ {
+			for j := 0; j < c; j++ {
+				g.Set(i, j, v.Grad.At(i, j)/a.Value.At(i, j))
+			}
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//Sum returns the sum of all elements of a as a 1x1 matrix
+func (t *Tape) Sum(a *Var) (*Var, error) {
+	s := 0.0
+	for _, x := range a.Value.GetData() {
+		s += x
+	}
+	return t.record(mat.NewM64(1, 1, []float64{s}), func(v *Var) error {
+		r, c := a.Value.Dims()
+		return accumulate(a, fill(r, c, v.Grad.AtInd(0)))
+	}, a), nil
+}
+
+//Mean returns the average of all elements of a as a 1x1 matrix
+func (t *Tape) Mean(a *Var) (*Var, error) {
+	s, err := t.Sum(a)
+	if err != nil {
+		return nil, err
+	}
+	return t.Scale(s, 1/float64(a.Value.Size()))
+}
+
+//Softmax normalizes each colomn of a: exp(a_ij)/sum_k(exp(a_kj))
+func (t *Tape) Softmax(a *Var) (*Var, error) {
+	r, c := a.Value.Dims()
+	res := mat.NewM64(r, c, nil)
+	for j := 0; j < c; j++ {
+		max := math.Inf(-1)
+		for i := 0; i < r; i++ {
+			max = math.Max(max, a.Value.At(i, j))
+		}
+		s := 0.0
+		for i := 0; i < r; i++ {
+			e := math.Exp(a.Value.At(i, j) - max)
+			res.Set(i, j, e)
+			s += e
+		}
+		for i := 0; i < r; i++ {
+			res.Set(i, j, res.At(i, j)/s)
+		}
+	}
+	return t.record(res, func(v *Var) error {
+		g := mat.NewM64(r, c, nil)
+		for j := 0; j < c; j++ {
+			dot := 0.0
+			for i := 0; i < r; i++ {
+				dot += v.Grad.At(i, j) * v.Value.At(i, j)
+			}
+			for i := 0; i < r; i++ {
+				g.Set(i, j, v.Value.At(i, j)*(v.Grad.At(i, j)-dot))
+			}
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//Concat stacks vars along axis. All vars must have the same number of colomns (Rows) or rows (Cols)
+func (t *Tape) Concat(axis Axis, vars ...*Var) (*Var, error) {
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("concat: no variables")
+	}
+	r, c := vars[0].Value.Dims()
+	for i, v := range vars[1:] {
+		vr, vc := v.Value.Dims()
+		switch axis {
+		case Rows:
+			if vc != c {
+				return nil, fmt.Errorf("concat: vars[%d] has %d colomns, expected %d", i+1, vc, c)
+			}
+			r += vr
+		case Cols:
+			if vr != r {
+				return nil, fmt.Errorf("concat: vars[%d] has %d rows, expected %d", i+1, vr, r)
+			}
+			c += vc
+		default:
+			return nil, fmt.Errorf("concat: invalid axis %d", axis)
+		}
+	}
+	res := mat.NewM64(r, c, nil)
+	offsets := make([]int, len(vars))
+	off := 0
+	for k, v := range vars {
+		offsets[k] = off
+		vr, vc := v.Value.Dims()
+		for i := 0; i < vr; i++ {
+			for j := 0; j < vc; j++ {
+				if axis == Rows {
+					res.Set(off+i, j, v.Value.At(i, j))
+				} else {
+					res.Set(i, off+j, v.Value.At(i, j))
+				}
+			}
+		}
+		if axis == Rows {
+			off += vr
+		} else {
+			off += vc
+		}
+	}
+	return t.record(res, func(v *Var) error {
+		for k, in := range vars {
+			if !in.needsGrad {
+				continue
+			}
+			vr, vc := in.Value.Dims()
+			var g *mat.M64
+			if axis == Rows {
+				g = slice(v.Grad, offsets[k], offsets[k]+vr, 0, vc)
+			} else {
+				g = slice(v.Grad, 0, vr, offsets[k], offsets[k]+vc)
+			}
+			if err := accumulate(in, g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, vars...), nil
+}
+
+//Slice returns rows [r0;r1[ and colomns [c0;c1[ of a
+func (t *Tape) Slice(a *Var, r0, r1, c0, c1 int) (*Var, error) {
+	r, c := a.Value.Dims()
+	if r0 < 0 || r1 > r || r0 >= r1 {
+		return nil, fmt.Errorf("slice: invalid row range [%d;%d[ for %d rows", r0, r1, r)
+	}
+	if c0 < 0 || c1 > c || c0 >= c1 {
+		return nil, fmt.Errorf("slice: invalid colomn range [%d;%d[ for %d colomns", c0, c1, c)
+	}
+	return t.record(slice(a.Value, r0, r1, c0, c1), func(v *Var) error {
+		g := mat.NewM64(r, c, nil)
+		for i := r0; i < r1; i++ {
+			for j := c0; j < c1; j++ {
+				g.Set(i, j, v.Grad.At(i-r0, j-c0))
+			}
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//slice copies rows [r0;r1[ and colomns [c0;c1[ of m
+func slice(m *mat.M64, r0, r1, c0, c1 int) *mat.M64 {
+	res := mat.NewM64(r1-r0, c1-c0, nil)
+	for i := r0; i < r1; i++ {
+		for j := c0; j < c1; j++ {
+			res.Set(i-r0, j-c0, m.At(i, j))
+		}
+	}
+	return res
+}
+
+//scale returns k*m
+func scale(m *mat.M64, k float64) *mat.M64 {
+	r, c := m.Dims()
+	res := mat.NewM64(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			res.Set(i, j, k*m.At(i, j))
+		}
+	}
+	return res
+}
+
+//fill returns a rxc matrix filled with val
+func fill(r, c int, val float64) *mat.M64 {
+	data := make([]float64, r*c)
+	for i := range data {
+		data[i] = val
+	}
+	return mat.NewM64(r, c, data)
+}
+
+//sumCols returns the column vector of the sums of each row of m
+func sumCols(m *mat.M64) *mat.M64 {
+	r, c := m.Dims()
+	res := mat.NewM64(r, 1, nil)
+	for i := 0; i < r; i++ {
+		s := 0.0
+		for j := 0; j < c; j++ {
+			s += m.At(i, j)
+		}
+		res.Set(i, 0, s)
+	}
+	return res
+}
+
+//Gather returns a rxc matrix whose element (i,j) is the element of a at flat (row major) index idx[i*c+j], or fill if this index is <0
+func (t *Tape) Gather(a *Var, r, c int, idx []int, fill float64) (*Var, error) {
+	if len(idx) != r*c {
+		return nil, fmt.Errorf("gather: expected %d indices received %d", r*c, len(idx))
+	}
+	data := a.Value.GetData()
+	res := make([]float64, r*c)
+	for k, ind := range idx {
+		if ind >= len(data) {
+			return nil, fmt.Errorf("gather: index %d out of range [0;%d[", ind, len(data))
+		}
+		if ind < 0 {
+			res[k] = fill
+			continue
+		}
+		res[k] = data[ind]
+	}
+	return t.record(mat.NewM64(r, c, res), func(v *Var) error {
+		ar, ac := a.Value.Dims()
+		g := make([]float64, ar*ac)
+		grad := v.Grad.GetData()
+		for k, ind := range idx {
+			if ind >= 0 {
+				g[ind] += grad[k]
+			}
+		}
+		return accumulate(a, mat.NewM64(ar, ac, g))
+	}, a), nil
+}
+
+//Max returns the 1xc matrix of the maximum of each colomn of a
+func (t *Tape) Max(a *Var) (*Var, error) {
+	r, c := a.Value.Dims()
+	res := mat.NewM64(1, c, nil)
+	arg := make([]int, c)
+	for j := 0; j < c; j++ {
+		max := a.Value.At(0, j)
+		for i := 1; i < r; i++ {
+			if x := a.Value.At(i, j); x > max {
+				max, arg[j] = x, i
+			}
+		}
+		res.Set(0, j, max)
+	}
+	return t.record(res, func(v *Var) error {
+		g := mat.NewM64(r, c, nil)
+		for j := 0; j < c; j++ {
+			g.Set(arg[j], j, v.Grad.At(0, j))
+		}
+		return accumulate(a, g)
+	}, a), nil
+}
+
+//Reshape returns a rxc matrix with the elements of a in the same (row major) order
+func (t *Tape) Reshape(a *Var, r, c int) (*Var, error) {
+	ar, ac := a.Value.Dims()
+	if r*c != ar*ac || r <= 0 || c <= 0 {
+		return nil, fmt.Errorf("reshape: can not reshape %dx%d into %dx%d", ar, ac, r, c)
+	}
+	return t.record(mat.NewM64(r, c, flatten(a.Value)), func(v *Var) error {
+		return accumulate(a, mat.NewM64(ar, ac, flatten(v.Grad)))
+	}, a), nil
+}
+
+//flatten returns the elements of m in row major order
+func flatten(m *mat.M64) []float64 {
+	r, c := m.Dims()
+	data := make([]float64, 0, r*c)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			data = append(data, m.At(i, j))
+		}
+	}
+	return data
+}
+
+//maskValue replaces the scores of masked keys: their softmax weights are 0
+const maskValue = -1e9
+
+//Attention returns the scaled dot-product attention of queries q over keys k and values v, with one colomn per position: v*softmax(k'q/sqrt(d)), d being the number of rows of q and k. Colomn j of the output is the average of the values weighted by the scores of query j against each key. If causal, query j only attends to keys 0 to j
+func (t *Tape) Attention(q, k, v *Var, causal bool) (*Var, error) {
+	d, _ := q.Value.Dims()
+	kt, err := t.Transpose(k)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := t.MatMul(kt, q)
+	if err != nil {
+		return nil, fmt.Errorf("attention: queries and keys: %s", err.Error())
+	}
+	if scores, err = t.Scale(scores, 1/math.Sqrt(float64(d))); err != nil {
+		return nil, err
+	}
+	if causal {
+		r, c := scores.Value.Dims()
+		mask := mat.NewM64(r, c, nil)
+		for i := 0; i < r; i++ {
+			for j := 0; j < c && j < i; j++ {
+				mask.Set(i, j, maskValue)
+			}
+		}
+		if scores, err = t.Add(scores, t.Const(mask)); err != nil {
+			return nil, err
+		}
+	}
+	weights, err := t.Softmax(scores)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.MatMul(v, weights)
+	if err != nil {
+		return nil, fmt.Errorf("attention: values: %s", err.Error())
+	}
+	return res, nil
+}
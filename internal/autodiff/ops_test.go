@@ -0,0 +1,201 @@
+package autodiff
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+type op func(t *Tape, in []*Var) (*Var, error)
+
+//randM64 returns a rxc matrix of values in [lo;hi[
+func randM64(r *rand.Rand, rows, cols int, lo, hi float64) *mat.M64 {
+	data := make([]float64, rows*cols)
+	for i := range data {
+		data[i] = lo + (hi-lo)*r.Float64()
+	}
+	return mat.NewM64(rows, cols, data)
+}
+
+//eval returns sum(f(in)*weights) and the recorded inputs
+func eval(f op, inputs []*mat.M64, weights *mat.M64, backward bool) (float64, []*Var, error) {
+	t := NewTape()
+	vars := make([]*Var, len(inputs))
+	for i, m := range inputs {
+		vars[i] = t.Var(m)
+	}
+	out, err := f(t, vars)
+	if err != nil {
+		return 0, nil, err
+	}
+	w := t.Const(weights)
+	prod, err := t.Mul(out, w)
+	if err != nil {
+		return 0, nil, err
+	}
+	s, err := t.Sum(prod)
+	if err != nil {
+		return 0, nil, err
+	}
+	if backward {
+		if err = t.Backward(s, nil); err != nil {
+			return 0, nil, err
+		}
+	}
+	return s.Value.AtInd(0), vars, nil
+}
+
+//checkOp compares the gradients of f wrt each input against central finite differences
+func checkOp(f op, inputs []*mat.M64, outR, outC int, seed int64) error {
+	r := rand.New(rand.NewSource(seed))
+	weights := randM64(r, outR, outC, -1, 1)
+	_, vars, err := eval(f, inputs, weights, true)
+	if err != nil {
+		return err
+	}
+	eps := 1e-6
+	for k, m := range inputs {
+		rows, cols := m.Dims()
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				v := m.At(i, j)
+				m.Set(i, j, v+eps)
+				plus, _, err := eval(f, inputs, weights, false)
+				if err != nil {
+					return err
+				}
+				m.Set(i, j, v-eps)
+				minus, _, err := eval(f, inputs, weights, false)
+				if err != nil {
+					return err
+				}
+				m.Set(i, j, v)
+				num := (plus - minus) / (2 * eps)
+				ana := 0.0
+				if vars[k].Grad != nil {
+					ana = vars[k].Grad.At(i, j)
+				}
+				if math.Abs(num-ana) > 1e-5*math.Max(1, math.Abs(num)) {
+					return fmt.Errorf("input %d (%d,%d): analytic gradient %g, numerical gradient %g", k, i, j, ana, num)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestOpsGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	tests := []struct {
+		name   string
+		f      op
+		inputs []*mat.M64
+		outR   int
+		outC   int
+	}{
+		{"add", func(t *Tape, in []*Var) (*Var, error) { return t.Add(in[0], in[1]) }, []*mat.M64{randM64(r, 3, 2, -1, 1), randM64(r, 3, 2, -1, 1)}, 3, 2},
+		{"add broadcast", func(t *Tape, in []*Var) (*Var, error) { return t.Add(in[0], in[1]) }, []*mat.M64{randM64(r, 3, 4, -1, 1), randM64(r, 3, 1, -1, 1)}, 3, 4},
+		{"sub", func(t *Tape, in []*Var) (*Var, error) { return t.Sub(in[0], in[1]) }, []*mat.M64{randM64(r, 2, 2, -1, 1), randM64(r, 2, 2, -1, 1)}, 2, 2},
+		{"mul", func(t *Tape, in []*Var) (*Var, error) { return t.Mul(in[0], in[1]) }, []*mat.M64{randM64(r, 2, 3, -1, 1), randM64(r, 2, 3, -1, 1)}, 2, 3},
+		{"scale", func(t *Tape, in []*Var) (*Var, error) { return t.Scale(in[0], -3) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 2, 3},
+		{"matmul", func(t *Tape, in []*Var) (*Var, error) { return t.MatMul(in[0], in[1]) }, []*mat.M64{randM64(r, 2, 3, -1, 1), randM64(r, 3, 4, -1, 1)}, 2, 4},
+		{"transpose", func(t *Tape, in []*Var) (*Var, error) { return t.Transpose(in[0]) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 3, 2},
+		{"map sigmoid", func(t *Tape, in []*Var) (*Var, error) { return t.Map(in[0], activation.Sigmoid()) }, []*mat.M64{randM64(r, 3, 1, -2, 2)}, 3, 1},
+		{"map tanh", func(t *Tape, in []*Var) (*Var, error) { return t.Map(in[0], activation.Tanh()) }, []*mat.M64{randM64(r, 3, 1, -2, 2)}, 3, 1},
+		{"exp", func(t *Tape, in []*Var) (*Var, error) { return t.Exp(in[0]) }, []*mat.M64{randM64(r, 2, 2, -1, 1)}, 2, 2},
+		{"log", func(t *Tape, in []*Var) (*Var, error) { return t.Log(in[0]) }, []*mat.M64{randM64(r, 2, 2, 0.5, 2)}, 2, 2},
+		{"sum", func(t *Tape, in []*Var) (*Var, error) { return t.Sum(in[0]) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 1, 1},
+		{"mean", func(t *Tape, in []*Var) (*Var, error) { return t.Mean(in[0]) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 1, 1},
+		{"softmax", func(t *Tape, in []*Var) (*Var, error) { return t.Softmax(in[0]) }, []*mat.M64{randM64(r, 4, 2, -2, 2)}, 4, 2},
+		{"concat rows", func(t *Tape, in []*Var) (*Var, error) { return t.Concat(Rows, in[0], in[1]) }, []*mat.M64{randM64(r, 2, 2, -1, 1), randM64(r, 3, 2, -1, 1)}, 5, 2},
+		{"concat cols", func(t *Tape, in []*Var) (*Var, error) { return t.Concat(Cols, in[0], in[1]) }, []*mat.M64{randM64(r, 2, 1, -1, 1), randM64(r, 2, 3, -1, 1)}, 2, 4},
+		{"slice", func(t *Tape, in []*Var) (*Var, error) { return t.Slice(in[0], 1, 3, 0, 2) }, []*mat.M64{randM64(r, 4, 3, -1, 1)}, 2, 2},
+		{"gather", func(t *Tape, in []*Var) (*Var, error) { return t.Gather(in[0], 2, 3, []int{0, 5, -1, 5, 2, 1}, 0) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 2, 3},
+		{"max", func(t *Tape, in []*Var) (*Var, error) { return t.Max(in[0]) }, []*mat.M64{randM64(r, 3, 4, -1, 1)}, 1, 4},
+		{"reshape", func(t *Tape, in []*Var) (*Var, error) { return t.Reshape(in[0], 6, 1) }, []*mat.M64{randM64(r, 2, 3, -1, 1)}, 6, 1},
+		{"attention", func(t *Tape, in []*Var) (*Var, error) { return t.Attention(in[0], in[1], in[2], false) }, []*mat.M64{randM64(r, 2, 3, -1, 1), randM64(r, 2, 4, -1, 1), randM64(r, 3, 4, -1, 1)}, 3, 3},
+		{"causal attention", func(t *Tape, in []*Var) (*Var, error) { return t.Attention(in[0], in[1], in[2], true) }, []*mat.M64{randM64(r, 2, 3, -1, 1), randM64(r, 2, 3, -1, 1), randM64(r, 2, 3, -1, 1)}, 2, 3},
+		{"composite", func(t *Tape, in []*Var) (*Var, error) {
+			z, err := t.MatMul(in[0], in[1])
+			if err != nil {
+				return nil, err
+			}
+			z, err = t.Add(z, in[2])
+			if err != nil {
+				return nil, err
+			}
+			z, err = t.Map(z, activation.Tanh())
+			if err != nil {
+				return nil, err
+			}
+			//reuse of an input
+			return t.Mul(z, z)
+		}, []*mat.M64{randM64(r, 3, 2, -1, 1), randM64(r, 2, 1, -1, 1), randM64(r, 3, 1, -1, 1)}, 3, 1},
+	}
+	for ind, test := range tests {
+		if err := checkOp(test.f, test.inputs, test.outR, test.outC, int64(ind)); err != nil {
+			t.Errorf("test %d (%s): %s", ind, test.name, err.Error())
+		}
+	}
+}
+
+func TestBackwardErrors(t *testing.T) {
+	te := tester.NewT(t)
+	tape := NewTape()
+	other := NewTape()
+	v := tape.Var(mat.NewM64(2, 1, nil))
+	s, _ := tape.Sum(v)
+	tests := []struct {
+		t    *Tape
+		out  *Var
+		seed *mat.M64
+		err  error
+	}{
+		{t: nil, out: v, err: fmt.Errorf("tape is nil")},
+		{t: tape, out: nil, err: fmt.Errorf("output variable is nil")},
+		{t: tape, out: v, seed: nil, err: fmt.Errorf("seed is required for a non scalar output")},
+		{t: other, out: s, seed: nil, err: fmt.Errorf("output variable is not recorded on this tape")},
+		{t: tape, out: v, seed: mat.NewM64(3, 1, nil), err: fmt.Errorf("invalid seed: gradient has shape 3x1, expected 2x1")},
+		{t: tape, out: s, seed: nil, err: nil},
+	}
+	for ind, test := range tests {
+		te.CheckError(ind, test.err, test.t.Backward(test.out, test.seed))
+	}
+}
+
+func TestCausalAttention(t *testing.T) {
+	te := tester.NewT(t)
+	tape := NewTape()
+	q := tape.Var(mat.NewM64(1, 3, []float64{1, 2, 3}))
+	k := tape.Var(mat.NewM64(1, 3, []float64{3, 2, 1}))
+	v := tape.Var(mat.NewM64(1, 3, []float64{10, 20, 30}))
+	res, err := tape.Attention(q, k, v, true)
+	te.CheckError(0, nil, err)
+	//the first query only sees the first value
+	te.DeepEqual(0, "first output", 10.0, res.Value.At(0, 0))
+	//the second query weights the first 2 values by softmax(6,4)
+	w := 1 / (1 + math.Exp(-2))
+	if math.Abs(res.Value.At(0, 1)-(10*w+20*(1-w))) > 1e-9 {
+		t.Errorf("expected %f received %f", 10*w+20*(1-w), res.Value.At(0, 1))
+	}
+}
+
+func TestConst(t *testing.T) {
+	tape := NewTape()
+	c := tape.Const(mat.NewM64(2, 1, []float64{1, 2}))
+	v := tape.Var(mat.NewM64(2, 1, []float64{3, 4}))
+	p, _ := tape.Mul(c, v)
+	s, _ := tape.Sum(p)
+	if err := tape.Backward(s, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if c.Grad != nil {
+		t.Errorf("expected no gradient for a constant, received %v", c.Grad.GetData())
+	}
+	tester.NewT(t).DeepEqual(0, "grad", []float64{1, 2}, v.Grad.GetData())
+}
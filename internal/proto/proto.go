@@ -0,0 +1,174 @@
+//Package proto encodes and decodes the protocol buffers wire format, for the few messages read and written by the package nn such as ONNX models
+package proto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+//wire types of the fields
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+//Encoder appends fields to a message
+type Encoder struct {
+	buf []byte
+}
+
+//Bytes returns the encoded message
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+//Int appends an integer field: int32, int64 or enum. Negative values take 10 bytes, as with int64 fields
+func (e *Encoder) Int(field int, v int64) {
+	e.tag(field, WireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+//Raw appends a length delimited field
+func (e *Encoder) Raw(field int, b []byte) {
+	e.tag(field, WireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+//String appends a string field
+func (e *Encoder) String(field int, s string) {
+	e.Raw(field, []byte(s))
+}
+
+//Message appends an embedded message
+func (e *Encoder) Message(field int, m *Encoder) {
+	e.Raw(field, m.buf)
+}
+
+//Float appends a float field
+func (e *Encoder) Float(field int, v float32) {
+	e.tag(field, WireFixed32)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(v))
+}
+
+//Field is a decoded field
+type Field struct {
+	Num   int
+	Wire  int
+	Value uint64 //value of varint, fixed32 and fixed64 fields
+	Bytes []byte //value of length delimited fields
+}
+
+//Int returns the value of an integer field
+func (f Field) Int() int64 {
+	return int64(f.Value)
+}
+
+//Float returns the value of a float field
+func (f Field) Float() float32 {
+	return math.Float32frombits(uint32(f.Value))
+}
+
+//Double returns the value of a double field
+func (f Field) Double() float64 {
+	return math.Float64frombits(f.Value)
+}
+
+//Decode returns the fields of a message, in order
+func Decode(b []byte) ([]Field, error) {
+	var fields []Field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid tag")
+		}
+		b = b[n:]
+		f := Field{Num: int(tag >> 3), Wire: int(tag & 7)}
+		if f.Num <= 0 {
+			return nil, fmt.Errorf("invalid field number %d", f.Num)
+		}
+		switch f.Wire {
+		case WireVarint:
+			if f.Value, n = binary.Uvarint(b); n <= 0 {
+				return nil, fmt.Errorf("field %d: invalid varint", f.Num)
+			}
+		case WireFixed64:
+			if n = 8; len(b) < n {
+				return nil, fmt.Errorf("field %d: truncated fixed64", f.Num)
+			}
+			f.Value = binary.LittleEndian.Uint64(b)
+		case WireFixed32:
+			if n = 4; len(b) < n {
+				return nil, fmt.Errorf("field %d: truncated fixed32", f.Num)
+			}
+			f.Value = uint64(binary.LittleEndian.Uint32(b))
+		case WireBytes:
+			l, k := binary.Uvarint(b)
+			if k <= 0 {
+				return nil, fmt.Errorf("field %d: invalid length", f.Num)
+			}
+			if l > uint64(len(b)-k) {
+				return nil, fmt.Errorf("field %d: length %d exceeds the message", f.Num, l)
+			}
+			f.Bytes, n = b[k:k+int(l)], k+int(l)
+		default:
+			return nil, fmt.Errorf("field %d: unsupported wire type %d", f.Num, f.Wire)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+//Ints appends to vs the values of a repeated integer field f, packed or not
+func Ints(vs []int64, f Field) ([]int64, error) {
+	if f.Wire == WireVarint {
+		return append(vs, f.Int()), nil
+	}
+	if f.Wire != WireBytes {
+		return nil, fmt.Errorf("field %d: wire type %d is not an integer", f.Num, f.Wire)
+	}
+	for b := f.Bytes; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("field %d: invalid varint", f.Num)
+		}
+		vs, b = append(vs, int64(v)), b[n:]
+	}
+	return vs, nil
+}
+
+//Floats appends to vs the values of a repeated float field f, packed or not
+func Floats(vs []float32, f Field) ([]float32, error) {
+	if f.Wire == WireFixed32 {
+		return append(vs, f.Float()), nil
+	}
+	if f.Wire != WireBytes || len(f.Bytes)%4 != 0 {
+		return nil, fmt.Errorf("field %d: invalid packed floats", f.Num)
+	}
+	for b := f.Bytes; len(b) > 0; b = b[4:] {
+		vs = append(vs, math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return vs, nil
+}
+
+//Doubles appends to vs the values of a repeated double field f, packed or not
+func Doubles(vs []float64, f Field) ([]float64, error) {
+	if f.Wire == WireFixed64 {
+		return append(vs, f.Double()), nil
+	}
+	if f.Wire != WireBytes || len(f.Bytes)%8 != 0 {
+		return nil, fmt.Errorf("field %d: invalid packed doubles", f.Num)
+	}
+	for b := f.Bytes; len(b) > 0; b = b[8:] {
+		vs = append(vs, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+	return vs, nil
+}
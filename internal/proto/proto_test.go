@@ -0,0 +1,80 @@
+package proto
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/klahssen/tester"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	te := tester.NewT(t)
+	sub := &Encoder{}
+	sub.Int(1, 300)
+	e := &Encoder{}
+	e.Int(1, 150)
+	e.Int(2, -1)
+	e.String(3, "abc")
+	e.Float(4, 1.5)
+	e.Message(5, sub)
+	e.Raw(300, nil)
+	//the example of the protocol buffers documentation: field 1 of value 150
+	te.DeepEqual(0, "varint", []byte{0x08, 0x96, 0x01}, e.Bytes()[:3])
+	fields, err := Decode(e.Bytes())
+	te.CheckError(0, nil, err)
+	if len(fields) != 6 {
+		t.Fatalf("expected 6 fields received %d", len(fields))
+	}
+	te.DeepEqual(1, "int", int64(150), fields[0].Int())
+	te.DeepEqual(2, "negative int", int64(-1), fields[1].Int())
+	te.DeepEqual(3, "string", "abc", string(fields[2].Bytes))
+	te.DeepEqual(4, "float", float32(1.5), fields[3].Float())
+	nested, err := Decode(fields[4].Bytes)
+	te.CheckError(5, nil, err)
+	te.DeepEqual(5, "nested", int64(300), nested[0].Int())
+	te.DeepEqual(6, "empty bytes", []int{300, WireBytes, 0}, []int{fields[5].Num, fields[5].Wire, len(fields[5].Bytes)})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{0x80}, fmt.Errorf("invalid tag")},
+		{[]byte{0x00}, fmt.Errorf("invalid field number 0")},
+		{[]byte{0x08, 0x80}, fmt.Errorf("field 1: invalid varint")},
+		{[]byte{0x0D, 0x00, 0x00}, fmt.Errorf("field 1: truncated fixed32")},
+		{[]byte{0x09, 0x00}, fmt.Errorf("field 1: truncated fixed64")},
+		{[]byte{0x0A, 0x05, 0x00}, fmt.Errorf("field 1: length 5 exceeds the message")},
+		{[]byte{0x0B}, fmt.Errorf("field 1: unsupported wire type 3")},
+	}
+	for ind, test := range tests {
+		_, err := Decode(test.data)
+		te.CheckError(ind, test.err, err)
+	}
+}
+
+func TestRepeated(t *testing.T) {
+	te := tester.NewT(t)
+	//packed
+	ints, err := Ints(nil, Field{Num: 1, Wire: WireBytes, Bytes: []byte{0x03, 0x8E, 0x02}})
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "packed ints", []int64{3, 270}, ints)
+	//unpacked values are appended
+	ints, err = Ints(ints, Field{Num: 1, Wire: WireVarint, Value: 7})
+	te.CheckError(1, nil, err)
+	te.DeepEqual(1, "ints", []int64{3, 270, 7}, ints)
+	_, err = Ints(nil, Field{Num: 1, Wire: WireFixed32})
+	te.CheckError(2, fmt.Errorf("field 1: wire type 5 is not an integer"), err)
+
+	floats, err := Floats(nil, Field{Num: 4, Wire: WireBytes, Bytes: []byte{0, 0, 0xC0, 0x3F, 0, 0, 0x80, 0xBF}})
+	te.CheckError(3, nil, err)
+	te.DeepEqual(3, "packed floats", []float32{1.5, -1}, floats)
+	_, err = Floats(nil, Field{Num: 4, Wire: WireBytes, Bytes: []byte{0, 0, 0}})
+	te.CheckError(4, fmt.Errorf("field 4: invalid packed floats"), err)
+
+	doubles, err := Doubles(nil, Field{Num: 10, Wire: WireFixed64, Value: 0x3FF8000000000000})
+	te.CheckError(5, nil, err)
+	te.DeepEqual(5, "double", []float64{1.5}, doubles)
+}
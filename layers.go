@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
 
 	mat "github.com/klahssen/go-mat"
 )
@@ -11,14 +12,67 @@ import (
 //ActivationFunc signature
 //type ActivationFunc func(x float64) float64
 
-//LayerConfig holds info to define a new layer
+//layer types
+const (
+	LayerTypeDense         = "dense"
+	LayerTypeActivation    = "activation"
+	LayerTypeAdd           = "add"
+	LayerTypeMul           = "mul"
+	LayerTypeConcat        = "concat"
+	LayerTypeConv1D        = "conv1d"
+	LayerTypeConv2D        = "conv2d"
+	LayerTypeMaxPool1D     = "maxpool1d"
+	LayerTypeAvgPool1D     = "avgpool1d"
+	LayerTypeMaxPool2D     = "maxpool2d"
+	LayerTypeAvgPool2D     = "avgpool2d"
+	LayerTypeGlobalMaxPool = "globalmaxpool"
+	LayerTypeGlobalAvgPool = "globalavgpool"
+	LayerTypeFlatten       = "flatten"
+	LayerTypeRNN           = "rnn"
+	LayerTypeLSTM          = "lstm"
+	LayerTypeGRU           = "gru"
+	LayerTypeBatchNorm     = "batchnorm"
+	LayerTypeLayerNorm     = "layernorm"
+	LayerTypeEmbedding     = "embedding"
+	LayerTypeAttention     = "attention"
+	LayerTypePositional    = "positional"
+	LayerTypeTransformer   = "transformer"
+)
+
+//LayerConfig holds info to define a new layer. Type defaults to LayerTypeDense. Size is the number of neurons, or of filters for convolutions. Kernel, Stride and Dilation have 1 value per dimension for convolution and pooling layers
 type LayerConfig struct {
 	//InSize  int
-	KeepState  bool
-	Size       int
-	FuncType   string
-	FuncParams []float64
-	F          activation.F
+	Type       string       `json:"type,omitempty"`
+	KeepState  bool         `json:"keep_state,omitempty"`
+	Size       int          `json:"size,omitempty"`
+	FuncType   string       `json:"ftype,omitempty"`
+	FuncParams []float64    `json:"fparams,omitempty"`
+	F          activation.F `json:"-"`
+	Kernel     []int        `json:"kernel,omitempty"`
+	Stride     []int        `json:"stride,omitempty"`
+	Dilation   []int        `json:"dilation,omitempty"`
+	Padding    string       `json:"padding,omitempty"`
+	//recurrent layers
+	ReturnSequences bool `json:"return_sequences,omitempty"` //output the hidden state of every timestep instead of the last one
+	Stateful        bool `json:"stateful,omitempty"`         //start each sequence from the final state of the previous one, until the states are reset
+	Truncate        int  `json:"truncate,omitempty"`         //truncated backpropagation through time: the sequence is split in chunks of Truncate timesteps and gradients do not flow between chunks, 0 for the full sequence
+	//normalization layers
+	Momentum float64 `json:"momentum,omitempty"` //weight of the previous running statistics of batchnorm, defaults to 0.9
+	Epsilon  float64 `json:"epsilon,omitempty"`  //added to the variance, defaults to 1e-5
+	//embedding layers
+	Vocab int `json:"vocab,omitempty"` //number of indices, Size being the size of their vectors
+	//attention layers. Size is the size of the attention, or of the hidden feed forward layer for transformer blocks
+	Heads  int  `json:"heads,omitempty"`  //number of attention heads, defaults to 1
+	Causal bool `json:"causal,omitempty"` //each position only attends to the previous ones
+	//regularization of the weights, applied by the trainer
+	L1             float64 `json:"l1,omitempty"`              //penalty l1*sum(|w|) added to the cost
+	L2             float64 `json:"l2,omitempty"`              //penalty l2*sum(w²) added to the cost, elastic-net with L1
+	RegularizeBias bool    `json:"regularize_bias,omitempty"` //penalize the biases too
+	MaxNorm        float64 `json:"max_norm,omitempty"`        //maximum norm of each row of the weights (the incoming weights of a neuron, an embedding vector) after each update, 0 for no constraint
+	//Dropout is the probability of zeroing each output of the layer while training, 0 for no dropout
+	Dropout float64 `json:"dropout,omitempty"`
+	//Frozen layers keep their params, and batchnorm its running statistics, when the network is trained, for transfer learning
+	Frozen bool `json:"frozen,omitempty"`
 }
 
 //Validate configuration
@@ -26,9 +80,38 @@ func (l *LayerConfig) Validate() error {
 	if l == nil {
 		return fmt.Errorf("level config is nil")
 	}
-	if l.Size <= 0 {
-		return fmt.Errorf("size must be >0")
+	if l.L1 < 0 || l.L2 < 0 {
+		return fmt.Errorf("l1 and l2 must be >=0")
+	}
+	if l.MaxNorm < 0 {
+		return fmt.Errorf("max norm must be >=0")
+	}
+	if l.Dropout < 0 || l.Dropout >= 1 {
+		return fmt.Errorf("dropout must be in range [0;1[")
+	}
+	switch l.Type {
+	case "", LayerTypeDense, LayerTypeConv1D, LayerTypeConv2D, LayerTypeRNN:
+		if l.Size <= 0 {
+			return fmt.Errorf("size must be >0")
+		}
+	case LayerTypeLSTM, LayerTypeGRU, LayerTypeEmbedding, LayerTypeAttention, LayerTypeTransformer:
+		//gates use sigmoid and tanh, embeddings and attention have no activation
+		if l.Size <= 0 {
+			return fmt.Errorf("size must be >0")
+		}
+		return nil
+	case LayerTypeActivation:
+	case LayerTypeAdd, LayerTypeMul, LayerTypeConcat, LayerTypeFlatten, LayerTypeBatchNorm, LayerTypeLayerNorm, LayerTypePositional,
+		LayerTypeMaxPool1D, LayerTypeAvgPool1D, LayerTypeMaxPool2D, LayerTypeAvgPool2D, LayerTypeGlobalMaxPool, LayerTypeGlobalAvgPool:
+		return nil
+	default:
+		return fmt.Errorf("invalid layer type '%s'", l.Type)
 	}
+	return l.validateActivation()
+}
+
+//validateActivation checks the activation function and sets F from FuncType
+func (l *LayerConfig) validateActivation() error {
 	if l.FuncType == "" {
 		if l.F.Func == nil {
 			return fmt.Errorf("activation function is nil")
@@ -49,7 +132,7 @@ func (l *LayerConfig) Validate() error {
 
 //newLayer returns a new Level
 func newLayer(inSize int, outSize int, ftype string, fparams []float64, f activation.F) *layer {
-	return &layer{
+	l := &layer{
 		inSize:  inSize,
 		outSize: outSize,
 		w:       mat.NewM64(outSize, inSize, nil),
@@ -58,13 +141,14 @@ func newLayer(inSize int, outSize int, ftype string, fparams []float64, f activa
 		fparams: fparams,
 		a:       f,
 	}
+	l.params = []*Param{{Name: "w", Value: l.w}, {Name: "b", Value: l.b, bias: true}}
+	return l
 }
 
 //layer represents a layer of neurons, defined by Y=fn(w*X+b) where X is the input, Y the output,fn the activation function, W the weights matrix and b the bias.
 type layer struct {
 	keepState bool
 	state     *mat.M64 //stores the output of each neuron (a)
-	gradSig   *mat.M64 //stores the gradient of the activation
 	inSize    int
 	outSize   int
 	w         *mat.M64
@@ -72,6 +156,8 @@ type layer struct {
 	ftype     string
 	fparams   []float64
 	a         activation.F
+	params    []*Param
+	rec       recording
 }
 
 func (l *layer) Config() *LayerConfig {
@@ -79,6 +165,7 @@ func (l *layer) Config() *LayerConfig {
 		return nil
 	}
 	return &LayerConfig{
+		Type:       LayerTypeDense,
 		Size:       l.outSize,
 		KeepState:  l.keepState,
 		FuncType:   l.ftype,
@@ -142,7 +229,6 @@ func (l *layer) IsUsable() error {
 	}
 	if l.keepState {
 		l.state = mat.NewM64(r, c, nil)
-		l.gradSig = mat.NewM64(r, c, nil)
 	} else {
 		l.state = nil
 	}
@@ -198,145 +284,90 @@ func (l *layer) FeedForward(input *mat.M64) (*mat.M64, error) {
 	if l == nil {
 		return nil, fmt.Errorf("layer is nil")
 	}
-	res, err := wxpb(l.w, input, l.b)
+	t := autodiff.NewTape()
+	out, _, _, err := l.forward(t, t.Const(input))
 	if err != nil {
 		return nil, err
 	}
-	//compute sigmaPrimes during forward pass, preparing for backprop (backward pass)
 	if l.keepState {
-		l.gradSig, err = mat.MapElem(res, l.a.Deriv)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compute sigPrimes: %s", err.Error())
-		}
-	}
-	res, err = mat.MapElem(res, l.a.Func)
-	if err == nil && l.keepState {
-		l.state = res
-	}
-	return res, err
-}
-
-//init sets all weights and bias to 1
-func (l *layer) init() {
-	if l == nil {
-		return
-	}
-	n := l.dataSize()
-	data := make([]float64, n)
-	for i := range data {
-		data[i] = 1.0
+		l.state = out.Value
 	}
-	l.UpdateData(data)
+	return out.Value, nil
 }
 
-/*
-Backprop propagates the gradient from layer l+1 to layer l, and updates inner w and b in layer l
-gradCost is the gradiant vector of the cost depending on the activation (backpropagated from layer l+1 if not output layer)
-gradSig is the derivative vector of the activation (not used if output layer)
-w is the weight matrix in layer l+1 (not used if output layer)
-in is the input (from layer l-1)
-*/
-func (l *layer) Backprop(lr float64, in, gradCost, gradSig, w *mat.M64, isOutputLayer bool) (*mat.M64, error) {
+//forward records fn(w*x+b) on tape t. w and b are recorded as variables, so their gradients are available once t.Backward has been called
+func (l *layer) forward(t *autodiff.Tape, x *autodiff.Var) (out, w, b *autodiff.Var, err error) {
 	if l == nil {
-		return nil, fmt.Errorf("layer is nil")
+		return nil, nil, nil, fmt.Errorf("layer is nil")
 	}
 	if l.w == nil {
-		return nil, fmt.Errorf("weight matrix is nil")
+		return nil, nil, nil, fmt.Errorf("weight matrix is nil")
 	}
 	if l.b == nil {
-		return nil, fmt.Errorf("bias vector is nil")
-	}
-	if lr <= 0 || lr > 1.0 {
-		return nil, fmt.Errorf("learning rate must be in range ]0;1]")
-	}
-	if gradCost == nil {
-		return nil, fmt.Errorf("cost gradient vector is nil")
+		return nil, nil, nil, fmt.Errorf("bias vector is nil")
 	}
+	w, b = t.Var(l.w), t.Var(l.b)
+	out, err = l.record(t, []*autodiff.Var{x}, []*autodiff.Var{w, b})
+	return out, w, b, err
+}
 
-	if in == nil {
-		return nil, fmt.Errorf("local input vector is nil")
+//record computes fn(w*x+b) on tape t from inputs {x} and params {w,b}
+func (l *layer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
 	}
-	var cprime *mat.M64
-	var err error
-	//if isOutputLayer, no downstream dependency (root of the back-propagation)
-	if !isOutputLayer {
-		//backpropagate downstream costPrimes to compute local costPrimes
-		if gradSig == nil {
-			return nil, fmt.Errorf("activation gradient vector is nil")
-		}
-		if w == nil {
-			return nil, fmt.Errorf("weight matrix is nil")
-		}
-		/*
-			r, c := gradSig.Dims()
-			fmt.Printf("gradSig r=%d c=%d\n", r, c)
-			r, c = gradCost.Dims()
-			fmt.Printf("gradCost r=%d c=%d\n", r, c)
-		*/
-		//layer l+1 outx1
-		cprime, err = mat.MulElem(gradSig, gradCost)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compute gradSig*gradCost: %s", err.Error())
-		}
-		//layer l+1 inx1 = layer l outx1
-		w.Transpose()
-		defer w.DeTranspose()
-		//r, c = w.Dims()
-		//fmt.Printf("wT r=%d c=%d\n", r, c)
-		cprime, err = mat.Mul(w, cprime)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compute wT*gradSig*gradCost: %s", err.Error())
-		}
-		//r, c = cprime.Dims()
-		//fmt.Printf("cprime r=%d c=%d\n", r, c)
-
-	} else {
-		cprime = gradCost
+	x := inputs[0]
+	if x == nil || x.Value == nil {
+		return nil, fmt.Errorf("local input vector is nil")
 	}
-	//delta is outx1
-	/*
-		r, c := cprime.Dims()
-		fmt.Printf("cprime.Dims r=%d c=%d\n", r, c)
-		r, c = l.gradSig.Dims()
-		fmt.Printf("l.gradSig.Dims r=%d c=%d\n", r, c)
-	*/
-	//update weights and bias
-	//gradB is outx1
-	gradB, err := mat.MulElem(l.gradSig, cprime)
+	z, err := t.MatMul(params[0], x)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute gradient of bias vector: %s", err.Error())
-	}
-	if err = gradB.MapElem(func(x float64) float64 { return lr * x }); err != nil {
-		return nil, fmt.Errorf("failed to multiply gradient by learning rate: %s", err.Error())
+		return nil, fmt.Errorf("w*x failed: %s", err.Error())
 	}
-	//gradW is outxin
-	in.Transpose()
-	defer in.DeTranspose()
-	//r, c := in.Dims()
-	//r, c = gradB.Dims()
-	gradW, err := mat.Mul(gradB, in)
+	z, err = t.Add(z, params[1])
 	if err != nil {
-		return nil, fmt.Errorf("failed to compute gradient of weight matrix: %s", err.Error())
+		return nil, fmt.Errorf("w*x +b failed: %s", err.Error())
 	}
-	if err = l.w.Sub(gradW); err != nil {
-		return nil, fmt.Errorf("failed to update weights: %s", err.Error())
+	return t.Map(z, l.a)
+}
+
+//Forward to implement Layer
+func (l *layer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	if l == nil {
+		return nil, fmt.Errorf("layer is nil")
 	}
-	if err = l.b.Sub(gradB); err != nil {
-		return nil, fmt.Errorf("failed to update bias: %s", err.Error())
+	out, err := l.rec.forward(l.record, inputs, l.params)
+	if err == nil && l.keepState {
+		l.state = out
 	}
-	return cprime, nil
+	return out, err
 }
 
-//wxpb computes the dot product of w and x then adds b
-func wxpb(w, x, b *mat.M64) (*mat.M64, error) {
-	res, err := mat.Mul(w, x)
-	if err != nil {
-		return nil, fmt.Errorf("w*x failed: %s", err.Error())
+//Backward to implement Layer
+func (l *layer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	if l == nil {
+		return nil, fmt.Errorf("layer is nil")
 	}
-	res, err = mat.Add(res, b)
-	if err != nil {
-		return nil, fmt.Errorf("w*x +b failed: %s", err.Error())
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *layer) Params() []*Param {
+	if l == nil {
+		return nil
 	}
+	return l.params
+}
 
-	return res, nil
+//init sets all weights and bias to 1
+func (l *layer) init() {
+	if l == nil {
+		return
+	}
+	n := l.dataSize()
+	data := make([]float64, n)
+	for i := range data {
+		data[i] = 1.0
+	}
+	l.UpdateData(data)
 }
@@ -0,0 +1,178 @@
+package nn
+
+import (
+	"fmt"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+//buildLayer returns a new layer from its config and the shape of its output, given the shapes of its inputs
+func buildLayer(cfg *LayerConfig, in []Shape) (Layer, Shape, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, Shape{}, err
+	}
+	switch cfg.Type {
+	case "", LayerTypeDense, LayerTypeActivation:
+		if len(in) != 1 {
+			return nil, Shape{}, fmt.Errorf("%s layer expects 1 input received %d", layerType(cfg), len(in))
+		}
+		if cfg.Type == LayerTypeActivation {
+			return &activationLayer{size: in[0].Rows, ftype: cfg.FuncType, fparams: cfg.FuncParams, a: cfg.F}, in[0], nil
+		}
+		//applied to each colomn
+		out := in[0]
+		out.Rows = cfg.Size
+		return newLayer(in[0].Rows, cfg.Size, cfg.FuncType, cfg.FuncParams, cfg.F), out, nil
+	case LayerTypeAdd, LayerTypeMul, LayerTypeConcat:
+		return newMergeLayer(cfg.Type, in)
+	case LayerTypeAttention:
+		return newAttentionLayer(cfg, in)
+	}
+	if len(in) != 1 {
+		return nil, Shape{}, fmt.Errorf("%s layer expects 1 input received %d", cfg.Type, len(in))
+	}
+	switch cfg.Type {
+	case LayerTypeConv1D:
+		return newConvLayer(cfg, 1, in[0])
+	case LayerTypeConv2D:
+		return newConvLayer(cfg, 2, in[0])
+	case LayerTypeMaxPool1D, LayerTypeAvgPool1D, LayerTypeMaxPool2D, LayerTypeAvgPool2D, LayerTypeGlobalMaxPool, LayerTypeGlobalAvgPool:
+		return newPoolLayer(cfg, in[0])
+	case LayerTypeRNN, LayerTypeLSTM, LayerTypeGRU:
+		return newRecurrentLayer(cfg, in[0])
+	case LayerTypeBatchNorm, LayerTypeLayerNorm:
+		return newNormLayer(cfg, in[0])
+	case LayerTypeEmbedding:
+		return newEmbeddingLayer(cfg, in[0])
+	case LayerTypePositional:
+		return &positionalLayer{size: in[0].Rows}, in[0], nil
+	case LayerTypeTransformer:
+		return newTransformerLayer(cfg, in[0])
+	case LayerTypeFlatten:
+		if in[0].Width == 0 {
+			return nil, Shape{}, fmt.Errorf("can not flatten an input with a variable number of colomns")
+		}
+		size := in[0].Rows * in[0].Cols()
+		return &flattenLayer{size: size}, Shape{Rows: size, Height: 1, Width: 1}, nil
+	default:
+		return nil, Shape{}, fmt.Errorf("invalid layer type '%s'", cfg.Type)
+	}
+}
+
+//layerType returns the type of the layer, LayerTypeDense by default
+func layerType(cfg *LayerConfig) string {
+	if cfg.Type == "" {
+		return LayerTypeDense
+	}
+	return cfg.Type
+}
+
+//activationLayer applies an activation function to each element of its input
+type activationLayer struct {
+	size    int
+	ftype   string
+	fparams []float64
+	a       activation.F
+	rec     recording
+}
+
+func (l *activationLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	return t.Map(inputs[0], l.a)
+}
+
+//Forward to implement Layer
+func (l *activationLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, nil)
+}
+
+//Backward to implement Layer
+func (l *activationLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, nil)
+}
+
+//Params to implement Layer
+func (l *activationLayer) Params() []*Param {
+	return nil
+}
+
+//Config to implement Layer
+func (l *activationLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: LayerTypeActivation, Size: l.size, FuncType: l.ftype, FuncParams: l.fparams}
+}
+
+//mergeLayer combines several inputs into one output, without params: element wise sum (add) or product (mul), or concatenation of rows (concat)
+type mergeLayer struct {
+	op   string
+	size int
+	n    int
+	rec  recording
+}
+
+func newMergeLayer(op string, in []Shape) (*mergeLayer, Shape, error) {
+	if len(in) < 2 {
+		return nil, Shape{}, fmt.Errorf("%s layer expects at least 2 inputs received %d", op, len(in))
+	}
+	out := in[0]
+	out.Rows = 0
+	for i, s := range in {
+		if s.Height != in[0].Height || s.Width != in[0].Width {
+			return nil, Shape{}, fmt.Errorf("%s layer: inputs[%d] has %dx%d colomns, expected %dx%d", op, i, s.Height, s.Width, in[0].Height, in[0].Width)
+		}
+		if op == LayerTypeConcat {
+			out.Rows += s.Rows
+			continue
+		}
+		if s.Rows != in[0].Rows {
+			return nil, Shape{}, fmt.Errorf("%s layer: inputs[%d] has size %d, expected %d", op, i, s.Rows, in[0].Rows)
+		}
+		out.Rows = s.Rows
+	}
+	return &mergeLayer{op: op, size: out.Rows, n: len(in)}, out, nil
+}
+
+func (l *mergeLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != l.n {
+		return nil, fmt.Errorf("expected %d inputs received %d", l.n, len(inputs))
+	}
+	if l.op == LayerTypeConcat {
+		return t.Concat(autodiff.Rows, inputs...)
+	}
+	out := inputs[0]
+	var err error
+	for i, in := range inputs[1:] {
+		if l.op == LayerTypeAdd {
+			out, err = t.Add(out, in)
+		} else {
+			out, err = t.Mul(out, in)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inputs[%d]: %s", i+1, err.Error())
+		}
+	}
+	return out, nil
+}
+
+//Forward to implement Layer
+func (l *mergeLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, nil)
+}
+
+//Backward to implement Layer
+func (l *mergeLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, nil)
+}
+
+//Params to implement Layer
+func (l *mergeLayer) Params() []*Param {
+	return nil
+}
+
+//Config to implement Layer
+func (l *mergeLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: l.op, Size: l.size}
+}
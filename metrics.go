@@ -0,0 +1,86 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//Metrics measures the performance of a network on a dataset
+type Metrics struct {
+	Points   int     `json:"points"`
+	Cost     float64 `json:"cost"`               //average cost of the outputs
+	MSE      float64 `json:"mse"`                //mean squared error of the outputs
+	MAE      float64 `json:"mae"`                //mean absolute error of the outputs
+	Accuracy float64 `json:"accuracy,omitempty"` //ratio of points whose largest output is the largest expected output, for networks with several outputs, omitted else
+}
+
+//Predictor runs a network on an input, like a Network or the inference only FC32 and QFC
+type Predictor interface {
+	FeedForward(input *mat.M64) (*mat.M64, error)
+}
+
+//Evaluate runs the network on each point of the dataset and measures its performance with the cost function
+func Evaluate(n Predictor, data Dataset, cost activation.F) (*Metrics, error) {
+	if n == nil {
+		return nil, fmt.Errorf("neural network is nil")
+	}
+	if cost.Func == nil {
+		return nil, fmt.Errorf("cost function is nil")
+	}
+	if data == nil || data.Size() == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+	if s, ok := n.(stateful); ok {
+		s.ResetStates()
+	}
+	res := &Metrics{}
+	values, correct, classes := 0, 0, false
+	data.Reset()
+	for p := data.Next(); p != nil; p = data.Next() {
+		if p.Exp == nil {
+			return nil, fmt.Errorf("datapoint[%d]: expected output is nil", res.Points)
+		}
+		pred, err := n.FeedForward(p.Inp)
+		if err != nil {
+			return nil, fmt.Errorf("datapoint[%d]: %s", res.Points, err.Error())
+		}
+		dev, err := mat.Sub(pred, p.Exp)
+		if err != nil {
+			return nil, fmt.Errorf("datapoint[%d]: failed to compute deviation: %s", res.Points, err.Error())
+		}
+		for _, v := range dev.GetData() {
+			res.Cost += cost.Func(v)
+			res.MSE += v * v
+			res.MAE += math.Abs(v)
+		}
+		values += dev.Size()
+		if pred.Size() > 1 {
+			classes = true
+			if argmax(pred.GetData()) == argmax(p.Exp.GetData()) {
+				correct++
+			}
+		}
+		res.Points++
+	}
+	res.Cost /= float64(values)
+	res.MSE /= float64(values)
+	res.MAE /= float64(values)
+	if classes {
+		res.Accuracy = float64(correct) / float64(res.Points)
+	}
+	return res, nil
+}
+
+//argmax returns the index of the largest value
+func argmax(x []float64) int {
+	ind := 0
+	for i, v := range x {
+		if v > x[ind] {
+			ind = i
+		}
+	}
+	return ind
+}
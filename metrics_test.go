@@ -0,0 +1,45 @@
+package nn
+
+import (
+	"fmt"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestEvaluate(t *testing.T) {
+	te := tester.NewT(t)
+	//identity network
+	n, err := NewSequential(2, &LayerConfig{Type: LayerTypeActivation, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := func(in, exp []float64) *Datapoint {
+		return &Datapoint{Inp: mat.NewM64(2, 1, in), Exp: mat.NewM64(2, 1, exp)}
+	}
+	tests := []struct {
+		points []*Datapoint
+		res    *Metrics
+		err    error
+	}{
+		{[]*Datapoint{point([]float64{1, 0}, []float64{1, 0}), point([]float64{0, 1}, []float64{1, 0})}, &Metrics{Points: 2, Cost: 0.25, MSE: 0.5, MAE: 0.5, Accuracy: 0.5}, nil},
+		{[]*Datapoint{point([]float64{0.5, 0}, []float64{1, 0}), point([]float64{0, 2}, []float64{0, 1})}, &Metrics{Points: 2, Cost: 0.3125 / 2, MSE: 0.3125, MAE: 0.375, Accuracy: 1}, nil},
+		{[]*Datapoint{{Inp: mat.NewM64(2, 1, nil)}}, nil, fmt.Errorf("datapoint[0]: expected output is nil")},
+		{nil, nil, fmt.Errorf("dataset is empty")},
+	}
+	for ind, test := range tests {
+		res, err := Evaluate(n, NewMemoryDataset(test.points), activation.Power(0.5, 2))
+		te.CheckError(ind, test.err, err)
+		te.DeepEqual(ind, "metrics", test.res, res)
+	}
+	//a single output has no accuracy
+	n, err = NewSequential(1, &LayerConfig{Type: LayerTypeActivation, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Evaluate(n, NewMemoryDataset([]*Datapoint{{Inp: mat.NewM64(1, 1, []float64{1}), Exp: mat.NewM64(1, 1, []float64{3})}}), activation.Abs())
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "metrics", &Metrics{Points: 1, Cost: 2, MSE: 4, MAE: 2}, res)
+}
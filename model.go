@@ -0,0 +1,636 @@
+package nn
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+//Input is the name of the model's input, to be used as input of the first layers
+const Input = "input"
+
+//Param is a trainable matrix of a layer, with the gradient accumulated by Backward since the last ZeroGrad
+type Param struct {
+	Name   string
+	Value  *mat.M64
+	Grad   *mat.M64
+	rows   map[int]struct{} //rows of a sparse param with a gradient, nil for dense params
+	bias   bool             //biases, shifts and scales are not penalized nor constrained unless required
+	pruned []bool           //values set to 0 by pruning and kept at 0 by updates, nil if not pruned
+}
+
+//ZeroGrad clears the accumulated gradient
+func (p *Param) ZeroGrad() {
+	if p == nil {
+		return
+	}
+	if p.rows == nil {
+		p.Grad = nil
+		return
+	}
+	_, c := p.Grad.Dims()
+	for i := range p.rows {
+		for j := 0; j < c; j++ {
+			p.Grad.Set(i, j, 0)
+		}
+	}
+	p.rows = map[int]struct{}{}
+}
+
+//accumulate adds g to the gradient of p
+func (p *Param) accumulate(g *mat.M64) error {
+	if g == nil {
+		return nil
+	}
+	if p.Grad == nil {
+		r, c := g.Dims()
+		p.Grad = mat.NewM64(r, c, g.GetData())
+		return nil
+	}
+	return p.Grad.Add(g)
+}
+
+//accumulateRow adds g to row i of the gradient of a sparse param
+func (p *Param) accumulateRow(i int, g []float64) {
+	for j, v := range g {
+		p.Grad.Set(i, j, p.Grad.At(i, j)+v)
+	}
+	p.rows[i] = struct{}{}
+}
+
+//Layer is a differentiable building block of a Model
+type Layer interface {
+	//Forward computes the output of the layer from its inputs, and keeps what is needed by Backward
+	Forward(inputs ...*mat.M64) (*mat.M64, error)
+	//Backward receives the gradient of the cost wrt the output of the last Forward call. It adds the gradients of the cost wrt the params to their Grad and returns the gradients wrt each input
+	Backward(gradOut *mat.M64) ([]*mat.M64, error)
+	//Params returns the trainable parameters
+	Params() []*Param
+	//Config returns the definition of the layer
+	Config() *LayerConfig
+}
+
+//recorder records the computation of a layer's output on a tape
+type recorder func(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error)
+
+//recording holds the tape of the last Forward call of a layer whose Backward is computed by autodiff
+type recording struct {
+	tape   *autodiff.Tape
+	inputs []*autodiff.Var
+	params []*autodiff.Var
+	out    *autodiff.Var
+}
+
+//forward records f on a new tape
+func (r *recording) forward(f recorder, inputs []*mat.M64, params []*Param) (*mat.M64, error) {
+	t := autodiff.NewTape()
+	xs := make([]*autodiff.Var, len(inputs))
+	for i, in := range inputs {
+		if in == nil {
+			return nil, fmt.Errorf("inputs[%d] is nil", i)
+		}
+		xs[i] = t.Var(in)
+	}
+	ps := make([]*autodiff.Var, len(params))
+	for i, p := range params {
+		ps[i] = t.Var(p.Value)
+	}
+	out, err := f(t, xs, ps)
+	if err != nil {
+		return nil, err
+	}
+	r.tape, r.inputs, r.params, r.out = t, xs, ps, out
+	return out.Value, nil
+}
+
+//backward propagates gradOut on the recorded tape, accumulates the gradients of params and returns the gradients wrt the inputs
+func (r *recording) backward(gradOut *mat.M64, params []*Param) ([]*mat.M64, error) {
+	if r.tape == nil {
+		return nil, fmt.Errorf("no forward pass to backpropagate")
+	}
+	if gradOut == nil {
+		return nil, fmt.Errorf("output gradient is nil")
+	}
+	r.tape.ZeroGrad()
+	if err := r.tape.Backward(r.out, gradOut); err != nil {
+		return nil, err
+	}
+	for i, p := range params {
+		if err := p.accumulate(r.params[i].Grad); err != nil {
+			return nil, fmt.Errorf("param '%s': %s", p.Name, err.Error())
+		}
+	}
+	grads := make([]*mat.M64, len(r.inputs))
+	for i, x := range r.inputs {
+		grads[i] = x.Grad
+		if grads[i] == nil {
+			rows, cols := x.Value.Dims()
+			grads[i] = mat.NewM64(rows, cols, nil)
+		}
+	}
+	return grads, nil
+}
+
+//Shape describes the matrices flowing through a model: Rows (features or channels) x Cols, the colomns being the Height*Width positions of 2D data (Height=1 for vectors and 1D data). Width=0 stands for a variable number of colomns, like sequences
+type Shape struct {
+	Rows   int `json:"rows"`
+	Height int `json:"height"`
+	Width  int `json:"width"`
+}
+
+//Cols returns the number of colomns, 0 if variable
+func (s Shape) Cols() int {
+	return s.Height * s.Width
+}
+
+//String returns rows x height x width, a variable width being written *
+func (s Shape) String() string {
+	if s.Width == 0 {
+		return fmt.Sprintf("%dx%dx*", s.Rows, s.Height)
+	}
+	return fmt.Sprintf("%dx%dx%d", s.Rows, s.Height, s.Width)
+}
+
+//validate checks if dimensions are consistent
+func (s Shape) validate() error {
+	if s.Rows <= 0 {
+		return fmt.Errorf("shape must have at least 1 row")
+	}
+	if s.Height <= 0 {
+		return fmt.Errorf("shape height must be >0")
+	}
+	if s.Width < 0 {
+		return fmt.Errorf("shape width must be >=0")
+	}
+	return nil
+}
+
+//node is a layer of a model, fed by the outputs of other nodes
+type node struct {
+	name    string
+	layer   Layer
+	shape   Shape
+	inputs  []int        //indices of the input nodes, -1 being the model's input
+	reg     *regularizer //penalties and constraints on the params, nil if none
+	dropout float64      //probability of zeroing each output while training
+	mask    *mat.M64     //dropout mask of the last output, nil if none
+	frozen  bool         //params not updated by the trainer, batchnorm statistics kept while training
+	out     *mat.M64
+	grad    *mat.M64
+}
+
+//Model is a directed acyclic graph of layers: each layer is fed by the model's input or the outputs of layers added before it. The last layer added is the output of the model
+type Model struct {
+	inShape Shape
+	nodes   []*node
+	names   map[string]int
+	last    *mat.M64 //input of the last forward pass, reused by Accumulate until the params change
+	//training mode, drawing dropout masks from rnd
+	training bool
+	rnd      *rand.Rand
+	opt      Optimizer //nil for sgd
+}
+
+//NewModel returns a new model with no layers, fed by column vectors
+func NewModel(inSize int) (*Model, error) {
+	if inSize < 1 {
+		return nil, fmt.Errorf("minimum input size is 1")
+	}
+	return NewModelWithShape(Shape{Rows: inSize, Height: 1, Width: 1})
+}
+
+//NewModelWithShape returns a new model with no layers, fed by matrices of shape in (like channels x positions for convolutions, or features x timesteps for sequences)
+func NewModelWithShape(in Shape) (*Model, error) {
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	return &Model{inShape: in, names: map[string]int{}}, nil
+}
+
+//NewSequential returns a model made of a stack of layers, each one fed by the previous one
+func NewSequential(inSize int, configs ...*LayerConfig) (*Model, error) {
+	m, err := NewModel(inSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("must have at least one layer")
+	}
+	prev := Input
+	for i, c := range configs {
+		name := fmt.Sprintf("layer%d", i)
+		if err = m.AddConfig(name, c, prev); err != nil {
+			return nil, fmt.Errorf("configs[%d]: %s", i, err.Error())
+		}
+		prev = name
+	}
+	return m, nil
+}
+
+//InSize returns the number of rows of the input
+func (m *Model) InSize() int {
+	return m.InShape().Rows
+}
+
+//InShape returns the shape of the input
+func (m *Model) InShape() Shape {
+	if m == nil {
+		return Shape{}
+	}
+	return m.inShape
+}
+
+//OutSize returns the number of rows of the output
+func (m *Model) OutSize() int {
+	return m.OutShape().Rows
+}
+
+//OutShape returns the shape of the output
+func (m *Model) OutShape() Shape {
+	if m == nil || len(m.nodes) == 0 {
+		return Shape{}
+	}
+	return m.nodes[len(m.nodes)-1].shape
+}
+
+//Layer returns the layer named name
+func (m *Model) Layer(name string) (Layer, error) {
+	n, err := m.node(name)
+	if err != nil {
+		return nil, err
+	}
+	return n.layer, nil
+}
+
+//Add appends layer l, fed by the outputs of the named layers (or Input)
+func (m *Model) Add(name string, l Layer, inputs ...string) error {
+	if m == nil {
+		return fmt.Errorf("model is nil")
+	}
+	if l == nil {
+		return fmt.Errorf("layer is nil")
+	}
+	cfg := l.Config()
+	if cfg == nil {
+		return fmt.Errorf("layer config is nil")
+	}
+	if cfg.Size <= 0 {
+		return fmt.Errorf("layer size must be >0")
+	}
+	ins, shapes, err := m.resolve(name, inputs)
+	if err != nil {
+		return err
+	}
+	m.push(name, l, cfg, Shape{Rows: cfg.Size, Height: shapes[0].Height, Width: shapes[0].Width}, ins)
+	return nil
+}
+
+//AddConfig builds a layer from its config and appends it, fed by the outputs of the named layers (or Input)
+func (m *Model) AddConfig(name string, cfg *LayerConfig, inputs ...string) error {
+	if m == nil {
+		return fmt.Errorf("model is nil")
+	}
+	ins, shapes, err := m.resolve(name, inputs)
+	if err != nil {
+		return err
+	}
+	l, shape, err := buildLayer(cfg, shapes)
+	if err != nil {
+		return fmt.Errorf("layer '%s': %s", name, err.Error())
+	}
+	m.push(name, l, cfg, shape, ins)
+	return nil
+}
+
+//resolve returns the indices and shapes of the named inputs
+func (m *Model) resolve(name string, inputs []string) ([]int, []Shape, error) {
+	if name == "" || name == Input {
+		return nil, nil, fmt.Errorf("invalid layer name '%s'", name)
+	}
+	if _, ok := m.names[name]; ok {
+		return nil, nil, fmt.Errorf("layer '%s' already exists", name)
+	}
+	if len(inputs) == 0 {
+		return nil, nil, fmt.Errorf("layer '%s' has no input", name)
+	}
+	ins := make([]int, len(inputs))
+	shapes := make([]Shape, len(inputs))
+	for i, in := range inputs {
+		if in == Input {
+			ins[i], shapes[i] = -1, m.inShape
+			continue
+		}
+		ind, ok := m.names[in]
+		if !ok {
+			return nil, nil, fmt.Errorf("layer '%s': unknown input '%s'", name, in)
+		}
+		ins[i], shapes[i] = ind, m.nodes[ind].shape
+	}
+	return ins, shapes, nil
+}
+
+//push appends layer l, regularized, dropped out and frozen as defined by cfg
+func (m *Model) push(name string, l Layer, cfg *LayerConfig, shape Shape, inputs []int) {
+	m.names[name] = len(m.nodes)
+	n := &node{name: name, layer: l, shape: shape, inputs: inputs, reg: newRegularizer(cfg), dropout: cfg.Dropout, frozen: cfg.Frozen}
+	m.nodes = append(m.nodes, n)
+	m.setTraining(n)
+	m.last = nil
+}
+
+//Params returns the trainable parameters of all layers
+func (m *Model) Params() []*Param {
+	if m == nil {
+		return nil
+	}
+	var params []*Param
+	for _, n := range m.nodes {
+		params = append(params, n.layer.Params()...)
+	}
+	return params
+}
+
+//Info prints the summary of the model to stdout, see WriteInfo. It panics if the model is not usable
+func (m *Model) Info() {
+	if err := m.WriteInfo(os.Stdout); err != nil {
+		panic(err)
+	}
+}
+
+//WriteInfo writes the summary of the model as a table: each layer with its type, inputs, output shape, number of params and FLOPs, see Summary
+func (m *Model) WriteInfo(w io.Writer) error {
+	s, err := m.Summary()
+	if err != nil {
+		return err
+	}
+	return s.WriteText(w)
+}
+
+//ZeroGrad clears the gradients of all parameters
+func (m *Model) ZeroGrad() {
+	for _, p := range m.Params() {
+		p.ZeroGrad()
+	}
+}
+
+//isUsable checks if the model can be run
+func (m *Model) isUsable() error {
+	if m == nil {
+		return fmt.Errorf("model is nil")
+	}
+	if len(m.nodes) == 0 {
+		return fmt.Errorf("model has no layers")
+	}
+	return nil
+}
+
+//FeedForward computes the output of the model. Models fed by colomn vectors whose layers process colomns independently also accept a batch of inputs stacked as colomns
+func (m *Model) FeedForward(input *mat.M64) (*mat.M64, error) {
+	if err := m.isUsable(); err != nil {
+		return nil, err
+	}
+	if input == nil {
+		return nil, fmt.Errorf("input is nil")
+	}
+	r, c := input.Dims()
+	if r != m.inShape.Rows {
+		return nil, fmt.Errorf("input has %d rows, expected %d", r, m.inShape.Rows)
+	}
+	if cols := m.inShape.Cols(); cols > 0 && c != cols && !(cols == 1 && m.stacksBatches()) {
+		return nil, fmt.Errorf("input has %d colomns, expected %d", c, cols)
+	}
+	var err error
+	for _, n := range m.nodes {
+		ins := make([]*mat.M64, len(n.inputs))
+		for j, ind := range n.inputs {
+			if ind < 0 {
+				ins[j] = input
+			} else {
+				ins[j] = m.nodes[ind].out
+			}
+		}
+		n.grad, n.mask = nil, nil
+		if n.out, err = n.layer.Forward(ins...); err != nil {
+			return nil, fmt.Errorf("layer '%s': %s", n.name, err.Error())
+		}
+		if m.training && n.dropout > 0 {
+			r, c := n.out.Dims()
+			if m.rnd == nil {
+				m.rnd = rand.New(rand.NewSource(1))
+			}
+			n.mask = dropMask(m.rnd, n.dropout, r, c)
+			if n.out, err = mat.MulElem(n.out, n.mask); err != nil {
+				return nil, fmt.Errorf("layer '%s': dropout: %s", n.name, err.Error())
+			}
+		}
+	}
+	m.last = input
+	return m.nodes[len(m.nodes)-1].out, nil
+}
+
+//ResetStates clears the state kept between sequences by stateful layers
+func (m *Model) ResetStates() {
+	if m == nil {
+		return
+	}
+	for _, n := range m.nodes {
+		if s, ok := n.layer.(interface{ ResetState() }); ok {
+			s.ResetState()
+		}
+	}
+	m.last = nil
+}
+
+//Accumulate backpropagates gradCost, the gradient of the cost wrt the output for input in, and adds the gradients to the params. The forward pass is not run again if in is the input of the last FeedForward call and the params were not updated since: stateful layers only advance once per input
+func (m *Model) Accumulate(in, gradCost *mat.M64) error {
+	if gradCost == nil {
+		return fmt.Errorf("cost gradient is nil")
+	}
+	if in == nil || in != m.last {
+		if _, err := m.FeedForward(in); err != nil {
+			return err
+		}
+	}
+	m.nodes[len(m.nodes)-1].grad = gradCost
+	for i := len(m.nodes) - 1; i >= 0; i-- {
+		n := m.nodes[i]
+		if n.grad == nil {
+			//output not used
+			continue
+		}
+		if n.mask != nil {
+			g, err := mat.MulElem(n.grad, n.mask)
+			if err != nil {
+				return fmt.Errorf("layer '%s': dropout: %s", n.name, err.Error())
+			}
+			n.grad = g
+		}
+		grads, err := n.layer.Backward(n.grad)
+		if err != nil {
+			return fmt.Errorf("layer '%s': %s", n.name, err.Error())
+		}
+		if n.frozen {
+			//the gradients flow through frozen layers but are not kept: they are neither clipped nor applied
+			for _, p := range n.layer.Params() {
+				p.ZeroGrad()
+			}
+		}
+		if len(grads) != len(n.inputs) {
+			return fmt.Errorf("layer '%s': expected %d input gradients received %d", n.name, len(n.inputs), len(grads))
+		}
+		for j, ind := range n.inputs {
+			if ind < 0 {
+				continue
+			}
+			up := m.nodes[ind]
+			if up.grad == nil {
+				up.grad = grads[j]
+				continue
+			}
+			if up.grad, err = mat.Add(up.grad, grads[j]); err != nil {
+				return fmt.Errorf("layer '%s': gradient from '%s': %s", up.name, n.name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+//Backprop the cost gradient and updates the parameters
+func (m *Model) Backprop(lr float64, in, gradCost *mat.M64) error {
+	if lr <= 0 || lr > 1.0 {
+		return fmt.Errorf("learning rate must be in range ]0;1]")
+	}
+	m.ZeroGrad()
+	if err := m.Accumulate(in, gradCost); err != nil {
+		return err
+	}
+	return m.step(lr)
+}
+
+//step updates the params of the layers which are not frozen with the accumulated gradients and the gradients of the penalties, then applies the max-norm constraints
+func (m *Model) step(lr float64) error {
+	m.last = nil
+	var params []*Param
+	for _, n := range m.nodes {
+		if n.frozen {
+			continue
+		}
+		n.reg.addGradients(n.layer.Params())
+		params = append(params, n.layer.Params()...)
+	}
+	update := sgdStep
+	if m.opt != nil {
+		update = m.opt.Update
+	}
+	if err := update(lr, params); err != nil {
+		return err
+	}
+	for _, n := range m.nodes {
+		if !n.frozen {
+			n.reg.constrain(n.layer.Params())
+		}
+	}
+	return nil
+}
+
+//layerStates returns the last outputs and the params of the layers
+func (m *Model) layerStates() []layerState {
+	states := make([]layerState, len(m.nodes))
+	for i, n := range m.nodes {
+		states[i] = layerState{name: n.name, out: n.out, params: n.layer.Params()}
+		if b, ok := n.layer.(buffered); ok {
+			states[i].buffers = b.Buffers()
+		}
+	}
+	return states
+}
+
+//penalty returns the sum of the penalties of the layers, to be added to the cost
+func (m *Model) penalty() float64 {
+	if m == nil {
+		return 0
+	}
+	s := 0.0
+	for _, n := range m.nodes {
+		s += n.reg.penalty(n.layer.Params())
+	}
+	return s
+}
+
+//SetTraining switches the layers with a different behaviour while training, like batchnorm and dropout, to training or inference mode. Models are in inference mode by default, the trainer switches them while training
+func (m *Model) SetTraining(training bool) {
+	if m == nil {
+		return
+	}
+	m.training = training
+	for _, n := range m.nodes {
+		m.setTraining(n)
+	}
+	m.last = nil
+}
+
+//setTraining switches the layer of n to the mode of the model. Frozen layers stay in inference mode: batchnorm normalizes with its running statistics and does not update them
+func (m *Model) setTraining(n *node) {
+	if l, ok := n.layer.(interface{ SetTraining(bool) }); ok {
+		l.SetTraining(m.training && !n.frozen)
+	}
+}
+
+//SetOptimizer sets the optimizer updating the params, nil for the stochastic gradient descent without momentum (default)
+func (m *Model) SetOptimizer(o Optimizer) {
+	if m == nil {
+		return
+	}
+	m.opt = o
+}
+
+//setRand sets the random source of the dropout masks
+func (m *Model) setRand(r *rand.Rand) {
+	m.rnd = r
+}
+
+//stacksBatches reports if the samples of a batch can be stacked as the colomns of a single input: the model is fed by colomn vectors and its layers process colomns independently, except batchnorm which normalizes over them
+func (m *Model) stacksBatches() bool {
+	if m == nil || m.inShape.Cols() != 1 {
+		return false
+	}
+	for _, n := range m.nodes {
+		switch n.layer.Config().Type {
+		case "", LayerTypeDense, LayerTypeActivation, LayerTypeAdd, LayerTypeMul, LayerTypeConcat, LayerTypeBatchNorm, LayerTypeLayerNorm, LayerTypeEmbedding:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//sgdStep substracts lr*grad from each param
+func sgdStep(lr float64, params []*Param) error {
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		if p.rows != nil {
+			//sparse param: only the rows with a gradient are updated
+			_, c := p.Value.Dims()
+			for i := range p.rows {
+				for j := 0; j < c; j++ {
+					p.Value.Set(i, j, p.Value.At(i, j)-lr*p.Grad.At(i, j))
+				}
+			}
+			continue
+		}
+		g, err := mat.MapElem(p.Grad, func(x float64) float64 { return lr * x })
+		if err != nil {
+			return fmt.Errorf("param '%s': %s", p.Name, err.Error())
+		}
+		if err = p.Value.Sub(g); err != nil {
+			return fmt.Errorf("param '%s': %s", p.Name, err.Error())
+		}
+	}
+	return nil
+}
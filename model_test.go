@@ -0,0 +1,269 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//randomizeParams sets every param of m to random values in [-1;1[
+func randomizeParams(seed int64, params []*Param) {
+	r := rand.New(rand.NewSource(seed))
+	for _, p := range params {
+		data := make([]float64, p.Value.Size())
+		for i := range data {
+			data[i] = 2*r.Float64() - 1
+		}
+		p.Value.SetData(data)
+	}
+}
+
+//modelCost returns sum(cost(m(in)-exp))
+func modelCost(m *Model, in, exp *mat.M64, cost activation.F) (float64, error) {
+	pred, err := m.FeedForward(in)
+	if err != nil {
+		return 0, err
+	}
+	dev, err := mat.Sub(pred, exp)
+	if err != nil {
+		return 0, err
+	}
+	c := 0.0
+	for _, v := range dev.GetData() {
+		c += cost.Func(v)
+	}
+	return c, nil
+}
+
+//checkModelGradients compares the gradients accumulated by the model against central finite differences
+func checkModelGradients(m *Model, in, exp *mat.M64, cost activation.F) error {
+	pred, err := m.FeedForward(in)
+	if err != nil {
+		return err
+	}
+	dev, _ := mat.Sub(pred, exp)
+	gradCost, _ := mat.MapElem(dev, cost.Deriv)
+	m.ZeroGrad()
+	if err = m.Accumulate(in, gradCost); err != nil {
+		return err
+	}
+	eps := 1e-6
+	for _, p := range m.Params() {
+		r, c := p.Value.Dims()
+		for i := 0; i < r; i++ {
+			for j := 0; j < c; j++ {
+				v := p.Value.At(i, j)
+				p.Value.Set(i, j, v+eps)
+				plus, err := modelCost(m, in, exp, cost)
+				if err != nil {
+					return err
+				}
+				p.Value.Set(i, j, v-eps)
+				minus, err := modelCost(m, in, exp, cost)
+				if err != nil {
+					return err
+				}
+				p.Value.Set(i, j, v)
+				//absolute tolerance for gradients which are 0 analytically, like the bias of a layer followed by batchnorm
+				num := (plus - minus) / (2 * eps)
+				if e := relativeErr(p.Grad.At(i, j), num); e > 1e-4 && math.Abs(p.Grad.At(i, j)-num) > 1e-8 {
+					return fmt.Errorf("param '%s' (%d,%d): relative error %g", p.Name, i, j, e)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestSequentialMatchesFC(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 4, FuncType: activation.FuncTypeTanh},
+		{Size: 2, FuncType: activation.FuncTypeSigmoid},
+	}
+	f, err := mockRandFC(7, 3, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewSequential(3, configs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := m.Params()
+	for i, l := range f.layers {
+		params[2*i].Value.SetData(l.w.GetData())
+		params[2*i+1].Value.SetData(l.b.GetData())
+	}
+	in := mat.NewM64(3, 1, []float64{0.1, -0.2, 0.3})
+	exp, _ := f.FeedForward(in)
+	res, err := m.FeedForward(in)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "output", exp, res)
+	gradCost := mat.NewM64(2, 1, []float64{0.5, -1})
+	gradW, gradB, err := f.gradients(in, gradCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Accumulate(in, gradCost); err != nil {
+		t.Fatal(err)
+	}
+	for i := range f.layers {
+		te.DeepEqual(i, "w gradient", gradW[i], params[2*i].Grad)
+		te.DeepEqual(i, "b gradient", gradB[i], params[2*i+1].Grad)
+	}
+}
+
+func TestModelInfo(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := residualModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, m.WriteInfo(buf))
+	exp := `LAYER  TYPE             INPUTS    SHAPE  WEIGHTS  BIASES  FROZEN  FLOPS
+input                             3x1x1                           
+h1     dense(tanh)      input     4x1x1  12       4       0       32
+h2     dense(iden)      h1        3x1x1  12       3       0       30
+skip   add              h2,input  3x1x1  0        0       0       3
+out    activation(elu)  skip      3x1x1  0        0       0       3
+total                                    24       7       0       68
+trainable params: 31, frozen values: 0, memory: 248 bytes
+`
+	te.DeepEqual(0, "info", exp, buf.String())
+	te.CheckError(1, fmt.Errorf("model has no layers"), (&Model{}).WriteInfo(buf))
+}
+
+//residualModel returns x -> relu(x + dense(tanh(dense(x))))
+func residualModel() (*Model, error) {
+	m, err := NewModel(3)
+	if err != nil {
+		return nil, err
+	}
+	steps := []struct {
+		name   string
+		cfg    *LayerConfig
+		inputs []string
+	}{
+		{"h1", &LayerConfig{Size: 4, FuncType: activation.FuncTypeTanh}, []string{Input}},
+		{"h2", &LayerConfig{Size: 3, FuncType: activation.FuncTypeIden}, []string{"h1"}},
+		{"skip", &LayerConfig{Type: LayerTypeAdd}, []string{"h2", Input}},
+		{"out", &LayerConfig{Type: LayerTypeActivation, FuncType: activation.FuncTypeElu, FuncParams: []float64{1}}, []string{"skip"}},
+	}
+	for _, s := range steps {
+		if err = m.AddConfig(s.name, s.cfg, s.inputs...); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+//wideAndDeepModel returns dense(concat(x, dense(dense(x)))*dense(x))
+func wideAndDeepModel() (*Model, error) {
+	m, err := NewModel(3)
+	if err != nil {
+		return nil, err
+	}
+	steps := []struct {
+		name   string
+		cfg    *LayerConfig
+		inputs []string
+	}{
+		{"deep1", &LayerConfig{Size: 5, FuncType: activation.FuncTypeSigmoid}, []string{Input}},
+		{"deep2", &LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh}, []string{"deep1"}},
+		{"wide", &LayerConfig{Type: LayerTypeConcat}, []string{Input, "deep2"}},
+		{"gate", &LayerConfig{Size: 5, FuncType: activation.FuncTypeSigmoid}, []string{Input}},
+		{"gated", &LayerConfig{Type: LayerTypeMul}, []string{"wide", "gate"}},
+		{"out", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{"gated"}},
+	}
+	for _, s := range steps {
+		if err = m.AddConfig(s.name, s.cfg, s.inputs...); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func TestModelGradients(t *testing.T) {
+	builders := []func() (*Model, error){residualModel, wideAndDeepModel}
+	in := mat.NewM64(3, 1, []float64{0.3, -0.6, 0.9})
+	for ind, build := range builders {
+		m, err := build()
+		if err != nil {
+			t.Errorf("test %d: failed to build model: %s", ind, err.Error())
+			continue
+		}
+		randomizeParams(int64(ind), m.Params())
+		exp := mat.NewM64(m.OutSize(), 1, nil)
+		if err = checkModelGradients(m, in, exp, activation.Power(0.5, 2)); err != nil {
+			t.Errorf("test %d: %s", ind, err.Error())
+		}
+	}
+}
+
+func TestModelAdd(t *testing.T) {
+	te := tester.NewT(t)
+	m, _ := NewModel(3)
+	m.AddConfig("a", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, Input)
+	tests := []struct {
+		name   string
+		cfg    *LayerConfig
+		inputs []string
+		err    error
+	}{
+		{"a", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{Input}, fmt.Errorf("layer 'a' already exists")},
+		{Input, &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{Input}, fmt.Errorf("invalid layer name 'input'")},
+		{"b", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, nil, fmt.Errorf("layer 'b' has no input")},
+		{"b", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{"c"}, fmt.Errorf("layer 'b': unknown input 'c'")},
+		{"b", &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden}, []string{"a", Input}, fmt.Errorf("layer 'b': dense layer expects 1 input received 2")},
+		{"b", &LayerConfig{Type: LayerTypeAdd}, []string{"a", Input}, fmt.Errorf("layer 'b': add layer: inputs[1] has size 3, expected 2")},
+		{"b", &LayerConfig{Type: LayerTypeConcat}, []string{"a"}, fmt.Errorf("layer 'b': concat layer expects at least 2 inputs received 1")},
+		{"b", &LayerConfig{Type: "conv"}, []string{"a"}, fmt.Errorf("layer 'b': invalid layer type 'conv'")},
+		{"b", &LayerConfig{Type: LayerTypeConcat}, []string{"a", Input}, nil},
+	}
+	for ind, test := range tests {
+		te.CheckError(ind, test.err, m.AddConfig(test.name, test.cfg, test.inputs...))
+	}
+	te.DeepEqual(0, "out size", 5, m.OutSize())
+}
+
+func TestTrainModel(t *testing.T) {
+	m, err := residualModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	target := func(x []float64) []float64 { return []float64{math.Max(x[0], 0), 0.5 * x[1], x[2]} }
+	test := NewRandomDataset(2, 3, 1000, 50, target)
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.05), 20, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := tr.testWith(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.Train(rand.NewSource(42), 0, 0.5, 1, NewRandomDataset(1, 3, 1000, 200, target), nil, test); err != nil {
+		t.Fatal(err)
+	}
+	after, err := tr.testWith(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after >= before {
+		t.Errorf("expected cost to decrease: before %f after %f", before, after)
+	}
+}
+
+type nopWriter struct{}
+
+func (w *nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
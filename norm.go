@@ -0,0 +1,214 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+const (
+	dftMomentum = 0.9
+	dftEpsilon  = 1e-5
+)
+
+//invSqrt returns x -> 1/sqrt(x+eps)
+func invSqrt(eps float64) activation.F {
+	return activation.F{
+		Func:  func(x float64) float64 { return 1 / math.Sqrt(x+eps) },
+		Deriv: func(x float64) float64 { return -0.5 / ((x + eps) * math.Sqrt(x+eps)) },
+	}
+}
+
+//normLayer is a batch normalization or a layer normalization layer: y=gamma*(x-mean)/sqrt(var+eps)+beta, gamma and beta having 1 value per row.
+//
+//batchnorm: the mean and variance of each row are computed over the colomns of the input, the samples of a batch when the trainer stacks them, while training. Running averages are used for inference: running=momentum*running+(1-momentum)*batch
+//
+//layernorm: the mean and variance of each colomn are computed over its rows, the same way while training and for inference
+type normLayer struct {
+	typ      string
+	size     int
+	momentum float64
+	eps      float64
+	training bool
+	gamma    *mat.M64
+	beta     *mat.M64
+	params   []*Param
+	mean     *mat.M64 //running mean, batchnorm only
+	variance *mat.M64 //running variance, batchnorm only
+	rec      recording
+}
+
+//newNormLayer returns a normalization layer for inputs of shape in
+func newNormLayer(cfg *LayerConfig, in Shape) (*normLayer, Shape, error) {
+	if cfg.Momentum < 0 || cfg.Momentum >= 1 {
+		return nil, Shape{}, fmt.Errorf("momentum must be in range [0;1[")
+	}
+	if cfg.Epsilon < 0 {
+		return nil, Shape{}, fmt.Errorf("epsilon must be >=0")
+	}
+	l := &normLayer{typ: cfg.Type, size: in.Rows, momentum: cfg.Momentum, eps: cfg.Epsilon}
+	if l.momentum == 0 {
+		l.momentum = dftMomentum
+	}
+	if l.eps == 0 {
+		l.eps = dftEpsilon
+	}
+	l.gamma, l.beta = filled(in.Rows, 1, 1), mat.NewM64(in.Rows, 1, nil)
+	l.params = []*Param{{Name: "gamma", Value: l.gamma, bias: true}, {Name: "beta", Value: l.beta, bias: true}}
+	if l.typ == LayerTypeBatchNorm {
+		l.mean, l.variance = mat.NewM64(in.Rows, 1, nil), filled(in.Rows, 1, 1)
+	}
+	return l, in, nil
+}
+
+//SetTraining switches between the training and the inference behaviour
+func (l *normLayer) SetTraining(training bool) {
+	l.training = training
+}
+
+//Buffers returns the running statistics of a batchnorm layer, saved with the model
+func (l *normLayer) Buffers() []*Param {
+	if l.typ != LayerTypeBatchNorm {
+		return nil
+	}
+	return []*Param{{Name: "mean", Value: l.mean}, {Name: "variance", Value: l.variance}}
+}
+
+func (l *normLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	r, c := x.Value.Dims()
+	if r != l.size {
+		return nil, fmt.Errorf("input has %d rows, expected %d", r, l.size)
+	}
+	var xhat *autodiff.Var
+	var err error
+	switch {
+	case l.typ == LayerTypeLayerNorm:
+		xhat, err = l.normalize(t, x, t.Const(filled(1, r, 1/float64(r))), t.Const(filled(r, 1, 1)), false)
+	case l.training:
+		//a single colomn is its own mean: it would be normalized to 0
+		if c < 2 {
+			return nil, fmt.Errorf("batchnorm needs a batch of at least 2 colomns in training, received %d", c)
+		}
+		xhat, err = l.normalize(t, x, t.Const(filled(c, 1, 1/float64(c))), t.Const(filled(1, c, 1)), true)
+	default:
+		xhat, err = l.infer(t, x)
+	}
+	if err != nil {
+		return nil, err
+	}
+	gamma, err := t.MatMul(params[0], t.Const(filled(1, c, 1)))
+	if err != nil {
+		return nil, err
+	}
+	if xhat, err = t.Mul(xhat, gamma); err != nil {
+		return nil, fmt.Errorf("gamma*x failed: %s", err.Error())
+	}
+	return t.Add(xhat, params[1])
+}
+
+//normalize records (x-mean)/sqrt(var+eps). avg computes the means by matrix multiplication and expand repeats them to the shape of x, on the left for colomns and on the right for rows
+func (l *normLayer) normalize(t *autodiff.Tape, x, avg, expand *autodiff.Var, rows bool) (*autodiff.Var, error) {
+	reduce := func(v *autodiff.Var) (*autodiff.Var, error) {
+		if rows {
+			return t.MatMul(v, avg)
+		}
+		return t.MatMul(avg, v)
+	}
+	repeat := func(v *autodiff.Var) (*autodiff.Var, error) {
+		if rows {
+			return t.MatMul(v, expand)
+		}
+		return t.MatMul(expand, v)
+	}
+	mean, err := reduce(x)
+	if err != nil {
+		return nil, fmt.Errorf("mean failed: %s", err.Error())
+	}
+	m, err := repeat(mean)
+	if err != nil {
+		return nil, err
+	}
+	d, err := t.Sub(x, m)
+	if err != nil {
+		return nil, err
+	}
+	sq, err := t.Mul(d, d)
+	if err != nil {
+		return nil, err
+	}
+	variance, err := reduce(sq)
+	if err != nil {
+		return nil, fmt.Errorf("variance failed: %s", err.Error())
+	}
+	if rows {
+		l.updateStats(mean.Value, variance.Value, x.Value.Size()/l.size)
+	}
+	inv, err := t.Map(variance, invSqrt(l.eps))
+	if err != nil {
+		return nil, err
+	}
+	if inv, err = repeat(inv); err != nil {
+		return nil, err
+	}
+	return t.Mul(d, inv)
+}
+
+//updateStats updates the running mean and variance with the statistics of a batch of n samples. The variance is unbiased
+func (l *normLayer) updateStats(mean, variance *mat.M64, n int) {
+	unbias := 1.0
+	if n > 1 {
+		unbias = float64(n) / float64(n-1)
+	}
+	for i := 0; i < l.size; i++ {
+		l.mean.Set(i, 0, l.momentum*l.mean.At(i, 0)+(1-l.momentum)*mean.At(i, 0))
+		l.variance.Set(i, 0, l.momentum*l.variance.At(i, 0)+(1-l.momentum)*unbias*variance.At(i, 0))
+	}
+}
+
+//infer records the normalization of x with the running statistics
+func (l *normLayer) infer(t *autodiff.Tape, x *autodiff.Var) (*autodiff.Var, error) {
+	_, c := x.Value.Dims()
+	mean, inv := mat.NewM64(l.size, c, nil), mat.NewM64(l.size, c, nil)
+	for i := 0; i < l.size; i++ {
+		s := 1 / math.Sqrt(l.variance.At(i, 0)+l.eps)
+		for j := 0; j < c; j++ {
+			mean.Set(i, j, l.mean.At(i, 0))
+			inv.Set(i, j, s)
+		}
+	}
+	d, err := t.Sub(x, t.Const(mean))
+	if err != nil {
+		return nil, err
+	}
+	return t.Mul(d, t.Const(inv))
+}
+
+//Forward to implement Layer
+func (l *normLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, l.params)
+}
+
+//Backward to implement Layer
+func (l *normLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *normLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *normLayer) Config() *LayerConfig {
+	if l.typ == LayerTypeLayerNorm {
+		return &LayerConfig{Type: l.typ, Epsilon: l.eps}
+	}
+	return &LayerConfig{Type: l.typ, Momentum: l.momentum, Epsilon: l.eps}
+}
@@ -0,0 +1,215 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//normModel returns dense(relu(norm(dense(x))))
+func normModel(typ string) (*Model, error) {
+	return NewSequential(3,
+		&LayerConfig{Size: 4, FuncType: activation.FuncTypeIden},
+		&LayerConfig{Type: typ},
+		&LayerConfig{Type: LayerTypeActivation, FuncType: activation.FuncTypeTanh},
+		&LayerConfig{Size: 2, FuncType: activation.FuncTypeIden},
+	)
+}
+
+func TestNormGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for ind, typ := range []string{LayerTypeBatchNorm, LayerTypeLayerNorm} {
+		m, err := normModel(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(int64(ind), m.Params())
+		m.SetTraining(true)
+		//a batch of 5 samples
+		in, exp := randM64(r, 3, 5), randM64(r, 2, 5)
+		if err = checkModelGradients(m, in, exp, activation.Power(0.5, 2)); err != nil {
+			t.Errorf("test %d: %s", ind, err.Error())
+		}
+	}
+}
+
+func TestNormForward(t *testing.T) {
+	te := tester.NewT(t)
+	in := mat.NewM64(2, 4, []float64{1, 2, 3, 4, 0, 0, 10, 10})
+	eps := 1e-5
+	tests := []struct {
+		cfg      *LayerConfig
+		training bool
+		exp      []float64
+	}{
+		//each row normalized over the batch
+		{&LayerConfig{Type: LayerTypeBatchNorm}, true, []float64{-1.5 / math.Sqrt(1.25+eps), -0.5 / math.Sqrt(1.25+eps), 0.5 / math.Sqrt(1.25+eps), 1.5 / math.Sqrt(1.25+eps), -5 / math.Sqrt(25+eps), -5 / math.Sqrt(25+eps), 5 / math.Sqrt(25+eps), 5 / math.Sqrt(25+eps)}},
+		//initial running statistics: mean 0, variance 1
+		{&LayerConfig{Type: LayerTypeBatchNorm}, false, []float64{1 / math.Sqrt(1+eps), 2 / math.Sqrt(1+eps), 3 / math.Sqrt(1+eps), 4 / math.Sqrt(1+eps), 0, 0, 10 / math.Sqrt(1+eps), 10 / math.Sqrt(1+eps)}},
+		//each colomn normalized over its rows
+		{&LayerConfig{Type: LayerTypeLayerNorm}, true, []float64{0.5 / math.Sqrt(0.25+eps), 1 / math.Sqrt(1+eps), -3.5 / math.Sqrt(12.25+eps), -3 / math.Sqrt(9+eps), -0.5 / math.Sqrt(0.25+eps), -1 / math.Sqrt(1+eps), 3.5 / math.Sqrt(12.25+eps), 3 / math.Sqrt(9+eps)}},
+		{&LayerConfig{Type: LayerTypeLayerNorm}, false, []float64{0.5 / math.Sqrt(0.25+eps), 1 / math.Sqrt(1+eps), -3.5 / math.Sqrt(12.25+eps), -3 / math.Sqrt(9+eps), -0.5 / math.Sqrt(0.25+eps), -1 / math.Sqrt(1+eps), 3.5 / math.Sqrt(12.25+eps), 3 / math.Sqrt(9+eps)}},
+	}
+	for ind, test := range tests {
+		m, err := NewSequential(2, test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetTraining(test.training)
+		res, err := m.FeedForward(in)
+		te.CheckError(ind, nil, err)
+		for i, v := range res.GetData() {
+			if math.Abs(v-test.exp[i]) > 1e-9 {
+				t.Errorf("test %d: output[%d]: expected %f received %f", ind, i, test.exp[i], v)
+			}
+		}
+	}
+}
+
+func TestBatchNormStatistics(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := NewSequential(1, &LayerConfig{Type: LayerTypeBatchNorm, Momentum: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _ := m.Layer("layer0")
+	bn := l.(*normLayer)
+	m.SetTraining(true)
+	//batch mean 2, unbiased variance 1
+	if _, err = m.FeedForward(mat.NewM64(1, 3, []float64{1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(0, "mean", mat.NewM64(1, 1, []float64{1}), bn.mean)
+	te.DeepEqual(0, "variance", mat.NewM64(1, 1, []float64{1}), bn.variance)
+	if _, err = m.FeedForward(mat.NewM64(1, 2, []float64{3, 5})); err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(1, "mean", mat.NewM64(1, 1, []float64{2.5}), bn.mean)
+	te.DeepEqual(1, "variance", mat.NewM64(1, 1, []float64{1.5}), bn.variance)
+	//statistics are not updated for inference
+	m.SetTraining(false)
+	res, err := m.FeedForward(mat.NewM64(1, 1, []float64{2.5}))
+	te.CheckError(2, nil, err)
+	te.DeepEqual(2, "output", mat.NewM64(1, 1, []float64{0}), res)
+	te.DeepEqual(2, "mean", mat.NewM64(1, 1, []float64{2.5}), bn.mean)
+	//a single sample can not be normalized over the batch in training
+	m.SetTraining(true)
+	_, err = m.FeedForward(mat.NewM64(1, 1, []float64{2.5}))
+	te.CheckError(3, fmt.Errorf("layer 'layer0': batchnorm needs a batch of at least 2 colomns in training, received 1"), err)
+	te.DeepEqual(3, "mean", mat.NewM64(1, 1, []float64{2.5}), bn.mean)
+
+	tests := []struct {
+		cfg *LayerConfig
+		err error
+	}{
+		{&LayerConfig{Type: LayerTypeBatchNorm, Momentum: 1}, fmt.Errorf("configs[0]: layer 'layer0': momentum must be in range [0;1[")},
+		{&LayerConfig{Type: LayerTypeLayerNorm, Epsilon: -1}, fmt.Errorf("configs[0]: layer 'layer0': epsilon must be >=0")},
+	}
+	for ind, test := range tests {
+		_, err = NewSequential(2, test.cfg)
+		te.CheckError(ind, test.err, err)
+	}
+}
+
+func TestModelEncode(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := normModel(LayerTypeBatchNorm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.AddConfig("norm", &LayerConfig{Type: LayerTypeLayerNorm, Epsilon: 1e-3}, "layer3"); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.AddConfig("skip", &LayerConfig{Type: LayerTypeConcat}, "norm", Input); err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(3, m.Params())
+	r := rand.New(rand.NewSource(4))
+	in := randM64(r, 3, 6)
+	m.SetTraining(true)
+	if _, err = m.FeedForward(in); err != nil {
+		t.Fatal(err)
+	}
+	m.SetTraining(false)
+	exp, err := m.FeedForward(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, m.Encode(buf))
+	d, err := DecodeModel(bytes.NewReader(buf.Bytes()))
+	te.CheckError(0, nil, err)
+	if err != nil {
+		return
+	}
+	res, err := d.FeedForward(in)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "output", exp, res)
+	te.DeepEqual(0, "out shape", m.OutShape(), d.OutShape())
+	l, _ := m.Layer("layer1")
+	dl, _ := d.Layer("layer1")
+	te.DeepEqual(0, "buffers", l.(buffered).Buffers(), dl.(buffered).Buffers())
+	dl, _ = d.Layer("norm")
+	te.DeepEqual(0, "config", &LayerConfig{Type: LayerTypeLayerNorm, Epsilon: 1e-3}, dl.Config())
+	//custom activation functions can not be decoded, so they are not encoded
+	c, err := NewSequential(2, &LayerConfig{Size: 1, F: activation.Iden()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	te.CheckError(1, fmt.Errorf("layer 'layer0': custom activation functions can not be encoded"), c.Encode(buf))
+	te.DeepEqual(1, "written", 0, buf.Len())
+
+	tests := []struct {
+		def string
+		err error
+	}{
+		{`{"version":2}`, fmt.Errorf("unsupported model version 2")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1}}`, fmt.Errorf("model has no layers")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1},"layers":[{"name":"a","config":{"type":"layernorm"},"inputs":["b"]}]}`, fmt.Errorf("layer 'a': unknown input 'b'")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1},"layers":[{"name":"a","config":{"type":"layernorm"},"inputs":["input"]}]}`, fmt.Errorf("layer 'a': params: received 0 values, expected 2")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1},"layers":[{"name":"a","config":{"type":"layernorm"},"inputs":["input"],"params":{"gamma":{"rows":2,"cols":1,"data":[1,1]},"b":{"rows":2,"cols":1,"data":[0,0]}}}]}`, fmt.Errorf("layer 'a': params: missing 'beta'")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1},"layers":[{"name":"a","config":{"type":"layernorm"},"inputs":["input"],"params":{"gamma":{"rows":2,"cols":1,"data":[1,1]},"beta":{"rows":1,"cols":2,"data":[0,0]}}}]}`, fmt.Errorf("layer 'a': params: 'beta' has shape 1x2 with 2 values, expected 2x1")},
+		{`{"version":1,"input":{"rows":2,"height":1,"width":1},"layers":[{"name":"a","config":{"type":"batchnorm"},"inputs":["input"],"params":{"gamma":{"rows":2,"cols":1,"data":[1,1]},"beta":{"rows":2,"cols":1,"data":[0,0]}}}]}`, fmt.Errorf("layer 'a': buffers: received 0 values, expected 2")},
+	}
+	for ind, test := range tests {
+		_, err := DecodeModel(strings.NewReader(test.def))
+		te.CheckError(ind, test.err, err)
+	}
+}
+
+func TestTrainBatchNormModel(t *testing.T) {
+	m, err := normModel(LayerTypeBatchNorm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	target := func(x []float64) []float64 { return []float64{x[0] * x[1], x[2]} }
+	test := NewRandomDataset(2, 3, 1000, 50, target)
+	tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.1), 30, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := tr.testWith(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tr.Train(rand.NewSource(42), 0, 0.5, 8, NewRandomDataset(1, 3, 1000, 200, target), nil, test); err != nil {
+		t.Fatal(err)
+	}
+	after, err := tr.testWith(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after >= before {
+		t.Errorf("expected cost to decrease: before %f after %f", before, after)
+	}
+}
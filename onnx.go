@@ -0,0 +1,791 @@
+package nn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/proto"
+)
+
+//ONNXOpset is the version of the default ONNX operator set used by the exported models
+const ONNXOpset = 13
+
+//onnxIRVersion is the version of the ONNX format of opset 13
+const onnxIRVersion = 7
+
+//onnxProducer is the producer name of the exported models
+const onnxProducer = "github.com/klahssen/nn"
+
+//data types of ONNX tensors
+const (
+	onnxFloat  = 1
+	onnxDouble = 11
+)
+
+//types of ONNX attributes
+const (
+	onnxAttrFloat = 1
+	onnxAttrInt   = 2
+)
+
+//onnxActivations maps the activation functions to ONNX operators
+var onnxActivations = map[string]string{
+	activation.FuncTypeSigmoid:   "Sigmoid",
+	activation.FuncTypeTanh:      "Tanh",
+	activation.FuncTypeRelu:      "Relu",
+	activation.FuncTypeLeakyRelu: "LeakyRelu",
+	activation.FuncTypeElu:       "Elu",
+	activation.FuncTypeIden:      "Identity",
+}
+
+//ONNXOptions sets how a network is exported to ONNX
+type ONNXOptions struct {
+	MatMul bool   //each dense layer is a MatMul node followed by an Add node instead of a Gemm node
+	Input  string //name of the input, "input" if empty
+	Output string //name of the output, "output" if empty
+}
+
+//onnxModel is an ONNX ModelProto
+type onnxModel struct {
+	irVersion int64
+	opset     int64 //version of the default operator set
+	producer  string
+	graph     *onnxGraph
+}
+
+//onnxGraph is an ONNX GraphProto
+type onnxGraph struct {
+	name         string
+	nodes        []*onnxNode
+	initializers []*onnxTensor
+	inputs       []*onnxValue
+	outputs      []*onnxValue
+}
+
+//onnxNode is an ONNX NodeProto
+type onnxNode struct {
+	name    string
+	opType  string
+	domain  string
+	inputs  []string
+	outputs []string
+	attrs   []*onnxAttr
+}
+
+//onnxAttr is an ONNX AttributeProto of type float or int
+type onnxAttr struct {
+	name string
+	typ  int64
+	f    float32
+	i    int64
+}
+
+//onnxTensor is an ONNX TensorProto of floats or doubles
+type onnxTensor struct {
+	name     string
+	dims     []int64
+	dataType int64
+	values   []float64
+}
+
+//onnxValue is an ONNX ValueInfoProto of a tensor
+type onnxValue struct {
+	name     string
+	elemType int64
+	dims     []onnxDim
+}
+
+//onnxDim is a dimension of a tensor, param naming a dimension of variable size such as the batch size
+type onnxDim struct {
+	value int64
+	param string
+}
+
+func (m *onnxModel) encode() *proto.Encoder {
+	e := &proto.Encoder{}
+	e.Int(1, m.irVersion)
+	e.String(2, m.producer)
+	e.Message(7, m.graph.encode())
+	opset := &proto.Encoder{}
+	opset.Int(2, m.opset)
+	e.Message(8, opset)
+	return e
+}
+
+func (g *onnxGraph) encode() *proto.Encoder {
+	e := &proto.Encoder{}
+	for _, n := range g.nodes {
+		e.Message(1, n.encode())
+	}
+	e.String(2, g.name)
+	for _, t := range g.initializers {
+		e.Message(5, t.encode())
+	}
+	for _, v := range g.inputs {
+		e.Message(11, v.encode())
+	}
+	for _, v := range g.outputs {
+		e.Message(12, v.encode())
+	}
+	return e
+}
+
+func (n *onnxNode) encode() *proto.Encoder {
+	e := &proto.Encoder{}
+	for _, in := range n.inputs {
+		e.String(1, in)
+	}
+	for _, out := range n.outputs {
+		e.String(2, out)
+	}
+	e.String(3, n.name)
+	e.String(4, n.opType)
+	if n.domain != "" {
+		e.String(7, n.domain)
+	}
+	for _, a := range n.attrs {
+		e.Message(5, a.encode())
+	}
+	return e
+}
+
+func (a *onnxAttr) encode() *proto.Encoder {
+	e := &proto.Encoder{}
+	e.String(1, a.name)
+	switch a.typ {
+	case onnxAttrFloat:
+		e.Float(2, a.f)
+	case onnxAttrInt:
+		e.Int(3, a.i)
+	}
+	e.Int(20, a.typ)
+	return e
+}
+
+//encode writes the values of the tensor as little endian raw data of its type
+func (t *onnxTensor) encode() *proto.Encoder {
+	e := &proto.Encoder{}
+	for _, d := range t.dims {
+		e.Int(1, d)
+	}
+	e.Int(2, t.dataType)
+	e.String(8, t.name)
+	var raw []byte
+	for _, v := range t.values {
+		if t.dataType == onnxDouble {
+			raw = binary.LittleEndian.AppendUint64(raw, math.Float64bits(v))
+			continue
+		}
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(float32(v)))
+	}
+	e.Raw(9, raw)
+	return e
+}
+
+func (v *onnxValue) encode() *proto.Encoder {
+	shape := &proto.Encoder{}
+	for _, d := range v.dims {
+		dim := &proto.Encoder{}
+		if d.param != "" {
+			dim.String(2, d.param)
+		} else {
+			dim.Int(1, d.value)
+		}
+		shape.Message(1, dim)
+	}
+	tensor := &proto.Encoder{}
+	tensor.Int(1, v.elemType)
+	tensor.Message(2, shape)
+	typ := &proto.Encoder{}
+	typ.Message(1, tensor)
+	e := &proto.Encoder{}
+	e.String(1, v.name)
+	e.Message(2, typ)
+	return e
+}
+
+//parseONNXModel decodes an ONNX ModelProto. Fields which are not used by the package are ignored
+func parseONNXModel(b []byte) (*onnxModel, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &onnxModel{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			m.irVersion = f.Int()
+		case 2:
+			m.producer = string(f.Bytes)
+		case 7:
+			if m.graph, err = parseONNXGraph(f.Bytes); err != nil {
+				return nil, fmt.Errorf("graph: %s", err.Error())
+			}
+		case 8:
+			opset, err := proto.Decode(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("opset_import: %s", err.Error())
+			}
+			domain, version := "", int64(0)
+			for _, o := range opset {
+				switch o.Num {
+				case 1:
+					domain = string(o.Bytes)
+				case 2:
+					version = o.Int()
+				}
+			}
+			if domain == "" || domain == "ai.onnx" {
+				m.opset = version
+			}
+		}
+	}
+	if m.graph == nil {
+		return nil, fmt.Errorf("model has no graph")
+	}
+	return m, nil
+}
+
+func parseONNXGraph(b []byte) (*onnxGraph, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	g := &onnxGraph{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			n, err := parseONNXNode(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("node[%d]: %s", len(g.nodes), err.Error())
+			}
+			g.nodes = append(g.nodes, n)
+		case 2:
+			g.name = string(f.Bytes)
+		case 5:
+			t, err := parseONNXTensor(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("initializer[%d]: %s", len(g.initializers), err.Error())
+			}
+			g.initializers = append(g.initializers, t)
+		case 11, 12:
+			v, err := parseONNXValue(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("input or output '%s': %s", v.name, err.Error())
+			}
+			if f.Num == 11 {
+				g.inputs = append(g.inputs, v)
+			} else {
+				g.outputs = append(g.outputs, v)
+			}
+		}
+	}
+	return g, nil
+}
+
+func parseONNXNode(b []byte) (*onnxNode, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	n := &onnxNode{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			n.inputs = append(n.inputs, string(f.Bytes))
+		case 2:
+			n.outputs = append(n.outputs, string(f.Bytes))
+		case 3:
+			n.name = string(f.Bytes)
+		case 4:
+			n.opType = string(f.Bytes)
+		case 7:
+			n.domain = string(f.Bytes)
+		case 5:
+			a, err := parseONNXAttr(f.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("attribute[%d]: %s", len(n.attrs), err.Error())
+			}
+			n.attrs = append(n.attrs, a)
+		}
+	}
+	return n, nil
+}
+
+//parseONNXAttr decodes an attribute, the values of types other than float and int being ignored
+func parseONNXAttr(b []byte) (*onnxAttr, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	a := &onnxAttr{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			a.name = string(f.Bytes)
+		case 2:
+			a.f = f.Float()
+		case 3:
+			a.i = f.Int()
+		case 20:
+			a.typ = f.Int()
+		}
+	}
+	return a, nil
+}
+
+//parseONNXTensor decodes a tensor of floats or doubles, stored as typed or raw data
+func parseONNXTensor(b []byte) (*onnxTensor, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	t := &onnxTensor{}
+	var floats []float32
+	var raw []byte
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			if t.dims, err = proto.Ints(t.dims, f); err != nil {
+				return nil, err
+			}
+		case 2:
+			t.dataType = f.Int()
+		case 4:
+			if floats, err = proto.Floats(floats, f); err != nil {
+				return nil, err
+			}
+		case 8:
+			t.name = string(f.Bytes)
+		case 9:
+			raw = f.Bytes
+		case 10:
+			if t.values, err = proto.Doubles(t.values, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	size := int64(1)
+	for i, d := range t.dims {
+		if d < 0 {
+			return nil, fmt.Errorf("tensor '%s': dimension %d is %d, expected >=0", t.name, i, d)
+		}
+		if d > 0 && size > math.MaxInt64/d {
+			return nil, fmt.Errorf("tensor '%s': the number of values overflows", t.name)
+		}
+		size *= d
+	}
+	switch t.dataType {
+	case onnxFloat:
+		if raw != nil {
+			for ; len(raw) >= 4; raw = raw[4:] {
+				floats = append(floats, math.Float32frombits(binary.LittleEndian.Uint32(raw)))
+			}
+		}
+		for _, v := range floats {
+			t.values = append(t.values, float64(v))
+		}
+	case onnxDouble:
+		if raw != nil {
+			for ; len(raw) >= 8; raw = raw[8:] {
+				t.values = append(t.values, math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("tensor '%s': unsupported data type %d, expected float or double", t.name, t.dataType)
+	}
+	if int64(len(t.values)) != size {
+		return nil, fmt.Errorf("tensor '%s': received %d values, expected %d", t.name, len(t.values), size)
+	}
+	return t, nil
+}
+
+func parseONNXValue(b []byte) (*onnxValue, error) {
+	v := &onnxValue{}
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return v, err
+	}
+	var typ []proto.Field
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			v.name = string(f.Bytes)
+		case 2:
+			if typ, err = proto.Decode(f.Bytes); err != nil {
+				return v, err
+			}
+		}
+	}
+	for _, f := range typ {
+		if f.Num != 1 {
+			continue
+		}
+		tensor, err := proto.Decode(f.Bytes)
+		if err != nil {
+			return v, err
+		}
+		for _, tf := range tensor {
+			switch tf.Num {
+			case 1:
+				v.elemType = tf.Int()
+			case 2:
+				if v.dims, err = parseONNXShape(tf.Bytes); err != nil {
+					return v, err
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+func parseONNXShape(b []byte) ([]onnxDim, error) {
+	fields, err := proto.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	var dims []onnxDim
+	for _, f := range fields {
+		if f.Num != 1 {
+			continue
+		}
+		dim, err := proto.Decode(f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		d := onnxDim{}
+		for _, df := range dim {
+			switch df.Num {
+			case 1:
+				d.value = df.Int()
+			case 2:
+				d.param = string(df.Bytes)
+			}
+		}
+		dims = append(dims, d)
+	}
+	return dims, nil
+}
+
+//attr returns the attribute of the node named name, nil if none
+func (n *onnxNode) attr(name string) *onnxAttr {
+	for _, a := range n.attrs {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+//WriteONNX writes the network as an ONNX model of opset ONNXOpset. The input is a float tensor of shape [N, InSize], N being the batch size, and the output a float tensor of shape [N, OutSize]. Each layer is a Gemm node, or MatMul and Add nodes, followed by the node of its activation. Weights are converted to float32, and layers with custom activation functions can not be exported
+func (ff *FC) WriteONNX(w io.Writer, opts ONNXOptions) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	if opts.Input == "" {
+		opts.Input = "input"
+	}
+	if opts.Output == "" {
+		opts.Output = "output"
+	}
+	g := &onnxGraph{
+		name:    "fc",
+		inputs:  []*onnxValue{{name: opts.Input, elemType: onnxFloat, dims: []onnxDim{{param: "N"}, {value: int64(ff.inSize)}}}},
+		outputs: []*onnxValue{{name: opts.Output, elemType: onnxFloat, dims: []onnxDim{{param: "N"}, {value: int64(ff.outSize)}}}},
+	}
+	prev := opts.Input
+	for i, l := range ff.layers {
+		op, ok := onnxActivations[l.ftype]
+		if !ok {
+			return fmt.Errorf("layers[%d]: activation '%s' can not be exported to ONNX", i, l.ftype)
+		}
+		name := fmt.Sprintf("layer%d", i)
+		w, b := name+".w", name+".b"
+		g.initializers = append(g.initializers, &onnxTensor{name: b, dims: []int64{int64(l.outSize)}, dataType: onnxFloat, values: l.b.GetData()})
+		if opts.MatMul {
+			//MatMul computes input*w, w being transposed
+			wt := make([]float64, 0, l.inSize*l.outSize)
+			for j := 0; j < l.inSize; j++ {
+				for k := 0; k < l.outSize; k++ {
+					wt = append(wt, l.w.At(k, j))
+				}
+			}
+			g.initializers = append(g.initializers, &onnxTensor{name: w, dims: []int64{int64(l.inSize), int64(l.outSize)}, dataType: onnxFloat, values: wt})
+			g.nodes = append(g.nodes,
+				&onnxNode{name: name + "_matmul", opType: "MatMul", inputs: []string{prev, w}, outputs: []string{name + "_xw"}},
+				&onnxNode{name: name + "_add", opType: "Add", inputs: []string{name + "_xw", b}, outputs: []string{name + "_z"}},
+			)
+		} else {
+			g.initializers = append(g.initializers, &onnxTensor{name: w, dims: []int64{int64(l.outSize), int64(l.inSize)}, dataType: onnxFloat, values: l.w.GetData()})
+			g.nodes = append(g.nodes, &onnxNode{name: name + "_gemm", opType: "Gemm", inputs: []string{prev, w, b}, outputs: []string{name + "_z"},
+				attrs: []*onnxAttr{{name: "transB", typ: onnxAttrInt, i: 1}}})
+		}
+		out := name + "_out"
+		if i == len(ff.layers)-1 {
+			out = opts.Output
+		}
+		act := &onnxNode{name: name + "_" + l.ftype, opType: op, inputs: []string{name + "_z"}, outputs: []string{out}}
+		if op == "LeakyRelu" || op == "Elu" {
+			act.attrs = []*onnxAttr{{name: "alpha", typ: onnxAttrFloat, f: float32(l.fparams[0])}}
+		}
+		g.nodes = append(g.nodes, act)
+		prev = out
+	}
+	m := &onnxModel{irVersion: onnxIRVersion, opset: ONNXOpset, producer: onnxProducer, graph: g}
+	_, err := w.Write(m.encode().Bytes())
+	return err
+}
+
+//String names the node in errors, by its output if it has no name
+func (n *onnxNode) String() string {
+	if n.name == "" && len(n.outputs) > 0 {
+		return fmt.Sprintf("%s producing '%s'", n.opType, n.outputs[0])
+	}
+	return fmt.Sprintf("%s '%s'", n.opType, n.name)
+}
+
+//float returns the value of the float attribute name of the node, dft if it is not set
+func (n *onnxNode) float(name string, dft float64) float64 {
+	if a := n.attr(name); a != nil {
+		return float64(a.f)
+	}
+	return dft
+}
+
+//int returns the value of the int attribute name of the node, dft if it is not set
+func (n *onnxNode) int(name string, dft int64) int64 {
+	if a := n.attr(name); a != nil {
+		return a.i
+	}
+	return dft
+}
+
+//onnxDense is a dense layer read from ONNX nodes
+type onnxDense struct {
+	in, out int
+	w       *mat.M64 //out*in
+	b       []float64
+	ftype   string //empty until an activation node is read
+	fparams []float64
+}
+
+//onnxDefaults are the parameters of the activation functions when the attributes are not set
+var onnxDefaults = map[string][]float64{activation.FuncTypeLeakyRelu: {0.01}, activation.FuncTypeElu: {1}}
+
+//ReadONNX reads a fully connected network from an ONNX model whose graph is a chain of dense layers from its input to its output. A dense layer is a Gemm node, or a MatMul node followed by an optional Add node, whose weights and biases are initializers, followed by an optional activation node: Sigmoid, Tanh, Relu, LeakyRelu, Elu or Identity. Other operators are rejected
+func ReadONNX(r io.Reader) (*FC, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseONNXModel(b)
+	if err != nil {
+		return nil, err
+	}
+	g := m.graph
+	inits := map[string]*onnxTensor{}
+	for _, t := range g.initializers {
+		inits[t.name] = t
+	}
+	//older models also list the initializers as inputs
+	var inputs []*onnxValue
+	for _, v := range g.inputs {
+		if _, ok := inits[v.name]; !ok {
+			inputs = append(inputs, v)
+		}
+	}
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("graph has %d inputs, expected 1", len(inputs))
+	}
+	if len(g.outputs) != 1 {
+		return nil, fmt.Errorf("graph has %d outputs, expected 1", len(g.outputs))
+	}
+	consumers := map[string][]*onnxNode{}
+	for _, n := range g.nodes {
+		if n.domain != "" && n.domain != "ai.onnx" {
+			return nil, fmt.Errorf("node %s: unsupported domain '%s'", n, n.domain)
+		}
+		if len(n.outputs) != 1 {
+			return nil, fmt.Errorf("node %s: received %d outputs, expected 1", n, len(n.outputs))
+		}
+		for _, in := range n.inputs {
+			consumers[in] = append(consumers[in], n)
+		}
+	}
+	inSize := 0
+	if dims := inputs[0].dims; len(dims) > 0 {
+		inSize = int(dims[len(dims)-1].value)
+	}
+	size := inSize //size of the current tensor, 0 if unknown
+	var layers []*onnxDense
+	var last *onnxDense
+	visited := map[*onnxNode]bool{}
+	for cur := inputs[0].name; cur != g.outputs[0].name; {
+		next := consumers[cur]
+		if len(next) == 0 {
+			return nil, fmt.Errorf("tensor '%s' does not lead to the output '%s'", cur, g.outputs[0].name)
+		}
+		if len(next) > 1 {
+			return nil, fmt.Errorf("tensor '%s' is used by %d nodes, only chains of nodes are supported", cur, len(next))
+		}
+		n := next[0]
+		if visited[n] {
+			return nil, fmt.Errorf("node %s: the graph has a cycle", n)
+		}
+		visited[n] = true
+		if len(n.inputs) == 0 || n.inputs[0] != cur {
+			return nil, fmt.Errorf("node %s: tensor '%s' must be its first input", n, cur)
+		}
+		switch n.opType {
+		case "Gemm", "MatMul":
+			if last, err = onnxLinear(n, inits, size); err != nil {
+				return nil, fmt.Errorf("node %s: %s", n, err.Error())
+			}
+			layers = append(layers, last)
+			if inSize == 0 && len(layers) == 1 {
+				inSize = last.in
+			}
+			size = last.out
+		case "Add":
+			if last == nil || last.ftype != "" {
+				return nil, fmt.Errorf("node %s: Add must follow a Gemm or MatMul node", n)
+			}
+			bias, err := onnxBias(n, inits, 1, len(last.b))
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %s", n, err.Error())
+			}
+			for i, v := range bias {
+				last.b[i] += v
+			}
+		case "Identity":
+		default:
+			ftype := ""
+			for ft, op := range onnxActivations {
+				if op == n.opType {
+					ftype = ft
+				}
+			}
+			if ftype == "" {
+				return nil, fmt.Errorf("node %s: unsupported operator, expected Gemm, MatMul, Add, Sigmoid, Tanh, Relu, LeakyRelu, Elu or Identity", n)
+			}
+			if last == nil || last.ftype != "" {
+				return nil, fmt.Errorf("node %s: activation must follow a dense layer", n)
+			}
+			last.ftype = ftype
+			if dft, ok := onnxDefaults[ftype]; ok {
+				last.fparams = []float64{n.float("alpha", dft[0])}
+			}
+		}
+		cur = n.outputs[0]
+	}
+	for _, n := range g.nodes {
+		if !visited[n] {
+			return nil, fmt.Errorf("node %s is not on the path from the input to the output", n)
+		}
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("graph has no dense layer")
+	}
+	ff, err := NewFC(inSize)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]*LayerConfig, len(layers))
+	for i, l := range layers {
+		if l.ftype == "" {
+			l.ftype = activation.FuncTypeIden
+		}
+		configs[i] = &LayerConfig{Size: l.out, FuncType: l.ftype, FuncParams: l.fparams}
+	}
+	if err = ff.SetLayers(configs...); err != nil {
+		return nil, err
+	}
+	for i, l := range layers {
+		ff.layers[i].w.SetData(l.w.GetData())
+		ff.layers[i].b.SetData(l.b)
+	}
+	return ff, nil
+}
+
+//onnxLinear returns the dense layer of a Gemm or MatMul node whose input has size values, 0 if unknown
+func onnxLinear(n *onnxNode, inits map[string]*onnxTensor, size int) (*onnxDense, error) {
+	if len(n.inputs) < 2 {
+		return nil, fmt.Errorf("received %d inputs, expected at least 2", len(n.inputs))
+	}
+	if n.opType == "MatMul" && len(n.inputs) != 2 {
+		return nil, fmt.Errorf("received %d inputs, expected 2", len(n.inputs))
+	}
+	w, ok := inits[n.inputs[1]]
+	if !ok {
+		return nil, fmt.Errorf("weights '%s' must be an initializer", n.inputs[1])
+	}
+	if len(w.dims) != 2 {
+		return nil, fmt.Errorf("weights '%s' have %d dimensions, expected 2", w.name, len(w.dims))
+	}
+	if w.dims[0] <= 0 || w.dims[1] <= 0 {
+		return nil, fmt.Errorf("weights '%s' have dimensions %dx%d, expected >0", w.name, w.dims[0], w.dims[1])
+	}
+	//w is stored as in*out unless transposed
+	in, out := int(w.dims[0]), int(w.dims[1])
+	alpha, trans := 1.0, false
+	if n.opType == "Gemm" {
+		if n.int("transA", 0) != 0 {
+			return nil, fmt.Errorf("transA is not supported")
+		}
+		alpha, trans = n.float("alpha", 1), n.int("transB", 0) != 0
+		if trans {
+			in, out = out, in
+		}
+	}
+	if size > 0 && in != size {
+		return nil, fmt.Errorf("weights '%s' have %d inputs, expected %d", w.name, in, size)
+	}
+	l := &onnxDense{in: in, out: out, w: mat.NewM64(out, in, nil), b: make([]float64, out)}
+	for i := 0; i < out; i++ {
+		for j := 0; j < in; j++ {
+			v := w.values[j*out+i]
+			if trans {
+				v = w.values[i*in+j]
+			}
+			l.w.Set(i, j, alpha*v)
+		}
+	}
+	if n.opType == "Gemm" && len(n.inputs) > 2 && n.inputs[2] != "" {
+		var err error
+		if l.b, err = onnxBias(n, inits, 2, out); err != nil {
+			return nil, err
+		}
+		for i := range l.b {
+			l.b[i] *= n.float("beta", 1)
+		}
+	}
+	return l, nil
+}
+
+//onnxBias returns the bias of size values which is the ith input of the node, broadcast if it has a single value
+func onnxBias(n *onnxNode, inits map[string]*onnxTensor, i, size int) ([]float64, error) {
+	if len(n.inputs) <= i {
+		return nil, fmt.Errorf("received %d inputs, expected %d", len(n.inputs), i+1)
+	}
+	t, ok := inits[n.inputs[i]]
+	if !ok {
+		return nil, fmt.Errorf("bias '%s' must be an initializer", n.inputs[i])
+	}
+	b := make([]float64, size)
+	switch len(t.values) {
+	case 1:
+		for j := range b {
+			b[j] = t.values[0]
+		}
+	case size:
+		copy(b, t.values)
+	default:
+		return nil, fmt.Errorf("bias '%s' has %d values, expected %d", t.name, len(t.values), size)
+	}
+	return b, nil
+}
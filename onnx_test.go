@@ -0,0 +1,316 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//runONNX evaluates the dense graphs written by WriteONNX on a single input row
+func runONNX(g *onnxGraph, in []float64) ([]float64, error) {
+	tensors := map[string]*onnxTensor{}
+	for _, t := range g.initializers {
+		tensors[t.name] = t
+	}
+	values := map[string][]float64{g.inputs[0].name: in}
+	for _, n := range g.nodes {
+		x := values[n.inputs[0]]
+		var out []float64
+		switch n.opType {
+		case "Gemm", "MatMul":
+			w := tensors[n.inputs[1]]
+			rows, cols := int(w.dims[0]), int(w.dims[1])
+			if n.opType == "Gemm" {
+				if a := n.attr("transB"); a == nil || a.i != 1 {
+					return nil, fmt.Errorf("node '%s': expected transB=1", n.name)
+				}
+				rows, cols = cols, rows
+			}
+			out = make([]float64, cols)
+			for j := range out {
+				for k := 0; k < rows; k++ {
+					if n.opType == "Gemm" {
+						out[j] += x[k] * w.values[j*rows+k]
+					} else {
+						out[j] += x[k] * w.values[k*cols+j]
+					}
+				}
+				if n.opType == "Gemm" {
+					out[j] += tensors[n.inputs[2]].values[j]
+				}
+			}
+		case "Add":
+			b := tensors[n.inputs[1]].values
+			out = make([]float64, len(x))
+			for j := range out {
+				out[j] = x[j] + b[j]
+			}
+		default:
+			var params []float64
+			if a := n.attr("alpha"); a != nil {
+				params = []float64{float64(a.f)}
+			}
+			ftype := ""
+			for ft, op := range onnxActivations {
+				if op == n.opType {
+					ftype = ft
+				}
+			}
+			f, err := activation.GetF(ftype, params)
+			if err != nil {
+				return nil, fmt.Errorf("node '%s': %s", n.name, err.Error())
+			}
+			out = make([]float64, len(x))
+			for j := range out {
+				out[j] = f.Func(x[j])
+			}
+		}
+		values[n.outputs[0]] = out
+	}
+	return values[g.outputs[0].name], nil
+}
+
+func TestWriteONNX(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 4, FuncType: activation.FuncTypeTanh},
+		{Size: 4, FuncType: activation.FuncTypeLeakyRelu, FuncParams: []float64{0.1}},
+		{Size: 3, FuncType: activation.FuncTypeElu, FuncParams: []float64{0.5}},
+		{Size: 3, FuncType: activation.FuncTypeRelu},
+		{Size: 2, FuncType: activation.FuncTypeSigmoid},
+		{Size: 2, FuncType: activation.FuncTypeIden},
+	}
+	f, err := mockRandFC(3, 3, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []float64{0.5, -1, 2}
+	pred, err := f.FeedForward(mat.NewM64(3, 1, in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts    ONNXOptions
+		input   string
+		output  string
+		opTypes []string
+	}{
+		{ONNXOptions{}, "input", "output", []string{"Gemm", "Tanh", "Gemm", "LeakyRelu", "Gemm", "Elu", "Gemm", "Relu", "Gemm", "Sigmoid", "Gemm", "Identity"}},
+		{ONNXOptions{MatMul: true, Input: "x", Output: "y"}, "x", "y", []string{"MatMul", "Add", "Tanh", "MatMul", "Add", "LeakyRelu", "MatMul", "Add", "Elu", "MatMul", "Add", "Relu", "MatMul", "Add", "Sigmoid", "MatMul", "Add", "Identity"}},
+	}
+	for ind, test := range tests {
+		buf := &bytes.Buffer{}
+		te.CheckError(ind, nil, f.WriteONNX(buf, test.opts))
+		m, err := parseONNXModel(buf.Bytes())
+		te.CheckError(ind, nil, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "ir version", int64(7), m.irVersion)
+		te.DeepEqual(ind, "opset", int64(ONNXOpset), m.opset)
+		te.DeepEqual(ind, "producer", onnxProducer, m.producer)
+		g := m.graph
+		te.DeepEqual(ind, "input", []*onnxValue{{name: test.input, elemType: onnxFloat, dims: []onnxDim{{param: "N"}, {value: 3}}}}, g.inputs)
+		te.DeepEqual(ind, "output", []*onnxValue{{name: test.output, elemType: onnxFloat, dims: []onnxDim{{param: "N"}, {value: 2}}}}, g.outputs)
+		var ops []string
+		for _, n := range g.nodes {
+			ops = append(ops, n.opType)
+		}
+		te.DeepEqual(ind, "nodes", test.opTypes, ops)
+		te.DeepEqual(ind, "initializers", 2*len(configs), len(g.initializers))
+		//activation node of the second layer
+		te.DeepEqual(ind, "leaky relu alpha", float32(0.1), g.nodes[len(test.opTypes)/len(configs)*2-1].attr("alpha").f)
+		//the parsed graph computes the predictions of the network, with float32 weights
+		out, err := runONNX(g, in)
+		te.CheckError(ind, nil, err)
+		for i, v := range out {
+			if math.Abs(v-pred.At(i, 0)) > 1e-6 {
+				t.Errorf("test %d: output %d: expected %f received %f", ind, i, pred.At(i, 0), v)
+			}
+		}
+	}
+}
+
+func TestWriteONNXErrors(t *testing.T) {
+	te := tester.NewT(t)
+	var nilFC *FC
+	te.CheckError(0, fmt.Errorf("network is nil"), nilFC.WriteONNX(&bytes.Buffer{}, ONNXOptions{}))
+	f, err := NewFC(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(1, fmt.Errorf("network has no layers"), f.WriteONNX(&bytes.Buffer{}, ONNXOptions{}))
+	if err = f.SetLayers(&LayerConfig{Size: 1, F: activation.Iden()}); err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(2, fmt.Errorf("layers[0]: activation 'custom' can not be exported to ONNX"), f.WriteONNX(&bytes.Buffer{}, ONNXOptions{}))
+}
+
+func TestParseONNXTensor(t *testing.T) {
+	te := tester.NewT(t)
+	for ind, test := range []struct {
+		t   *onnxTensor
+		err error
+	}{
+		{&onnxTensor{name: "w", dims: []int64{2, 2}, dataType: onnxFloat, values: []float64{1, -2, 0.5, 4}}, nil},
+		{&onnxTensor{name: "w", dims: []int64{3}, dataType: onnxDouble, values: []float64{0.1, 0.2, 0.3}}, nil},
+		{&onnxTensor{name: "w", dims: []int64{3}, dataType: onnxFloat, values: []float64{0.1, 0.2}}, fmt.Errorf("tensor 'w': received 2 values, expected 3")},
+		{&onnxTensor{name: "w", dims: []int64{1}, dataType: 7, values: []float64{1}}, fmt.Errorf("tensor 'w': unsupported data type 7, expected float or double")},
+		{&onnxTensor{name: "w", dims: []int64{2, -3}, dataType: onnxFloat}, fmt.Errorf("tensor 'w': dimension 1 is -3, expected >=0")},
+		{&onnxTensor{name: "w", dims: []int64{1 << 32, 1 << 32}, dataType: onnxFloat}, fmt.Errorf("tensor 'w': the number of values overflows")},
+	} {
+		parsed, err := parseONNXTensor(test.t.encode().Bytes())
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "tensor", test.t, parsed)
+		}
+	}
+}
+
+//onnxBytes encodes a model of the nodes and initializers, whose graph maps input x of size in to output y
+func onnxBytes(in int64, nodes []*onnxNode, inits ...*onnxTensor) []byte {
+	g := &onnxGraph{
+		name:         "test",
+		nodes:        nodes,
+		initializers: inits,
+		inputs:       []*onnxValue{{name: "x", elemType: onnxFloat, dims: []onnxDim{{param: "N"}, {value: in}}}},
+		outputs:      []*onnxValue{{name: "y", elemType: onnxFloat}},
+	}
+	return (&onnxModel{irVersion: onnxIRVersion, opset: ONNXOpset, graph: g}).encode().Bytes()
+}
+
+func TestReadONNX(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 4, FuncType: activation.FuncTypeElu, FuncParams: []float64{0.5}},
+		{Size: 3, FuncType: activation.FuncTypeLeakyRelu, FuncParams: []float64{0.25}},
+		{Size: 2, FuncType: activation.FuncTypeSigmoid},
+	}
+	f, err := mockRandFC(5, 3, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := mat.NewM64(3, 1, []float64{0.5, -1, 2})
+	pred, err := f.FeedForward(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ind, opts := range []ONNXOptions{{}, {MatMul: true}} {
+		buf := &bytes.Buffer{}
+		if err = f.WriteONNX(buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		r, err := ReadONNX(buf)
+		te.CheckError(ind, nil, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "sizes", []int{3, 2}, []int{r.InSize(), r.OutSize()})
+		for i, l := range r.layers {
+			te.DeepEqual(ind, fmt.Sprintf("layer %d", i), configs[i].FuncType, l.ftype)
+		}
+		out, err := r.FeedForward(in)
+		te.CheckError(ind, nil, err)
+		for i, v := range out.GetData() {
+			if math.Abs(v-pred.At(i, 0)) > 1e-6 {
+				t.Errorf("test %d: output %d: expected %f received %f", ind, i, pred.At(i, 0), v)
+			}
+		}
+	}
+}
+
+func TestReadONNXGraphs(t *testing.T) {
+	te := tester.NewT(t)
+	w := &onnxTensor{name: "w", dims: []int64{2, 3}, dataType: onnxFloat, values: []float64{1, 2, 3, 4, 5, 6}}
+	wt := &onnxTensor{name: "w", dims: []int64{3, 2}, dataType: onnxDouble, values: []float64{1, 4, 2, 5, 3, 6}}
+	b := &onnxTensor{name: "b", dims: []int64{2}, dataType: onnxFloat, values: []float64{0.5, -0.5}}
+	scalar := &onnxTensor{name: "s", dims: []int64{1}, dataType: onnxFloat, values: []float64{1}}
+	in := mat.NewM64(3, 1, []float64{1, 0, -1})
+	//w*in = [-2, -2]
+	tests := []struct {
+		nodes  []*onnxNode
+		inits  []*onnxTensor
+		ftypes []string
+		exp    []float64
+	}{
+		{[]*onnxNode{{opType: "Gemm", inputs: []string{"x", "w", "b"}, outputs: []string{"y"}, attrs: []*onnxAttr{{name: "transB", typ: onnxAttrInt, i: 1}}}},
+			[]*onnxTensor{w, b}, []string{"iden"}, []float64{-1.5, -2.5}},
+		//alpha and beta scale the weights and the bias, the bias being broadcast
+		{[]*onnxNode{{opType: "Gemm", inputs: []string{"x", "w", "s"}, outputs: []string{"y"}, attrs: []*onnxAttr{{name: "alpha", typ: onnxAttrFloat, f: 2}, {name: "beta", typ: onnxAttrFloat, f: -1}}}},
+			[]*onnxTensor{wt, scalar}, []string{"iden"}, []float64{-5, -5}},
+		{[]*onnxNode{{opType: "MatMul", inputs: []string{"x", "w"}, outputs: []string{"y"}}}, []*onnxTensor{wt}, []string{"iden"}, []float64{-2, -2}},
+		//a Gemm node without bias followed by Add, and an activation with its default alpha. Identity nodes are ignored
+		{[]*onnxNode{
+			{opType: "Identity", inputs: []string{"x"}, outputs: []string{"x1"}},
+			{opType: "Gemm", inputs: []string{"x1", "w"}, outputs: []string{"z"}, attrs: []*onnxAttr{{name: "transB", typ: onnxAttrInt, i: 1}}},
+			{opType: "Add", inputs: []string{"z", "b"}, outputs: []string{"a"}},
+			{opType: "LeakyRelu", inputs: []string{"a"}, outputs: []string{"h"}},
+			{opType: "Identity", inputs: []string{"h"}, outputs: []string{"h1"}},
+			{opType: "MatMul", inputs: []string{"h1", "v"}, outputs: []string{"o"}},
+			{opType: "Relu", inputs: []string{"o"}, outputs: []string{"y"}},
+		}, []*onnxTensor{w, b, {name: "v", dims: []int64{2, 1}, dataType: onnxFloat, values: []float64{1, -1}}}, []string{"leaky_relu", "relu"}, []float64{0.01}},
+	}
+	for ind, test := range tests {
+		f, err := ReadONNX(bytes.NewReader(onnxBytes(3, test.nodes, test.inits...)))
+		te.CheckError(ind, nil, err)
+		if err != nil {
+			continue
+		}
+		var ftypes []string
+		for _, l := range f.layers {
+			ftypes = append(ftypes, l.ftype)
+		}
+		te.DeepEqual(ind, "activations", test.ftypes, ftypes)
+		out, err := f.FeedForward(in)
+		te.CheckError(ind, nil, err)
+		for i, v := range out.GetData() {
+			if math.Abs(v-test.exp[i]) > 1e-6 {
+				t.Errorf("test %d: output %d: expected %f received %f", ind, i, test.exp[i], v)
+			}
+		}
+	}
+}
+
+func TestReadONNXErrors(t *testing.T) {
+	te := tester.NewT(t)
+	w := &onnxTensor{name: "w", dims: []int64{2, 3}, dataType: onnxFloat, values: []float64{1, 2, 3, 4, 5, 6}}
+	gemm := func(in, out string) *onnxNode {
+		return &onnxNode{name: "gemm", opType: "Gemm", inputs: []string{in, "w"}, outputs: []string{out}, attrs: []*onnxAttr{{name: "transB", typ: onnxAttrInt, i: 1}}}
+	}
+	tests := []struct {
+		in    int64
+		nodes []*onnxNode
+		err   error
+	}{
+		{3, []*onnxNode{gemm("x", "z"), {name: "conv", opType: "Conv", inputs: []string{"z", "k"}, outputs: []string{"y"}}},
+			fmt.Errorf("node Conv 'conv': unsupported operator, expected Gemm, MatMul, Add, Sigmoid, Tanh, Relu, LeakyRelu, Elu or Identity")},
+		{3, []*onnxNode{gemm("x", "z"), {opType: "Softmax", inputs: []string{"z"}, outputs: []string{"y"}}},
+			fmt.Errorf("node Softmax producing 'y': unsupported operator, expected Gemm, MatMul, Add, Sigmoid, Tanh, Relu, LeakyRelu, Elu or Identity")},
+		{3, []*onnxNode{{name: "relu", opType: "Relu", inputs: []string{"x"}, outputs: []string{"y"}}}, fmt.Errorf("node Relu 'relu': activation must follow a dense layer")},
+		{3, []*onnxNode{gemm("x", "z"), {name: "a", opType: "Tanh", inputs: []string{"z"}, outputs: []string{"t"}}, {name: "b", opType: "Relu", inputs: []string{"t"}, outputs: []string{"y"}}},
+			fmt.Errorf("node Relu 'b': activation must follow a dense layer")},
+		{4, []*onnxNode{gemm("x", "y")}, fmt.Errorf("node Gemm 'gemm': weights 'w' have 3 inputs, expected 4")},
+		{3, []*onnxNode{{name: "gemm", opType: "Gemm", inputs: []string{"x", "x"}, outputs: []string{"y"}}}, fmt.Errorf("tensor 'x' is used by 2 nodes, only chains of nodes are supported")},
+		{3, []*onnxNode{{name: "gemm", opType: "Gemm", inputs: []string{"x", "u"}, outputs: []string{"y"}}}, fmt.Errorf("node Gemm 'gemm': weights 'u' must be an initializer")},
+		{3, []*onnxNode{{name: "gemm", opType: "Gemm", inputs: []string{"x", "w"}, outputs: []string{"y"}, attrs: []*onnxAttr{{name: "transA", typ: onnxAttrInt, i: 1}}}}, fmt.Errorf("node Gemm 'gemm': transA is not supported")},
+		{3, []*onnxNode{gemm("x", "z")}, fmt.Errorf("tensor 'z' does not lead to the output 'y'")},
+		{3, []*onnxNode{gemm("x", "y"), {name: "extra", opType: "Relu", inputs: []string{"u"}, outputs: []string{"v"}}}, fmt.Errorf("node Relu 'extra' is not on the path from the input to the output")},
+		{3, []*onnxNode{{name: "id", opType: "Identity", inputs: []string{"x"}, outputs: []string{"y"}}}, fmt.Errorf("graph has no dense layer")},
+		{3, []*onnxNode{{name: "mm", opType: "Mul", domain: "com.example", inputs: []string{"x"}, outputs: []string{"y"}}}, fmt.Errorf("node Mul 'mm': unsupported domain 'com.example'")},
+	}
+	for ind, test := range tests {
+		_, err := ReadONNX(bytes.NewReader(onnxBytes(test.in, test.nodes, w)))
+		te.CheckError(ind, test.err, err)
+	}
+	_, err := ReadONNX(bytes.NewReader([]byte{0x0B}))
+	te.CheckError(len(tests), fmt.Errorf("field 1: unsupported wire type 3"), err)
+	//empty weights
+	empty := &onnxTensor{name: "w", dims: []int64{0, 3}, dataType: onnxFloat}
+	_, err = ReadONNX(bytes.NewReader(onnxBytes(3, []*onnxNode{gemm("x", "y")}, empty)))
+	te.CheckError(len(tests)+1, fmt.Errorf("node Gemm 'gemm': weights 'w' have dimensions 0x3, expected >0"), err)
+}
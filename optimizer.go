@@ -0,0 +1,123 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//Optimizer updates params from their accumulated gradients, once per batch
+type Optimizer interface {
+	Update(lr float64, params []*Param) error
+}
+
+//SGD is the stochastic gradient descent with momentum: v=momentum*v+grad then param-=lr*v. Without momentum, params are updated with -lr*grad, which is the default of networks without optimizer
+type SGD struct {
+	momentum float64
+	velocity map[*Param]*mat.M64
+}
+
+//NewSGD returns a stochastic gradient descent with momentum in range [0;1[, 0 for none
+func NewSGD(momentum float64) (*SGD, error) {
+	if momentum < 0 || momentum >= 1 {
+		return nil, fmt.Errorf("momentum must be in range [0;1[")
+	}
+	return &SGD{momentum: momentum, velocity: map[*Param]*mat.M64{}}, nil
+}
+
+//Update to implement Optimizer
+func (o *SGD) Update(lr float64, params []*Param) error {
+	if o == nil {
+		return fmt.Errorf("optimizer is nil")
+	}
+	if o.momentum == 0 {
+		return sgdStep(lr, params)
+	}
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		v := moment(o.velocity, p)
+		eachGradRow(p, func(i, j int) {
+			vij := o.momentum*v.At(i, j) + p.Grad.At(i, j)
+			v.Set(i, j, vij)
+			p.Value.Set(i, j, p.Value.At(i, j)-lr*vij)
+		})
+	}
+	return nil
+}
+
+//Adam is the adaptive moment estimation of Kingma and Ba: params are updated with -lr*m/(sqrt(v)+epsilon), m and v being the bias-corrected moving averages of the gradient and of its square
+type Adam struct {
+	beta1   float64
+	beta2   float64
+	epsilon float64
+	t       int //number of updates
+	m       map[*Param]*mat.M64
+	v       map[*Param]*mat.M64
+}
+
+//NewAdam returns an Adam optimizer, beta1 and beta2 being the decay rates of the moving averages in range [0;1[, usually 0.9 and 0.999, and epsilon>0 (usually 1e-8)
+func NewAdam(beta1, beta2, epsilon float64) (*Adam, error) {
+	if beta1 < 0 || beta1 >= 1 || beta2 < 0 || beta2 >= 1 {
+		return nil, fmt.Errorf("beta1 and beta2 must be in range [0;1[")
+	}
+	if epsilon <= 0 {
+		return nil, fmt.Errorf("epsilon must be >0")
+	}
+	return &Adam{beta1: beta1, beta2: beta2, epsilon: epsilon, m: map[*Param]*mat.M64{}, v: map[*Param]*mat.M64{}}, nil
+}
+
+//Update to implement Optimizer. Only the rows with a gradient of sparse params, like embedding tables, are updated
+func (o *Adam) Update(lr float64, params []*Param) error {
+	if o == nil {
+		return fmt.Errorf("optimizer is nil")
+	}
+	o.t++
+	c1, c2 := 1-math.Pow(o.beta1, float64(o.t)), 1-math.Pow(o.beta2, float64(o.t))
+	for _, p := range params {
+		if p.Grad == nil {
+			continue
+		}
+		m, v := moment(o.m, p), moment(o.v, p)
+		eachGradRow(p, func(i, j int) {
+			g := p.Grad.At(i, j)
+			mij := o.beta1*m.At(i, j) + (1-o.beta1)*g
+			vij := o.beta2*v.At(i, j) + (1-o.beta2)*g*g
+			m.Set(i, j, mij)
+			v.Set(i, j, vij)
+			p.Value.Set(i, j, p.Value.At(i, j)-lr*(mij/c1)/(math.Sqrt(vij/c2)+o.epsilon))
+		})
+	}
+	return nil
+}
+
+//moment returns the matrix of p in moments, created with zeros on first use
+func moment(moments map[*Param]*mat.M64, p *Param) *mat.M64 {
+	m, ok := moments[p]
+	if !ok {
+		r, c := p.Value.Dims()
+		m = mat.NewM64(r, c, nil)
+		moments[p] = m
+	}
+	return m
+}
+
+//eachGradRow calls f on each position of the rows of p with a gradient: every row of dense params
+func eachGradRow(p *Param, f func(i, j int)) {
+	r, c := p.Value.Dims()
+	if p.rows != nil {
+		for i := range p.rows {
+			for j := 0; j < c; j++ {
+				f(i, j)
+			}
+		}
+		return
+	}
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			f(i, j)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/tester"
+)
+
+func TestOptimizers(t *testing.T) {
+	te := tester.NewT(t)
+	sgd, _ := NewSGD(0)
+	momentum, _ := NewSGD(0.5)
+	adam, _ := NewAdam(0.9, 0.999, 1e-8)
+	//two updates of w=[1 -1] with a gradient of [2 0.5]
+	tests := []struct {
+		o   Optimizer
+		exp []float64
+	}{
+		{sgd, []float64{1 - 0.1*2 - 0.1*2, -1 - 0.1*0.5 - 0.1*0.5}},
+		//v=g then v=0.5*g+g
+		{momentum, []float64{1 - 0.1*2 - 0.1*3, -1 - 0.1*0.5 - 0.1*0.75}},
+		//constant gradients: the bias-corrected moments are g and g², each update is lr*sign(g)
+		{adam, []float64{1 - 0.2, -1 - 0.2}},
+	}
+	for ind, test := range tests {
+		p := &Param{Name: "w", Value: mat.NewM64(1, 2, []float64{1, -1}), Grad: mat.NewM64(1, 2, []float64{2, 0.5})}
+		for i := 0; i < 2; i++ {
+			te.CheckError(ind, nil, test.o.Update(0.1, []*Param{p, {Name: "unused"}}))
+		}
+		for j, v := range p.Value.GetData() {
+			if math.Abs(v-test.exp[j]) > 1e-6 {
+				t.Errorf("test %d: (%d): expected %f received %f", ind, j, test.exp[j], v)
+			}
+		}
+	}
+	_, err := NewSGD(1)
+	te.CheckError(0, fmt.Errorf("momentum must be in range [0;1["), err)
+	_, err = NewAdam(0.9, -1, 1e-8)
+	te.CheckError(1, fmt.Errorf("beta1 and beta2 must be in range [0;1["), err)
+	_, err = NewAdam(0.9, 0.999, 0)
+	te.CheckError(2, fmt.Errorf("epsilon must be >0"), err)
+}
+
+func TestSparseOptimizers(t *testing.T) {
+	te := tester.NewT(t)
+	momentum, _ := NewSGD(0.9)
+	adam, _ := NewAdam(0.9, 0.999, 1e-8)
+	for ind, o := range []Optimizer{momentum, adam} {
+		//only row 1 of the table has a gradient
+		p := &Param{Name: "table", Value: mat.NewM64(2, 1, []float64{1, 1}), Grad: mat.NewM64(2, 1, []float64{5, 1}), rows: map[int]struct{}{1: {}}}
+		te.CheckError(ind, nil, o.Update(0.1, []*Param{p}))
+		te.DeepEqual(ind, "unused row", 1.0, p.Value.At(0, 0))
+		te.DeepEqual(ind, "used row", true, p.Value.At(1, 0) < 1)
+	}
+}
+
+func TestLrSchedules(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		lr  LrSource
+		exp []float64
+	}{
+		{NewLr(0.1), []float64{0.1, 0.1, 0.1, 0.1, 0.1}},
+		{NewStepLr(0.1, 0.5, 2), []float64{0.1, 0.1, 0.05, 0.05, 0.025}},
+		{NewExpLr(0.1, 0.5), []float64{0.1, 0.05, 0.025, 0.0125, 0.00625}},
+	}
+	for ind, test := range tests {
+		for epoch, exp := range test.exp {
+			if s, ok := test.lr.(scheduled); ok {
+				s.SetEpoch(uint(epoch))
+			}
+			te.DeepEqual(ind, fmt.Sprintf("rate of epoch %d", epoch), true, math.Abs(test.lr.GetRate()-exp) < 1e-12)
+		}
+	}
+}
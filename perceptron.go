@@ -3,7 +3,9 @@ package nn
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 
 	"github.com/klahssen/go-mat"
 	"github.com/klahssen/nn/internal/activation"
@@ -17,6 +19,7 @@ type Perceptron struct {
 	fparams []float64
 	f       activation.F
 	cost    activation.F
+	loss    string //name of the cost function, empty if it was given as a function to NewPerceptron
 	b       float64
 	alpha   float64 //learning rate
 	s       float64
@@ -28,24 +31,59 @@ func (p *Perceptron) Size() int {
 	return p.inSize
 }
 
-//Perceptron is the simplest neuron, representing a function P. It applies an activation function f to s which is the weighted sum of its inputs + bias: output=f(w*x+b). the multiplication here is a dot product and wx+b is a scalar
+//perceptronVersion is the version of the encoding of perceptrons. Version 0 is the encoding written before versioning, without loss: its cost function is mse
+const perceptronVersion = 1
+
+//publicPerceptron is the encoding of a perceptron
 type publicPerceptron struct {
-	InSize  int          `json:"in_size"`
-	W       []float64    `json:"w"` //size 1*inSize
-	F       activation.F `json:"-"`
-	Cost    activation.F `json:"-"`
-	Ftype   string       `json:"ftype"`
-	Fparams []float64    `json:"fparams"`
-	B       float64      `json:"b"`
-	Alpha   float64      `json:"alpha"` //learning rate
-	S       float64      `json:"s"`
-	A       float64      `json:"a"`
+	Version int       `json:"version"`
+	InSize  int       `json:"in_size"`
+	W       []float64 `json:"w"` //size 1*inSize
+	Ftype   string    `json:"ftype"`
+	Fparams []float64 `json:"fparams"`
+	Loss    string    `json:"loss"` //name of the cost function, see LossFunc
+	B       float64   `json:"b"`
+	Alpha   float64   `json:"alpha"` //learning rate
+	S       float64   `json:"s"`
+	A       float64   `json:"a"`
 }
 
 func (p *Perceptron) export() *publicPerceptron {
-	return &publicPerceptron{InSize: p.inSize, W: p.w.GetData(), F: p.f, Cost: p.cost, Ftype: p.ftype, Fparams: p.fparams, B: p.b, Alpha: p.alpha, S: p.s, A: p.a}
+	return &publicPerceptron{Version: perceptronVersion, InSize: p.inSize, W: p.w.GetData(), Ftype: p.ftype, Fparams: p.fparams, Loss: p.loss, B: p.b, Alpha: p.alpha, S: p.s, A: p.a}
 }
 
+//validate checks the definition and returns its activation and cost functions
+func (def *publicPerceptron) validate() (activation.F, activation.F, error) {
+	if def.Version < 0 || def.Version > perceptronVersion {
+		return activation.F{}, activation.F{}, fmt.Errorf("unsupported perceptron version %d", def.Version)
+	}
+	if def.InSize <= 0 {
+		return activation.F{}, activation.F{}, fmt.Errorf("input size is <=0")
+	}
+	if len(def.W) != def.InSize {
+		return activation.F{}, activation.F{}, fmt.Errorf("received %d weights, expected %d", len(def.W), def.InSize)
+	}
+	if def.Alpha <= 0 || def.Alpha > 1 {
+		return activation.F{}, activation.F{}, fmt.Errorf("learning rate must be in ]0;1]")
+	}
+	if def.Ftype == activation.FuncTypeCustom {
+		return activation.F{}, activation.F{}, fmt.Errorf("custom activation functions can not be decoded")
+	}
+	f, err := activation.GetF(def.Ftype, def.Fparams)
+	if err != nil {
+		return activation.F{}, activation.F{}, err
+	}
+	if def.Loss == "" && def.Version > 0 {
+		return activation.F{}, activation.F{}, fmt.Errorf("loss is missing")
+	}
+	cost, err := LossFunc(def.Loss)
+	if err != nil {
+		return activation.F{}, activation.F{}, err
+	}
+	return f, cost, nil
+}
+
+//inject sets the definition of the perceptron, which is not modified if the definition is invalid
 func (p *Perceptron) inject(def *publicPerceptron) error {
 	if p == nil {
 		return fmt.Errorf("perceptron is nil")
@@ -53,44 +91,114 @@ func (p *Perceptron) inject(def *publicPerceptron) error {
 	if def == nil {
 		return fmt.Errorf("definition is nil")
 	}
-	p.inSize = def.InSize
-	p.w = mat.NewM64(1, p.inSize, def.W)
-	p.ftype = def.Ftype
-	p.fparams = def.Fparams
-	p.b = def.B
-	p.alpha = def.Alpha
-	p.s = def.S
-	p.a = def.A
-	F, err := activation.GetF(p.ftype, p.fparams)
-	p.f = F
-	return err
+	f, cost, err := def.validate()
+	if err != nil {
+		return err
+	}
+	loss := def.Loss
+	if loss == "" {
+		loss = "mse"
+	}
+	np := Perceptron{inSize: def.InSize, w: mat.NewM64(1, def.InSize, def.W), ftype: def.Ftype, fparams: def.Fparams, f: f, cost: cost, loss: loss, b: def.B, alpha: def.Alpha, s: def.S, a: def.A}
+	if err = np.Validate(); err != nil {
+		return err
+	}
+	*p = np
+	return nil
 }
 
-//FromJSON unmarshals the config and sets the Perceptron's definition
-func (p *Perceptron) FromJSON(filename string) error {
-	b, err := ioutil.ReadFile(filename)
+//SetLoss sets the cost function by name, mse (default if empty) or mae, so that it is encoded with the perceptron. See LossFunc
+func (p *Perceptron) SetLoss(name string) error {
+	if p == nil {
+		return fmt.Errorf("perceptron is nil")
+	}
+	cost, err := LossFunc(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "mse"
+	}
+	p.cost, p.loss = cost, name
+	return nil
+}
+
+//Loss returns the name of the cost function, empty if it was given as a function to NewPerceptron
+func (p *Perceptron) Loss() string {
+	if p == nil {
+		return ""
+	}
+	return p.loss
+}
+
+//MarshalJSON implements json.Marshaler, see Encode
+func (p *Perceptron) MarshalJSON() ([]byte, error) {
+	if p == nil || p.w == nil {
+		return nil, fmt.Errorf("perceptron is not defined")
+	}
+	if p.ftype == activation.FuncTypeCustom {
+		return nil, fmt.Errorf("custom activation functions can not be encoded")
+	}
+	if p.loss == "" {
+		return nil, fmt.Errorf("cost function has no name, set it with SetLoss or NewPerceptronWithLoss")
+	}
+	return json.Marshal(p.export())
+}
+
+//UnmarshalJSON implements json.Unmarshaler, see Decode
+func (p *Perceptron) UnmarshalJSON(data []byte) error {
+	def := &publicPerceptron{}
+	if err := json.Unmarshal(data, def); err != nil {
+		return err
+	}
+	return p.inject(def)
+}
+
+//Encode writes the definition of the perceptron in JSON: its weights, bias, activation function, learning rate and the name of its cost function. Perceptrons with custom activation functions or a cost function without name can not be encoded
+func (p *Perceptron) Encode(w io.Writer) error {
+	b, err := p.MarshalJSON()
 	if err != nil {
-		return nil
+		return err
 	}
-	pp := &publicPerceptron{}
-	err = json.Unmarshal(b, pp)
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+//Decode reads the definition of the perceptron written by Encode. The definition is validated and the perceptron left unchanged if it is invalid
+func (p *Perceptron) Decode(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
-	return p.inject(pp)
+	return p.UnmarshalJSON(data)
 }
 
-//JSON stores the neuron's definition in  a json file
-func (p *Perceptron) JSON(filename string) error {
-	b, err := json.Marshal(p.export())
+//DecodePerceptron reads a perceptron written by Encode
+func DecodePerceptron(r io.Reader) (*Perceptron, error) {
+	p := &Perceptron{}
+	if err := p.Decode(r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+//FromJSON reads the definition of the perceptron from a file written by JSON
+func (p *Perceptron) FromJSON(filename string) error {
+	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
-	if err = ioutil.WriteFile(filename, b, 0666); err != nil {
+	defer f.Close()
+	return p.Decode(f)
+}
+
+//JSON stores the neuron's definition in a json file, see Encode
+func (p *Perceptron) JSON(filename string) error {
+	b, err := p.MarshalJSON()
+	if err != nil {
 		return err
 	}
-	fmt.Printf("Perceptron Configuration:\n%s\n", string(b))
-	return nil
+	return ioutil.WriteFile(filename, append(b, '\n'), 0666)
 }
 
 //Compute the P(x)
@@ -187,3 +295,16 @@ func NewPerceptron(inSize int, learningRate float64, ftype string, fparams []flo
 	err := p.Validate()
 	return p, err
 }
+
+//NewPerceptronWithLoss is a Perceptron constructor whose cost function is named by loss, mse (default if empty) or mae, so that the perceptron can be encoded. See LossFunc
+func NewPerceptronWithLoss(inSize int, learningRate float64, ftype string, fparams []float64, f activation.F, loss string) (*Perceptron, error) {
+	cost, err := LossFunc(loss)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPerceptron(inSize, learningRate, ftype, fparams, f, cost)
+	if err != nil {
+		return nil, err
+	}
+	return p, p.SetLoss(loss)
+}
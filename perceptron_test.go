@@ -1 +1,250 @@
 package nn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//separable returns n points of [-1;1[² labelled 1 if x0+x1>0.2 and 0 else, keeping a margin of 0.1 around the boundary. A ratio noise of labels is flipped
+func separable(seed int64, n int, noise float64) *pointsDataset {
+	r := rand.New(rand.NewSource(seed))
+	d := &pointsDataset{}
+	for len(d.points) < n {
+		x := randM64(r, 2, 1)
+		s := x.At(0, 0) + x.At(1, 0) - 0.2
+		if s > -0.1 && s < 0.1 {
+			continue
+		}
+		label := 0.0
+		if (s > 0) != (r.Float64() < noise) {
+			label = 1
+		}
+		d.points = append(d.points, &Datapoint{Inp: x, Exp: mat.NewM64(1, 1, []float64{label})})
+	}
+	return d
+}
+
+func TestPerceptronTrain(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		data      Dataset
+		algorithm string
+		converged bool
+		accuracy  float64 //minimum accuracy
+	}{
+		{separable(1, 100, 0), "", true, 1},
+		{separable(1, 100, 0), Pocket, true, 1},
+		{separable(1, 100, 0), Averaged, true, 0.97},
+		//10% of noise: the rule does not converge, pocket keeps the best epoch
+		{separable(2, 100, 0.1), Rosenblatt, false, 0},
+		{separable(2, 100, 0.1), Pocket, false, 0.85},
+		{separable(2, 100, 0.1), Averaged, false, 0.85},
+	}
+	accuracies := map[string]float64{}
+	for ind, test := range tests {
+		p, err := NewPerceptron(2, 0.1, activation.FuncTypeIden, nil, activation.F{}, activation.Power(0.5, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep, err := p.Train(test.data, 50, test.algorithm)
+		te.CheckError(ind, nil, err)
+		t.Logf("%d: %s: %d epochs, accuracy %.2f", ind, test.algorithm, rep.Epochs, rep.Accuracy)
+		te.DeepEqual(ind, "converged", test.converged, rep.Converged)
+		te.DeepEqual(ind, "epochs", int(rep.Epochs), len(rep.Mistakes))
+		if test.converged {
+			te.DeepEqual(ind, "no mistake", 0, rep.Mistakes[len(rep.Mistakes)-1])
+		} else {
+			te.DeepEqual(ind, "epochs", uint(50), rep.Epochs)
+		}
+		if rep.Accuracy < test.accuracy {
+			t.Errorf("%d: expected an accuracy >=%.2f received %.2f", ind, test.accuracy, rep.Accuracy)
+		}
+		//the accuracy is the one of the final weights
+		correct := 0
+		for _, d := range test.data.(*pointsDataset).points {
+			c, err := p.Classify(d.Inp)
+			te.CheckError(ind, nil, err)
+			if c == (d.Exp.AtInd(0) > 0) {
+				correct++
+			}
+		}
+		te.DeepEqual(ind, "accuracy", float64(correct)/100, rep.Accuracy)
+		if !test.converged {
+			accuracies[test.algorithm] = rep.Accuracy
+		}
+	}
+	if accuracies[Pocket] < accuracies[Rosenblatt] {
+		t.Errorf("expected pocket to be at least as accurate as the rule: %.2f < %.2f", accuracies[Pocket], accuracies[Rosenblatt])
+	}
+}
+
+func TestPerceptronTrainErrors(t *testing.T) {
+	te := tester.NewT(t)
+	p, err := NewPerceptron(2, 0.1, activation.FuncTypeIden, nil, activation.F{}, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data      Dataset
+		epochs    uint
+		algorithm string
+		err       error
+	}{
+		{nil, 1, "", fmt.Errorf("dataset is empty")},
+		{separable(1, 2, 0), 0, "", fmt.Errorf("epochs must be >0")},
+		{separable(1, 2, 0), 1, "svm", fmt.Errorf("unknown algorithm 'svm', expected rosenblatt, pocket or averaged")},
+		{&pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(3, 1, nil)}}}, 1, "", fmt.Errorf("datapoint[0]: input must have 2 values")},
+		{&pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(2, 1, nil), Exp: mat.NewM64(2, 1, nil)}}}, 1, "", fmt.Errorf("datapoint[0]: expected output must have 1 value")},
+	}
+	for ind, test := range tests {
+		_, err := p.Train(test.data, test.epochs, test.algorithm)
+		te.CheckError(ind, test.err, err)
+	}
+	_, err = p.Classify(mat.NewM64(1, 1, nil))
+	te.CheckError(len(tests), fmt.Errorf("input must have 2 values"), err)
+}
+
+//clusters returns n points around 3 centers, labelled with the index of their center, or one-hot encoded
+func clusters(seed int64, n int, oneHot bool) *pointsDataset {
+	centers := [][]float64{{1, 0}, {-1, 1}, {-1, -1}}
+	r := rand.New(rand.NewSource(seed))
+	d := &pointsDataset{}
+	for i := 0; i < n; i++ {
+		c := i % 3
+		x := mat.NewM64(2, 1, []float64{centers[c][0] + 0.6*r.Float64() - 0.3, centers[c][1] + 0.6*r.Float64() - 0.3})
+		exp := mat.NewM64(1, 1, []float64{float64(c)})
+		if oneHot {
+			exp = mat.NewM64(3, 1, nil)
+			exp.Set(c, 0, 1)
+		}
+		d.points = append(d.points, &Datapoint{Inp: x, Exp: exp})
+	}
+	return d
+}
+
+func TestOneVsRest(t *testing.T) {
+	te := tester.NewT(t)
+	for ind, oneHot := range []bool{false, true} {
+		o, err := NewOneVsRest(2, 3, 0.1)
+		te.CheckError(ind, nil, err)
+		rep, err := o.Train(clusters(1, 60, oneHot), 20, Averaged)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "accuracy", 1.0, rep.Accuracy)
+		te.DeepEqual(ind, "reports", 3, len(rep.Classes))
+		for c, r := range rep.Classes {
+			te.DeepEqual(ind, fmt.Sprintf("class %d", c), true, r.Converged)
+		}
+		//new points
+		for _, d := range clusters(2, 30, false).points {
+			c, err := o.Predict(d.Inp)
+			te.CheckError(ind, nil, err)
+			te.DeepEqual(ind, "class", int(d.Exp.AtInd(0)), c)
+		}
+	}
+	//errors
+	_, err := NewOneVsRest(2, 1, 0.1)
+	te.CheckError(2, fmt.Errorf("number of classes must be >=2"), err)
+	o, _ := NewOneVsRest(2, 3, 0.1)
+	_, err = o.Train(&pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(2, 1, nil), Exp: mat.NewM64(1, 1, []float64{3})}}}, 1, "")
+	te.CheckError(3, fmt.Errorf("class 0: datapoint[0]: class 3 must be an integer between 0 and 2"), err)
+	_, err = o.Train(&pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(2, 1, nil), Exp: mat.NewM64(2, 1, nil)}}}, 1, "")
+	te.CheckError(4, fmt.Errorf("class 0: datapoint[0]: expected output must have 1 or 3 values"), err)
+	_, err = o.Predict(mat.NewM64(3, 1, nil))
+	te.CheckError(5, fmt.Errorf("input must have 2 values"), err)
+	te.DeepEqual(6, "perceptrons", []bool{true, false}, []bool{o.Perceptron(2) != nil, o.Perceptron(3) != nil})
+}
+
+func TestPerceptronEncode(t *testing.T) {
+	te := tester.NewT(t)
+	p, err := NewPerceptron(2, 0.1, activation.FuncTypeLeakyRelu, []float64{0.1}, activation.F{}, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, nil, p.UpdateCoefs([]float64{0.5, 1, -2}))
+	te.CheckError(0, nil, p.SetLoss("mae"))
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, p.Encode(buf))
+	d, err := DecodePerceptron(buf)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "decoded", p.export(), d.export())
+	te.CheckError(0, nil, d.Validate())
+	x := mat.NewM64(2, 1, []float64{-1, 1})
+	a, _ := p.Compute(x)
+	b, err := d.Compute(x)
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "output", a, b)
+	//json.Marshaler and json.Unmarshaler
+	data, err := json.Marshal(map[string]*Perceptron{"p": p})
+	te.CheckError(1, nil, err)
+	m := map[string]*Perceptron{}
+	te.CheckError(1, nil, json.Unmarshal(data, &m))
+	te.DeepEqual(1, "unmarshaled", p.export(), m["p"].export())
+	//files
+	filename := filepath.Join(t.TempDir(), "perceptron.json")
+	te.CheckError(2, nil, p.JSON(filename))
+	f := &Perceptron{}
+	te.CheckError(2, nil, f.FromJSON(filename))
+	te.DeepEqual(2, "file", p.export(), f.export())
+	err = f.FromJSON(filepath.Join(t.TempDir(), "missing.json"))
+	te.DeepEqual(3, "missing file", true, os.IsNotExist(err))
+	//the cost function must have a name to be decoded with the same behaviour
+	q, _ := NewPerceptron(1, 0.1, activation.FuncTypeIden, nil, activation.F{}, activation.Power(0.5, 2))
+	te.CheckError(4, fmt.Errorf("cost function has no name, set it with SetLoss or NewPerceptronWithLoss"), q.Encode(buf))
+	te.CheckError(4, fmt.Errorf("unknown loss 'hinge', expected mse or mae"), q.SetLoss("hinge"))
+	te.CheckError(4, nil, q.SetLoss(""))
+	te.DeepEqual(4, "loss", "mse", q.Loss())
+	n, err := NewPerceptronWithLoss(1, 0.1, activation.FuncTypeIden, nil, activation.F{}, "mae")
+	te.CheckError(5, nil, err)
+	te.DeepEqual(5, "loss", "mae", n.Loss())
+	_, err = NewPerceptronWithLoss(1, 0.1, activation.FuncTypeIden, nil, activation.F{}, "hinge")
+	te.CheckError(5, fmt.Errorf("unknown loss 'hinge', expected mse or mae"), err)
+	//custom activation functions can not be encoded
+	c, _ := NewPerceptron(1, 0.1, activation.FuncTypeCustom, nil, activation.Iden(), activation.Power(0.5, 2))
+	te.CheckError(6, fmt.Errorf("custom activation functions can not be encoded"), c.Encode(buf))
+}
+
+func TestPerceptronDecode(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		data string
+		err  error
+	}{
+		//version 0, written before the version and the loss
+		{`{"in_size": 2, "w": [1, -1], "ftype": "iden", "b": 0.5, "alpha": 0.1}`, nil},
+		{`{"version": 1, "in_size": 1, "w": [1], "ftype": "sig", "loss": "mse", "alpha": 0.1}`, nil},
+		{`{"version": 2, "in_size": 1, "w": [1], "ftype": "iden"}`, fmt.Errorf("unsupported perceptron version 2")},
+		{`{"in_size": 0, "w": [], "ftype": "iden"}`, fmt.Errorf("input size is <=0")},
+		{`{"in_size": 2, "w": [1], "ftype": "iden"}`, fmt.Errorf("received 1 weights, expected 2")},
+		{`{"in_size": 2, "w": [1, 2, 3], "ftype": "iden"}`, fmt.Errorf("received 3 weights, expected 2")},
+		{`{"in_size": 1, "w": [1], "ftype": "iden", "alpha": 2}`, fmt.Errorf("learning rate must be in ]0;1]")},
+		{`{"in_size": 1, "w": [1], "ftype": "iden"}`, fmt.Errorf("learning rate must be in ]0;1]")},
+		{`{"version": 1, "in_size": 1, "w": [1], "ftype": "iden", "alpha": 0.1}`, fmt.Errorf("loss is missing")},
+		{`{"in_size": 1, "w": [1], "ftype": "custom", "alpha": 0.1}`, fmt.Errorf("custom activation functions can not be decoded")},
+		{`{"in_size": 1, "w": [1], "ftype": "iden", "alpha": 0.1, "loss": "hinge"}`, fmt.Errorf("unknown loss 'hinge', expected mse or mae")},
+	}
+	for ind, test := range tests {
+		_, err := DecodePerceptron(strings.NewReader(test.data))
+		te.CheckError(ind, test.err, err)
+	}
+	//the cost of version 0 is mse, so that the perceptron can be trained
+	legacy, err := DecodePerceptron(strings.NewReader(tests[0].data))
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "loss", "mse", legacy.Loss())
+	te.CheckError(0, nil, legacy.Validate())
+	//an invalid definition leaves the perceptron unchanged
+	p, _ := NewPerceptron(1, 0.1, activation.FuncTypeIden, nil, activation.F{}, activation.Power(0.5, 2))
+	before := p.export()
+	te.CheckError(len(tests), fmt.Errorf("received 2 weights, expected 1"), p.Decode(strings.NewReader(`{"in_size": 1, "w": [1, 2], "ftype": "iden"}`)))
+	te.DeepEqual(len(tests), "unchanged", before, p.export())
+	te.CheckError(len(tests), nil, p.Validate())
+}
@@ -0,0 +1,278 @@
+package nn
+
+import (
+	"fmt"
+
+	"github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//Training algorithms of perceptrons, see Perceptron.Train
+const (
+	//Rosenblatt adds lr*y*x to the weights and lr*y to the bias for each misclassified point x, y being 1 for the positive class and -1 else
+	Rosenblatt = "rosenblatt"
+	//Pocket runs the Rosenblatt rule and keeps the weights reaching the best accuracy on the dataset at the end of an epoch, for data which are not linearly separable
+	Pocket = "pocket"
+	//Averaged runs the Rosenblatt rule and returns the average of the weights after each point, which are less sensitive to the last points
+	Averaged = "averaged"
+)
+
+//PerceptronReport sums up the training of a perceptron
+type PerceptronReport struct {
+	Epochs    uint    `json:"epochs"`    //number of epochs run
+	Converged bool    `json:"converged"` //the last epoch classified every point correctly, which stops the training
+	Mistakes  []int   `json:"mistakes"`  //number of points misclassified during each epoch, before their update
+	Accuracy  float64 `json:"accuracy"`  //ratio of the points of the dataset classified correctly by the final weights
+}
+
+//weightedSum returns w*x+b
+func weightedSum(w []float64, b float64, x []float64) float64 {
+	s := b
+	for i, v := range w {
+		s += v * x[i]
+	}
+	return s
+}
+
+//Classify reports if x is in the positive class: w*x+b>0
+func (p *Perceptron) Classify(x *mat.M64) (bool, error) {
+	if p == nil {
+		return false, fmt.Errorf("perceptron is nil")
+	}
+	if p.w == nil {
+		return false, fmt.Errorf("weight matrix is nil")
+	}
+	if x == nil || x.Size() != p.inSize {
+		return false, fmt.Errorf("input must have %d values", p.inSize)
+	}
+	return weightedSum(p.w.GetData(), p.b, x.GetData()) > 0, nil
+}
+
+//Train learns to classify the points of the dataset with the algorithm Rosenblatt (default), Pocket or Averaged, the learning rate of the perceptron scaling the updates. A point is in the positive class if its expected output is >0, which fits labels in {0,1} and {-1,1}. Training stops after epochs iterations over the dataset, or after an iteration without mistake. The activation function is not used: the class of x is given by the sign of w*x+b, see Classify
+func (p *Perceptron) Train(data Dataset, epochs uint, algorithm string) (*PerceptronReport, error) {
+	return p.train(data, epochs, algorithm, func(d *Datapoint) (bool, error) {
+		if d.Exp == nil || d.Exp.Size() != 1 {
+			return false, fmt.Errorf("expected output must have 1 value")
+		}
+		return d.Exp.AtInd(0) > 0, nil
+	})
+}
+
+//train runs the algorithm on the dataset, label returning the class of each point
+func (p *Perceptron) train(data Dataset, epochs uint, algorithm string, label func(d *Datapoint) (bool, error)) (*PerceptronReport, error) {
+	if p == nil {
+		return nil, fmt.Errorf("perceptron is nil")
+	}
+	if p.w == nil {
+		return nil, fmt.Errorf("weight matrix is nil")
+	}
+	if data == nil || data.Size() == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+	if epochs == 0 {
+		return nil, fmt.Errorf("epochs must be >0")
+	}
+	switch algorithm {
+	case "":
+		algorithm = Rosenblatt
+	case Rosenblatt, Pocket, Averaged:
+	default:
+		return nil, fmt.Errorf("unknown algorithm '%s', expected %s, %s or %s", algorithm, Rosenblatt, Pocket, Averaged)
+	}
+	points, labels, err := p.labelled(data, label)
+	if err != nil {
+		return nil, err
+	}
+	w, b := p.w.GetData(), p.b
+	//sums of the weights after each point, for the averaged perceptron
+	sumW, sumB, n := make([]float64, len(w)), 0.0, 0
+	//best weights, for the pocket algorithm
+	bestW, bestB, best := append([]float64{}, w...), b, accuracy(points, labels, w, b)
+	rep := &PerceptronReport{}
+	for rep.Epochs < epochs && !rep.Converged {
+		rep.Epochs++
+		mistakes := 0
+		for i, x := range points {
+			if (weightedSum(w, b, x) > 0) != labels[i] {
+				mistakes++
+				y := -p.alpha
+				if labels[i] {
+					y = p.alpha
+				}
+				for j, v := range x {
+					w[j] += y * v
+				}
+				b += y
+			}
+			if algorithm == Averaged {
+				for j, v := range w {
+					sumW[j] += v
+				}
+				sumB += b
+				n++
+			}
+		}
+		rep.Mistakes = append(rep.Mistakes, mistakes)
+		rep.Converged = mistakes == 0
+		if algorithm == Pocket {
+			if acc := accuracy(points, labels, w, b); acc > best {
+				bestW, bestB, best = append(bestW[:0], w...), b, acc
+			}
+		}
+	}
+	switch algorithm {
+	case Pocket:
+		w, b = bestW, bestB
+	case Averaged:
+		for j := range w {
+			w[j] = sumW[j] / float64(n)
+		}
+		b = sumB / float64(n)
+	}
+	p.w.SetData(w)
+	p.b = b
+	rep.Accuracy = accuracy(points, labels, w, b)
+	return rep, nil
+}
+
+//labelled reads the inputs of the dataset and their class
+func (p *Perceptron) labelled(data Dataset, label func(d *Datapoint) (bool, error)) ([][]float64, []bool, error) {
+	var points [][]float64
+	var labels []bool
+	data.Reset()
+	for d := data.Next(); d != nil; d = data.Next() {
+		if d.Inp == nil || d.Inp.Size() != p.inSize {
+			return nil, nil, fmt.Errorf("datapoint[%d]: input must have %d values", len(points), p.inSize)
+		}
+		l, err := label(d)
+		if err != nil {
+			return nil, nil, fmt.Errorf("datapoint[%d]: %s", len(points), err.Error())
+		}
+		points, labels = append(points, d.Inp.GetData()), append(labels, l)
+	}
+	return points, labels, nil
+}
+
+//accuracy returns the ratio of points classified as labels by w and b
+func accuracy(points [][]float64, labels []bool, w []float64, b float64) float64 {
+	correct := 0
+	for i, x := range points {
+		if (weightedSum(w, b, x) > 0) == labels[i] {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(points))
+}
+
+//OneVsRest is a multi-class classifier made of a perceptron per class, each one separating its class from the others. The class of an input is the one whose perceptron has the largest weighted sum
+type OneVsRest struct {
+	inSize      int
+	perceptrons []*Perceptron
+}
+
+//OneVsRestReport sums up the training of a OneVsRest classifier
+type OneVsRestReport struct {
+	Classes  []*PerceptronReport `json:"classes"`  //training of the perceptron of each class
+	Accuracy float64             `json:"accuracy"` //ratio of the points of the dataset classified correctly
+}
+
+//NewOneVsRest returns a classifier of inputs of size inSize in classes classes, whose perceptrons learn with learningRate
+func NewOneVsRest(inSize, classes int, learningRate float64) (*OneVsRest, error) {
+	if classes < 2 {
+		return nil, fmt.Errorf("number of classes must be >=2")
+	}
+	o := &OneVsRest{inSize: inSize, perceptrons: make([]*Perceptron, classes)}
+	for i := range o.perceptrons {
+		p, err := NewPerceptronWithLoss(inSize, learningRate, activation.FuncTypeIden, nil, activation.F{}, "mse")
+		if err != nil {
+			return nil, err
+		}
+		o.perceptrons[i] = p
+	}
+	return o, nil
+}
+
+//Classes returns the number of classes
+func (o *OneVsRest) Classes() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.perceptrons)
+}
+
+//Perceptron returns the perceptron of class i, nil if it does not exist
+func (o *OneVsRest) Perceptron(i int) *Perceptron {
+	if o == nil || i < 0 || i >= len(o.perceptrons) {
+		return nil
+	}
+	return o.perceptrons[i]
+}
+
+//Predict returns the class of x
+func (o *OneVsRest) Predict(x *mat.M64) (int, error) {
+	if o == nil {
+		return 0, fmt.Errorf("classifier is nil")
+	}
+	if x == nil || x.Size() != o.inSize {
+		return 0, fmt.Errorf("input must have %d values", o.inSize)
+	}
+	scores := make([]float64, len(o.perceptrons))
+	for i, p := range o.perceptrons {
+		scores[i] = weightedSum(p.w.GetData(), p.b, x.GetData())
+	}
+	return argmax(scores), nil
+}
+
+//class returns the class of the datapoint: the index of the largest expected output if there is one per class, or the expected output if there is one
+func (o *OneVsRest) class(d *Datapoint) (int, error) {
+	if d.Exp == nil {
+		return 0, fmt.Errorf("expected output is nil")
+	}
+	switch d.Exp.Size() {
+	case len(o.perceptrons):
+		return argmax(d.Exp.GetData()), nil
+	case 1:
+		c := int(d.Exp.AtInd(0))
+		if float64(c) != d.Exp.AtInd(0) || c < 0 || c >= len(o.perceptrons) {
+			return 0, fmt.Errorf("class %v must be an integer between 0 and %d", d.Exp.AtInd(0), len(o.perceptrons)-1)
+		}
+		return c, nil
+	}
+	return 0, fmt.Errorf("expected output must have 1 or %d values", len(o.perceptrons))
+}
+
+//Train trains the perceptron of each class to separate it from the others, see Perceptron.Train. The expected output of a point is either its class or a value per class, the largest one giving its class
+func (o *OneVsRest) Train(data Dataset, epochs uint, algorithm string) (*OneVsRestReport, error) {
+	if o == nil {
+		return nil, fmt.Errorf("classifier is nil")
+	}
+	rep := &OneVsRestReport{Classes: make([]*PerceptronReport, len(o.perceptrons))}
+	for i, p := range o.perceptrons {
+		r, err := p.train(data, epochs, algorithm, func(d *Datapoint) (bool, error) {
+			c, err := o.class(d)
+			return c == i, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("class %d: %s", i, err.Error())
+		}
+		rep.Classes[i] = r
+	}
+	correct, n := 0, 0
+	data.Reset()
+	for d := data.Next(); d != nil; d = data.Next() {
+		c, err := o.class(d)
+		if err != nil {
+			return nil, err
+		}
+		pred, err := o.Predict(d.Inp)
+		if err != nil {
+			return nil, err
+		}
+		if pred == c {
+			correct++
+		}
+		n++
+	}
+	rep.Accuracy = float64(correct) / float64(n)
+	return rep, nil
+}
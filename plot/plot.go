@@ -0,0 +1,281 @@
+//Package plot renders the training curves of a report of nn.FCTrainer as SVG or PNG images.
+//
+//The image stacks a panel per curve, along the epochs: the cost on the training and validation sets, the learning rate and, for networks accumulating their gradients, the norm of the gradient
+package plot
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/klahssen/nn"
+)
+
+const (
+	//DefaultWidth is the width of the image in pixels when none is set
+	DefaultWidth = 640
+	//DefaultHeight is the height of the image in pixels when none is set
+	DefaultHeight = 480
+	minWidth      = 200
+	minHeight     = 150
+)
+
+//layout of the image, in pixels
+const (
+	marginLeft   = 64
+	marginRight  = 16
+	marginTop    = 8
+	marginBottom = 20 //label of the x axis
+	panelTitle   = 20 //title and legend above each panel
+	panelTicks   = 18 //labels of the epochs below each panel
+	charWidth    = 6  //width of a character of the labels
+	yTicks       = 5
+	xTicks       = 6
+)
+
+//colors of the curves and axes
+var (
+	colorTraining   = color.RGBA{0x1f, 0x77, 0xb4, 0xff}
+	colorValidation = color.RGBA{0xff, 0x7f, 0x0e, 0xff}
+	colorLr         = color.RGBA{0x2c, 0xa0, 0x2c, 0xff}
+	colorGradNorm   = color.RGBA{0xd6, 0x27, 0x28, 0xff}
+	colorText       = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	colorFrame      = color.RGBA{0x88, 0x88, 0x88, 0xff}
+	colorGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	colorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+//Options sets the size and scales of the image
+type Options struct {
+	Width   int  //in pixels, DefaultWidth if <=0
+	Height  int  //in pixels, DefaultHeight if <=0
+	LogCost bool //logarithmic scale for the costs, costs <=0 are not drawn
+}
+
+//size returns the size of the image, with the defaults
+func (o Options) size() (int, int, error) {
+	w, h := o.Width, o.Height
+	if w <= 0 {
+		w = DefaultWidth
+	}
+	if h <= 0 {
+		h = DefaultHeight
+	}
+	if w < minWidth || h < minHeight {
+		return 0, 0, fmt.Errorf("image is %dx%d, minimum is %dx%d", w, h, minWidth, minHeight)
+	}
+	return w, h, nil
+}
+
+//anchor aligns a text horizontally on its position
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+//point is a position in the image, in pixels from the top left corner
+type point struct {
+	x, y float64
+}
+
+//canvas draws the primitives of the image
+type canvas interface {
+	line(a, b point, c color.RGBA)
+	//polyline draws a curve, a dot if it has a single point
+	polyline(pts []point, c color.RGBA)
+	//text writes s with its baseline at p
+	text(p point, s string, a anchor, c color.RGBA)
+}
+
+//series is a named curve, NaN values are not drawn
+type series struct {
+	name   string
+	color  color.RGBA
+	values []float64
+}
+
+//panel is a chart of one or more curves sharing the y axis
+type panel struct {
+	title  string
+	log    bool
+	series []*series
+}
+
+//panels returns the charts of the report
+func panels(report []nn.EpochReport, opts Options) []*panel {
+	n := len(report)
+	cost := &series{name: "training", color: colorTraining, values: make([]float64, n)}
+	validation := &series{name: "validation", color: colorValidation, values: make([]float64, n)}
+	lr := &series{name: "learning rate", color: colorLr, values: make([]float64, n)}
+	grad := &series{name: "gradient norm", color: colorGradNorm, values: make([]float64, n)}
+	validated, accumulated := false, false
+	for i, r := range report {
+		cost.values[i], lr.values[i], grad.values[i] = r.Cost, r.Lr, r.GradNorm
+		validation.values[i] = math.NaN()
+		if r.Validation != nil {
+			validation.values[i], validated = *r.Validation, true
+		}
+		if r.GradNorm != 0 {
+			accumulated = true
+		}
+	}
+	costs := &panel{title: "cost", log: opts.LogCost, series: []*series{cost}}
+	if validated {
+		costs.series = append(costs.series, validation)
+	}
+	res := []*panel{costs, {title: "learning rate", series: []*series{lr}}}
+	if accumulated {
+		res = append(res, &panel{title: "gradient norm", series: []*series{grad}})
+	}
+	return res
+}
+
+//scale maps the values of a panel to the y axis
+type scale struct {
+	log      bool
+	min, max float64 //transformed values
+	top, bot float64 //in pixels
+}
+
+//newScale returns the scale of the values of the panel, drawn between top and bot
+func newScale(p *panel, top, bot float64) *scale {
+	s := &scale{log: p.log, min: math.Inf(1), max: math.Inf(-1), top: top, bot: bot}
+	for _, ser := range p.series {
+		for _, v := range ser.values {
+			if v, ok := s.transform(v); ok {
+				s.min, s.max = math.Min(s.min, v), math.Max(s.max, v)
+			}
+		}
+	}
+	if s.min > s.max {
+		s.min, s.max = 0, 1
+	}
+	if s.min == s.max {
+		d := math.Abs(s.min) * 0.1
+		if d == 0 {
+			d = 1
+		}
+		s.min, s.max = s.min-d, s.max+d
+	}
+	return s
+}
+
+//transform returns the value drawn for v, false if it is not drawn
+func (s *scale) transform(v float64) (float64, bool) {
+	if s.log {
+		if v <= 0 {
+			return 0, false
+		}
+		v = math.Log10(v)
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+//y returns the position of the transformed value v
+func (s *scale) y(v float64) float64 {
+	return s.bot - (v-s.min)/(s.max-s.min)*(s.bot-s.top)
+}
+
+//label returns the label of the transformed value v
+func (s *scale) label(v float64) string {
+	if s.log {
+		v = math.Pow(10, v)
+	}
+	return fmt.Sprintf("%.3g", v)
+}
+
+//xAxis maps the epochs to the x axis
+type xAxis struct {
+	n           int
+	left, right float64
+}
+
+//x returns the position of the ith epoch of the report
+func (a *xAxis) x(i int) float64 {
+	if a.n == 1 {
+		return (a.left + a.right) / 2
+	}
+	return a.left + float64(i)/float64(a.n-1)*(a.right-a.left)
+}
+
+//ticks returns the indices of the labeled epochs
+func (a *xAxis) ticks() []int {
+	step := (a.n - 1 + xTicks - 2) / (xTicks - 1)
+	if step < 1 {
+		step = 1
+	}
+	var res []int
+	for i := 0; i < a.n; i += step {
+		res = append(res, i)
+	}
+	if last := res[len(res)-1]; last != a.n-1 && a.n-1-last >= (step+1)/2 {
+		res = append(res, a.n-1)
+	}
+	return res
+}
+
+//drawCurves draws the curves of the report on c, of size w*h
+func drawCurves(c canvas, report []nn.EpochReport, opts Options, w, h int) {
+	ps := panels(report, opts)
+	ax := &xAxis{n: len(report), left: marginLeft, right: float64(w - marginRight)}
+	height := float64(h-marginTop-marginBottom) / float64(len(ps))
+	for k, p := range ps {
+		top := marginTop + float64(k)*height
+		s := newScale(p, top+panelTitle, top+height-panelTicks)
+		//title and legend
+		c.text(point{ax.left, top + 14}, p.title, anchorStart, colorText)
+		x := ax.right
+		for i := len(p.series) - 1; i >= 0 && len(p.series) > 1; i-- {
+			ser := p.series[i]
+			c.text(point{x, top + 14}, ser.name, anchorEnd, ser.color)
+			x -= float64(len(ser.name)*charWidth) + 4
+			c.line(point{x - 16, top + 10}, point{x, top + 10}, ser.color)
+			x -= 28
+		}
+		//grid and ticks
+		for i := 0; i < yTicks; i++ {
+			v := s.min + float64(i)/float64(yTicks-1)*(s.max-s.min)
+			y := s.y(v)
+			c.line(point{ax.left, y}, point{ax.right, y}, colorGrid)
+			c.text(point{ax.left - 6, y + 4}, s.label(v), anchorEnd, colorText)
+		}
+		for _, i := range ax.ticks() {
+			x := ax.x(i)
+			c.line(point{x, s.top}, point{x, s.bot}, colorGrid)
+			c.text(point{x, s.bot + 13}, fmt.Sprint(report[i].Epoch), anchorMiddle, colorText)
+		}
+		c.line(point{ax.left, s.top}, point{ax.right, s.top}, colorFrame)
+		c.line(point{ax.left, s.bot}, point{ax.right, s.bot}, colorFrame)
+		c.line(point{ax.left, s.top}, point{ax.left, s.bot}, colorFrame)
+		c.line(point{ax.right, s.top}, point{ax.right, s.bot}, colorFrame)
+		//curves, broken where values are not drawn
+		for _, ser := range p.series {
+			var pts []point
+			for i, v := range ser.values {
+				if v, ok := s.transform(v); ok {
+					pts = append(pts, point{ax.x(i), s.y(v)})
+					continue
+				}
+				if len(pts) > 0 {
+					c.polyline(pts, ser.color)
+				}
+				pts = nil
+			}
+			if len(pts) > 0 {
+				c.polyline(pts, ser.color)
+			}
+		}
+	}
+	c.text(point{(ax.left + ax.right) / 2, float64(h - 6)}, "epoch", anchorMiddle, colorText)
+}
+
+//check returns an error if the report cannot be drawn
+func check(report []nn.EpochReport) error {
+	if len(report) == 0 {
+		return fmt.Errorf("report is empty")
+	}
+	return nil
+}
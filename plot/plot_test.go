@@ -0,0 +1,142 @@
+package plot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/klahssen/nn"
+	"github.com/klahssen/tester"
+)
+
+//report returns n epochs of decreasing costs, with validation costs and gradient norms if set
+func report(n int, validated, accumulated bool) []nn.EpochReport {
+	res := make([]nn.EpochReport, n)
+	for i := range res {
+		res[i] = nn.EpochReport{Epoch: uint(i + 1), Cost: math.Exp(-float64(i) / 4), Lr: 0.1 * math.Pow(0.5, float64(i/5))}
+		if validated {
+			v := res[i].Cost + 0.1
+			res[i].Validation = &v
+		}
+		if accumulated {
+			res[i].GradNorm = 2 / float64(i+1)
+		}
+	}
+	return res
+}
+
+//elements counts the elements of an SVG image by name, and returns the texts
+func elements(t *testing.T, data []byte) (map[string]int, []string) {
+	counts := map[string]int{}
+	var texts []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %s", err.Error())
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			counts[tok.Name.Local]++
+			inText = tok.Name.Local == "text"
+		case xml.CharData:
+			if inText {
+				texts = append(texts, string(tok))
+			}
+		case xml.EndElement:
+			inText = false
+		}
+	}
+	return counts, texts
+}
+
+func TestWriteSVG(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		report    []nn.EpochReport
+		opts      Options
+		err       error
+		polylines int
+		titles    []string
+	}{
+		{nil, Options{}, fmt.Errorf("report is empty"), 0, nil},
+		{report(3, false, false), Options{Width: 100}, fmt.Errorf("image is 100x480, minimum is 200x150"), 0, nil},
+		{report(20, false, false), Options{}, nil, 2, []string{"cost", "learning rate"}},
+		{report(20, true, true), Options{Width: 800, Height: 600}, nil, 4, []string{"cost", "training", "validation", "learning rate", "gradient norm"}},
+		//a single epoch is drawn as dots
+		{report(1, true, false), Options{}, nil, 0, []string{"cost", "training", "validation", "learning rate"}},
+	}
+	for ind, test := range tests {
+		buf := &bytes.Buffer{}
+		err := WriteSVG(buf, test.report, test.opts)
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		counts, texts := elements(t, buf.Bytes())
+		te.DeepEqual(ind, "svg", 1, counts["svg"])
+		te.DeepEqual(ind, "polylines", test.polylines, counts["polyline"])
+		all := strings.Join(texts, "|")
+		for _, title := range test.titles {
+			te.DeepEqual(ind, title, true, strings.Contains("|"+all+"|", "|"+title+"|"))
+		}
+		te.DeepEqual(ind, "last epoch", true, strings.Contains("|"+all+"|", fmt.Sprintf("|%d|", len(test.report))))
+		if len(test.report) == 1 {
+			te.DeepEqual(ind, "dots", 3, counts["circle"])
+		}
+	}
+}
+
+func TestLogScale(t *testing.T) {
+	te := tester.NewT(t)
+	rep := report(10, false, false)
+	rep[0].Cost, rep[9].Cost = 100, 0.01
+	//a cost of 0 cannot be drawn, and breaks the curve
+	rep[5].Cost = 0
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, WriteSVG(buf, rep, Options{LogCost: true}))
+	counts, texts := elements(t, buf.Bytes())
+	te.DeepEqual(0, "polylines", 3, counts["polyline"])
+	te.DeepEqual(0, "min", "0.01", texts[1])
+	te.DeepEqual(0, "middle", "1", texts[3])
+	te.DeepEqual(0, "max", "100", texts[5])
+}
+
+func TestWritePNG(t *testing.T) {
+	te := tester.NewT(t)
+	te.CheckError(0, fmt.Errorf("report is empty"), WritePNG(&bytes.Buffer{}, nil, Options{}))
+	buf := &bytes.Buffer{}
+	te.CheckError(1, nil, WritePNG(buf, report(20, true, true), Options{Width: 320, Height: 240}))
+	img, err := png.Decode(buf)
+	te.CheckError(1, nil, err)
+	if err != nil {
+		return
+	}
+	te.DeepEqual(1, "size", [2]int{320, 240}, [2]int{img.Bounds().Dx(), img.Bounds().Dy()})
+	//count the pixels of each curve
+	found := map[string]int{}
+	names := map[[3]uint32]string{}
+	for name, c := range map[string][3]uint8{"training": {0x1f, 0x77, 0xb4}, "validation": {0xff, 0x7f, 0x0e}, "lr": {0x2c, 0xa0, 0x2c}, "grad": {0xd6, 0x27, 0x28}} {
+		names[[3]uint32{uint32(c[0]) * 0x101, uint32(c[1]) * 0x101, uint32(c[2]) * 0x101}] = name
+	}
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if name, ok := names[[3]uint32{r, g, b}]; ok {
+				found[name]++
+			}
+		}
+	}
+	for _, name := range []string{"training", "validation", "lr", "grad"} {
+		te.DeepEqual(1, name, true, found[name] > 100)
+	}
+}
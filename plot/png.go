@@ -0,0 +1,144 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/klahssen/nn"
+)
+
+//glyphs is a 5x7 bitmap font of the characters of the labels: each row is a byte whose 5 lowest bits are the pixels, the highest one on the left. Other characters are drawn as blanks
+var glyphs = map[rune][7]byte{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'+': {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	'a': {0x00, 0x00, 0x0E, 0x01, 0x0F, 0x11, 0x0F},
+	'b': {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x1E},
+	'c': {0x00, 0x00, 0x0E, 0x10, 0x10, 0x11, 0x0E},
+	'd': {0x01, 0x01, 0x0D, 0x13, 0x11, 0x11, 0x0F},
+	'e': {0x00, 0x00, 0x0E, 0x11, 0x1F, 0x10, 0x0E},
+	'f': {0x06, 0x09, 0x08, 0x1C, 0x08, 0x08, 0x08},
+	'g': {0x00, 0x00, 0x0F, 0x11, 0x0F, 0x01, 0x0E},
+	'h': {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'i': {0x04, 0x00, 0x0C, 0x04, 0x04, 0x04, 0x0E},
+	'j': {0x02, 0x00, 0x06, 0x02, 0x02, 0x12, 0x0C},
+	'k': {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12},
+	'l': {0x0C, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'm': {0x00, 0x00, 0x1A, 0x15, 0x15, 0x11, 0x11},
+	'n': {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'o': {0x00, 0x00, 0x0E, 0x11, 0x11, 0x11, 0x0E},
+	'p': {0x00, 0x00, 0x1E, 0x11, 0x1E, 0x10, 0x10},
+	'q': {0x00, 0x00, 0x0D, 0x13, 0x0F, 0x01, 0x01},
+	'r': {0x00, 0x00, 0x16, 0x19, 0x10, 0x10, 0x10},
+	's': {0x00, 0x00, 0x0E, 0x10, 0x0E, 0x01, 0x1E},
+	't': {0x08, 0x08, 0x1C, 0x08, 0x08, 0x09, 0x06},
+	'u': {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0D},
+	'v': {0x00, 0x00, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'w': {0x00, 0x00, 0x11, 0x11, 0x15, 0x15, 0x0A},
+	'x': {0x00, 0x00, 0x11, 0x0A, 0x04, 0x0A, 0x11},
+	'y': {0x00, 0x00, 0x11, 0x11, 0x0F, 0x01, 0x0E},
+	'z': {0x00, 0x00, 0x1F, 0x02, 0x04, 0x08, 0x1F},
+}
+
+//pngCanvas rasterizes the primitives
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+//dot sets a square of size*size pixels at p
+func (pc *pngCanvas) dot(p point, size int, c color.RGBA) {
+	x, y := int(math.Round(p.x)), int(math.Round(p.y))
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			pc.img.SetRGBA(x+i, y+j, c)
+		}
+	}
+}
+
+//stroke draws a segment with a brush of size*size pixels
+func (pc *pngCanvas) stroke(a, b point, size int, c color.RGBA) {
+	n := int(math.Max(math.Abs(b.x-a.x), math.Abs(b.y-a.y)))
+	if n == 0 {
+		pc.dot(a, size, c)
+		return
+	}
+	for i := 0; i <= n; i++ {
+		t := float64(i) / float64(n)
+		pc.dot(point{a.x + t*(b.x-a.x), a.y + t*(b.y-a.y)}, size, c)
+	}
+}
+
+func (pc *pngCanvas) line(a, b point, c color.RGBA) {
+	pc.stroke(a, b, 1, c)
+}
+
+func (pc *pngCanvas) polyline(pts []point, c color.RGBA) {
+	if len(pts) == 1 {
+		pc.dot(point{pts[0].x - 1, pts[0].y - 1}, 3, c)
+		return
+	}
+	for i := 1; i < len(pts); i++ {
+		pc.stroke(pts[i-1], pts[i], 2, c)
+	}
+}
+
+func (pc *pngCanvas) text(p point, s string, a anchor, c color.RGBA) {
+	runes := []rune(s)
+	width := len(runes)*charWidth - 1
+	x := int(math.Round(p.x))
+	switch a {
+	case anchorMiddle:
+		x -= width / 2
+	case anchorEnd:
+		x -= width
+	}
+	top := int(math.Round(p.y)) - 7
+	for k, r := range runes {
+		g := glyphs[r]
+		for i, row := range g {
+			for j := 0; j < 5; j++ {
+				if row&(0x10>>uint(j)) != 0 {
+					pc.img.SetRGBA(x+k*charWidth+j, top+i, c)
+				}
+			}
+		}
+	}
+}
+
+//Image draws the training curves of the report
+func Image(report []nn.EpochReport, opts Options) (*image.RGBA, error) {
+	if err := check(report); err != nil {
+		return nil, err
+	}
+	width, height, err := opts.size()
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{colorBackground}, image.Point{}, draw.Src)
+	drawCurves(&pngCanvas{img: img}, report, opts, width, height)
+	return img, nil
+}
+
+//WritePNG writes the training curves of the report as a PNG image
+func WritePNG(w io.Writer, report []nn.EpochReport, opts Options) error {
+	img, err := Image(report, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
@@ -0,0 +1,62 @@
+package plot
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/klahssen/nn"
+)
+
+//svgCanvas writes the primitives as SVG elements
+type svgCanvas struct {
+	w *bufio.Writer
+}
+
+//hex returns the hexadecimal notation of c
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s *svgCanvas) line(a, b point, c color.RGBA) {
+	fmt.Fprintf(s.w, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"%s\"/>\n", a.x, a.y, b.x, b.y, hex(c))
+}
+
+func (s *svgCanvas) polyline(pts []point, c color.RGBA) {
+	if len(pts) == 1 {
+		fmt.Fprintf(s.w, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"2\" fill=\"%s\"/>\n", pts[0].x, pts[0].y, hex(c))
+		return
+	}
+	coords := make([]string, len(pts))
+	for i, p := range pts {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", p.x, p.y)
+	}
+	fmt.Fprintf(s.w, "<polyline points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"2\"/>\n", strings.Join(coords, " "), hex(c))
+}
+
+func (s *svgCanvas) text(p point, txt string, a anchor, c color.RGBA) {
+	anchors := []string{"start", "middle", "end"}
+	fmt.Fprintf(s.w, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"%s\" fill=\"%s\">", p.x, p.y, anchors[a], hex(c))
+	xml.EscapeText(s.w, []byte(txt))
+	fmt.Fprintf(s.w, "</text>\n")
+}
+
+//WriteSVG writes the training curves of the report as an SVG image
+func WriteSVG(w io.Writer, report []nn.EpochReport, opts Options) error {
+	if err := check(report); err != nil {
+		return err
+	}
+	width, height, err := opts.size()
+	if err != nil {
+		return err
+	}
+	c := &svgCanvas{w: bufio.NewWriter(w)}
+	fmt.Fprintf(c.w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"monospace\" font-size=\"10\">\n", width, height, width, height)
+	fmt.Fprintf(c.w, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hex(colorBackground))
+	drawCurves(c, report, opts, width, height)
+	fmt.Fprintf(c.w, "</svg>\n")
+	return c.w.Flush()
+}
@@ -0,0 +1,290 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//PruneOptions selects the weights set to 0 by Prune, by magnitude. Biases are never pruned
+type PruneOptions struct {
+	Threshold float64 //weights whose absolute value is below the threshold are pruned
+	Sparsity  float64 //ratio of weights to prune in [0;1[, the smallest in absolute value, used instead of the threshold if >0
+	Global    bool    //the sparsity is reached over all the weights of the network instead of in each layer
+}
+
+//validate checks the options
+func (o PruneOptions) validate() error {
+	if o.Threshold < 0 {
+		return fmt.Errorf("threshold must be >=0")
+	}
+	if o.Sparsity < 0 || o.Sparsity >= 1 {
+		return fmt.Errorf("sparsity must be in [0;1[")
+	}
+	if o.Threshold > 0 && o.Sparsity > 0 {
+		return fmt.Errorf("threshold and sparsity can not be both set")
+	}
+	return nil
+}
+
+//mask sets the pruned values of p to 0, or of its gradient if grad is set
+func (p *Param) mask(grad bool) {
+	if p == nil || p.pruned == nil {
+		return
+	}
+	m := p.Value
+	if grad {
+		if m = p.Grad; m == nil {
+			return
+		}
+	}
+	data := m.GetData()
+	for i, pruned := range p.pruned {
+		if pruned {
+			data[i] = 0
+		}
+	}
+	m.SetData(data)
+}
+
+//prune sets the values of indexes inds of p to 0 and keeps them at 0. Values pruned before stay pruned
+func (p *Param) prune(inds []int) {
+	if p.pruned == nil {
+		p.pruned = make([]bool, p.Value.Size())
+	}
+	for _, i := range inds {
+		p.pruned[i] = true
+	}
+	p.mask(false)
+}
+
+//byMagnitude returns the indexes of the values sorted by increasing absolute value
+func byMagnitude(values []float64) []int {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return math.Abs(values[order[i]]) < math.Abs(values[order[j]]) })
+	return order
+}
+
+//Prune sets the weights of small magnitude to 0 and keeps them at 0 when the network is trained. Successive calls prune more weights: the weights pruned before stay pruned. The masks are not encoded, pruned weights being decoded as trainable zeros
+func (ff *FC) Prune(opts PruneOptions) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Sparsity == 0 || !opts.Global {
+		for i := range ff.layers {
+			ff.pruneLayer(i, opts)
+		}
+		return nil
+	}
+	//global sparsity: the threshold is the magnitude of the n-th smallest weight of the network
+	var all []float64
+	for _, l := range ff.layers {
+		all = append(all, l.w.GetData()...)
+	}
+	order := byMagnitude(all)
+	n := int(math.Round(opts.Sparsity * float64(len(all))))
+	pruned := make([]bool, len(all))
+	for _, i := range order[:n] {
+		pruned[i] = true
+	}
+	k := 0
+	for _, l := range ff.layers {
+		var inds []int
+		for i := 0; i < l.w.Size(); i++ {
+			if pruned[k+i] {
+				inds = append(inds, i)
+			}
+		}
+		l.params[0].prune(inds)
+		k += l.w.Size()
+	}
+	return nil
+}
+
+//PruneLayer prunes the weights of layer i only, see Prune. The Global option is ignored
+func (ff *FC) PruneLayer(i int, opts PruneOptions) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	if i < 0 || i >= len(ff.layers) {
+		return fmt.Errorf("layer index must be between %d and %d", 0, len(ff.layers)-1)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	ff.pruneLayer(i, opts)
+	return nil
+}
+
+//pruneLayer prunes the weights of layer i with valid options
+func (ff *FC) pruneLayer(i int, opts PruneOptions) {
+	p := ff.layers[i].params[0]
+	data := p.Value.GetData()
+	if opts.Sparsity > 0 {
+		p.prune(byMagnitude(data)[:int(math.Round(opts.Sparsity*float64(len(data))))])
+		return
+	}
+	var inds []int
+	for j, v := range data {
+		if math.Abs(v) < opts.Threshold {
+			inds = append(inds, j)
+		}
+	}
+	p.prune(inds)
+}
+
+//Unprune removes the masks of the pruned weights, which are trained again from 0
+func (ff *FC) Unprune() {
+	for _, p := range ff.Params() {
+		p.pruned = nil
+	}
+}
+
+//Sparsity returns the ratio of weights equal to 0, pruned or not. Biases are not counted
+func (ff *FC) Sparsity() float64 {
+	if ff == nil {
+		return 0
+	}
+	zeros, n := 0, 0
+	for _, l := range ff.layers {
+		for _, v := range l.w.GetData() {
+			if v == 0 {
+				zeros++
+			}
+		}
+		n += l.w.Size()
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(zeros) / float64(n)
+}
+
+//SparseFC is a fully connected network whose weights are stored as sparse matrices, for inference only: the weighted sums only go through the weights which are not 0, which is faster than the dense FC once most weights are pruned
+type SparseFC struct {
+	inSize  int
+	outSize int
+	layers  []*sparseLayer
+}
+
+//sparseLayer is a dense layer of a SparseFC, whose weights are stored in the compressed sparse row format: the weights of neuron i are vals[rows[i]:rows[i+1]], for the inputs cols[rows[i]:rows[i+1]]
+type sparseLayer struct {
+	inSize  int
+	outSize int
+	rows    []int
+	cols    []int
+	vals    []float64
+	b       []float64
+	a       activation.F
+}
+
+//Sparse returns the sparse version of the network, for inference. Regularization and dropout are not kept
+func (ff *FC) Sparse() (*SparseFC, error) {
+	if err := ff.validate(); err != nil {
+		return nil, err
+	}
+	s := &SparseFC{inSize: ff.inSize, outSize: ff.outSize, layers: make([]*sparseLayer, len(ff.layers))}
+	for i, l := range ff.layers {
+		sl := &sparseLayer{inSize: l.inSize, outSize: l.outSize, rows: make([]int, l.outSize+1), b: l.b.GetData(), a: l.a}
+		w := l.w.GetData()
+		for n := 0; n < l.outSize; n++ {
+			for j, v := range w[n*l.inSize : (n+1)*l.inSize] {
+				if v != 0 {
+					sl.cols, sl.vals = append(sl.cols, j), append(sl.vals, v)
+				}
+			}
+			sl.rows[n+1] = len(sl.vals)
+		}
+		s.layers[i] = sl
+	}
+	return s, nil
+}
+
+//InSize returns the size of the input
+func (s *SparseFC) InSize() int {
+	if s == nil {
+		return 0
+	}
+	return s.inSize
+}
+
+//OutSize returns the size of the output, the size of the last layer
+func (s *SparseFC) OutSize() int {
+	if s == nil {
+		return 0
+	}
+	return s.outSize
+}
+
+//Weights returns the number of weights which are not 0
+func (s *SparseFC) Weights() int {
+	if s == nil {
+		return 0
+	}
+	n := 0
+	for _, l := range s.layers {
+		n += len(l.vals)
+	}
+	return n
+}
+
+//Predict returns the output of the network for the input
+func (s *SparseFC) Predict(input []float64) ([]float64, error) {
+	if s == nil {
+		return nil, fmt.Errorf("network is nil")
+	}
+	if len(input) != s.inSize {
+		return nil, fmt.Errorf("input has %d values, expected %d", len(input), s.inSize)
+	}
+	out := input
+	for _, l := range s.layers {
+		in := out
+		out = make([]float64, l.outSize)
+		for i := range out {
+			sum := l.b[i]
+			for k := l.rows[i]; k < l.rows[i+1]; k++ {
+				sum += l.vals[k] * in[l.cols[k]]
+			}
+			out[i] = l.a.Func(sum)
+		}
+	}
+	return out, nil
+}
+
+//FeedForward runs the network on each colomn of the input and returns the outputs as colomns
+func (s *SparseFC) FeedForward(input *mat.M64) (*mat.M64, error) {
+	if s == nil {
+		return nil, fmt.Errorf("network is nil")
+	}
+	if input == nil {
+		return nil, fmt.Errorf("input is nil")
+	}
+	r, c := input.Dims()
+	if r != s.inSize {
+		return nil, fmt.Errorf("input has %d rows, expected %d", r, s.inSize)
+	}
+	res := mat.NewM64(s.outSize, c, nil)
+	col := make([]float64, r)
+	for j := 0; j < c; j++ {
+		for i := range col {
+			col[i] = input.At(i, j)
+		}
+		out, err := s.Predict(col)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range out {
+			res.Set(i, j, v)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,179 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//prunedFC returns a network 2->2->1 with weights of distinct magnitudes
+func prunedFC() *FC {
+	f, _ := NewFC(2)
+	f.SetLayers(&LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh}, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	f.SetLayerData(0, []float64{0.1, -0.4, 0.3, -0.02, 1, 1})
+	f.SetLayerData(1, []float64{-0.5, 0.9, 1})
+	return f
+}
+
+func TestPrune(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		opts  PruneOptions
+		layer int //pruned alone if >=0
+		w     [][]float64
+		err   error
+	}{
+		{PruneOptions{Threshold: 0.2}, -1, [][]float64{{0, -0.4, 0.3, 0}, {-0.5, 0.9}}, nil},
+		//half of the weights of each layer
+		{PruneOptions{Sparsity: 0.5}, -1, [][]float64{{0, -0.4, 0.3, 0}, {0, 0.9}}, nil},
+		//half of the weights of the network: the second layer keeps both
+		{PruneOptions{Sparsity: 0.5, Global: true}, -1, [][]float64{{0, -0.4, 0, 0}, {-0.5, 0.9}}, nil},
+		{PruneOptions{Sparsity: 0.25}, 0, [][]float64{{0.1, -0.4, 0.3, 0}, {-0.5, 0.9}}, nil},
+		{PruneOptions{}, -1, [][]float64{{0.1, -0.4, 0.3, -0.02}, {-0.5, 0.9}}, nil},
+		{PruneOptions{Threshold: -1}, -1, nil, fmt.Errorf("threshold must be >=0")},
+		{PruneOptions{Sparsity: 1}, -1, nil, fmt.Errorf("sparsity must be in [0;1[")},
+		{PruneOptions{Threshold: 0.1, Sparsity: 0.5}, -1, nil, fmt.Errorf("threshold and sparsity can not be both set")},
+		{PruneOptions{}, 2, nil, fmt.Errorf("layer index must be between 0 and 1")},
+	}
+	for ind, test := range tests {
+		f := prunedFC()
+		var err error
+		if test.layer >= 0 {
+			err = f.PruneLayer(test.layer, test.opts)
+		} else {
+			err = f.Prune(test.opts)
+		}
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "weights", test.w, [][]float64{f.layers[0].w.GetData(), f.layers[1].w.GetData()})
+		te.DeepEqual(ind, "biases", [][]float64{{1, 1}, {1}}, [][]float64{f.layers[0].b.GetData(), f.layers[1].b.GetData()})
+	}
+	//pruning again keeps the weights pruned before
+	f := prunedFC()
+	te.CheckError(0, nil, f.Prune(PruneOptions{Sparsity: 0.5, Global: true}))
+	te.CheckError(1, nil, f.PruneLayer(1, PruneOptions{Sparsity: 0.5}))
+	te.DeepEqual(1, "weights", [][]float64{{0, -0.4, 0, 0}, {0, 0.9}}, [][]float64{f.layers[0].w.GetData(), f.layers[1].w.GetData()})
+	te.DeepEqual(1, "sparsity", float64(4)/6, f.Sparsity())
+	f.Unprune()
+	for _, p := range f.Params() {
+		te.DeepEqual(2, p.Name, []bool(nil), p.pruned)
+	}
+	empty, _ := NewFC(2)
+	te.CheckError(3, fmt.Errorf("network has no layers"), empty.Prune(PruneOptions{}))
+}
+
+//pruningSet returns n points of (x0-x1, x2), which a network can fit with few weights
+func pruningSet(n int) Dataset {
+	r := rand.New(rand.NewSource(1))
+	points := make([]*Datapoint, n)
+	for i := range points {
+		in := randM64(r, 4, 1)
+		points[i] = &Datapoint{Inp: in, Exp: mat.NewM64(2, 1, []float64{in.At(0, 0) - in.At(1, 0), in.At(2, 0)})}
+	}
+	return &pointsDataset{points: points}
+}
+
+func TestPruneTraining(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := mockRandFC(1, 4, []*LayerConfig{{Size: 4, FuncType: activation.FuncTypeIden}, {Size: 2, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the momentum of adam does not move the pruned weights
+	adam, _ := NewAdam(0.9, 0.999, 1e-8)
+	f.SetOptimizer(adam)
+	tr, err := NewFCTrainer(f, log.New(&nopWriter{}, "", 0), NewLr(0.01), 6, 0, activation.Power(0.5, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//24 weights pruned to 25% then 50%, per layer and globally
+	te.CheckError(0, nil, tr.SetPruning(PruneOptions{Sparsity: 0.5}, 2, 2))
+	te.CheckError(0, nil, tr.Train(rand.NewSource(1), 0, 0.5, 4, pruningSet(40), nil, pruningSet(10)))
+	sparsity := make([]float64, 0, 6)
+	for _, rep := range tr.Report() {
+		sparsity = append(sparsity, rep.Sparsity)
+	}
+	te.DeepEqual(0, "sparsity", []float64{0, 0.25, 0.25, 0.5, 0.5, 0.5}, sparsity)
+	for _, l := range f.layers {
+		for i, v := range l.w.GetData() {
+			if l.params[0].pruned[i] && v != 0 {
+				t.Errorf("pruned weight %d was updated to %f", i, v)
+			}
+		}
+	}
+	//errors
+	te.CheckError(1, fmt.Errorf("pruning steps must be >0"), tr.SetPruning(PruneOptions{}, 1, 0))
+	te.CheckError(2, fmt.Errorf("sparsity must be in [0;1["), tr.SetPruning(PruneOptions{Sparsity: 2}, 1, 1))
+	m, _ := NewSequential(1, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	tm, _ := NewTrainer(m, nil, NewLr(0.1), 1, 0, activation.Power(0.5, 2))
+	te.CheckError(3, fmt.Errorf("network can not be pruned"), tm.SetPruning(PruneOptions{}, 1, 1))
+}
+
+func TestSparseFC(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := mockRandFC(1, 8, []*LayerConfig{{Size: 16, FuncType: activation.FuncTypeTanh}, {Size: 3, FuncType: activation.FuncTypeSigmoid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, nil, f.Prune(PruneOptions{Sparsity: 0.75}))
+	s, err := f.Sparse()
+	te.CheckError(0, nil, err)
+	te.DeepEqual(0, "sizes", []int{8, 3, 44}, []int{s.InSize(), s.OutSize(), s.Weights()})
+	in := randM64(rand.New(rand.NewSource(2)), 8, 5)
+	exp, err := f.FeedForward(in)
+	te.CheckError(1, nil, err)
+	out, err := s.FeedForward(in)
+	te.CheckError(1, nil, err)
+	for i, v := range out.GetData() {
+		if math.Abs(v-exp.GetData()[i]) > 1e-12 {
+			t.Errorf("output %d: expected %f received %f", i, exp.GetData()[i], v)
+		}
+	}
+	//errors
+	_, err = s.Predict([]float64{1})
+	te.CheckError(2, fmt.Errorf("input has 1 values, expected 8"), err)
+	_, err = s.FeedForward(mat.NewM64(2, 1, nil))
+	te.CheckError(3, fmt.Errorf("input has 2 rows, expected 8"), err)
+	empty, _ := NewFC(2)
+	_, err = empty.Sparse()
+	te.CheckError(4, fmt.Errorf("network has no layers"), err)
+	var nilSparse *SparseFC
+	_, err = nilSparse.Predict(nil)
+	te.CheckError(5, fmt.Errorf("network is nil"), err)
+}
+
+//benchmarkPruned runs a network 256->256->10 with 90% of its weights pruned, dense or sparse
+func benchmarkPruned(b *testing.B, sparse bool) {
+	f, err := mockRandFC(1, 256, []*LayerConfig{{Size: 256, FuncType: activation.FuncTypeRelu}, {Size: 10, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = f.Prune(PruneOptions{Sparsity: 0.9}); err != nil {
+		b.Fatal(err)
+	}
+	var n Predictor = f
+	if sparse {
+		if n, err = f.Sparse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	in := randM64(rand.New(rand.NewSource(2)), 256, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = n.FeedForward(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrunedFC(b *testing.B) { benchmarkPruned(b, false) }
+
+func BenchmarkSparseFC(b *testing.B) { benchmarkPruned(b, true) }
@@ -0,0 +1,316 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+)
+
+//QuantizeOptions configures the post-training quantization of an FC
+type QuantizeOptions struct {
+	PerChannel bool //a weights scale for each neuron instead of a single one for each layer, more accurate when the rows of the weights have different magnitudes
+}
+
+//QFC is a fully connected network quantized to int8, for inference only. Weights are quantized symmetrically, with a scale per layer or per neuron. Activations are quantized with a scale and a zero point calibrated on a representative dataset, bias to int32 with the scale of the weighted sums.
+//
+//The weighted sums are computed on int8 values accumulated in int64, so that they can not overflow whatever the bias and the number of inputs. Each sum is then rescaled to float64 to apply the activation function, and the output quantized to int8 again for the next layer
+type QFC struct {
+	inSize  int
+	outSize int
+	in      quant //quantization of the input
+	layers  []*qlayer
+}
+
+//qlayer is a dense layer of a QFC
+type qlayer struct {
+	inSize  int
+	outSize int
+	w       []int8    //outSize*inSize, row by row
+	scales  []float64 //scale of the weights, one per layer or one per neuron
+	b       []int32   //bias quantized with the scale of the weighted sums of each neuron
+	a       activation.F
+	out     quant //quantization of the output
+}
+
+//quant maps real values in a range to int8: x = scale*(q-zero)
+type quant struct {
+	scale float64
+	zero  int32
+}
+
+//newQuant returns the quantization of the range [min;max], extended to include 0 so that it is represented exactly
+func newQuant(min, max float64) quant {
+	min, max = math.Min(min, 0), math.Max(max, 0)
+	if max == min {
+		return quant{scale: 1, zero: 0}
+	}
+	scale := (max - min) / 255
+	return quant{scale: scale, zero: int32(clampInt(math.Round(-128-min/scale), -128, 127))}
+}
+
+//quantize returns the int8 value closest to x
+func (q quant) quantize(x float64) int8 {
+	return int8(clampInt(math.Round(x/q.scale)+float64(q.zero), -128, 127))
+}
+
+//dequantize returns the real value of v
+func (q quant) dequantize(v int8) float64 {
+	return q.scale * float64(int32(v)-q.zero)
+}
+
+//clampInt clamps the rounded value x to [min;max]
+func clampInt(x, min, max float64) float64 {
+	return math.Max(min, math.Min(max, x))
+}
+
+//Quantize returns the network quantized to int8. The ranges of the input and of the outputs of each layer are calibrated on every point of the dataset. Regularization and dropout are not kept
+func (ff *FC) Quantize(calibration Dataset, opts QuantizeOptions) (*QFC, error) {
+	if err := ff.validate(); err != nil {
+		return nil, err
+	}
+	if calibration == nil || calibration.Size() == 0 {
+		return nil, fmt.Errorf("calibration dataset is empty")
+	}
+	ranges, err := ff.calibrate(calibration)
+	if err != nil {
+		return nil, err
+	}
+	q := &QFC{inSize: ff.inSize, outSize: ff.outSize, in: newQuant(ranges[0][0], ranges[0][1]), layers: make([]*qlayer, len(ff.layers))}
+	in := q.in
+	for i, l := range ff.layers {
+		ql := &qlayer{inSize: l.inSize, outSize: l.outSize, w: make([]int8, l.inSize*l.outSize), b: make([]int32, l.outSize), a: l.a, out: newQuant(ranges[i+1][0], ranges[i+1][1])}
+		w, b := l.w.GetData(), l.b.GetData()
+		ql.scales = weightScales(w, l.outSize, l.inSize, opts.PerChannel)
+		for n := 0; n < l.outSize; n++ {
+			s := ql.scale(n)
+			for j, v := range w[n*l.inSize : (n+1)*l.inSize] {
+				ql.w[n*l.inSize+j] = int8(clampInt(math.Round(v/s), -127, 127))
+			}
+			ql.b[n] = int32(clampInt(math.Round(b[n]/(in.scale*s)), math.MinInt32, math.MaxInt32))
+		}
+		q.layers[i] = ql
+		in = ql.out
+	}
+	return q, nil
+}
+
+//calibrate runs the network on each input of the dataset and returns the [min, max] range of the input, then of the output of each layer
+func (ff *FC) calibrate(data Dataset) ([][2]float64, error) {
+	training := ff.training
+	ff.training = false
+	defer func() { ff.training = training }()
+	ranges := make([][2]float64, len(ff.layers)+1)
+	for i := range ranges {
+		ranges[i] = [2]float64{math.Inf(1), math.Inf(-1)}
+	}
+	update := func(i int, values []float64) {
+		for _, v := range values {
+			ranges[i][0], ranges[i][1] = math.Min(ranges[i][0], v), math.Max(ranges[i][1], v)
+		}
+	}
+	ind := 0
+	data.Reset()
+	for p := data.Next(); p != nil; p = data.Next() {
+		if _, err := ff.FeedForward(p.Inp); err != nil {
+			return nil, fmt.Errorf("datapoint[%d]: %s", ind, err.Error())
+		}
+		update(0, p.Inp.GetData())
+		for i, out := range ff.outs {
+			update(i+1, out.GetData())
+		}
+		ind++
+	}
+	return ranges, nil
+}
+
+//weightScales returns the symmetric scales of the weights w of rows*cols values, one per row if perRow is set
+func weightScales(w []float64, rows, cols int, perRow bool) []float64 {
+	max := make([]float64, rows)
+	for i := range max {
+		for _, v := range w[i*cols : (i+1)*cols] {
+			max[i] = math.Max(max[i], math.Abs(v))
+		}
+	}
+	if !perRow {
+		m := 0.0
+		for _, v := range max {
+			m = math.Max(m, v)
+		}
+		max = []float64{m}
+	}
+	for i, v := range max {
+		if v == 0 {
+			max[i] = 1
+		} else {
+			max[i] = v / 127
+		}
+	}
+	return max
+}
+
+//scale returns the scale of the weights of neuron n
+func (l *qlayer) scale(n int) float64 {
+	if len(l.scales) == 1 {
+		return l.scales[0]
+	}
+	return l.scales[n]
+}
+
+//InSize returns the size of the input
+func (q *QFC) InSize() int {
+	if q == nil {
+		return 0
+	}
+	return q.inSize
+}
+
+//OutSize returns the size of the output, the size of the last layer
+func (q *QFC) OutSize() int {
+	if q == nil {
+		return 0
+	}
+	return q.outSize
+}
+
+//Bytes returns the memory taken by the parameters: int8 weights, int32 bias and float64 scales and activation ranges
+func (q *QFC) Bytes() int {
+	if q == nil {
+		return 0
+	}
+	n := 8 + 4
+	for _, l := range q.layers {
+		n += len(l.w) + 4*len(l.b) + 8*len(l.scales) + 8 + 4
+	}
+	return n
+}
+
+//Predict returns the output of the network for the input: the input is quantized and the output dequantized
+func (q *QFC) Predict(input []float64) ([]float64, error) {
+	if q == nil {
+		return nil, fmt.Errorf("network is nil")
+	}
+	if len(input) != q.inSize {
+		return nil, fmt.Errorf("input has %d values, expected %d", len(input), q.inSize)
+	}
+	x := make([]int8, len(input))
+	for i, v := range input {
+		x[i] = q.in.quantize(v)
+	}
+	in := q.in
+	for _, l := range q.layers {
+		x = l.forward(x, in)
+		in = l.out
+	}
+	out := make([]float64, len(x))
+	for i, v := range x {
+		out[i] = in.dequantize(v)
+	}
+	return out, nil
+}
+
+//forward returns the quantized output of the layer for the input x quantized with in
+func (l *qlayer) forward(x []int8, in quant) []int8 {
+	out := make([]int8, l.outSize)
+	for n := range out {
+		acc := int64(l.b[n])
+		for j, w := range l.w[n*l.inSize : (n+1)*l.inSize] {
+			acc += int64(w) * (int64(x[j]) - int64(in.zero))
+		}
+		out[n] = l.out.quantize(l.a.Func(float64(acc) * in.scale * l.scale(n)))
+	}
+	return out
+}
+
+//FeedForward runs the quantized network on each colomn of the input and returns the outputs as colomns
+func (q *QFC) FeedForward(input *mat.M64) (*mat.M64, error) {
+	if q == nil {
+		return nil, fmt.Errorf("network is nil")
+	}
+	if input == nil {
+		return nil, fmt.Errorf("input is nil")
+	}
+	r, c := input.Dims()
+	if r != q.inSize {
+		return nil, fmt.Errorf("input has %d rows, expected %d", r, q.inSize)
+	}
+	res := mat.NewM64(q.outSize, c, nil)
+	col := make([]float64, r)
+	for j := 0; j < c; j++ {
+		for i := range col {
+			col[i] = input.At(i, j)
+		}
+		out, err := q.Predict(col)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range out {
+			res.Set(i, j, v)
+		}
+	}
+	return res, nil
+}
+
+//QuantizationReport compares a quantized network to the float network it comes from
+type QuantizationReport struct {
+	Float          *Metrics `json:"float"`
+	Quantized      *Metrics `json:"quantized"`
+	AccuracyLoss   float64  `json:"accuracy_loss,omitempty"` //accuracy of the float network minus accuracy of the quantized one, for networks with several outputs
+	MaxError       float64  `json:"max_error"`               //largest absolute difference between the outputs of both networks
+	MeanError      float64  `json:"mean_error"`              //mean absolute difference between the outputs of both networks
+	Agreement      float64  `json:"agreement,omitempty"`     //ratio of points whose largest output is the same for both networks, for networks with several outputs
+	FloatBytes     int      `json:"float_bytes"`             //memory taken by the float64 parameters
+	QuantizedBytes int      `json:"quantized_bytes"`         //memory taken by the quantized parameters, see QFC.Bytes
+}
+
+//CompareQuantized evaluates the float network and its quantized version on the dataset and reports the loss of accuracy
+func CompareQuantized(ff *FC, q *QFC, data Dataset, cost activation.F) (*QuantizationReport, error) {
+	if err := ff.validate(); err != nil {
+		return nil, err
+	}
+	if q == nil {
+		return nil, fmt.Errorf("quantized network is nil")
+	}
+	if q.inSize != ff.inSize || q.outSize != ff.outSize {
+		return nil, fmt.Errorf("quantized network is %dx%d, expected %dx%d", q.inSize, q.outSize, ff.inSize, ff.outSize)
+	}
+	res := &QuantizationReport{QuantizedBytes: q.Bytes()}
+	var err error
+	if res.Float, err = Evaluate(ff, data, cost); err != nil {
+		return nil, err
+	}
+	if res.Quantized, err = Evaluate(q, data, cost); err != nil {
+		return nil, err
+	}
+	res.AccuracyLoss = res.Float.Accuracy - res.Quantized.Accuracy
+	for _, l := range ff.layers {
+		res.FloatBytes += 8 * (l.w.Size() + l.b.Size())
+	}
+	values, agree := 0, 0
+	data.Reset()
+	for p := data.Next(); p != nil; p = data.Next() {
+		exp, err := ff.FeedForward(p.Inp)
+		if err != nil {
+			return nil, err
+		}
+		out, err := q.FeedForward(p.Inp)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range out.GetData() {
+			d := math.Abs(v - exp.GetData()[i])
+			res.MaxError = math.Max(res.MaxError, d)
+			res.MeanError += d
+		}
+		values += out.Size()
+		if argmax(out.GetData()) == argmax(exp.GetData()) {
+			agree++
+		}
+	}
+	res.MeanError /= float64(values)
+	if ff.outSize > 1 {
+		res.Agreement = float64(agree) / float64(res.Float.Points)
+	}
+	return res, nil
+}
@@ -0,0 +1,181 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestQuant(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		min, max float64
+		q        quant
+		in       []float64
+		out      []int8
+	}{
+		//0 is represented exactly
+		{-1, 1, quant{scale: 2.0 / 255, zero: -1}, []float64{0, -1, 1, 2}, []int8{-1, -128, 127, 127}},
+		//the range is extended to 0
+		{0.5, 2, quant{scale: 2.0 / 255, zero: -128}, []float64{0, 1, -1}, []int8{-128, 0, -128}},
+		{0, 0, quant{scale: 1, zero: 0}, []float64{0, 3}, []int8{0, 3}},
+	}
+	for ind, test := range tests {
+		q := newQuant(test.min, test.max)
+		te.DeepEqual(ind, "quant", test.q, q)
+		out := make([]int8, len(test.in))
+		for i, v := range test.in {
+			out[i] = q.quantize(v)
+		}
+		te.DeepEqual(ind, "quantized", test.out, out)
+		te.DeepEqual(ind, "zero", 0.0, q.dequantize(q.quantize(0)))
+	}
+}
+
+//quantizationSet returns n random inputs in [-1;1[ labelled with the outputs of the network
+func quantizationSet(f *FC, seed int64, n int) (Dataset, error) {
+	r := rand.New(rand.NewSource(seed))
+	points := make([]*Datapoint, n)
+	for i := range points {
+		in := randM64(r, f.InSize(), 1)
+		out, err := f.FeedForward(in)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = &Datapoint{Inp: in, Exp: out}
+	}
+	return &pointsDataset{points: points}, nil
+}
+
+func TestQuantize(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := mockRandFC(1, 8, []*LayerConfig{{Size: 16, FuncType: activation.FuncTypeTanh}, {Size: 3, FuncType: activation.FuncTypeSigmoid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the first neuron has weights 20 times larger than the others: a single scale for the layer loses the precision of the others
+	w := f.layers[0].w.GetData()
+	for j := 0; j < 8; j++ {
+		w[j] *= 20
+	}
+	f.layers[0].w.SetData(w)
+	calibration, err := quantizationSet(f, 2, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := quantizationSet(f, 3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := make([]*QuantizationReport, 2)
+	for i, perChannel := range []bool{false, true} {
+		q, err := f.Quantize(calibration, QuantizeOptions{PerChannel: perChannel})
+		te.CheckError(i, nil, err)
+		te.DeepEqual(i, "sizes", []int{8, 3}, []int{q.InSize(), q.OutSize()})
+		reports[i], err = CompareQuantized(f, q, test, activation.Power(0.5, 2))
+		te.CheckError(i, nil, err)
+		r := reports[i]
+		t.Logf("per channel %t: max error %g, mean error %g, agreement %g", perChannel, r.MaxError, r.MeanError, r.Agreement)
+		if max := []float64{0.1, 0.05}[i]; r.MaxError > max {
+			t.Errorf("%d: expected a maximum error <%g received %g", i, max, r.MaxError)
+		}
+		if r.Agreement < 0.9 {
+			t.Errorf("%d: expected an agreement >=0.9 received %g", i, r.Agreement)
+		}
+		te.DeepEqual(i, "accuracy loss", r.Float.Accuracy-r.Quantized.Accuracy, r.AccuracyLoss)
+		te.DeepEqual(i, "float accuracy", 1.0, r.Float.Accuracy)
+		//the scales of each neuron take 8 bytes
+		if 3*r.QuantizedBytes > r.FloatBytes {
+			t.Errorf("%d: expected at most %d bytes received %d", i, r.FloatBytes/3, r.QuantizedBytes)
+		}
+	}
+	if reports[1].MeanError >= reports[0].MeanError {
+		t.Errorf("expected per channel scales to be more accurate: mean error %g, per layer %g", reports[1].MeanError, reports[0].MeanError)
+	}
+}
+
+func TestQFC(t *testing.T) {
+	te := tester.NewT(t)
+	double := activation.F{Func: func(x float64) float64 { return 2 * x }, Deriv: func(x float64) float64 { return 2 }}
+	f, err := mockRandFC(3, 3, []*LayerConfig{{Size: 2, FuncType: activation.FuncTypeRelu}, {Size: 2, F: double}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calibration, err := quantizationSet(f, 4, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := f.Quantize(calibration, QuantizeOptions{})
+	te.CheckError(0, nil, err)
+	//colomns are run as a batch
+	in := mat.NewM64(3, 2, []float64{1, 0.5, -1, 0, 0.25, 0.5})
+	batch, err := q.FeedForward(in)
+	te.CheckError(1, nil, err)
+	for j := 0; j < 2; j++ {
+		out, err := q.Predict([]float64{in.At(0, j), in.At(1, j), in.At(2, j)})
+		te.CheckError(1, nil, err)
+		te.DeepEqual(1, fmt.Sprintf("colomn %d", j), out, []float64{batch.At(0, j), batch.At(1, j)})
+	}
+	//errors
+	_, err = q.Predict([]float64{1})
+	te.CheckError(2, fmt.Errorf("input has 1 values, expected 3"), err)
+	_, err = q.FeedForward(mat.NewM64(2, 1, nil))
+	te.CheckError(3, fmt.Errorf("input has 2 rows, expected 3"), err)
+	_, err = f.Quantize(nil, QuantizeOptions{})
+	te.CheckError(4, fmt.Errorf("calibration dataset is empty"), err)
+	_, err = f.Quantize(&pointsDataset{points: []*Datapoint{{Inp: mat.NewM64(2, 1, nil)}}}, QuantizeOptions{})
+	te.CheckError(5, fmt.Errorf("datapoint[0]: layer[0]: w*x failed: matmul: m colomns != n rows"), err)
+	empty, _ := NewFC(2)
+	_, err = empty.Quantize(calibration, QuantizeOptions{})
+	te.CheckError(6, fmt.Errorf("network has no layers"), err)
+	other, _ := mockRandFC(3, 2, []*LayerConfig{{Size: 2, FuncType: activation.FuncTypeRelu}})
+	_, err = CompareQuantized(other, q, calibration, activation.Power(0.5, 2))
+	te.CheckError(7, fmt.Errorf("quantized network is 3x2, expected 2x2"), err)
+	_, err = CompareQuantized(f, nil, calibration, activation.Power(0.5, 2))
+	te.CheckError(8, fmt.Errorf("quantized network is nil"), err)
+	var nilQFC *QFC
+	_, err = nilQFC.Predict(nil)
+	te.CheckError(9, fmt.Errorf("network is nil"), err)
+}
+
+func TestQuantizeLargeBias(t *testing.T) {
+	te := tester.NewT(t)
+	//64 inputs in [-1;1] with small weights: the bias quantized with the scale of the weighted sums is close to the int32 limit
+	f, _ := NewFC(64)
+	if err := f.SetLayers(&LayerConfig{Size: 1, FuncType: activation.FuncTypeIden}); err != nil {
+		t.Fatal(err)
+	}
+	w := make([]float64, 64)
+	for i := range w {
+		w[i] = 1e-6
+	}
+	f.layers[0].w.SetData(w)
+	ones, minus := mat.NewM64(64, 1, nil), mat.NewM64(64, 1, nil)
+	for i := 0; i < 64; i++ {
+		ones.Set(i, 0, 1)
+		minus.Set(i, 0, -1)
+	}
+	calibration := &pointsDataset{points: []*Datapoint{{Inp: ones}, {Inp: minus}}}
+	q, err := f.Quantize(calibration, QuantizeOptions{})
+	te.CheckError(0, nil, err)
+	//the largest weighted sum, 64*127*128, does not fit in int32 with this bias
+	b := float64(math.MaxInt32-1000) * q.in.scale * q.layers[0].scale(0)
+	f.layers[0].b.SetData([]float64{b})
+	q, err = f.Quantize(calibration, QuantizeOptions{})
+	te.CheckError(1, nil, err)
+	te.DeepEqual(1, "bias", true, q.layers[0].b[0] > math.MaxInt32-2000)
+	for ind, x := range []*mat.M64{ones, minus} {
+		exp, err := f.FeedForward(x)
+		te.CheckError(ind, nil, err)
+		out, err := q.FeedForward(x)
+		te.CheckError(ind, nil, err)
+		if d := math.Abs(out.AtInd(0) - exp.AtInd(0)); d > q.layers[0].out.scale {
+			t.Errorf("%d: expected %f received %f", ind, exp.AtInd(0), out.AtInd(0))
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package nn
 
+import "math"
+
 //LrSource is an interface for a learning rate source
 type LrSource interface {
 	GetRate() float64
@@ -19,3 +21,56 @@ func (l *Lr) GetRate() float64 {
 func NewLr(rate float64) *Lr {
 	return &Lr{val: rate}
 }
+
+//scheduled is implemented by learning rate sources depending on the epoch, set by the trainer at the beginning of each iteration over the training set
+type scheduled interface {
+	SetEpoch(epoch uint)
+}
+
+//StepLr is a learning rate multiplied by factor every step epochs
+type StepLr struct {
+	val    float64
+	factor float64
+	step   uint
+	epoch  uint
+}
+
+//NewStepLr returns a learning rate source starting at rate and multiplied by factor every step epochs
+func NewStepLr(rate, factor float64, step uint) *StepLr {
+	if step == 0 {
+		step = 1
+	}
+	return &StepLr{val: rate, factor: factor, step: step}
+}
+
+//GetRate to implement LrSource
+func (l *StepLr) GetRate() float64 {
+	return l.val * math.Pow(l.factor, float64(l.epoch/l.step))
+}
+
+//SetEpoch sets the current epoch, starting at 0
+func (l *StepLr) SetEpoch(epoch uint) {
+	l.epoch = epoch
+}
+
+//ExpLr is a learning rate decaying exponentially with the epoch: rate*decay^epoch
+type ExpLr struct {
+	val   float64
+	decay float64
+	epoch uint
+}
+
+//NewExpLr returns a learning rate source starting at rate and multiplied by decay at each epoch
+func NewExpLr(rate, decay float64) *ExpLr {
+	return &ExpLr{val: rate, decay: decay}
+}
+
+//GetRate to implement LrSource
+func (l *ExpLr) GetRate() float64 {
+	return l.val * math.Pow(l.decay, float64(l.epoch))
+}
+
+//SetEpoch sets the current epoch, starting at 0
+func (l *ExpLr) SetEpoch(epoch uint) {
+	l.epoch = epoch
+}
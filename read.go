@@ -0,0 +1,177 @@
+package nn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//ReadCSV reads a dataset from CSV records: the first inSize values of a record are the input, the following ones the expected output (none for inputs to predict). A first record which is not numeric is skipped as a header
+func ReadCSV(r io.Reader, inSize int) (*MemoryDataset, error) {
+	if inSize <= 0 {
+		return nil, fmt.Errorf("input size must be >0")
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var points []*Datapoint
+	outSize := -1
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, len(rec))
+		bad := -1
+		for i, v := range rec {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				bad = i
+				break
+			}
+		}
+		if bad >= 0 {
+			if line == 1 {
+				//header
+				continue
+			}
+			return nil, fmt.Errorf("line %d: colomn %d: invalid value '%s'", line, bad, rec[bad])
+		}
+		if len(values) < inSize {
+			return nil, fmt.Errorf("line %d: received %d values, expected at least %d", line, len(values), inSize)
+		}
+		if outSize < 0 {
+			outSize = len(values) - inSize
+		}
+		if len(values)-inSize != outSize {
+			return nil, fmt.Errorf("line %d: received %d expected outputs, expected %d", line, len(values)-inSize, outSize)
+		}
+		p := &Datapoint{Inp: mat.NewM64(inSize, 1, values[:inSize])}
+		if outSize > 0 {
+			p.Exp = mat.NewM64(outSize, 1, values[inSize:])
+		}
+		points = append(points, p)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no records")
+	}
+	return NewMemoryDataset(points), nil
+}
+
+//idxTypes maps the type codes of the IDX format to the size of their values
+var idxTypes = map[byte]int{0x08: 1, 0x09: 1, 0x0B: 2, 0x0C: 4, 0x0D: 4, 0x0E: 8}
+
+//maxIDXValues bounds the number of values of an IDX file, 2GiB once decoded
+const maxIDXValues = 1 << 28
+
+//idxChunk is the number of values allocated before any is read: the slice then grows with the values actually read
+const idxChunk = 1 << 16
+
+//ReadIDX reads data in the IDX format of the MNIST database. It returns the dimensions and the values, in row-major order
+func ReadIDX(r io.Reader) ([]int, []float64, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, nil, fmt.Errorf("failed to read magic number: %s", err.Error())
+	}
+	if magic[0] != 0 || magic[1] != 0 {
+		return nil, nil, fmt.Errorf("invalid magic number")
+	}
+	size, ok := idxTypes[magic[2]]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported data type 0x%02x", magic[2])
+	}
+	if magic[3] == 0 {
+		return nil, nil, fmt.Errorf("data has no dimensions")
+	}
+	dims := make([]int, magic[3])
+	n := 1
+	for i := range dims {
+		var d uint32
+		if err := binary.Read(br, binary.BigEndian, &d); err != nil {
+			return nil, nil, fmt.Errorf("failed to read dimension %d: %s", i, err.Error())
+		}
+		if d == 0 {
+			return nil, nil, fmt.Errorf("dimension %d is 0", i)
+		}
+		//n<=maxIDXValues and d<2^32: the product fits in 64 bits
+		if uint64(n)*uint64(d) > maxIDXValues {
+			return nil, nil, fmt.Errorf("data has more than %d values", maxIDXValues)
+		}
+		dims[i] = int(d)
+		n *= dims[i]
+	}
+	buf := make([]byte, size)
+	//a truncated file fails before the number of values announced by its header is allocated
+	c := n
+	if c > idxChunk {
+		c = idxChunk
+	}
+	values := make([]float64, 0, c)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, nil, fmt.Errorf("value %d: %s", i, err.Error())
+		}
+		var v float64
+		switch magic[2] {
+		case 0x08:
+			v = float64(buf[0])
+		case 0x09:
+			v = float64(int8(buf[0]))
+		case 0x0B:
+			v = float64(int16(binary.BigEndian.Uint16(buf)))
+		case 0x0C:
+			v = float64(int32(binary.BigEndian.Uint32(buf)))
+		case 0x0D:
+			v = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+		case 0x0E:
+			v = math.Float64frombits(binary.BigEndian.Uint64(buf))
+		}
+		values = append(values, v)
+	}
+	return dims, values, nil
+}
+
+//NewIDXDataset returns the dataset of the items (first dimension) of IDX inputs and labels, each item being flattened as a colomn. If classes>0, labels are class indices encoded as one-hot vectors of size classes
+func NewIDXDataset(inputs, labels io.Reader, classes int) (*MemoryDataset, error) {
+	inDims, inValues, err := ReadIDX(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("inputs: %s", err.Error())
+	}
+	labDims, labValues, err := ReadIDX(labels)
+	if err != nil {
+		return nil, fmt.Errorf("labels: %s", err.Error())
+	}
+	if inDims[0] != labDims[0] {
+		return nil, fmt.Errorf("received %d inputs and %d labels", inDims[0], labDims[0])
+	}
+	n := inDims[0]
+	points := make([]*Datapoint, n)
+	inSize, labSize := len(inValues)/n, len(labValues)/n
+	for i := range points {
+		points[i] = &Datapoint{Inp: mat.NewM64(inSize, 1, inValues[i*inSize:(i+1)*inSize])}
+		if classes <= 0 {
+			points[i].Exp = mat.NewM64(labSize, 1, labValues[i*labSize:(i+1)*labSize])
+			continue
+		}
+		if labSize != 1 {
+			return nil, fmt.Errorf("labels have %d values, expected 1 class index", labSize)
+		}
+		c := labValues[i]
+		if c < 0 || int(c) >= classes || c != math.Trunc(c) {
+			return nil, fmt.Errorf("label %d: %v is not a class in range [0;%d[", i, c, classes)
+		}
+		points[i].Exp = mat.NewM64(classes, 1, nil)
+		points[i].Exp.Set(int(c), 0, 1)
+	}
+	return NewMemoryDataset(points), nil
+}
@@ -0,0 +1,114 @@
+package nn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/tester"
+)
+
+func TestReadCSV(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		text   string
+		inSize int
+		points []*Datapoint
+		err    error
+	}{
+		{"x0,x1,y\n1,2,3\n4, 5,6\n", 2, []*Datapoint{{mat.NewM64(2, 1, []float64{1, 2}), mat.NewM64(1, 1, []float64{3})}, {mat.NewM64(2, 1, []float64{4, 5}), mat.NewM64(1, 1, []float64{6})}}, nil},
+		{"1,2\n3,4\n", 2, []*Datapoint{{mat.NewM64(2, 1, []float64{1, 2}), nil}, {mat.NewM64(2, 1, []float64{3, 4}), nil}}, nil},
+		{"1,2,3\n", 1, []*Datapoint{{mat.NewM64(1, 1, []float64{1}), mat.NewM64(2, 1, []float64{2, 3})}}, nil},
+		{"1,2,3\n", 0, nil, fmt.Errorf("input size must be >0")},
+		{"x,y\n", 1, nil, fmt.Errorf("no records")},
+		{"1,2,3\n1,x,3\n", 2, nil, fmt.Errorf("line 2: colomn 1: invalid value 'x'")},
+		{"1,2,3\n1\n", 2, nil, fmt.Errorf("line 2: received 1 values, expected at least 2")},
+		{"1,2,3\n1,2,3,4\n", 2, nil, fmt.Errorf("line 2: received 2 expected outputs, expected 1")},
+	}
+	for ind, test := range tests {
+		d, err := ReadCSV(strings.NewReader(test.text), test.inSize)
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "points", test.points, d.Points())
+		}
+	}
+}
+
+//idx encodes values in the IDX format with the given type code
+func idx(typ byte, dims []int, values []float64) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0, 0, typ, byte(len(dims))})
+	for _, d := range dims {
+		binary.Write(buf, binary.BigEndian, uint32(d))
+	}
+	for _, v := range values {
+		switch typ {
+		case 0x08:
+			buf.WriteByte(byte(v))
+		case 0x0B:
+			binary.Write(buf, binary.BigEndian, int16(v))
+		case 0x0D:
+			binary.Write(buf, binary.BigEndian, float32(v))
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadIDX(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		data   []byte
+		dims   []int
+		values []float64
+		err    error
+	}{
+		{idx(0x08, []int{2, 2}, []float64{0, 1, 2, 255}), []int{2, 2}, []float64{0, 1, 2, 255}, nil},
+		{idx(0x0B, []int{3}, []float64{-2, 0, 300}), []int{3}, []float64{-2, 0, 300}, nil},
+		{idx(0x0D, []int{1, 1, 2}, []float64{0.5, -1}), []int{1, 1, 2}, []float64{0.5, -1}, nil},
+		{[]byte{1, 0, 8, 1}, nil, nil, fmt.Errorf("invalid magic number")},
+		{[]byte{0, 0, 7, 1}, nil, nil, fmt.Errorf("unsupported data type 0x07")},
+		{[]byte{0, 0}, nil, nil, fmt.Errorf("failed to read magic number: unexpected EOF")},
+		{idx(0x08, []int{3}, []float64{1, 2}), nil, nil, fmt.Errorf("value 2: EOF")},
+		{[]byte{0, 0, 8, 2, 0, 0, 0, 1}, nil, nil, fmt.Errorf("failed to read dimension 1: EOF")},
+		{idx(0x08, []int{2, 0}, nil), nil, nil, fmt.Errorf("dimension 1 is 0")},
+		{idx(0x08, []int{1 << 20, 1 << 9}, nil), nil, nil, fmt.Errorf("data has more than 268435456 values")},
+		{idx(0x08, []int{1 << 31, 1 << 31, 1 << 31}, nil), nil, nil, fmt.Errorf("data has more than 268435456 values")},
+		//the announced values are not allocated before being read
+		{idx(0x08, []int{1 << 14, 1 << 14}, []float64{1}), nil, nil, fmt.Errorf("value 1: EOF")},
+	}
+	for ind, test := range tests {
+		dims, values, err := ReadIDX(bytes.NewReader(test.data))
+		te.CheckError(ind, test.err, err)
+		te.DeepEqual(ind, "dims", test.dims, dims)
+		te.DeepEqual(ind, "values", test.values, values)
+	}
+}
+
+func TestNewIDXDataset(t *testing.T) {
+	te := tester.NewT(t)
+	//2 images of 2x2 pixels
+	images := idx(0x08, []int{2, 2, 2}, []float64{1, 2, 3, 4, 5, 6, 7, 8})
+	tests := []struct {
+		labels  []byte
+		classes int
+		points  []*Datapoint
+		err     error
+	}{
+		{idx(0x08, []int{2}, []float64{2, 0}), 3, []*Datapoint{{mat.NewM64(4, 1, []float64{1, 2, 3, 4}), mat.NewM64(3, 1, []float64{0, 0, 1})}, {mat.NewM64(4, 1, []float64{5, 6, 7, 8}), mat.NewM64(3, 1, []float64{1, 0, 0})}}, nil},
+		{idx(0x08, []int{2}, []float64{2, 0}), 0, []*Datapoint{{mat.NewM64(4, 1, []float64{1, 2, 3, 4}), mat.NewM64(1, 1, []float64{2})}, {mat.NewM64(4, 1, []float64{5, 6, 7, 8}), mat.NewM64(1, 1, []float64{0})}}, nil},
+		{idx(0x08, []int{2}, []float64{2, 3}), 3, nil, fmt.Errorf("label 1: 3 is not a class in range [0;3[")},
+		{idx(0x08, []int{3}, []float64{0, 1, 2}), 3, nil, fmt.Errorf("received 2 inputs and 3 labels")},
+		{idx(0x08, []int{2, 2}, []float64{0, 1, 2, 0}), 3, nil, fmt.Errorf("labels have 2 values, expected 1 class index")},
+		{[]byte{}, 3, nil, fmt.Errorf("labels: failed to read magic number: EOF")},
+	}
+	for ind, test := range tests {
+		d, err := NewIDXDataset(bytes.NewReader(images), bytes.NewReader(test.labels), test.classes)
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "points", test.points, d.Points())
+		}
+	}
+}
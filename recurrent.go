@@ -0,0 +1,286 @@
+package nn
+
+import (
+	"fmt"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/nn/internal/autodiff"
+)
+
+//recurrentLayer is a simple (Elman) RNN, a LSTM or a GRU layer. Its input is a sequence with one colomn per timestep, its output is the sequence of hidden states (ReturnSequences) or the last one.
+//
+//rnn: h=fn(wx*x+wh*h+b)
+//
+//lstm: gates i,f,g,o stacked in w and b. c=f*c+i*g, h=o*tanh(c)
+//
+//gru: gates z,r,n stacked in w and b. n=tanh(wxn*x+bn+r*(whn*h)), h=n+z*(h-n)
+type recurrentLayer struct {
+	typ       string
+	inSize    int
+	size      int
+	gates     int
+	ftype     string
+	fparams   []float64
+	a         activation.F
+	returnSeq bool
+	stateful  bool
+	truncate  int
+	wx        *mat.M64
+	wh        *mat.M64
+	b         *mat.M64
+	params    []*Param
+	h         *mat.M64 //hidden state at the end of the last sequence, if stateful
+	c         *mat.M64 //cell state at the end of the last sequence, if stateful lstm
+	rec       recording
+}
+
+//newRecurrentLayer returns a recurrent layer for sequences of shape in
+func newRecurrentLayer(cfg *LayerConfig, in Shape) (*recurrentLayer, Shape, error) {
+	if in.Height != 1 {
+		return nil, Shape{}, fmt.Errorf("recurrent layer expects a sequence of height 1, received %d", in.Height)
+	}
+	if cfg.Truncate < 0 {
+		return nil, Shape{}, fmt.Errorf("truncate must be >=0")
+	}
+	l := &recurrentLayer{typ: cfg.Type, inSize: in.Rows, size: cfg.Size, ftype: cfg.FuncType, fparams: cfg.FuncParams, a: cfg.F,
+		returnSeq: cfg.ReturnSequences, stateful: cfg.Stateful, truncate: cfg.Truncate}
+	switch cfg.Type {
+	case LayerTypeRNN:
+		l.gates = 1
+	case LayerTypeLSTM:
+		l.gates = 4
+	case LayerTypeGRU:
+		l.gates = 3
+	default:
+		return nil, Shape{}, fmt.Errorf("invalid recurrent layer type '%s'", cfg.Type)
+	}
+	n := l.gates * l.size
+	l.wx, l.wh, l.b = mat.NewM64(n, in.Rows, nil), mat.NewM64(n, l.size, nil), mat.NewM64(n, 1, nil)
+	l.params = []*Param{{Name: "wx", Value: l.wx}, {Name: "wh", Value: l.wh}, {Name: "b", Value: l.b, bias: true}}
+	out := Shape{Rows: l.size, Height: 1, Width: 1}
+	if l.returnSeq {
+		out.Width = in.Width
+	}
+	return l, out, nil
+}
+
+//ResetState clears the hidden state kept between sequences in stateful mode
+func (l *recurrentLayer) ResetState() {
+	l.h, l.c = nil, nil
+}
+
+//initialState returns the hidden (and cell) state at the beginning of a sequence, as constants
+func (l *recurrentLayer) initialState(t *autodiff.Tape) (*autodiff.Var, *autodiff.Var) {
+	h, c := l.h, l.c
+	if !l.stateful || h == nil {
+		h = mat.NewM64(l.size, 1, nil)
+	}
+	if !l.stateful || c == nil {
+		c = mat.NewM64(l.size, 1, nil)
+	}
+	return t.Const(h), t.Const(c)
+}
+
+func (l *recurrentLayer) record(t *autodiff.Tape, inputs, params []*autodiff.Var) (*autodiff.Var, error) {
+	if len(inputs) != 1 {
+		return nil, fmt.Errorf("expected 1 input received %d", len(inputs))
+	}
+	x := inputs[0]
+	r, steps := x.Value.Dims()
+	if r != l.inSize {
+		return nil, fmt.Errorf("input has %d features, expected %d", r, l.inSize)
+	}
+	n := l.gates * l.size
+	//input contributions of all timesteps at once
+	xw, err := t.MatMul(params[0], x)
+	if err != nil {
+		return nil, fmt.Errorf("wx*x failed: %s", err.Error())
+	}
+	if xw, err = t.Add(xw, params[2]); err != nil {
+		return nil, fmt.Errorf("wx*x +b failed: %s", err.Error())
+	}
+	h, c := l.initialState(t)
+	hs := make([]*autodiff.Var, 0, steps)
+	for s := 0; s < steps; s++ {
+		if l.truncate > 0 && s > 0 && s%l.truncate == 0 {
+			//truncated backpropagation through time: gradients do not flow to previous steps
+			h, c = t.Const(h.Value), t.Const(c.Value)
+		}
+		xs, err := t.Slice(xw, 0, n, s, s+1)
+		if err != nil {
+			return nil, err
+		}
+		if h, c, err = l.step(t, xs, h, c, params[1]); err != nil {
+			return nil, fmt.Errorf("timestep %d: %s", s, err.Error())
+		}
+		hs = append(hs, h)
+	}
+	if l.stateful {
+		l.h, l.c = h.Value, c.Value
+	}
+	if l.returnSeq {
+		return t.Concat(autodiff.Cols, hs...)
+	}
+	return h, nil
+}
+
+//step computes the hidden and cell states of a timestep from the input contribution xs=wx*x+b and the previous states
+func (l *recurrentLayer) step(t *autodiff.Tape, xs, h, c, wh *autodiff.Var) (*autodiff.Var, *autodiff.Var, error) {
+	hw, err := t.MatMul(wh, h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wh*h failed: %s", err.Error())
+	}
+	switch l.typ {
+	case LayerTypeLSTM:
+		return l.lstmStep(t, xs, hw, c)
+	case LayerTypeGRU:
+		h, err = l.gruStep(t, xs, hw, h)
+		return h, c, err
+	}
+	if h, err = t.Add(xs, hw); err != nil {
+		return nil, nil, fmt.Errorf("wx*x+wh*h failed: %s", err.Error())
+	}
+	if h, err = t.Map(h, l.a); err != nil {
+		return nil, nil, fmt.Errorf("activation failed: %s", err.Error())
+	}
+	return h, c, nil
+}
+
+//gate returns the rows of gate i of v, the gates being stacked by blocks of size rows
+func (l *recurrentLayer) gate(t *autodiff.Tape, v *autodiff.Var, i int) (*autodiff.Var, error) {
+	return t.Slice(v, i*l.size, (i+1)*l.size, 0, 1)
+}
+
+//activeGate returns f applied to gate i of v
+func (l *recurrentLayer) activeGate(t *autodiff.Tape, v *autodiff.Var, i int, f activation.F) (*autodiff.Var, error) {
+	g, err := l.gate(t, v, i)
+	if err != nil {
+		return nil, err
+	}
+	return t.Map(g, f)
+}
+
+//lstmStep computes c=f*c+i*g and h=o*tanh(c), the gates i, f, g and o being stacked in z=xs+hw
+func (l *recurrentLayer) lstmStep(t *autodiff.Tape, xs, hw, c *autodiff.Var) (*autodiff.Var, *autodiff.Var, error) {
+	z, err := t.Add(xs, hw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wx*x+wh*h failed: %s", err.Error())
+	}
+	i, err := l.activeGate(t, z, 0, activation.Sigmoid())
+	if err != nil {
+		return nil, nil, fmt.Errorf("input gate failed: %s", err.Error())
+	}
+	f, err := l.activeGate(t, z, 1, activation.Sigmoid())
+	if err != nil {
+		return nil, nil, fmt.Errorf("forget gate failed: %s", err.Error())
+	}
+	g, err := l.activeGate(t, z, 2, activation.Tanh())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cell candidate failed: %s", err.Error())
+	}
+	o, err := l.activeGate(t, z, 3, activation.Sigmoid())
+	if err != nil {
+		return nil, nil, fmt.Errorf("output gate failed: %s", err.Error())
+	}
+	if c, err = t.Mul(f, c); err != nil {
+		return nil, nil, fmt.Errorf("f*c failed: %s", err.Error())
+	}
+	if i, err = t.Mul(i, g); err != nil {
+		return nil, nil, fmt.Errorf("i*g failed: %s", err.Error())
+	}
+	if c, err = t.Add(c, i); err != nil {
+		return nil, nil, fmt.Errorf("f*c+i*g failed: %s", err.Error())
+	}
+	h, err := t.Map(c, activation.Tanh())
+	if err != nil {
+		return nil, nil, fmt.Errorf("tanh(c) failed: %s", err.Error())
+	}
+	if h, err = t.Mul(o, h); err != nil {
+		return nil, nil, fmt.Errorf("o*tanh(c) failed: %s", err.Error())
+	}
+	return h, c, nil
+}
+
+//gruStep computes h=n+z*(h-n) with n=tanh(xn+r*hn), the gates z and r and the candidates xn and hn being stacked in xs and hw
+func (l *recurrentLayer) gruStep(t *autodiff.Tape, xs, hw, h *autodiff.Var) (*autodiff.Var, error) {
+	xz, err := l.gate(t, xs, 0)
+	if err != nil {
+		return nil, fmt.Errorf("update gate failed: %s", err.Error())
+	}
+	hz, err := l.gate(t, hw, 0)
+	if err != nil {
+		return nil, fmt.Errorf("update gate failed: %s", err.Error())
+	}
+	z, err := t.Add(xz, hz)
+	if err != nil {
+		return nil, fmt.Errorf("update gate failed: %s", err.Error())
+	}
+	if z, err = t.Map(z, activation.Sigmoid()); err != nil {
+		return nil, fmt.Errorf("update gate failed: %s", err.Error())
+	}
+	xr, err := l.gate(t, xs, 1)
+	if err != nil {
+		return nil, fmt.Errorf("reset gate failed: %s", err.Error())
+	}
+	hr, err := l.gate(t, hw, 1)
+	if err != nil {
+		return nil, fmt.Errorf("reset gate failed: %s", err.Error())
+	}
+	r, err := t.Add(xr, hr)
+	if err != nil {
+		return nil, fmt.Errorf("reset gate failed: %s", err.Error())
+	}
+	if r, err = t.Map(r, activation.Sigmoid()); err != nil {
+		return nil, fmt.Errorf("reset gate failed: %s", err.Error())
+	}
+	xn, err := l.gate(t, xs, 2)
+	if err != nil {
+		return nil, fmt.Errorf("candidate failed: %s", err.Error())
+	}
+	hn, err := l.gate(t, hw, 2)
+	if err != nil {
+		return nil, fmt.Errorf("candidate failed: %s", err.Error())
+	}
+	n, err := t.Mul(r, hn)
+	if err != nil {
+		return nil, fmt.Errorf("r*hn failed: %s", err.Error())
+	}
+	if n, err = t.Add(xn, n); err != nil {
+		return nil, fmt.Errorf("xn+r*hn failed: %s", err.Error())
+	}
+	if n, err = t.Map(n, activation.Tanh()); err != nil {
+		return nil, fmt.Errorf("candidate failed: %s", err.Error())
+	}
+	d, err := t.Sub(h, n)
+	if err != nil {
+		return nil, fmt.Errorf("h-n failed: %s", err.Error())
+	}
+	if d, err = t.Mul(z, d); err != nil {
+		return nil, fmt.Errorf("z*(h-n) failed: %s", err.Error())
+	}
+	if h, err = t.Add(n, d); err != nil {
+		return nil, fmt.Errorf("n+z*(h-n) failed: %s", err.Error())
+	}
+	return h, nil
+}
+
+//Forward to implement Layer
+func (l *recurrentLayer) Forward(inputs ...*mat.M64) (*mat.M64, error) {
+	return l.rec.forward(l.record, inputs, l.params)
+}
+
+//Backward to implement Layer
+func (l *recurrentLayer) Backward(gradOut *mat.M64) ([]*mat.M64, error) {
+	return l.rec.backward(gradOut, l.params)
+}
+
+//Params to implement Layer
+func (l *recurrentLayer) Params() []*Param {
+	return l.params
+}
+
+//Config to implement Layer
+func (l *recurrentLayer) Config() *LayerConfig {
+	return &LayerConfig{Type: l.typ, Size: l.size, FuncType: l.ftype, FuncParams: l.fparams, ReturnSequences: l.returnSeq, Stateful: l.stateful, Truncate: l.truncate}
+}
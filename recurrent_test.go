@@ -0,0 +1,269 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//recurrentModel returns dense(rec(x)) for sequences of inSize features
+func recurrentModel(cfg *LayerConfig, inSize, outSize int) (*Model, error) {
+	m, err := NewModelWithShape(Shape{Rows: inSize, Height: 1})
+	if err != nil {
+		return nil, err
+	}
+	if err = m.AddConfig("rec", cfg, Input); err != nil {
+		return nil, err
+	}
+	if err = m.AddConfig("out", &LayerConfig{Size: outSize, FuncType: activation.FuncTypeIden}, "rec"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func recurrentConfigs() []*LayerConfig {
+	return []*LayerConfig{
+		{Type: LayerTypeRNN, Size: 3, FuncType: activation.FuncTypeTanh},
+		{Type: LayerTypeRNN, Size: 3, FuncType: activation.FuncTypeTanh, ReturnSequences: true},
+		{Type: LayerTypeLSTM, Size: 3},
+		{Type: LayerTypeLSTM, Size: 3, ReturnSequences: true},
+		{Type: LayerTypeGRU, Size: 3},
+		{Type: LayerTypeGRU, Size: 3, ReturnSequences: true},
+	}
+}
+
+func TestRecurrentGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for ind, cfg := range recurrentConfigs() {
+		m, err := recurrentModel(cfg, 2, 2)
+		if err != nil {
+			t.Errorf("test %d: failed to build model: %s", ind, err.Error())
+			continue
+		}
+		randomizeParams(int64(ind), m.Params())
+		//sequences of different lengths go through the same model
+		for _, steps := range []int{1, 4} {
+			x := randM64(r, 2, steps)
+			cols := 1
+			if cfg.ReturnSequences {
+				cols = steps
+			}
+			exp := randM64(r, 2, cols)
+			if err = checkModelGradients(m, x, exp, activation.Power(0.5, 2)); err != nil {
+				t.Errorf("test %d: %d steps: %s", ind, steps, err.Error())
+			}
+		}
+	}
+}
+
+func TestRecurrentConfig(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		cfg   *LayerConfig
+		in    Shape
+		shape Shape
+		err   error
+	}{
+		{&LayerConfig{Type: LayerTypeRNN, Size: 3}, Shape{2, 1, 0}, Shape{}, fmt.Errorf("activation function is nil")},
+		{&LayerConfig{Type: LayerTypeLSTM}, Shape{2, 1, 0}, Shape{}, fmt.Errorf("size must be >0")},
+		{&LayerConfig{Type: LayerTypeGRU, Size: 3}, Shape{2, 2, 4}, Shape{}, fmt.Errorf("recurrent layer expects a sequence of height 1, received 2")},
+		{&LayerConfig{Type: LayerTypeGRU, Size: 3, Truncate: -1}, Shape{2, 1, 0}, Shape{}, fmt.Errorf("truncate must be >=0")},
+		{&LayerConfig{Type: LayerTypeLSTM, Size: 3}, Shape{2, 1, 0}, Shape{3, 1, 1}, nil},
+		{&LayerConfig{Type: LayerTypeLSTM, Size: 3, ReturnSequences: true}, Shape{2, 1, 0}, Shape{3, 1, 0}, nil},
+		{&LayerConfig{Type: LayerTypeRNN, Size: 3, FuncType: activation.FuncTypeRelu, ReturnSequences: true}, Shape{2, 1, 5}, Shape{3, 1, 5}, nil},
+	}
+	for ind, test := range tests {
+		m, err := NewModelWithShape(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.AddConfig("rec", test.cfg, Input)
+		if err != nil {
+			err = fmt.Errorf("%s", err.Error()[len("layer 'rec': "):])
+		}
+		te.CheckError(ind, test.err, err)
+		if err == nil {
+			te.DeepEqual(ind, "shape", test.shape, m.OutShape())
+		}
+	}
+}
+
+func TestRecurrentTruncate(t *testing.T) {
+	te := tester.NewT(t)
+	r := rand.New(rand.NewSource(2))
+	x := randM64(r, 2, 6)
+	for ind, truncate := range []int{0, 1, 2, 6} {
+		m, err := NewModelWithShape(Shape{Rows: 2, Height: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.AddConfig("rec", &LayerConfig{Type: LayerTypeLSTM, Size: 3, Truncate: truncate}, Input); err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(7, m.Params())
+		l, _ := m.Layer("rec")
+		if _, err = l.Forward(x); err != nil {
+			t.Fatal(err)
+		}
+		grads, err := l.Backward(mat.NewM64(3, 1, ones(3, 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		//only the timesteps of the last chunk receive a gradient from the last output
+		first := 0
+		if truncate > 0 {
+			first = 6 - truncate
+		}
+		for s := 0; s < 6; s++ {
+			zero := grads[0].At(0, s) == 0 && grads[0].At(1, s) == 0
+			te.DeepEqual(ind, fmt.Sprintf("zero gradient at step %d", s), s < first, zero)
+		}
+	}
+}
+
+func TestRecurrentStateful(t *testing.T) {
+	te := tester.NewT(t)
+	r := rand.New(rand.NewSource(3))
+	x := randM64(r, 2, 6)
+	a, b := sliceCols(x, 0, 4), sliceCols(x, 4, 6)
+	for ind, typ := range []string{LayerTypeRNN, LayerTypeLSTM, LayerTypeGRU} {
+		cfg := &LayerConfig{Type: typ, Size: 3, FuncType: activation.FuncTypeTanh, ReturnSequences: true}
+		full, err := recurrentModel(cfg, 2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(int64(ind), full.Params())
+		cfg = &LayerConfig{Type: typ, Size: 3, FuncType: activation.FuncTypeTanh, ReturnSequences: true, Stateful: true}
+		m, err := recurrentModel(cfg, 2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range m.Params() {
+			p.Value.SetData(full.Params()[i].Value.GetData())
+		}
+		exp, err := full.FeedForward(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//the forward pass is not run again by Accumulate: the state only advances once
+		if _, err = m.FeedForward(a); err != nil {
+			t.Fatal(err)
+		}
+		if err = m.Accumulate(a, mat.NewM64(1, 4, nil)); err != nil {
+			t.Fatal(err)
+		}
+		res, err := m.FeedForward(b)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "continued sequence", sliceCols(exp, 4, 6), res)
+		//after a reset, the layer starts from a zero state
+		m.ResetStates()
+		res, err = m.FeedForward(a)
+		te.CheckError(ind, nil, err)
+		te.DeepEqual(ind, "reset sequence", sliceCols(exp, 0, 4), res)
+	}
+}
+
+//sliceCols returns the colomns [c0;c1[ of m
+func sliceCols(m *mat.M64, c0, c1 int) *mat.M64 {
+	r, _ := m.Dims()
+	res := mat.NewM64(r, c1-c0, nil)
+	for i := 0; i < r; i++ {
+		for j := c0; j < c1; j++ {
+			res.Set(i, j-c0, m.At(i, j))
+		}
+	}
+	return res
+}
+
+func TestSequenceDataset(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		inputs   [][][]float64
+		expected [][][]float64
+		points   []*Datapoint
+		err      error
+	}{
+		{[][][]float64{{{1}}}, nil, nil, fmt.Errorf("received 1 input sequences and 0 expected sequences")},
+		{[][][]float64{{}}, [][][]float64{{{1}}}, nil, fmt.Errorf("inputs[0]: sequence is empty")},
+		{[][][]float64{{{1, 2}, {3}}}, [][][]float64{{{1}}}, nil, fmt.Errorf("inputs[0]: step 1 has 1 features, expected 2")},
+		{[][][]float64{{{1, 2}}, {{3}}}, [][][]float64{{{1}}, {{1}}}, nil, fmt.Errorf("inputs[1]: step 0 has 1 features, expected 2")},
+		{[][][]float64{{{1}}}, [][][]float64{{{}}}, nil, fmt.Errorf("expected[0]: steps have no features")},
+		{
+			[][][]float64{{{1, 2}, {3, 4}, {5, 6}}, {{7, 8}}},
+			[][][]float64{{{1}}, {{2}}},
+			[]*Datapoint{
+				{Inp: mat.NewM64(2, 3, []float64{1, 3, 5, 2, 4, 6}), Exp: mat.NewM64(1, 1, []float64{1})},
+				{Inp: mat.NewM64(2, 1, []float64{7, 8}), Exp: mat.NewM64(1, 1, []float64{2})},
+			},
+			nil,
+		},
+	}
+	for ind, test := range tests {
+		d, err := NewSequenceDataset(test.inputs, test.expected)
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "size", len(test.points), d.Size())
+		for i := 0; i < 2; i++ {
+			d.Reset()
+			var points []*Datapoint
+			for p := d.Next(); p != nil; p = d.Next() {
+				points = append(points, p)
+			}
+			te.DeepEqual(ind, "points", test.points, points)
+			te.DeepEqual(ind, "left", 0, d.Left())
+		}
+	}
+}
+
+func TestTrainRecurrentModel(t *testing.T) {
+	//count the positive values of sequences of variable length
+	r := rand.New(rand.NewSource(4))
+	inputs := make([][][]float64, 200)
+	expected := make([][][]float64, len(inputs))
+	for i := range inputs {
+		inputs[i] = make([][]float64, 1+r.Intn(6))
+		count := 0.0
+		for s := range inputs[i] {
+			v := 2*r.Float64() - 1
+			if v > 0 {
+				count++
+			}
+			inputs[i][s] = []float64{v}
+		}
+		expected[i] = [][]float64{{count / 6}}
+	}
+	training, err := NewSequenceDataset(inputs[:160], expected[:160])
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := NewSequenceDataset(inputs[160:], expected[160:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ind, typ := range []string{LayerTypeRNN, LayerTypeLSTM, LayerTypeGRU} {
+		m, err := recurrentModel(&LayerConfig{Type: typ, Size: 4, FuncType: activation.FuncTypeTanh, Truncate: 3}, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(int64(ind), m.Params())
+		tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.05), 10, 0, activation.Power(0.5, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, _ := tr.testWith(test)
+		if err = tr.Train(rand.NewSource(42), 0, 0.5, 1, training, nil, test); err != nil {
+			t.Fatal(err)
+		}
+		after, _ := tr.testWith(test)
+		if after >= before {
+			t.Errorf("test %d: expected cost to decrease: before %f after %f", ind, before, after)
+		}
+	}
+}
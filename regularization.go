@@ -0,0 +1,125 @@
+package nn
+
+import (
+	"math"
+
+	mat "github.com/klahssen/go-mat"
+)
+
+//regularizer holds the penalties and constraints on the params of a layer: the penalty l1*sum(|w|)+l2*sum(w²) is added to the cost and its gradient to the gradient of the weights (and biases if bias is set). After each update, the rows of the weights whose norm exceeds maxNorm are rescaled to maxNorm
+type regularizer struct {
+	l1      float64
+	l2      float64
+	bias    bool
+	maxNorm float64
+}
+
+//newRegularizer returns the regularizer defined by cfg, nil if none
+func newRegularizer(cfg *LayerConfig) *regularizer {
+	if cfg == nil || (cfg.L1 == 0 && cfg.L2 == 0 && cfg.MaxNorm == 0) {
+		return nil
+	}
+	return &regularizer{l1: cfg.L1, l2: cfg.L2, bias: cfg.RegularizeBias, maxNorm: cfg.MaxNorm}
+}
+
+//configure sets the regularization fields of cfg
+func (r *regularizer) configure(cfg *LayerConfig) {
+	if r == nil {
+		return
+	}
+	cfg.L1, cfg.L2, cfg.RegularizeBias, cfg.MaxNorm = r.l1, r.l2, r.bias, r.maxNorm
+}
+
+//penalized reports if p is penalized
+func (r *regularizer) penalized(p *Param) bool {
+	return r != nil && (r.l1 != 0 || r.l2 != 0) && (!p.bias || r.bias)
+}
+
+//penalty returns the penalty of params
+func (r *regularizer) penalty(params []*Param) float64 {
+	s := 0.0
+	for _, p := range params {
+		if !r.penalized(p) {
+			continue
+		}
+		for _, v := range p.Value.GetData() {
+			s += r.l1*math.Abs(v) + r.l2*v*v
+		}
+	}
+	return s
+}
+
+//addGradient adds the gradient of the penalty of p to g. Only the rows with a gradient of sparse params are penalized
+func (r *regularizer) addGradient(p *Param, g *mat.M64) {
+	if !r.penalized(p) {
+		return
+	}
+	rows, c := p.Value.Dims()
+	add := func(i int) {
+		for j := 0; j < c; j++ {
+			v := p.Value.At(i, j)
+			d := 2 * r.l2 * v
+			if v > 0 {
+				d += r.l1
+			} else if v < 0 {
+				d -= r.l1
+			}
+			g.Set(i, j, g.At(i, j)+d)
+		}
+	}
+	if p.rows != nil {
+		for i := range p.rows {
+			add(i)
+		}
+		return
+	}
+	for i := 0; i < rows; i++ {
+		add(i)
+	}
+}
+
+//addGradients adds the gradients of the penalties to the accumulated gradients of params
+func (r *regularizer) addGradients(params []*Param) {
+	for _, p := range params {
+		if !r.penalized(p) {
+			continue
+		}
+		if p.Grad == nil {
+			rows, c := p.Value.Dims()
+			p.Grad = mat.NewM64(rows, c, nil)
+		}
+		r.addGradient(p, p.Grad)
+	}
+}
+
+//constrain applies the max-norm constraint to the weights of params
+func (r *regularizer) constrain(params []*Param) {
+	if r == nil || r.maxNorm == 0 {
+		return
+	}
+	for _, p := range params {
+		if p.bias {
+			continue
+		}
+		rows, _ := p.Value.Dims()
+		for i := 0; i < rows; i++ {
+			renormRow(p.Value, i, r.maxNorm)
+		}
+	}
+}
+
+//renormRow rescales row i of m to a norm of maxNorm if it is larger
+func renormRow(m *mat.M64, i int, maxNorm float64) {
+	_, c := m.Dims()
+	norm := 0.0
+	for j := 0; j < c; j++ {
+		norm += m.At(i, j) * m.At(i, j)
+	}
+	norm = math.Sqrt(norm)
+	if norm <= maxNorm {
+		return
+	}
+	for j := 0; j < c; j++ {
+		m.Set(i, j, m.At(i, j)*maxNorm/norm)
+	}
+}
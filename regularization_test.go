@@ -0,0 +1,239 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestRegularizerPenalty(t *testing.T) {
+	te := tester.NewT(t)
+	//w=[1 -2], b=[3]
+	params := func() []*Param {
+		return []*Param{{Name: "w", Value: mat.NewM64(1, 2, []float64{1, -2})}, {Name: "b", Value: mat.NewM64(1, 1, []float64{3}), bias: true}}
+	}
+	tests := []struct {
+		cfg     *LayerConfig
+		penalty float64
+		gradW   []float64
+		gradB   []float64
+	}{
+		{&LayerConfig{}, 0, []float64{0, 0}, []float64{0}},
+		{&LayerConfig{MaxNorm: 1}, 0, []float64{0, 0}, []float64{0}},
+		{&LayerConfig{L1: 0.1}, 0.3, []float64{0.1, -0.1}, []float64{0}},
+		{&LayerConfig{L2: 0.1}, 0.5, []float64{0.2, -0.4}, []float64{0}},
+		{&LayerConfig{L1: 0.1, L2: 0.1}, 0.8, []float64{0.3, -0.5}, []float64{0}},
+		{&LayerConfig{L1: 0.1, L2: 0.1, RegularizeBias: true}, 2, []float64{0.3, -0.5}, []float64{0.7}},
+	}
+	for ind, test := range tests {
+		r := newRegularizer(test.cfg)
+		ps := params()
+		te.DeepEqual(ind, "penalty", true, math.Abs(r.penalty(ps)-test.penalty) < 1e-12)
+		r.addGradients(ps)
+		for i, exp := range [][]float64{test.gradW, test.gradB} {
+			grad := make([]float64, len(exp))
+			if ps[i].Grad != nil {
+				grad = ps[i].Grad.GetData()
+			}
+			for j := range exp {
+				if math.Abs(grad[j]-exp[j]) > 1e-12 {
+					t.Errorf("test %d: param '%s' (%d): expected gradient %f received %f", ind, ps[i].Name, j, exp[j], grad[j])
+				}
+			}
+		}
+	}
+}
+
+func TestRegularizedGradients(t *testing.T) {
+	models := []func() (*Model, error){
+		func() (*Model, error) {
+			return NewSequential(3, &LayerConfig{Size: 4, FuncType: activation.FuncTypeTanh, L1: 0.01, L2: 0.1}, &LayerConfig{Size: 2, FuncType: activation.FuncTypeIden, L2: 0.2, RegularizeBias: true})
+		},
+		func() (*Model, error) {
+			return NewSequential(3, &LayerConfig{Type: LayerTypeEmbedding, Size: 2, Vocab: 5, L2: 0.5}, &LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh, L1: 0.1})
+		},
+	}
+	inputs := []*mat.M64{mat.NewM64(3, 1, []float64{0.1, -0.2, 0.3}), mat.NewM64(3, 1, []float64{4, 0, 4})}
+	cost := activation.Power(0.5, 2)
+	exp := mat.NewM64(2, 1, []float64{0.5, -0.5})
+	for ind, build := range models {
+		m, err := build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(int64(ind), m.Params())
+		in := inputs[ind]
+		pred, err := m.FeedForward(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dev, _ := mat.Sub(pred, exp)
+		gradCost, _ := mat.MapElem(dev, cost.Deriv)
+		m.ZeroGrad()
+		if err = m.Accumulate(in, gradCost); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range m.nodes {
+			n.reg.addGradients(n.layer.Params())
+		}
+		eps := 1e-6
+		total := func() float64 {
+			c, err := modelCost(m, in, exp, cost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c + m.penalty()
+		}
+		for _, p := range m.Params() {
+			r, c := p.Value.Dims()
+			for i := 0; i < r; i++ {
+				for j := 0; j < c; j++ {
+					v := p.Value.At(i, j)
+					p.Value.Set(i, j, v+eps)
+					plus := total()
+					p.Value.Set(i, j, v-eps)
+					minus := total()
+					p.Value.Set(i, j, v)
+					//rows of the embedding table which are not used have no gradient, and are not penalized
+					if p.rows != nil {
+						if _, ok := p.rows[i]; !ok {
+							continue
+						}
+					}
+					if e := relativeErr(p.Grad.At(i, j), (plus-minus)/(2*eps)); e > 1e-4 {
+						t.Errorf("test %d: param '%s' (%d,%d): relative error %g", ind, p.Name, i, j, e)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMaxNormConstraint(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := NewSequential(3, &LayerConfig{Size: 4, FuncType: activation.FuncTypeTanh, MaxNorm: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	in := mat.NewM64(3, 1, []float64{1, -1, 1})
+	if err = m.Backprop(0.1, in, mat.NewM64(4, 1, []float64{1, 1, 1, 1})); err != nil {
+		t.Fatal(err)
+	}
+	w, b := m.Params()[0].Value, m.Params()[1].Value
+	for i := 0; i < 4; i++ {
+		norm := 0.0
+		for j := 0; j < 3; j++ {
+			norm += w.At(i, j) * w.At(i, j)
+		}
+		te.DeepEqual(i, "row norm <= max norm", true, math.Sqrt(norm) <= 0.5+1e-12)
+	}
+	//biases are not constrained
+	b.SetData([]float64{10, -10, 0, 1})
+	if err = m.Backprop(0.1, in, mat.NewM64(4, 1, nil)); err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(0, "bias", []float64{10, -10, 0, 1}, b.GetData())
+}
+
+func TestRegularizedFCMatchesModel(t *testing.T) {
+	te := tester.NewT(t)
+	configs := []*LayerConfig{
+		{Size: 4, FuncType: activation.FuncTypeTanh, L1: 0.05, L2: 0.1, MaxNorm: 0.8},
+		{Size: 2, FuncType: activation.FuncTypeSigmoid, L2: 0.3, RegularizeBias: true},
+	}
+	f, err := mockRandFC(7, 3, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewSequential(3, configs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := m.Params()
+	for i, l := range f.layers {
+		params[2*i].Value.SetData(l.w.GetData())
+		params[2*i+1].Value.SetData(l.b.GetData())
+	}
+	te.DeepEqual(0, "penalty", true, math.Abs(f.penalty()-m.penalty()) < 1e-12)
+	in := mat.NewM64(3, 1, []float64{0.1, -0.2, 0.3})
+	gradCost := mat.NewM64(2, 1, []float64{0.5, -1})
+	te.CheckError(0, nil, f.Backprop(0.5, in, gradCost))
+	te.CheckError(0, nil, m.Backprop(0.5, in, gradCost))
+	for i, l := range f.layers {
+		for j, exp := range []*mat.M64{l.w, l.b} {
+			for k, v := range exp.GetData() {
+				if math.Abs(v-params[2*i+j].Value.GetData()[k]) > 1e-12 {
+					t.Errorf("layer %d: param '%s' (%d): expected %f received %f", i, params[2*i+j].Name, k, v, params[2*i+j].Value.GetData()[k])
+				}
+			}
+		}
+	}
+}
+
+func TestRegularizationConfig(t *testing.T) {
+	te := tester.NewT(t)
+	for ind, test := range []struct {
+		cfg *LayerConfig
+		err error
+	}{
+		{&LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh, L1: -1}, fmt.Errorf("configs[0]: layer 'layer0': l1 and l2 must be >=0")},
+		{&LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh, L2: -1}, fmt.Errorf("configs[0]: layer 'layer0': l1 and l2 must be >=0")},
+		{&LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh, MaxNorm: -1}, fmt.Errorf("configs[0]: layer 'layer0': max norm must be >=0")},
+		{&LayerConfig{Size: 2, FuncType: activation.FuncTypeTanh, L1: 0.1, L2: 0.2, RegularizeBias: true, MaxNorm: 3}, nil},
+	} {
+		m, err := NewSequential(2, test.cfg)
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		//regularization is saved with the model
+		randomizeParams(1, m.Params())
+		buf := &bytes.Buffer{}
+		te.CheckError(ind, nil, m.Encode(buf))
+		d, err := DecodeModel(buf)
+		te.CheckError(ind, nil, err)
+		if err == nil {
+			te.DeepEqual(ind, "regularizer", m.nodes[0].reg, d.nodes[0].reg)
+			te.DeepEqual(ind, "penalty", m.penalty(), d.penalty())
+		}
+	}
+}
+
+func TestTrainRegularized(t *testing.T) {
+	//learns y=x0 from 4 features: weight decay keeps the weights small
+	r := rand.New(rand.NewSource(1))
+	points := make([]*Datapoint, 200)
+	for i := range points {
+		x := []float64{2*r.Float64() - 1, 2*r.Float64() - 1, 2*r.Float64() - 1, 2*r.Float64() - 1}
+		points[i] = &Datapoint{Inp: mat.NewM64(4, 1, x), Exp: mat.NewM64(1, 1, []float64{x[0]})}
+	}
+	norms := make([]float64, 2)
+	for ind, l2 := range []float64{0, 0.05} {
+		m, err := NewSequential(4, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden, L2: l2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		randomizeParams(2, m.Params())
+		tr, err := NewTrainer(m, log.New(&nopWriter{}, "", 0), NewLr(0.1), 20, 0, activation.Power(0.5, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tr.Train(rand.NewSource(42), 0, 0.8, 4, &pointsDataset{points: points[:150]}, nil, &pointsDataset{points: points[150:]}); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range m.Params()[0].Value.GetData() {
+			norms[ind] += v * v
+		}
+	}
+	if norms[1] >= norms[0] {
+		t.Errorf("expected weight decay to shrink the weights of the noise: %f without, %f with", norms[0], norms[1])
+	}
+}
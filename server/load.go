@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn"
+)
+
+//types of the networks served
+const (
+	TypeFC         = "fc"
+	TypeModel      = "model"
+	TypePerceptron = "perceptron"
+)
+
+//Predictor computes the output of a network. Inputs and outputs are matrices flattened in row-major order, colomn vectors for fully connected networks and perceptrons. Predictors are not safe for concurrent use
+type Predictor interface {
+	Predict(input []float64) ([]float64, error)
+	//Type returns the type of the network: fc, model or perceptron
+	Type() string
+	//Shapes returns the shapes of the input and of the output
+	Shapes() (nn.Shape, nn.Shape)
+}
+
+//Decode reads a network saved as JSON: a fully connected network (FC.Encode), a model (Model.Encode) or a perceptron (Perceptron.Encode)
+func Decode(r io.Reader) (Predictor, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	head := &struct {
+		Type   string `json:"type"`
+		InSize int    `json:"in_size"`
+	}{}
+	if err = json.Unmarshal(data, head); err != nil {
+		return nil, err
+	}
+	switch {
+	case head.InSize > 0:
+		p, err := nn.DecodePerceptron(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("perceptron: %s", err.Error())
+		}
+		return &perceptronPredictor{p: p}, nil
+	case head.Type == nn.FCType:
+		f, err := nn.DecodeFC(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("fully connected network: %s", err.Error())
+		}
+		return &fcPredictor{f: f}, nil
+	}
+	m, err := nn.DecodeModel(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("model: %s", err.Error())
+	}
+	return &modelPredictor{m: m}, nil
+}
+
+//colomn returns the shape of colomn vectors of size n
+func colomn(n int) nn.Shape {
+	return nn.Shape{Rows: n, Height: 1, Width: 1}
+}
+
+//checkSize returns an error if input does not have n values
+func checkSize(input []float64, n int) error {
+	if len(input) != n {
+		return fmt.Errorf("input has %d values, expected %d", len(input), n)
+	}
+	return nil
+}
+
+type fcPredictor struct {
+	f *nn.FC
+}
+
+func (p *fcPredictor) Predict(input []float64) ([]float64, error) {
+	if err := checkSize(input, p.f.InSize()); err != nil {
+		return nil, err
+	}
+	out, err := p.f.FeedForward(mat.NewM64(len(input), 1, input))
+	if err != nil {
+		return nil, err
+	}
+	return out.GetData(), nil
+}
+
+func (p *fcPredictor) Type() string {
+	return TypeFC
+}
+
+func (p *fcPredictor) Shapes() (nn.Shape, nn.Shape) {
+	return colomn(p.f.InSize()), colomn(p.f.OutSize())
+}
+
+type modelPredictor struct {
+	m *nn.Model
+}
+
+//Predict runs the model on the input, whose number of colomns is deduced from its size if the model accepts a variable number of colomns. The states of stateful layers are reset first: each input is a sequence
+func (p *modelPredictor) Predict(input []float64) ([]float64, error) {
+	shape := p.m.InShape()
+	cols := shape.Cols()
+	if cols == 0 {
+		if len(input) == 0 || len(input)%shape.Rows != 0 {
+			return nil, fmt.Errorf("input has %d values, expected a multiple of %d", len(input), shape.Rows)
+		}
+		cols = len(input) / shape.Rows
+	}
+	if err := checkSize(input, shape.Rows*cols); err != nil {
+		return nil, err
+	}
+	p.m.ResetStates()
+	out, err := p.m.FeedForward(mat.NewM64(shape.Rows, cols, input))
+	if err != nil {
+		return nil, err
+	}
+	return out.GetData(), nil
+}
+
+func (p *modelPredictor) Type() string {
+	return TypeModel
+}
+
+func (p *modelPredictor) Shapes() (nn.Shape, nn.Shape) {
+	return p.m.InShape(), p.m.OutShape()
+}
+
+type perceptronPredictor struct {
+	p *nn.Perceptron
+}
+
+func (p *perceptronPredictor) Predict(input []float64) ([]float64, error) {
+	if err := checkSize(input, p.p.Size()); err != nil {
+		return nil, err
+	}
+	out, err := p.p.Compute(mat.NewM64(len(input), 1, input))
+	if err != nil {
+		return nil, err
+	}
+	return []float64{out}, nil
+}
+
+func (p *perceptronPredictor) Type() string {
+	return TypePerceptron
+}
+
+func (p *perceptronPredictor) Shapes() (nn.Shape, nn.Shape) {
+	return colomn(p.p.Size()), colomn(1)
+}
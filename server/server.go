@@ -0,0 +1,287 @@
+//Package server serves the predictions of a saved network over HTTP, with JSON endpoints:
+//
+//	POST /predict        {"input": [...]}            -> {"output": [...]}
+//	POST /predict/batch  {"inputs": [[...], [...]]}  -> {"outputs": [[...], [...]]}
+//	GET  /metadata       type and shapes of the network, file and time it was loaded from
+//	GET  /health         {"status": "ok"}
+//
+//Errors are returned as {"error": "..."}. The network file can be reloaded while serving, requests being answered by the previous network until the new one is loaded.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/klahssen/nn"
+)
+
+//defaults of Options
+const (
+	DefaultMaxBodyBytes = 1 << 20
+	DefaultMaxBatch     = 1000
+)
+
+//Options configure a server, zero values being replaced by defaults
+type Options struct {
+	MaxBodyBytes int64     //maximum size of a request body
+	MaxBatch     int       //maximum number of inputs of a batch
+	Logger       nn.Logger //logs the reloads, discarded if nil
+}
+
+//Metadata describes the network served
+type Metadata struct {
+	Type     string    `json:"type"`   //fc, model or perceptron
+	Input    nn.Shape  `json:"input"`  //shape of the input, rows x height x width, a width of 0 being variable
+	Output   nn.Shape  `json:"output"` //shape of the output
+	Source   string    `json:"source"` //file the network was loaded from
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+//loaded is a network loaded from a file. Its predictions are serialized: networks keep the outputs of their last input
+type loaded struct {
+	mu      sync.Mutex
+	pred    Predictor
+	meta    Metadata
+	modTime time.Time
+}
+
+//predict runs the network on each input
+func (l *loaded) predict(inputs [][]float64) ([][]float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	outs := make([][]float64, len(inputs))
+	for i, in := range inputs {
+		out, err := l.pred.Predict(in)
+		if err != nil {
+			return nil, &inputError{i, err}
+		}
+		outs[i] = out
+	}
+	return outs, nil
+}
+
+//inputError is an error on the input at index ind of a request
+type inputError struct {
+	ind int
+	err error
+}
+
+func (e *inputError) Error() string {
+	return e.err.Error()
+}
+
+//Server serves the predictions of the network saved at a path
+type Server struct {
+	path string
+	opts Options
+	mu   sync.RWMutex
+	cur  *loaded
+	mux  *http.ServeMux
+}
+
+//New loads the network saved at path, see Decode, and returns a server for it
+func New(path string, opts Options) (*Server, error) {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultMaxBatch
+	}
+	s := &Server{path: path, opts: opts, mux: http.NewServeMux()}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	s.mux.HandleFunc("/predict", s.handlePredict)
+	s.mux.HandleFunc("/predict/batch", s.handleBatch)
+	s.mux.HandleFunc("/metadata", s.handleMetadata)
+	s.mux.HandleFunc("/health", s.handleHealth)
+	return s, nil
+}
+
+//Reload loads the network file again. Requests are answered by the previous network until the new one is loaded, which is kept if the file is invalid
+func (s *Server) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pred, err := Decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", s.path, err.Error())
+	}
+	in, out := pred.Shapes()
+	l := &loaded{pred: pred, modTime: info.ModTime(), meta: Metadata{Type: pred.Type(), Input: in, Output: out, Source: s.path, LoadedAt: time.Now()}}
+	s.mu.Lock()
+	s.cur = l
+	s.mu.Unlock()
+	s.logf("loaded %s network from %s", l.meta.Type, s.path)
+	return nil
+}
+
+//Watch reloads the network each time its file is modified, checking every interval until ctx is done. Failed reloads are logged
+func (s *Server) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.reloadIfModified(); err != nil {
+				s.logf("reload failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+//reloadIfModified reloads the network if its file was modified since it was loaded
+func (s *Server) reloadIfModified() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.current().modTime) {
+		return nil
+	}
+	return s.Reload()
+}
+
+//current returns the network being served
+func (s *Server) current() *loaded {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cur
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Printf(format, args...)
+	}
+}
+
+//ServeHTTP to implement http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type predictRequest struct {
+	Input []float64 `json:"input"`
+}
+
+type predictResponse struct {
+	Output []float64 `json:"output"`
+}
+
+type batchRequest struct {
+	Inputs [][]float64 `json:"inputs"`
+}
+
+type batchResponse struct {
+	Outputs [][]float64 `json:"outputs"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handlePredict(w http.ResponseWriter, r *http.Request) {
+	req := &predictRequest{}
+	if !s.decode(w, r, req) {
+		return
+	}
+	outs, err := s.current().predict([][]float64{req.Input})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &predictResponse{Output: outs[0]})
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	req := &batchRequest{}
+	if !s.decode(w, r, req) {
+		return
+	}
+	if len(req.Inputs) == 0 {
+		writeError(w, http.StatusBadRequest, "inputs is empty")
+		return
+	}
+	if len(req.Inputs) > s.opts.MaxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch has %d inputs, maximum is %d", len(req.Inputs), s.opts.MaxBatch))
+		return
+	}
+	outs, err := s.current().predict(req.Inputs)
+	if err != nil {
+		msg := err.Error()
+		if e, ok := err.(*inputError); ok {
+			msg = fmt.Sprintf("inputs[%d]: %s", e.ind, msg)
+		}
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, &batchResponse{Outputs: outs})
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.current().meta)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+//decode reads the JSON body of a POST request into v, within the size limit. Errors are written to w
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if !allow(w, r, http.MethodPost) {
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", s.opts.MaxBodyBytes))
+		return false
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+//allow writes an error if the method of r is not method
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed, expected %s", r.Method, method))
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &errorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
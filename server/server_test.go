@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klahssen/nn"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//writeFC writes a network computing y=x0+scale*x1 at path
+func writeFC(t *testing.T, path string, scale float64) {
+	f, err := nn.NewFC(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SetLayers(&nn.LayerConfig{Size: 1, FuncType: activation.FuncTypeIden}); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.SetLayerData(0, []float64{1, scale, 0}); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err = f.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//do sends a request to h and returns the status and the body
+func do(h http.Handler, method, path, body string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestServer(t *testing.T) {
+	te := tester.NewT(t)
+	path := filepath.Join(t.TempDir(), "fc.json")
+	writeFC(t, path, 2)
+	s, err := New(path, Options{MaxBodyBytes: 64, MaxBatch: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		resp   string
+	}{
+		{"GET", "/health", "", 200, `{"status":"ok"}`},
+		{"POST", "/health", "", 405, `{"error":"method POST not allowed, expected GET"}`},
+		{"POST", "/predict", `{"input": [1, 2]}`, 200, `{"output":[5]}`},
+		{"GET", "/predict", "", 405, `{"error":"method GET not allowed, expected POST"}`},
+		{"POST", "/predict", `{"input": [1]}`, 400, `{"error":"input has 1 values, expected 2"}`},
+		{"POST", "/predict", `{"inputs": [1, 2]}`, 400, `{"error":"invalid request: json: unknown field \"inputs\""}`},
+		{"POST", "/predict", `{"input": [1, 2`, 400, `{"error":"invalid request: unexpected EOF"}`},
+		{"POST", "/predict", `{"input": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19]}`, 413, `{"error":"request body exceeds 64 bytes"}`},
+		{"POST", "/predict/batch", `{"inputs": [[1, 2], [0, -1]]}`, 200, `{"outputs":[[5],[-2]]}`},
+		{"POST", "/predict/batch", `{"inputs": []}`, 400, `{"error":"inputs is empty"}`},
+		{"POST", "/predict/batch", `{"inputs": [[1, 2], [1]]}`, 400, `{"error":"inputs[1]: input has 1 values, expected 2"}`},
+		{"POST", "/predict/batch", `{"inputs": [[1], [2], [3]]}`, 413, `{"error":"batch has 3 inputs, maximum is 2"}`},
+	}
+	for ind, test := range tests {
+		status, resp := do(s, test.method, test.path, test.body)
+		te.DeepEqual(ind, "status", test.status, status)
+		te.DeepEqual(ind, "response", test.resp, resp)
+	}
+	status, resp := do(s, "GET", "/metadata", "")
+	te.DeepEqual(0, "metadata status", 200, status)
+	meta := &Metadata{}
+	te.CheckError(0, nil, json.Unmarshal([]byte(resp), meta))
+	te.DeepEqual(0, "metadata", Metadata{Type: TypeFC, Input: nn.Shape{Rows: 2, Height: 1, Width: 1}, Output: nn.Shape{Rows: 1, Height: 1, Width: 1}, Source: path}, Metadata{Type: meta.Type, Input: meta.Input, Output: meta.Output, Source: meta.Source})
+}
+
+func TestReload(t *testing.T) {
+	te := tester.NewT(t)
+	path := filepath.Join(t.TempDir(), "fc.json")
+	writeFC(t, path, 2)
+	s, err := New(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	//requests are answered by either network while reloading
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				resp, err := http.Post(srv.URL+"/predict", "application/json", strings.NewReader(`{"input": [1, 1]}`))
+				if err != nil {
+					errs <- err
+					return
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if s := strings.TrimSpace(string(body)); resp.StatusCode != 200 || (s != `{"output":[3]}` && s != `{"output":[4]}`) {
+					errs <- fmt.Errorf("received %d %s", resp.StatusCode, s)
+				}
+			}
+		}()
+	}
+	writeFC(t, path, 3)
+	te.CheckError(0, nil, s.Reload())
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	_, resp := do(s, "POST", "/predict", `{"input": [1, 1]}`)
+	te.DeepEqual(0, "reloaded", `{"output":[4]}`, resp)
+	//an invalid file keeps the current network
+	if err = ioutil.WriteFile(path, []byte(`{"type": "fc", "version": 9}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(1, fmt.Errorf("%s: fully connected network: unsupported network version 9", path), s.Reload())
+	_, resp = do(s, "POST", "/predict", `{"input": [1, 1]}`)
+	te.DeepEqual(1, "kept", `{"output":[4]}`, resp)
+	//the file is reloaded when modified
+	writeFC(t, path, 4)
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(2, nil, s.reloadIfModified())
+	_, resp = do(s, "POST", "/predict", `{"input": [1, 1]}`)
+	te.DeepEqual(2, "watched", `{"output":[5]}`, resp)
+}
+
+func TestDecode(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := nn.NewModelWithShape(nn.Shape{Rows: 2, Height: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.AddConfig("rnn", &nn.LayerConfig{Type: nn.LayerTypeRNN, Size: 1, FuncType: activation.FuncTypeIden}, nn.Input); err != nil {
+		t.Fatal(err)
+	}
+	model := &bytes.Buffer{}
+	if err = m.Encode(model); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data  string
+		typ   string
+		in    []float64
+		out   []float64
+		err   error
+		inErr error
+	}{
+		{`{"in_size": 2, "w": [1, -1], "ftype": "iden", "b": 0.5, "alpha": 0.1}`, TypePerceptron, []float64{3, 1}, []float64{2.5}, nil, nil},
+		{`{"in_size": 2, "w": [1], "ftype": "iden"}`, "", nil, nil, fmt.Errorf("perceptron: received 1 weights, expected 2"), nil},
+		{model.String(), TypeModel, []float64{1, 2, 3, 4, 5, 6}, []float64{0}, nil, nil},
+		{model.String(), TypeModel, []float64{1, 2, 3}, nil, nil, fmt.Errorf("input has 3 values, expected a multiple of 2")},
+		{`{"type": "fc", "version": 1, "input": 2, "layers": []}`, "", nil, nil, fmt.Errorf("fully connected network: must have at least one layer"), nil},
+	}
+	for ind, test := range tests {
+		p, err := Decode(strings.NewReader(test.data))
+		te.CheckError(ind, test.err, err)
+		if err != nil {
+			continue
+		}
+		te.DeepEqual(ind, "type", test.typ, p.Type())
+		out, err := p.Predict(test.in)
+		te.CheckError(ind, test.inErr, err)
+		te.DeepEqual(ind, "output", test.out, out)
+	}
+}
@@ -0,0 +1,391 @@
+package nn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/klahssen/nn/internal/activation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Spec declares a network and its training. It is read from JSON or YAML by ReadSpec, then built by Build or BuildModel
+type Spec struct {
+	Input         int                `json:"input"`
+	Layers        []*LayerSpec       `json:"layers"`
+	Loss          string             `json:"loss,omitempty"`        //mse (default) or mae
+	Optimizer     *OptimizerSpec     `json:"optimizer,omitempty"`   //sgd with a learning rate of 0.1 by default
+	Schedule      *ScheduleSpec      `json:"lr_schedule,omitempty"` //constant learning rate by default
+	BatchSize     uint               `json:"batch_size,omitempty"`  //1 by default
+	Epochs        uint               `json:"epochs,omitempty"`      //maximum number of iterations over the training set, 1 by default
+	Tolerance     float64            `json:"tolerance,omitempty"`   //training stops when the average cost of an iteration is below
+	EarlyStopping *EarlyStoppingSpec `json:"early_stopping,omitempty"`
+	Seed          int64              `json:"seed,omitempty"` //seed of the initializers and of the dropout masks
+}
+
+//LayerSpec is the config of a layer, with the initializer of its weights
+type LayerSpec struct {
+	LayerConfig
+	Init string `json:"init,omitempty"` //xavier by default, see InitParams
+}
+
+//OptimizerSpec declares the optimizer updating the params
+type OptimizerSpec struct {
+	Type     string  `json:"type,omitempty"`     //sgd (default) or adam
+	Lr       float64 `json:"lr,omitempty"`       //initial learning rate in range ]0;1], 0.1 by default for sgd, 0.001 for adam
+	Momentum float64 `json:"momentum,omitempty"` //sgd only
+	Beta1    float64 `json:"beta1,omitempty"`    //adam only, 0.9 by default
+	Beta2    float64 `json:"beta2,omitempty"`    //adam only, 0.999 by default
+	Epsilon  float64 `json:"epsilon,omitempty"`  //adam only, 1e-8 by default
+}
+
+//ScheduleSpec declares how the learning rate changes with the epoch
+type ScheduleSpec struct {
+	Type   string  `json:"type,omitempty"`   //constant (default), step or exponential
+	Factor float64 `json:"factor,omitempty"` //step: the rate is multiplied by factor every step epochs
+	Step   uint    `json:"step,omitempty"`   //step: 1 by default
+	Decay  float64 `json:"decay,omitempty"`  //exponential: the rate is multiplied by decay at each epoch
+}
+
+//EarlyStoppingSpec declares when the training stops, see FCTrainer.SetEarlyStopping
+type EarlyStoppingSpec struct {
+	Patience uint    `json:"patience"`
+	MinDelta float64 `json:"min_delta,omitempty"`
+}
+
+//losses are the cost functions available by name
+var losses = map[string]activation.F{
+	"mse": activation.Power(0.5, 2),
+	"mae": activation.Abs(),
+}
+
+//LossFunc returns the cost function named name: mse (default if empty) or mae
+func LossFunc(name string) (activation.F, error) {
+	if name == "" {
+		name = "mse"
+	}
+	f, ok := losses[name]
+	if !ok {
+		return activation.F{}, fmt.Errorf("unknown loss '%s', expected mse or mae", name)
+	}
+	return f, nil
+}
+
+//ReadSpec reads and validates a spec in JSON or YAML. Unknown fields are rejected
+func ReadSpec(r io.Reader) (*Spec, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if t := bytes.TrimSpace(data); len(t) == 0 || t[0] != '{' {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	s := &Spec{}
+	if err = dec.Decode(s); err != nil {
+		return nil, err
+	}
+	return s, s.Validate()
+}
+
+//Validate checks the spec. Errors name the invalid field
+func (s *Spec) Validate() error {
+	if s == nil {
+		return fmt.Errorf("spec is nil")
+	}
+	if s.Input <= 0 {
+		return fmt.Errorf("input: must be >0")
+	}
+	if len(s.Layers) == 0 {
+		return fmt.Errorf("layers: must have at least one layer")
+	}
+	for i, l := range s.Layers {
+		if l == nil {
+			return fmt.Errorf("layers[%d]: is nil", i)
+		}
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("layers[%d]: %s", i, err.Error())
+		}
+		if _, ok := initializers[l.Init]; !ok && l.Init != "" {
+			return fmt.Errorf("layers[%d].init: unknown initializer '%s', expected one of %s", i, l.Init, initializerNames())
+		}
+	}
+	if _, err := LossFunc(s.Loss); err != nil {
+		return fmt.Errorf("loss: %s", err.Error())
+	}
+	if s.Tolerance < 0 {
+		return fmt.Errorf("tolerance: must be >=0")
+	}
+	if err := s.Optimizer.validate(); err != nil {
+		return fmt.Errorf("optimizer.%s", err.Error())
+	}
+	if err := s.Schedule.validate(); err != nil {
+		return fmt.Errorf("lr_schedule.%s", err.Error())
+	}
+	if e := s.EarlyStopping; e != nil {
+		if e.Patience == 0 {
+			return fmt.Errorf("early_stopping.patience: must be >0")
+		}
+		if e.MinDelta < 0 {
+			return fmt.Errorf("early_stopping.min_delta: must be >=0")
+		}
+	}
+	return nil
+}
+
+//validate checks the optimizer, errors start with the name of the invalid field
+func (o *OptimizerSpec) validate() error {
+	if o == nil {
+		return nil
+	}
+	switch o.Type {
+	case "", "sgd":
+		if o.Momentum < 0 || o.Momentum >= 1 {
+			return fmt.Errorf("momentum: must be in range [0;1[")
+		}
+		if o.Beta1 != 0 || o.Beta2 != 0 || o.Epsilon != 0 {
+			return fmt.Errorf("beta1, beta2 and epsilon only apply to adam")
+		}
+	case "adam":
+		if o.Momentum != 0 {
+			return fmt.Errorf("momentum: only applies to sgd")
+		}
+		if o.Beta1 < 0 || o.Beta1 >= 1 {
+			return fmt.Errorf("beta1: must be in range [0;1[")
+		}
+		if o.Beta2 < 0 || o.Beta2 >= 1 {
+			return fmt.Errorf("beta2: must be in range [0;1[")
+		}
+		if o.Epsilon < 0 {
+			return fmt.Errorf("epsilon: must be >=0")
+		}
+	default:
+		return fmt.Errorf("type: unknown optimizer '%s', expected sgd or adam", o.Type)
+	}
+	if o.Lr < 0 || o.Lr > 1 {
+		return fmt.Errorf("lr: must be in range ]0;1], or 0 for the default")
+	}
+	return nil
+}
+
+//validate checks the schedule, errors start with the name of the invalid field
+func (sc *ScheduleSpec) validate() error {
+	if sc == nil {
+		return nil
+	}
+	switch sc.Type {
+	case "", "constant":
+		if sc.Factor != 0 || sc.Step != 0 || sc.Decay != 0 {
+			return fmt.Errorf("type: a constant learning rate has no factor, step nor decay")
+		}
+	case "step":
+		if sc.Factor <= 0 || sc.Factor > 1 {
+			return fmt.Errorf("factor: must be in range ]0;1]")
+		}
+		if sc.Decay != 0 {
+			return fmt.Errorf("decay: only applies to exponential schedules")
+		}
+	case "exponential":
+		if sc.Decay <= 0 || sc.Decay > 1 {
+			return fmt.Errorf("decay: must be in range ]0;1]")
+		}
+		if sc.Factor != 0 || sc.Step != 0 {
+			return fmt.Errorf("factor and step only apply to step schedules")
+		}
+	default:
+		return fmt.Errorf("type: unknown schedule '%s', expected constant, step or exponential", sc.Type)
+	}
+	return nil
+}
+
+//Build returns the fully connected network defined by the spec, its weights being initialized, and its trainer. Layers must be dense
+func (s *Spec) Build(l Logger) (*FC, *FCTrainer, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+	configs := make([]*LayerConfig, len(s.Layers))
+	for i, ls := range s.Layers {
+		if ls.Type != "" && ls.Type != LayerTypeDense {
+			return nil, nil, fmt.Errorf("layers[%d].type: layer type '%s' is not supported in a fully connected network", i, ls.Type)
+		}
+		cfg := ls.LayerConfig
+		configs[i] = &cfg
+	}
+	f, err := NewFC(s.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = f.SetLayers(configs...); err != nil {
+		return nil, nil, err
+	}
+	params := make([][]*Param, len(f.layers))
+	for i, lay := range f.layers {
+		params[i] = lay.params
+	}
+	if err = s.initialize(params); err != nil {
+		return nil, nil, err
+	}
+	t, err := s.trainer(f, f.SetOptimizer, l)
+	return f, t, err
+}
+
+//BuildModel returns the sequential model defined by the spec, its layers being named layer0, layer1..., and its trainer. Layers may have any type
+func (s *Spec) BuildModel(l Logger) (*Model, *FCTrainer, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+	m, err := NewModel(s.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	prev := Input
+	params := make([][]*Param, len(s.Layers))
+	for i, ls := range s.Layers {
+		cfg := ls.LayerConfig
+		name := fmt.Sprintf("layer%d", i)
+		if err = m.AddConfig(name, &cfg, prev); err != nil {
+			return nil, nil, fmt.Errorf("layers[%d]: %s", i, err.Error())
+		}
+		params[i] = m.nodes[i].layer.Params()
+		prev = name
+	}
+	if err = s.initialize(params); err != nil {
+		return nil, nil, err
+	}
+	t, err := s.trainer(m, m.SetOptimizer, l)
+	return m, t, err
+}
+
+//Train trains the network of t with the batch size of the spec, dropout masks of the layers being drawn from its seed
+func (s *Spec) Train(t *FCTrainer, training, validation, test Dataset) error {
+	if s == nil {
+		return fmt.Errorf("spec is nil")
+	}
+	return t.Train(rand.NewSource(s.Seed), 0, 0, s.BatchSize, training, validation, test)
+}
+
+//initialize sets the weights of the params of each layer with its initializer, drawn from the seed of the spec
+func (s *Spec) initialize(params [][]*Param) error {
+	r := rand.NewSource(s.Seed)
+	for i, ls := range s.Layers {
+		init := ls.Init
+		if init == "" {
+			init = "xavier"
+		}
+		if err := InitParams(params[i], init, r); err != nil {
+			return fmt.Errorf("layers[%d].init: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+//trainer returns the trainer of n defined by the spec, setOptimizer setting the optimizer of n
+func (s *Spec) trainer(n Network, setOptimizer func(Optimizer), l Logger) (*FCTrainer, error) {
+	o := s.Optimizer
+	if o == nil {
+		o = &OptimizerSpec{}
+	}
+	lr := o.Lr
+	switch o.Type {
+	case "", "sgd":
+		if lr == 0 {
+			lr = 0.1
+		}
+		if o.Momentum > 0 {
+			opt, err := NewSGD(o.Momentum)
+			if err != nil {
+				return nil, fmt.Errorf("optimizer: %s", err.Error())
+			}
+			setOptimizer(opt)
+		}
+	case "adam":
+		if lr == 0 {
+			lr = 0.001
+		}
+		beta1, beta2, eps := o.Beta1, o.Beta2, o.Epsilon
+		if beta1 == 0 {
+			beta1 = 0.9
+		}
+		if beta2 == 0 {
+			beta2 = 0.999
+		}
+		if eps == 0 {
+			eps = 1e-8
+		}
+		opt, err := NewAdam(beta1, beta2, eps)
+		if err != nil {
+			return nil, fmt.Errorf("optimizer: %s", err.Error())
+		}
+		setOptimizer(opt)
+	}
+	var source LrSource = NewLr(lr)
+	if sc := s.Schedule; sc != nil {
+		switch sc.Type {
+		case "step":
+			source = NewStepLr(lr, sc.Factor, sc.Step)
+		case "exponential":
+			source = NewExpLr(lr, sc.Decay)
+		}
+	}
+	cost, _ := LossFunc(s.Loss)
+	epochs := s.Epochs
+	if epochs == 0 {
+		epochs = 1
+	}
+	t, err := NewTrainer(n, l, source, epochs, s.Tolerance, cost)
+	if err != nil {
+		return nil, err
+	}
+	if e := s.EarlyStopping; e != nil {
+		if err = t.SetEarlyStopping(e.Patience, e.MinDelta); err != nil {
+			return nil, fmt.Errorf("early_stopping: %s", err.Error())
+		}
+	}
+	return t, nil
+}
+
+//yamlToJSON converts a YAML document to JSON, so that it is decoded with the JSON tags of the library
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+//jsonValue converts the maps decoded from YAML to maps with string keys
+func jsonValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", k)
+			}
+			var err error
+			if m[key], err = jsonValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range t {
+			var err error
+			if t[i], err = jsonValue(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
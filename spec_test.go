@@ -0,0 +1,133 @@
+package nn
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/tester"
+)
+
+func TestReadSpec(t *testing.T) {
+	te := tester.NewT(t)
+	tests := []struct {
+		spec string
+		err  error
+	}{
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}]}`, nil},
+		{"input: 2\nlayers:\n  - size: 4\n    ftype: tanh\n    dropout: 0.2\n    l2: 0.01\n    init: he\n  - size: 1\n    ftype: iden\nloss: mae\noptimizer:\n  type: adam\n  lr: 0.01\nlr_schedule:\n  type: step\n  factor: 0.5\n  step: 10\nbatch_size: 8\nepochs: 50\nearly_stopping:\n  patience: 3\n", nil},
+		{`{"input": 0, "layers": [{"size": 1, "ftype": "iden"}]}`, fmt.Errorf("input: must be >0")},
+		{`{"input": 2}`, fmt.Errorf("layers: must have at least one layer")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}, {"size": 0, "ftype": "iden"}]}`, fmt.Errorf("layers[1]: size must be >0")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden", "dropout": 1}]}`, fmt.Errorf("layers[0]: dropout must be in range [0;1[")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden", "init": "random"}]}`, fmt.Errorf("layers[0].init: unknown initializer 'random', expected one of he, lecun, normal, ones, uniform, xavier, zeros")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "loss": "hinge"}`, fmt.Errorf("loss: unknown loss 'hinge', expected mse or mae")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "optimizer": {"type": "rmsprop"}}`, fmt.Errorf("optimizer.type: unknown optimizer 'rmsprop', expected sgd or adam")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "optimizer": {"lr": 2}}`, fmt.Errorf("optimizer.lr: must be in range ]0;1], or 0 for the default")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "optimizer": {"momentum": 1}}`, fmt.Errorf("optimizer.momentum: must be in range [0;1[")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "optimizer": {"type": "adam", "momentum": 0.9}}`, fmt.Errorf("optimizer.momentum: only applies to sgd")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "optimizer": {"type": "adam", "beta2": 1}}`, fmt.Errorf("optimizer.beta2: must be in range [0;1[")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "lr_schedule": {"type": "cosine"}}`, fmt.Errorf("lr_schedule.type: unknown schedule 'cosine', expected constant, step or exponential")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "lr_schedule": {"type": "exponential", "decay": 1.5}}`, fmt.Errorf("lr_schedule.decay: must be in range ]0;1]")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "early_stopping": {"patience": 0}}`, fmt.Errorf("early_stopping.patience: must be >0")},
+		{`{"input": 2, "layers": [{"size": 1, "ftype": "iden"}], "epoch": 3}`, fmt.Errorf(`json: unknown field "epoch"`)},
+		{"input: 2\nlayers:\n  - size: one\n", fmt.Errorf("json: cannot unmarshal string into Go struct field Spec.layers.0.size of type int")},
+	}
+	for ind, test := range tests {
+		//decoding errors are not built by fmt.Errorf
+		_, err := ReadSpec(strings.NewReader(test.spec))
+		te.DeepEqual(ind, "error", fmt.Sprint(test.err), fmt.Sprint(err))
+	}
+}
+
+func TestSpecBuild(t *testing.T) {
+	te := tester.NewT(t)
+	spec := `input: 3
+layers:
+  - size: 4
+    ftype: tanh
+    init: he
+  - size: 2
+    ftype: iden
+optimizer:
+  type: sgd
+  lr: 0.05
+  momentum: 0.9
+lr_schedule:
+  type: exponential
+  decay: 0.9
+epochs: 5
+seed: 3
+`
+	s, err := ReadSpec(strings.NewReader(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, tr, err := s.Build(log.New(&nopWriter{}, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.DeepEqual(0, "layers", 2, len(f.layers))
+	te.DeepEqual(0, "epochs", uint(5), tr.maxiter)
+	te.DeepEqual(0, "optimizer", &SGD{momentum: 0.9, velocity: map[*Param]*mat.M64{}}, f.opt)
+	te.DeepEqual(0, "schedule", NewExpLr(0.05, 0.9), tr.lr)
+	for _, p := range f.Params() {
+		nonZero := false
+		for _, v := range p.Value.GetData() {
+			nonZero = nonZero || v != 0
+		}
+		te.DeepEqual(0, p.Name+" initialized", !p.bias, nonZero)
+	}
+	//the same spec builds a model with the same weights
+	m, _, err := s.BuildModel(log.New(&nopWriter{}, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range m.Params() {
+		te.DeepEqual(i, "model params", f.Params()[i].Value.GetData(), p.Value.GetData())
+	}
+	s.Layers[0].Type = LayerTypeLSTM
+	_, _, err = s.Build(nil)
+	te.CheckError(1, fmt.Errorf("layers[0].type: layer type 'lstm' is not supported in a fully connected network"), err)
+	_, _, err = s.BuildModel(nil)
+	te.CheckError(2, nil, err)
+}
+
+func TestSpecTrain(t *testing.T) {
+	//learns y=0.5*x0-x1 with each optimizer
+	r := rand.New(rand.NewSource(1))
+	points := make([]*Datapoint, 300)
+	for i := range points {
+		x0, x1 := 2*r.Float64()-1, 2*r.Float64()-1
+		points[i] = &Datapoint{Inp: mat.NewM64(2, 1, []float64{x0, x1}), Exp: mat.NewM64(1, 1, []float64{0.5*x0 - x1})}
+	}
+	training, validation, test := &pointsDataset{points: points[:200]}, &pointsDataset{points: points[200:250]}, &pointsDataset{points: points[250:]}
+	for ind, optimizer := range []string{"sgd", "adam"} {
+		spec := fmt.Sprintf(`{"input": 2, "layers": [{"size": 8, "ftype": "tanh", "dropout": 0.1}, {"size": 1, "ftype": "iden"}],
+			"optimizer": {"type": "%s", "lr": 0.02}, "batch_size": 4, "epochs": 100, "early_stopping": {"patience": 5}, "seed": 1}`, optimizer)
+		s, err := ReadSpec(strings.NewReader(spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, tr, err := s.Build(log.New(&nopWriter{}, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Train(tr, training, validation, test); err != nil {
+			t.Fatal(err)
+		}
+		c, err := tr.testWith(test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c > 0.01 {
+			t.Errorf("test %d: expected a test cost below 0.01 received %f", ind, c)
+		}
+		if f.training {
+			t.Errorf("test %d: network is still in training mode", ind)
+		}
+	}
+}
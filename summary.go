@@ -0,0 +1,191 @@
+package nn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+//bytesPerValue is the memory used by a param value
+const bytesPerValue = 8
+
+//LayerSummary describes a layer of a network
+type LayerSummary struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Activation string   `json:"activation,omitempty"`
+	Inputs     []string `json:"inputs"`
+	Input      Shape    `json:"input"` //shape of the first input
+	Output     Shape    `json:"output"`
+	Weights    int      `json:"weights"`   //number of params which are not biases
+	Biases     int      `json:"biases"`    //number of biases, shifts and scales
+	Trainable  int      `json:"trainable"` //number of values updated by the trainer
+	Frozen     int      `json:"frozen"`    //number of values saved with the layer but not trained, like the statistics of batchnorm or the params of frozen layers
+	FLOPs      int64    `json:"flops"`     //estimated floating point operations per prediction
+}
+
+//Summary describes the layers of a network, their params and their cost. For inputs of variable width, the FLOPs are given per colomn
+type Summary struct {
+	Input     Shape           `json:"input"`
+	Output    Shape           `json:"output"`
+	Layers    []*LayerSummary `json:"layers"`
+	Weights   int             `json:"weights"`
+	Biases    int             `json:"biases"`
+	Trainable int             `json:"trainable"`
+	Frozen    int             `json:"frozen"`
+	Memory    int64           `json:"memory"` //bytes used by the trainable and frozen values
+	FLOPs     int64           `json:"flops"`
+}
+
+//add appends l and updates the totals
+func (s *Summary) add(l *LayerSummary) {
+	s.Layers = append(s.Layers, l)
+	s.Weights += l.Weights
+	s.Biases += l.Biases
+	s.Trainable += l.Trainable
+	s.Frozen += l.Frozen
+	s.Memory += int64(l.Trainable+l.Frozen) * bytesPerValue
+	s.FLOPs += l.FLOPs
+}
+
+//WriteText writes the summary as a table, one row per layer, followed by the totals
+func (s *Summary) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "LAYER\tTYPE\tINPUTS\tSHAPE\tWEIGHTS\tBIASES\tFROZEN\tFLOPS\n")
+	fmt.Fprintf(tw, "%s\t\t\t%s\t\t\t\t\n", Input, s.Input)
+	for _, l := range s.Layers {
+		typ := l.Type
+		if l.Activation != "" {
+			typ += "(" + l.Activation + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n", l.Name, typ, strings.Join(l.Inputs, ","), l.Output, l.Weights, l.Biases, l.Frozen, l.FLOPs)
+	}
+	fmt.Fprintf(tw, "total\t\t\t\t%d\t%d\t%d\t%d\n", s.Weights, s.Biases, s.Frozen, s.FLOPs)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "trainable params: %d, frozen values: %d, memory: %d bytes\n", s.Trainable, s.Frozen, s.Memory)
+	return err
+}
+
+//WriteJSON writes the summary as indented JSON
+func (s *Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+//summarize returns the summary of a layer with its params and statistics, fed by inputs of shapes ins
+func summarize(name string, cfg *LayerConfig, inputs []string, ins []Shape, out Shape, params, buffers []*Param) *LayerSummary {
+	l := &LayerSummary{Name: name, Type: cfg.Type, Inputs: inputs, Output: out}
+	if l.Type == "" {
+		l.Type = LayerTypeDense
+	}
+	if len(ins) > 0 {
+		l.Input = ins[0]
+	}
+	switch l.Type {
+	case LayerTypeDense, LayerTypeConv1D, LayerTypeConv2D, LayerTypeRNN, LayerTypeActivation:
+		l.Activation = cfg.FuncType
+	}
+	for _, p := range params {
+		if p.bias {
+			l.Biases += p.Value.Size()
+		} else {
+			l.Weights += p.Value.Size()
+		}
+	}
+	l.Trainable = l.Weights + l.Biases
+	if cfg.Frozen {
+		l.Trainable, l.Frozen = 0, l.Weights+l.Biases
+	}
+	for _, p := range buffers {
+		l.Frozen += p.Value.Size()
+	}
+	l.FLOPs = flops(l)
+	return l
+}
+
+//flops estimates the floating point operations of a layer for one prediction: a multiplication and an addition per weight and position the weights are applied to, an addition per bias and position, and an operation per output value for activations and element wise layers. The positions are the colomns of the input, or of the output for convolutions, a variable width counting as 1
+func flops(l *LayerSummary) int64 {
+	cols := func(s Shape) int64 {
+		if c := s.Cols(); c > 0 {
+			return int64(c)
+		}
+		return 1
+	}
+	outValues := int64(l.Output.Rows) * cols(l.Output)
+	inValues := int64(l.Input.Rows) * cols(l.Input)
+	switch l.Type {
+	case LayerTypeEmbedding, LayerTypeConcat, LayerTypeFlatten:
+		//lookups and copies
+		return 0
+	case LayerTypeActivation, LayerTypeAdd, LayerTypeMul, LayerTypePositional:
+		return outValues
+	case LayerTypeBatchNorm, LayerTypeLayerNorm:
+		//substract the mean, divide by the deviation, scale and shift
+		return 4 * outValues
+	case LayerTypeMaxPool1D, LayerTypeAvgPool1D, LayerTypeMaxPool2D, LayerTypeAvgPool2D, LayerTypeGlobalMaxPool, LayerTypeGlobalAvgPool:
+		return inValues
+	}
+	pos := cols(l.Input)
+	if l.Type == LayerTypeConv1D || l.Type == LayerTypeConv2D {
+		pos = cols(l.Output)
+	}
+	res := (2*int64(l.Weights)+int64(l.Biases))*pos + outValues
+	if l.Type == LayerTypeAttention || l.Type == LayerTypeTransformer {
+		//scores and weighted sum of the values over each pair of positions
+		res += 4 * pos * pos * int64(l.Input.Rows)
+	}
+	return res
+}
+
+//Summary describes the layers of the model, see Summary
+func (m *Model) Summary() (*Summary, error) {
+	if err := m.isUsable(); err != nil {
+		return nil, err
+	}
+	s := &Summary{Input: m.inShape, Output: m.OutShape()}
+	for _, n := range m.nodes {
+		inputs, shapes := make([]string, len(n.inputs)), make([]Shape, len(n.inputs))
+		for i, ind := range n.inputs {
+			if ind < 0 {
+				inputs[i], shapes[i] = Input, m.inShape
+				continue
+			}
+			inputs[i], shapes[i] = m.nodes[ind].name, m.nodes[ind].shape
+		}
+		var buffers []*Param
+		if b, ok := n.layer.(buffered); ok {
+			buffers = b.Buffers()
+		}
+		cfg := n.layer.Config()
+		cfg.Frozen = n.frozen
+		s.add(summarize(n.name, cfg, inputs, shapes, n.shape, n.layer.Params(), buffers))
+	}
+	return s, nil
+}
+
+//Summary describes the layers of the network, named layer0, layer1..., see Summary
+func (ff *FC) Summary() (*Summary, error) {
+	if err := ff.validate(); err != nil {
+		return nil, err
+	}
+	s := &Summary{Input: colomnShape(ff.inSize), Output: colomnShape(ff.outSize)}
+	prev := Input
+	for i, l := range ff.layers {
+		name := fmt.Sprintf("layer%d", i)
+		cfg := l.Config()
+		cfg.Frozen = ff.isFrozen(i)
+		s.add(summarize(name, cfg, []string{prev}, []Shape{colomnShape(l.inSize)}, colomnShape(l.outSize), l.params, nil))
+		prev = name
+	}
+	return s, nil
+}
+
+//colomnShape returns the shape of colomn vectors of n rows
+func colomnShape(n int) Shape {
+	return Shape{Rows: n, Height: 1, Width: 1}
+}
@@ -0,0 +1,81 @@
+package nn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+func TestModelSummary(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := NewModelWithShape(Shape{Rows: 2, Height: 1, Width: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, cfg := range []*LayerConfig{
+		{Type: LayerTypeConv1D, Size: 3, FuncType: activation.FuncTypeRelu, Kernel: []int{3}},
+		{Type: LayerTypeBatchNorm},
+		{Type: LayerTypeFlatten},
+		{Size: 2, FuncType: activation.FuncTypeIden},
+	} {
+		prev := Input
+		if i > 0 {
+			prev = fmt.Sprintf("l%d", i-1)
+		}
+		if err = m.AddConfig(fmt.Sprintf("l%d", i), cfg, prev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := m.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []*LayerSummary{
+		//3 filters of 2 channels x 3, applied at 6 positions
+		{Name: "l0", Type: LayerTypeConv1D, Activation: activation.FuncTypeRelu, Inputs: []string{Input}, Input: Shape{2, 1, 8}, Output: Shape{3, 1, 6}, Weights: 18, Biases: 3, Trainable: 21, FLOPs: (2*18+3)*6 + 18},
+		//the running mean and variance are not trained
+		{Name: "l1", Type: LayerTypeBatchNorm, Inputs: []string{"l0"}, Input: Shape{3, 1, 6}, Output: Shape{3, 1, 6}, Biases: 6, Trainable: 6, Frozen: 6, FLOPs: 4 * 18},
+		{Name: "l2", Type: LayerTypeFlatten, Inputs: []string{"l1"}, Input: Shape{3, 1, 6}, Output: Shape{18, 1, 1}},
+		{Name: "l3", Type: LayerTypeDense, Activation: activation.FuncTypeIden, Inputs: []string{"l2"}, Input: Shape{18, 1, 1}, Output: Shape{2, 1, 1}, Weights: 36, Biases: 2, Trainable: 38, FLOPs: 2*36 + 2 + 2},
+	}
+	for i, l := range exp {
+		te.DeepEqual(i, "layer", l, s.Layers[i])
+	}
+	te.DeepEqual(0, "totals", []int{54, 11, 65, 6}, []int{s.Weights, s.Biases, s.Trainable, s.Frozen})
+	te.DeepEqual(0, "memory", int64(71*8), s.Memory)
+	te.DeepEqual(0, "flops", int64(252+72+76), s.FLOPs)
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, s.WriteJSON(buf))
+	d := &Summary{}
+	te.CheckError(0, nil, json.Unmarshal(buf.Bytes(), d))
+	te.DeepEqual(0, "json", s, d)
+	_, err = (&Model{}).Summary()
+	te.CheckError(1, fmt.Errorf("model has no layers"), err)
+}
+
+func TestFCSummary(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := mockRandFC(1, 3, []*LayerConfig{{Size: 4, FuncType: activation.FuncTypeTanh}, {Size: 2, FuncType: activation.FuncTypeSigmoid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, f.WriteInfo(buf))
+	exp := `LAYER   TYPE         INPUTS  SHAPE  WEIGHTS  BIASES  FROZEN  FLOPS
+input                        3x1x1                           
+layer0  dense(tanh)  input   4x1x1  12       4       0       32
+layer1  dense(sig)   layer0  2x1x1  8        2       0       20
+total                               20       6       0       52
+trainable params: 26, frozen values: 0, memory: 208 bytes
+`
+	te.DeepEqual(0, "info", exp, buf.String())
+	//invalid networks return an error
+	empty, _ := NewFC(3)
+	te.CheckError(1, fmt.Errorf("network has no layers"), empty.WriteInfo(buf))
+	_, err = (*FC)(nil).Summary()
+	te.CheckError(2, fmt.Errorf("network is nil"), err)
+}
@@ -0,0 +1,198 @@
+package nn
+
+import "fmt"
+
+//isFrozen reports if the params of layer i are not trained
+func (ff *FC) isFrozen(i int) bool {
+	return i < len(ff.frozen) && ff.frozen[i]
+}
+
+//checkLayer checks that layer i exists
+func (ff *FC) checkLayer(i int) error {
+	if ff == nil {
+		return fmt.Errorf("network is nil")
+	}
+	if i < 0 || i >= len(ff.layers) {
+		return fmt.Errorf("layer index must be between %d and %d", 0, len(ff.layers)-1)
+	}
+	return nil
+}
+
+//SetTrainable freezes layer i if trainable is false: its params are then kept when the network is trained, the gradients still flowing through it to the previous layers. Layers are trainable by default, unless frozen by their config
+func (ff *FC) SetTrainable(i int, trainable bool) error {
+	if err := ff.checkLayer(i); err != nil {
+		return err
+	}
+	if len(ff.frozen) < len(ff.layers) {
+		ff.frozen = append(ff.frozen, make([]bool, len(ff.layers)-len(ff.frozen))...)
+	}
+	ff.frozen[i] = !trainable
+	if !trainable {
+		for _, p := range ff.layers[i].params {
+			p.ZeroGrad()
+		}
+	}
+	return nil
+}
+
+//Trainable reports if the params of layer i are updated by the trainer, false if the layer does not exist
+func (ff *FC) Trainable(i int) bool {
+	if ff.checkLayer(i) != nil {
+		return false
+	}
+	return !ff.isFrozen(i)
+}
+
+//TrainableParams returns the weights and bias of the layers which are not frozen, to initialize a new head with InitParams for instance
+func (ff *FC) TrainableParams() []*Param {
+	if ff == nil {
+		return nil
+	}
+	var params []*Param
+	for i, l := range ff.layers {
+		if !ff.isFrozen(i) {
+			params = append(params, l.params...)
+		}
+	}
+	return params
+}
+
+//DropLayers removes the last n layers, the head of the network. At least one layer must be kept
+func (ff *FC) DropLayers(n int) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	if n < 0 || n >= len(ff.layers) {
+		return fmt.Errorf("number of layers to drop must be between %d and %d", 0, len(ff.layers)-1)
+	}
+	ff.truncate(len(ff.layers) - n)
+	return nil
+}
+
+//truncate keeps the first n layers
+func (ff *FC) truncate(n int) {
+	ff.layers = ff.layers[:n]
+	if len(ff.regs) > n {
+		ff.regs = ff.regs[:n]
+	}
+	if len(ff.drops) > n {
+		ff.drops = ff.drops[:n]
+	}
+	if len(ff.frozen) > n {
+		ff.frozen = ff.frozen[:n]
+	}
+	ff.outSize = ff.inSize
+	if n > 0 {
+		ff.outSize = ff.layers[n-1].outSize
+	}
+	ff.outs, ff.masks, ff.masked = nil, nil, nil
+}
+
+//AddLayers appends layers defined like in SetLayers after the last one. Their weights and bias are 0 until initialized, with InitParams for instance
+func (ff *FC) AddLayers(configs ...*LayerConfig) error {
+	if ff == nil {
+		return fmt.Errorf("network is nil")
+	}
+	if len(configs) < 1 {
+		return fmt.Errorf("must have at least one layer")
+	}
+	layers, regs, drops, frozen, err := newLayers(ff.outSize, configs)
+	if err != nil {
+		return err
+	}
+	//the slices of the layers set before are completed as they may be shorter
+	n := len(ff.layers)
+	ff.regs = append(append(ff.regs, make([]*regularizer, n-len(ff.regs))...), regs...)
+	ff.drops = append(append(ff.drops, make([]float64, n-len(ff.drops))...), drops...)
+	ff.frozen = append(append(ff.frozen, make([]bool, n-len(ff.frozen))...), frozen...)
+	ff.layers = append(ff.layers, layers...)
+	ff.outSize = layers[len(layers)-1].outSize
+	ff.outs, ff.masks, ff.masked = nil, nil, nil
+	return nil
+}
+
+//ReplaceLayers replaces the last n layers by the layers defined by configs, to train a new head on top of a pretrained network. The network is not modified if configs are invalid
+func (ff *FC) ReplaceLayers(n int, configs ...*LayerConfig) error {
+	if err := ff.validate(); err != nil {
+		return err
+	}
+	if n < 0 || n > len(ff.layers) {
+		return fmt.Errorf("number of layers to replace must be between %d and %d", 0, len(ff.layers))
+	}
+	if len(configs) < 1 {
+		return fmt.Errorf("must have at least one layer")
+	}
+	inSize := ff.inSize
+	if k := len(ff.layers) - n; k > 0 {
+		inSize = ff.layers[k-1].outSize
+	}
+	if _, _, _, _, err := newLayers(inSize, configs); err != nil {
+		return err
+	}
+	ff.truncate(len(ff.layers) - n)
+	return ff.AddLayers(configs...)
+}
+
+//node returns the node of the layer named name
+func (m *Model) node(name string) (*node, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model is nil")
+	}
+	ind, ok := m.names[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer '%s'", name)
+	}
+	return m.nodes[ind], nil
+}
+
+//SetTrainable freezes the layer named name if trainable is false, like FC.SetTrainable. A frozen batchnorm layer also keeps its running statistics while training
+func (m *Model) SetTrainable(name string, trainable bool) error {
+	n, err := m.node(name)
+	if err != nil {
+		return err
+	}
+	n.frozen = !trainable
+	if !trainable {
+		for _, p := range n.layer.Params() {
+			p.ZeroGrad()
+		}
+	}
+	m.setTraining(n)
+	return nil
+}
+
+//Trainable reports if the params of the layer named name are updated by the trainer, false if the layer does not exist
+func (m *Model) Trainable(name string) bool {
+	n, err := m.node(name)
+	return err == nil && !n.frozen
+}
+
+//TrainableParams returns the params of the layers which are not frozen, to initialize a new head with InitParams for instance
+func (m *Model) TrainableParams() []*Param {
+	if m == nil {
+		return nil
+	}
+	var params []*Param
+	for _, n := range m.nodes {
+		if !n.frozen {
+			params = append(params, n.layer.Params()...)
+		}
+	}
+	return params
+}
+
+//DropLayers removes the last n layers added to the model, the layer added before them becoming its output. At least one layer must be kept. A new head is then added with Add or AddConfig
+func (m *Model) DropLayers(n int) error {
+	if err := m.isUsable(); err != nil {
+		return err
+	}
+	if n < 0 || n >= len(m.nodes) {
+		return fmt.Errorf("number of layers to drop must be between %d and %d", 0, len(m.nodes)-1)
+	}
+	for _, d := range m.nodes[len(m.nodes)-n:] {
+		delete(m.names, d.name)
+	}
+	m.nodes = m.nodes[:len(m.nodes)-n]
+	m.last = nil
+	return nil
+}
@@ -0,0 +1,178 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"testing"
+
+	mat "github.com/klahssen/go-mat"
+	"github.com/klahssen/nn/internal/activation"
+	"github.com/klahssen/tester"
+)
+
+//paramValues returns a copy of the values of params
+func paramValues(params []*Param) [][]float64 {
+	values := make([][]float64, len(params))
+	for i, p := range params {
+		values[i] = p.Value.GetData()
+	}
+	return values
+}
+
+//trainPoints trains n on points of y=x0*x1 for a few iterations
+func trainPoints(n Network) error {
+	r := rand.New(rand.NewSource(1))
+	points := make([]*Datapoint, 20)
+	for i := range points {
+		in := randM64(r, 2, 1)
+		points[i] = &Datapoint{Inp: in, Exp: mat.NewM64(1, 1, []float64{in.At(0, 0) * in.At(1, 0)})}
+	}
+	tr, err := NewTrainer(n, log.New(&nopWriter{}, "", 0), NewLr(0.1), 3, 0, activation.Power(0.5, 2))
+	if err != nil {
+		return err
+	}
+	data := &pointsDataset{points: points}
+	return tr.Train(rand.NewSource(1), 0, 0.5, 4, data, nil, data)
+}
+
+func TestFreeze(t *testing.T) {
+	te := tester.NewT(t)
+	f, err := mockRandFC(1, 2, []*LayerConfig{{Size: 3, FuncType: activation.FuncTypeTanh}, {Size: 1, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.CheckError(0, nil, f.SetTrainable(0, false))
+	te.DeepEqual(0, "trainable", []bool{false, true, false}, []bool{f.Trainable(0), f.Trainable(1), f.Trainable(2)})
+	te.DeepEqual(0, "trainable params", f.layers[1].params, f.TrainableParams())
+	body, head := paramValues(f.layers[0].params), paramValues(f.layers[1].params)
+	te.CheckError(1, nil, trainPoints(f))
+	te.DeepEqual(1, "frozen layer", body, paramValues(f.layers[0].params))
+	te.DeepEqual(1, "trained layer", false, fmt.Sprint(head) == fmt.Sprint(paramValues(f.layers[1].params)))
+	//the frozen params are counted apart
+	s, err := f.Summary()
+	te.CheckError(2, nil, err)
+	te.DeepEqual(2, "counts", []int{9, 4, 0, 4, 9, 4}, []int{s.Layers[0].Frozen, s.Layers[1].Trainable, s.Layers[0].Trainable, s.Trainable, s.Frozen, s.Weights + s.Biases - s.Frozen})
+	//the flags are encoded
+	buf := &bytes.Buffer{}
+	te.CheckError(3, nil, f.Encode(buf))
+	g, err := DecodeFC(buf)
+	te.CheckError(3, nil, err)
+	te.DeepEqual(3, "decoded", []bool{false, true}, []bool{g.Trainable(0), g.Trainable(1)})
+	te.CheckError(4, nil, g.SetTrainable(0, true))
+	te.DeepEqual(4, "unfrozen", len(g.Params()), len(g.TrainableParams()))
+	te.CheckError(5, fmt.Errorf("layer index must be between 0 and 1"), g.SetTrainable(2, false))
+}
+
+func TestFreezeModel(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := NewSequential(2, &LayerConfig{Size: 3, FuncType: activation.FuncTypeTanh, Frozen: true}, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	l0, err := m.Layer("layer0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := paramValues(l0.Params())
+	te.CheckError(0, nil, trainPoints(m))
+	te.DeepEqual(0, "frozen layer", body, paramValues(l0.Params()))
+	s, err := m.Summary()
+	te.CheckError(1, nil, err)
+	te.DeepEqual(1, "frozen", []int{9, 4}, []int{s.Frozen, s.Trainable})
+	buf := &bytes.Buffer{}
+	te.CheckError(2, nil, m.Encode(buf))
+	d, err := DecodeModel(buf)
+	te.CheckError(2, nil, err)
+	te.DeepEqual(2, "decoded", []bool{true, false}, []bool{d.nodes[0].frozen, d.nodes[1].frozen})
+}
+
+func TestTransfer(t *testing.T) {
+	te := tester.NewT(t)
+	base, err := mockRandFC(1, 2, []*LayerConfig{{Size: 4, FuncType: activation.FuncTypeRelu}, {Size: 3, FuncType: activation.FuncTypeTanh}, {Size: 1, FuncType: activation.FuncTypeIden}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	te.CheckError(0, nil, base.Encode(buf))
+	//a saved network whose body is kept and whose head is replaced by 2 outputs
+	f, err := DecodeFC(buf)
+	te.CheckError(0, nil, err)
+	te.CheckError(0, nil, f.ReplaceLayers(1, &LayerConfig{Size: 2, FuncType: activation.FuncTypeSigmoid}))
+	te.DeepEqual(0, "sizes", []int{2, 2, 3}, []int{f.InSize(), f.OutSize(), len(f.layers)})
+	te.DeepEqual(0, "body", paramValues(base.Params()[:4]), paramValues(f.Params()[:4]))
+	//only the new head is initialized and trained
+	te.CheckError(1, nil, f.SetTrainable(0, false))
+	te.CheckError(1, nil, f.SetTrainable(1, false))
+	te.CheckError(1, nil, InitParams(f.TrainableParams(), "xavier", rand.NewSource(1)))
+	te.DeepEqual(1, "body", paramValues(base.Params()[:4]), paramValues(f.Params()[:4]))
+	te.DeepEqual(1, "head", false, fmt.Sprint(paramValues(f.layers[2].params)) == fmt.Sprint([][]float64{make([]float64, 6), make([]float64, 2)}))
+	out, err := f.FeedForward(mat.NewM64(2, 1, []float64{0.5, -0.5}))
+	te.CheckError(1, nil, err)
+	te.DeepEqual(1, "output", 2, out.Size())
+	//drop then append layers
+	te.CheckError(2, nil, f.DropLayers(2))
+	te.DeepEqual(2, "sizes", []int{4, 1}, []int{f.OutSize(), len(f.layers)})
+	te.CheckError(3, nil, f.AddLayers(&LayerConfig{Size: 5, FuncType: activation.FuncTypeRelu, Dropout: 0.5}, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden}))
+	te.DeepEqual(3, "added", []int{1, 3}, []int{f.OutSize(), len(f.layers)})
+	te.DeepEqual(3, "flags", []bool{false, true, true}, []bool{f.Trainable(0), f.Trainable(1), f.Trainable(2)})
+	te.DeepEqual(3, "dropout", []float64{0, 0.5, 0}, f.drops)
+	te.DeepEqual(3, "inputs", []int{2, 4, 5}, []int{f.layers[0].inSize, f.layers[1].inSize, f.layers[2].inSize})
+	//errors leave the network unchanged
+	tests := []struct {
+		f   func() error
+		err error
+	}{
+		{func() error { return f.DropLayers(3) }, fmt.Errorf("number of layers to drop must be between 0 and 2")},
+		{func() error { return f.ReplaceLayers(4, &LayerConfig{Size: 1}) }, fmt.Errorf("number of layers to replace must be between 0 and 3")},
+		{func() error { return f.ReplaceLayers(1) }, fmt.Errorf("must have at least one layer")},
+		{func() error {
+			return f.ReplaceLayers(1, &LayerConfig{Size: 1, Type: LayerTypeConv1D, FuncType: activation.FuncTypeIden})
+		}, fmt.Errorf("configs[0]: layer type 'conv1d' is not supported in a fully connected network")},
+		{func() error { return f.AddLayers() }, fmt.Errorf("must have at least one layer")},
+	}
+	for ind, test := range tests {
+		te.CheckError(ind, test.err, test.f())
+		te.DeepEqual(ind, "layers", 3, len(f.layers))
+	}
+}
+
+func TestTransferModel(t *testing.T) {
+	te := tester.NewT(t)
+	m, err := NewSequential(2, &LayerConfig{Size: 3, FuncType: activation.FuncTypeTanh}, &LayerConfig{Type: LayerTypeBatchNorm}, &LayerConfig{Size: 1, FuncType: activation.FuncTypeIden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	randomizeParams(1, m.Params())
+	//the body and its batchnorm statistics are kept, only the head is trained
+	te.CheckError(0, nil, m.SetTrainable("layer0", false))
+	te.CheckError(0, nil, m.SetTrainable("layer1", false))
+	te.DeepEqual(0, "trainable", []bool{false, false, true, false}, []bool{m.Trainable("layer0"), m.Trainable("layer1"), m.Trainable("layer2"), m.Trainable("layer3")})
+	te.DeepEqual(0, "trainable params", m.nodes[2].layer.Params(), m.TrainableParams())
+	bn := m.nodes[1].layer.(buffered)
+	body, stats, head := paramValues(m.nodes[0].layer.Params()), paramValues(bn.Buffers()), paramValues(m.nodes[2].layer.Params())
+	te.CheckError(1, nil, trainPoints(m))
+	te.DeepEqual(1, "frozen layer", body, paramValues(m.nodes[0].layer.Params()))
+	te.DeepEqual(1, "batchnorm statistics", stats, paramValues(bn.Buffers()))
+	te.DeepEqual(1, "trained layer", false, fmt.Sprint(head) == fmt.Sprint(paramValues(m.nodes[2].layer.Params())))
+	//the gradients of frozen layers are not kept, so that they are not clipped
+	m.ZeroGrad()
+	te.CheckError(2, nil, m.Accumulate(mat.NewM64(2, 1, []float64{0.5, -0.5}), mat.NewM64(1, 1, []float64{1})))
+	for _, p := range m.nodes[0].layer.Params() {
+		te.DeepEqual(2, p.Name, (*mat.M64)(nil), p.Grad)
+	}
+	te.DeepEqual(2, "head gradient", true, m.nodes[2].layer.Params()[0].Grad != nil)
+	//the head is replaced
+	te.CheckError(3, nil, m.DropLayers(1))
+	te.DeepEqual(3, "layers", 2, len(m.nodes))
+	te.CheckError(3, nil, m.AddConfig("head", &LayerConfig{Size: 2, FuncType: activation.FuncTypeSigmoid}, "layer1"))
+	out, err := m.FeedForward(mat.NewM64(2, 1, []float64{0.5, -0.5}))
+	te.CheckError(3, nil, err)
+	te.DeepEqual(3, "output", 2, out.Size())
+	//errors
+	te.CheckError(4, fmt.Errorf("unknown layer 'layer2'"), m.SetTrainable("layer2", false))
+	te.CheckError(5, fmt.Errorf("number of layers to drop must be between 0 and 2"), m.DropLayers(3))
+	te.DeepEqual(6, "unknown", false, m.Trainable("layer2"))
+}